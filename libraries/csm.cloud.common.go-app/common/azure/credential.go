@@ -0,0 +1,70 @@
+package azure
+
+import (
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/config/properties"
+	"fmt"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"net/http"
+)
+
+const (
+	CredentialTypeClientSecret     = "clientSecret"
+	CredentialTypeManagedIdentity  = "managedIdentity"
+	CredentialTypeWorkloadIdentity = "workloadIdentity"
+)
+
+/*
+UsesTokenCredential returns true if a token based authentication is configured
+*/
+func UsesTokenCredential(credentialProperties properties.AzureCredentialProperties) bool {
+	return credentialProperties.Type != ""
+}
+
+/*
+NewTokenCredential creates the token credential of the configured type. Token requests are sent with the HTTP
+DefaultClient so that request interceptors apply.
+*/
+func NewTokenCredential(credentialProperties properties.AzureCredentialProperties) (azcore.TokenCredential, error) {
+	clientOptions := policy.ClientOptions{
+		Transport: http.DefaultClient,
+	}
+
+	// Use a custom token endpoint (e.g. a test server), instance discovery isn't supported there
+	disableInstanceDiscovery := false
+	if credentialProperties.AuthorityHost != "" {
+		clientOptions.Cloud = cloud.Configuration{ActiveDirectoryAuthorityHost: credentialProperties.AuthorityHost}
+		disableInstanceDiscovery = true
+	}
+
+	switch credentialProperties.Type {
+	case CredentialTypeWorkloadIdentity:
+		return azidentity.NewWorkloadIdentityCredential(&azidentity.WorkloadIdentityCredentialOptions{
+			ClientOptions:            clientOptions,
+			ClientID:                 credentialProperties.ClientId,
+			TenantID:                 credentialProperties.TenantId,
+			TokenFilePath:            credentialProperties.TokenFilePath,
+			DisableInstanceDiscovery: disableInstanceDiscovery,
+		})
+	case CredentialTypeManagedIdentity:
+		options := azidentity.ManagedIdentityCredentialOptions{ClientOptions: clientOptions}
+		if credentialProperties.ClientId != "" {
+			options.ID = azidentity.ClientID(credentialProperties.ClientId)
+		}
+		return azidentity.NewManagedIdentityCredential(&options)
+	case CredentialTypeClientSecret:
+		return azidentity.NewClientSecretCredential(
+			credentialProperties.TenantId,
+			credentialProperties.ClientId,
+			credentialProperties.ClientSecret,
+			&azidentity.ClientSecretCredentialOptions{
+				ClientOptions:            clientOptions,
+				DisableInstanceDiscovery: disableInstanceDiscovery,
+			},
+		)
+	default:
+		return nil, fmt.Errorf("unsupported azure credential type %q", credentialProperties.Type)
+	}
+}
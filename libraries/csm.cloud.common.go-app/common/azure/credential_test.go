@@ -0,0 +1,69 @@
+package azure
+
+import (
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/config/properties"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUsesTokenCredential(t *testing.T) {
+	assert.False(t, UsesTokenCredential(properties.AzureCredentialProperties{}))
+	assert.True(t, UsesTokenCredential(properties.AzureCredentialProperties{Type: CredentialTypeManagedIdentity}))
+}
+
+func TestNewTokenCredential_ClientSecret(t *testing.T) {
+
+	// execute
+	credential, err := NewTokenCredential(properties.AzureCredentialProperties{
+		Type:          CredentialTypeClientSecret,
+		TenantId:      "00000000-0000-0000-0000-000000000001",
+		ClientId:      "00000000-0000-0000-0000-000000000002",
+		ClientSecret:  "secret",
+		AuthorityHost: "https://localhost:8443/",
+	})
+
+	// verify
+	assert.Nil(t, err)
+	assert.IsType(t, &azidentity.ClientSecretCredential{}, credential)
+}
+
+func TestNewTokenCredential_WorkloadIdentity(t *testing.T) {
+
+	// prepare
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	assert.Nil(t, os.WriteFile(tokenFile, []byte("token"), 0o600))
+
+	// execute
+	credential, err := NewTokenCredential(properties.AzureCredentialProperties{
+		Type:          CredentialTypeWorkloadIdentity,
+		TenantId:      "00000000-0000-0000-0000-000000000001",
+		ClientId:      "00000000-0000-0000-0000-000000000002",
+		TokenFilePath: tokenFile,
+	})
+
+	// verify
+	assert.Nil(t, err)
+	assert.IsType(t, &azidentity.WorkloadIdentityCredential{}, credential)
+}
+
+func TestNewTokenCredential_ManagedIdentity(t *testing.T) {
+
+	// execute
+	credential, err := NewTokenCredential(properties.AzureCredentialProperties{Type: CredentialTypeManagedIdentity})
+
+	// verify
+	assert.Nil(t, err)
+	assert.IsType(t, &azidentity.ManagedIdentityCredential{}, credential)
+}
+
+func TestNewTokenCredential_UnsupportedType(t *testing.T) {
+
+	// execute
+	_, err := NewTokenCredential(properties.AzureCredentialProperties{Type: "sharedKey"})
+
+	// verify
+	assert.NotNil(t, err)
+}
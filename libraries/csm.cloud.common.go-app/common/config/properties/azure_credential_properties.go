@@ -0,0 +1,14 @@
+package properties
+
+/*
+AzureCredentialProperties configure the token based (AAD) authentication against azure services.
+Without a type, services fall back to their connection string.
+*/
+type AzureCredentialProperties struct {
+	Type          string //optional (workloadIdentity, managedIdentity or clientSecret)
+	TenantId      string //optional (required for clientSecret, workloadIdentity defaults to AZURE_TENANT_ID)
+	ClientId      string //optional (required for clientSecret, workloadIdentity defaults to AZURE_CLIENT_ID)
+	ClientSecret  string //optional (required for clientSecret)
+	TokenFilePath string //optional (workloadIdentity defaults to AZURE_FEDERATED_TOKEN_FILE)
+	AuthorityHost string //optional (token endpoint, e.g. of a test server, defaults to the public cloud)
+}
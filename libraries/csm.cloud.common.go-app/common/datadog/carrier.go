@@ -6,15 +6,35 @@ import (
 	"strings"
 )
 
-// TraceHeaderStringCarrier implements the propagator.TextMapReader interface for a string with trace header.
+// TraceHeaderStringCarrier implements the propagator.TextMapReader and propagator.TextMapWriter interface for
+// trace headers stored as strings (e.g. in blob metadata). Both the custom trace header format and the
+// W3C Trace Context (traceparent and tracestate) are supported.
 type TraceHeaderStringCarrier struct {
 	traceHeader string
+	values      map[string]string
 }
 
 // NewTraceHeaderStringCarrier is a constructor to initialize the carrier with a trace header value.
 // The expected format is: {TraceId}-{SpanId}-{SamplingState}-{ParentSpanId}.
+// A W3C traceparent value ({Version}-{TraceId}-{ParentId}-{TraceFlags}) is accepted as well.
 func NewTraceHeaderStringCarrier(traceHeader string) *TraceHeaderStringCarrier {
-	return &TraceHeaderStringCarrier{traceHeader: traceHeader}
+	if isTraceParent(traceHeader) {
+		return NewTraceContextStringCarrier(traceHeader, "")
+	}
+	return &TraceHeaderStringCarrier{traceHeader: traceHeader, values: make(map[string]string)}
+}
+
+// NewTraceContextStringCarrier is a constructor to initialize the carrier with W3C Trace Context values.
+// The tracestate is optional and may be empty.
+func NewTraceContextStringCarrier(traceParent string, traceState string) *TraceHeaderStringCarrier {
+	values := make(map[string]string)
+	if traceParent != "" {
+		values[TraceParent] = traceParent
+		if traceState != "" {
+			values[TraceState] = traceState
+		}
+	}
+	return &TraceHeaderStringCarrier{values: values}
 }
 
 // ForeachKey implements the tracer.TextMapReader interface.
@@ -34,9 +54,41 @@ func (c *TraceHeaderStringCarrier) ForeachKey(handler func(key, val string) erro
 			return err
 		}
 	}
+	for key, val := range c.values {
+		err := handler(key, val)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// Set implements the tracer.TextMapWriter interface which can be used to inject the W3C Trace Context
+// (e.g. to be stored in blob metadata). Other headers are ignored.
+func (c *TraceHeaderStringCarrier) Set(key, val string) {
+	if slices.Contains(TraceContextHeaders, key) {
+		c.values[key] = val
+	}
+}
+
+// GetTraceParent returns the W3C traceparent stored in the carrier or an empty string.
+func (c *TraceHeaderStringCarrier) GetTraceParent() string {
+	return c.values[TraceParent]
+}
+
+// GetTraceState returns the W3C tracestate stored in the carrier or an empty string.
+func (c *TraceHeaderStringCarrier) GetTraceState() string {
+	return c.values[TraceState]
+}
+
+// isTraceParent checks if the value has the W3C traceparent format, e.g.
+// 00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01
+func isTraceParent(value string) bool {
+	elements := strings.Split(value, "-")
+	return len(elements) >= 4 && len(elements[0]) == 2 && len(elements[1]) == 32 && len(elements[2]) == 16 &&
+		len(elements[3]) == 2
+}
+
 // KafkaHeaderCarrier implements the tracer.TextMapReader and propagator.TextMapWriter interface for a
 // slice of kafka headers.
 type KafkaHeaderCarrier struct {
@@ -54,7 +106,7 @@ func NewKafkaHeaderCarrier() *KafkaHeaderCarrier {
 func NewKafkaHeaderCarrierFromHeaders(headers []kafka.Header) *KafkaHeaderCarrier {
 	filteredHeaders := make([]kafka.Header, 0)
 	for _, h := range headers {
-		if slices.Contains(DatadogHeaders, h.Key) {
+		if slices.Contains(PropagatedHeaders, h.Key) {
 			filteredHeaders = append(filteredHeaders, h)
 		}
 	}
@@ -62,9 +114,9 @@ func NewKafkaHeaderCarrierFromHeaders(headers []kafka.Header) *KafkaHeaderCarrie
 }
 
 // Set implements the tracer.TextMapWriter interface which can be used in a kafka producer to inject
-// datadog headers into kafka messages.
+// datadog and W3C Trace Context headers into kafka messages.
 func (c *KafkaHeaderCarrier) Set(key, val string) {
-	if slices.Contains(DatadogHeaders, key) {
+	if slices.Contains(PropagatedHeaders, key) {
 		c.headers = append(c.headers, kafka.Header{
 			Key:   key,
 			Value: []byte(val),
@@ -72,8 +124,8 @@ func (c *KafkaHeaderCarrier) Set(key, val string) {
 	}
 }
 
-// ForeachKey implements the tracer.TextMapReader interface which can be used to extract datadog headers
-// from kafka message headers for a span context.
+// ForeachKey implements the tracer.TextMapReader interface which can be used to extract datadog and
+// W3C Trace Context headers from kafka message headers for a span context.
 func (c *KafkaHeaderCarrier) ForeachKey(handler func(key, val string) error) error {
 	for _, h := range c.headers {
 		err := handler(h.Key, string(h.Value))
@@ -95,3 +147,11 @@ const DatadogTags = "x-datadog-tags"
 const DatadogTraceId = "x-datadog-trace-id"
 
 var DatadogHeaders = []string{DatadogParentId, DatadogSamplingPriority, DatadogTags, DatadogTraceId}
+
+const TraceParent = "traceparent"
+const TraceState = "tracestate"
+
+var TraceContextHeaders = []string{TraceParent, TraceState}
+
+// PropagatedHeaders are the headers passed on by the carriers (datadog and W3C Trace Context).
+var PropagatedHeaders = []string{DatadogParentId, DatadogSamplingPriority, DatadogTags, DatadogTraceId, TraceParent, TraceState}
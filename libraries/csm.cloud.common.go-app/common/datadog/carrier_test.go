@@ -0,0 +1,90 @@
+package datadog
+
+import (
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"strings"
+	"testing"
+)
+
+// W3C Trace Context example with trace id 0x8448eb211c80319c (lower 64 bits) and parent id 0xb7ad6b7169203331
+const testTraceParent = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+const testTraceState = "dd=s:1,congo=t61rcWkgMzE"
+
+func TestTraceHeaderStringCarrier_CustomTraceHeader(t *testing.T) {
+
+	// prepare
+	propagator := tracer.NewPropagator(nil)
+
+	// execute
+	spanContext, err := propagator.Extract(NewTraceHeaderStringCarrier("123-456-1-789"))
+
+	// verify
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(123), spanContext.TraceID())
+	assert.Equal(t, uint64(789), spanContext.SpanID())
+}
+
+func TestTraceHeaderStringCarrier_TraceParentAsTraceHeader(t *testing.T) {
+
+	// prepare
+	propagator := tracer.NewPropagator(nil)
+
+	// execute
+	spanContext, err := propagator.Extract(NewTraceHeaderStringCarrier(testTraceParent))
+
+	// verify
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0x8448eb211c80319c), spanContext.TraceID())
+	assert.Equal(t, uint64(0xb7ad6b7169203331), spanContext.SpanID())
+}
+
+func TestTraceContextStringCarrier_ExtractAndInject(t *testing.T) {
+
+	// prepare
+	propagator := tracer.NewPropagator(nil)
+
+	// execute
+	spanContext, err := propagator.Extract(NewTraceContextStringCarrier(testTraceParent, testTraceState))
+	assert.Nil(t, err)
+
+	carrier := NewTraceContextStringCarrier("", "")
+	err = propagator.Inject(spanContext, carrier)
+
+	// verify
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0x8448eb211c80319c), spanContext.TraceID())
+	assert.Equal(t, testTraceParent, carrier.GetTraceParent())
+	assert.True(t, strings.Contains(carrier.GetTraceState(), "congo=t61rcWkgMzE"))
+}
+
+func TestKafkaHeaderCarrier_PropagatesTraceContext(t *testing.T) {
+
+	// prepare
+	propagator := tracer.NewPropagator(nil)
+	spanContext, err := propagator.Extract(NewTraceContextStringCarrier(testTraceParent, testTraceState))
+	assert.Nil(t, err)
+
+	// execute
+	producerCarrier := NewKafkaHeaderCarrier()
+	err = propagator.Inject(spanContext, producerCarrier)
+	assert.Nil(t, err)
+
+	headers := append(producerCarrier.GetHeaders(), kafka.Header{Key: "other", Value: []byte("value")})
+	consumerCarrier := NewKafkaHeaderCarrierFromHeaders(headers)
+	extractedContext, err := propagator.Extract(consumerCarrier)
+
+	// verify
+	assert.Nil(t, err)
+	headerKeys := make(map[string]string)
+	for _, header := range consumerCarrier.GetHeaders() {
+		headerKeys[header.Key] = string(header.Value)
+	}
+	assert.Equal(t, testTraceParent, headerKeys[TraceParent])
+	assert.Contains(t, headerKeys, TraceState)
+	assert.Contains(t, headerKeys, DatadogTraceId)
+	assert.NotContains(t, headerKeys, "other")
+	assert.Equal(t, spanContext.TraceID(), extractedContext.TraceID())
+	assert.Equal(t, spanContext.SpanID(), extractedContext.SpanID())
+}
@@ -0,0 +1,233 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	StatusUp   = "UP"
+	StatusDown = "DOWN"
+
+	// DefaultTimeout limits the duration of a check if no timeout is given on registration
+	DefaultTimeout = 2 * time.Second
+
+	// DefaultCacheDuration is the time a check result is reused if no cache duration is given on registration
+	DefaultCacheDuration = 5 * time.Second
+)
+
+/*
+Check verifies the availability of a component (e.g. a connection to a broker or storage account).
+A nil error means the component is available. Checks should honor the deadline of the context.
+*/
+type Check func(ctx context.Context) error
+
+/*
+CheckOptions configure a registered check. Zero values are replaced by DefaultTimeout and DefaultCacheDuration.
+*/
+type CheckOptions struct {
+	Timeout       time.Duration
+	CacheDuration time.Duration
+}
+
+/*
+Report is the result of evaluating all registered checks. It is UP only if all checks are UP.
+*/
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+type CheckResult struct {
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"durationMs"`
+	CheckedAt  time.Time `json:"checkedAt"`
+}
+
+/*
+Registry keeps the named checks of an application. Components register their checks when they are created,
+readiness endpoints evaluate them. Use DefaultRegistry for the application wide registry.
+*/
+type Registry struct {
+	mutex  sync.Mutex
+	checks map[string]*registeredCheck
+}
+
+type registeredCheck struct {
+	mutex      sync.Mutex
+	check      Check
+	options    CheckOptions
+	lastResult *CheckResult
+}
+
+var defaultRegistry = NewRegistry()
+
+/*
+NewRegistry creates an empty registry
+*/
+func NewRegistry() *Registry {
+	return &Registry{checks: make(map[string]*registeredCheck)}
+}
+
+/*
+DefaultRegistry returns the application wide registry the common components register their checks with
+*/
+func DefaultRegistry() *Registry {
+	return defaultRegistry
+}
+
+/*
+RegisterCheck registers a check with the default registry
+*/
+func RegisterCheck(name string, options CheckOptions, check Check) {
+	defaultRegistry.Register(name, options, check)
+}
+
+/*
+Register adds a named check. A check registered with the same name before is replaced.
+*/
+func (this *Registry) Register(name string, options CheckOptions, check Check) {
+	if options.Timeout <= 0 {
+		options.Timeout = DefaultTimeout
+	}
+	if options.CacheDuration <= 0 {
+		options.CacheDuration = DefaultCacheDuration
+	}
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.checks[name] = &registeredCheck{check: check, options: options}
+}
+
+/*
+Evaluate runs all checks concurrently (or reuses their cached results) and returns the report
+*/
+func (this *Registry) Evaluate(ctx context.Context) Report {
+	this.mutex.Lock()
+	checks := make(map[string]*registeredCheck, len(this.checks))
+	for name, check := range this.checks {
+		checks[name] = check
+	}
+	this.mutex.Unlock()
+
+	var waitGroup sync.WaitGroup
+	var resultMutex sync.Mutex
+	report := Report{Status: StatusUp, Checks: make(map[string]CheckResult, len(checks))}
+	for name, check := range checks {
+		waitGroup.Add(1)
+		go func(name string, check *registeredCheck) {
+			defer waitGroup.Done()
+			result := check.evaluate(ctx, name)
+
+			resultMutex.Lock()
+			defer resultMutex.Unlock()
+			report.Checks[name] = result
+			if result.Status != StatusUp {
+				report.Status = StatusDown
+			}
+		}(name, check)
+	}
+	waitGroup.Wait()
+	return report
+}
+
+/*
+Names returns the names of the registered checks in alphabetical order
+*/
+func (this *Registry) Names() []string {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	names := make([]string, 0, len(this.checks))
+	for name := range this.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+/*
+HttpStatus returns 200 for a report that is UP and 503 otherwise
+*/
+func (this *Report) HttpStatus() int {
+	if this.Status == StatusUp {
+		return http.StatusOK
+	}
+	return http.StatusServiceUnavailable
+}
+
+/*
+evaluate returns the cached result if it isn't older than the cache duration, otherwise the check is executed.
+Concurrent evaluations of the same check wait for a single execution.
+*/
+func (this *registeredCheck) evaluate(ctx context.Context, name string) CheckResult {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if this.lastResult != nil && time.Since(this.lastResult.CheckedAt) < this.options.CacheDuration {
+		return *this.lastResult
+	}
+
+	checkedAt := time.Now()
+	err := this.execute(ctx)
+	result := CheckResult{
+		Status:     StatusUp,
+		DurationMs: time.Since(checkedAt).Milliseconds(),
+		CheckedAt:  checkedAt,
+	}
+	if err != nil {
+		log.Warn().Msg(fmt.Sprintf("Health check %s failed: %s", name, err.Error()))
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+	this.lastResult = &result
+	return result
+}
+
+/*
+execute runs the check with the configured timeout. Checks ignoring the deadline of the context are abandoned
+when the timeout expires.
+*/
+func (this *registeredCheck) execute(ctx context.Context) error {
+	checkContext, cancelFn := context.WithTimeout(ctx, this.options.Timeout)
+	defer cancelFn()
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				done <- fmt.Errorf("check panicked: %v", recovered)
+			}
+		}()
+		done <- this.check(checkContext)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-checkContext.Done():
+		if errors.Is(checkContext.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("check timed out after %s", this.options.Timeout)
+		}
+		return checkContext.Err()
+	}
+}
+
+/*
+TimeoutMillis returns the time left until the deadline of the context in milliseconds, e.g. for clients
+expecting a timeout instead of a context. Returns DefaultTimeout if the context has no deadline.
+*/
+func TimeoutMillis(ctx context.Context) int {
+	deadline, hasDeadline := ctx.Deadline()
+	if !hasDeadline {
+		return int(DefaultTimeout.Milliseconds())
+	}
+	return max(int(time.Until(deadline).Milliseconds()), 1)
+}
@@ -0,0 +1,109 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRegistry_EvaluateWithoutChecksIsUp(t *testing.T) {
+
+	// execute
+	report := NewRegistry().Evaluate(context.Background())
+
+	// verify
+	assert.Equal(t, StatusUp, report.Status)
+	assert.Empty(t, report.Checks)
+	assert.Equal(t, http.StatusOK, report.HttpStatus())
+}
+
+func TestRegistry_EvaluateReportsEachCheck(t *testing.T) {
+
+	// prepare
+	cut := NewRegistry()
+	cut.Register("kafka", CheckOptions{}, func(ctx context.Context) error { return nil })
+	cut.Register("storage", CheckOptions{}, func(ctx context.Context) error { return errors.New("connection refused") })
+
+	// execute
+	report := cut.Evaluate(context.Background())
+
+	// verify
+	assert.Equal(t, StatusDown, report.Status)
+	assert.Equal(t, http.StatusServiceUnavailable, report.HttpStatus())
+	assert.Equal(t, StatusUp, report.Checks["kafka"].Status)
+	assert.Equal(t, StatusDown, report.Checks["storage"].Status)
+	assert.Equal(t, "connection refused", report.Checks["storage"].Error)
+	assert.Equal(t, []string{"kafka", "storage"}, cut.Names())
+}
+
+func TestRegistry_EvaluateAbandonsCheckAfterTimeout(t *testing.T) {
+
+	// prepare a check ignoring the context
+	cut := NewRegistry()
+	cut.Register("slow", CheckOptions{Timeout: 10 * time.Millisecond}, func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+
+	// execute
+	start := time.Now()
+	report := cut.Evaluate(context.Background())
+
+	// verify
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Equal(t, StatusDown, report.Status)
+	assert.Equal(t, "check timed out after 10ms", report.Checks["slow"].Error)
+}
+
+func TestRegistry_EvaluateRecoversPanickingCheck(t *testing.T) {
+
+	// prepare
+	cut := NewRegistry()
+	cut.Register("panicking", CheckOptions{}, func(ctx context.Context) error {
+		panic("nil client")
+	})
+
+	// execute
+	report := cut.Evaluate(context.Background())
+
+	// verify
+	assert.Equal(t, StatusDown, report.Status)
+	assert.Equal(t, "check panicked: nil client", report.Checks["panicking"].Error)
+}
+
+func TestRegistry_EvaluateCachesResults(t *testing.T) {
+
+	// prepare
+	var executions atomic.Int32
+	cut := NewRegistry()
+	cut.Register("cached", CheckOptions{CacheDuration: time.Hour}, func(ctx context.Context) error {
+		executions.Add(1)
+		return nil
+	})
+	cut.Register("uncached", CheckOptions{CacheDuration: time.Nanosecond}, func(ctx context.Context) error {
+		executions.Add(10)
+		return nil
+	})
+
+	// execute
+	first := cut.Evaluate(context.Background())
+	time.Sleep(time.Millisecond)
+	second := cut.Evaluate(context.Background())
+
+	// verify
+	assert.Equal(t, int32(21), executions.Load())
+	assert.Equal(t, first.Checks["cached"].CheckedAt, second.Checks["cached"].CheckedAt)
+}
+
+func TestTimeoutMillis(t *testing.T) {
+
+	assert.Equal(t, 2000, TimeoutMillis(context.Background()))
+
+	ctx, cancelFn := context.WithTimeout(context.Background(), time.Minute)
+	defer cancelFn()
+	assert.InDelta(t, 60000, TimeoutMillis(ctx), 1000)
+}
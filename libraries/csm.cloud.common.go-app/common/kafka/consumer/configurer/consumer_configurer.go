@@ -1,8 +1,10 @@
 package configurer
 
 import (
+	"context"
 	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/app"
 	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/config/properties"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/health"
 	"fmt"
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
 	"github.com/rs/zerolog/log"
@@ -26,6 +28,12 @@ func ConfigureKafkaConsumer(brokerProperties properties.BrokerProperties, consum
 		log.Info().Msg("Kafka Consumer closed")
 	})
 
+	// Register readiness check requesting the cluster metadata from the brokers
+	health.RegisterCheck("kafkaConsumer", health.CheckOptions{}, func(ctx context.Context) error {
+		_, err := consumer.GetMetadata(nil, false, health.TimeoutMillis(ctx))
+		return err
+	})
+
 	return consumer
 }
 
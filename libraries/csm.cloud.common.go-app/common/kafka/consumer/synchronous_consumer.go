@@ -7,6 +7,7 @@ import (
 	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/datadog"
 	commonKafka "dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/kafka"
 	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/kafka/consumer/deserializer"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/metrics"
 	"errors"
 	"fmt"
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
@@ -14,8 +15,9 @@ import (
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 	"os"
 	"os/signal"
-	"slices"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
@@ -23,6 +25,35 @@ import (
 type SynchronousKafkaConsumer struct {
 	consumer     *kafka.Consumer
 	deserializer deserializer.Deserializer
+	state        *consumerState
+}
+
+/*
+consumerState is shared by the consumption loop and the callers controlling the consumer (e.g. an admin api)
+*/
+type consumerState struct {
+	paused          atomic.Bool
+	lastMessageTime atomic.Pointer[time.Time]
+
+	// Only accessed by the consumption loop
+	pauseApplied bool
+}
+
+/*
+ConsumerStatus describes the state of the consumer and its lag per assigned partition
+*/
+type ConsumerStatus struct {
+	Paused          bool              `json:"paused"`
+	LastMessageTime *time.Time        `json:"lastMessageTime,omitempty"`
+	Partitions      []PartitionStatus `json:"partitions"`
+}
+
+type PartitionStatus struct {
+	Topic           string `json:"topic"`
+	Partition       int32  `json:"partition"`
+	CommittedOffset int64  `json:"committedOffset"`
+	HighWatermark   int64  `json:"highWatermark"`
+	Lag             int64  `json:"lag"`
 }
 
 func NewSynchronousKafkaConsumer(
@@ -31,7 +62,69 @@ func NewSynchronousKafkaConsumer(
 	return SynchronousKafkaConsumer{
 		consumer:     consumer,
 		deserializer: deserializer,
+		state:        &consumerState{},
+	}
+}
+
+/*
+Pause stops the consumption of messages until Resume is called. The consumer stays member of the consumer group,
+so that the assigned partitions are not rebalanced to other instances.
+*/
+func (this *SynchronousKafkaConsumer) Pause() {
+	if !this.state.paused.Swap(true) {
+		log.Info().Msg("Pausing kafka consumer")
+	}
+}
+
+/*
+Resume continues the consumption of messages after Pause
+*/
+func (this *SynchronousKafkaConsumer) Resume() {
+	if this.state.paused.Swap(false) {
+		log.Info().Msg("Resuming kafka consumer")
+	}
+}
+
+/*
+Status returns the pause state, the time of the last processed message and the lag of the assigned partitions.
+The committed offsets and watermarks are requested from the brokers within the given timeout.
+*/
+func (this *SynchronousKafkaConsumer) Status(timeout time.Duration) (ConsumerStatus, error) {
+	status := ConsumerStatus{
+		Paused:          this.state.paused.Load(),
+		LastMessageTime: this.state.lastMessageTime.Load(),
+		Partitions:      []PartitionStatus{},
+	}
+
+	assignment, err := this.consumer.Assignment()
+	if err != nil || len(assignment) == 0 {
+		return status, err
+	}
+	committed, err := this.consumer.Committed(assignment, int(timeout.Milliseconds()))
+	if err != nil {
+		return status, err
+	}
+	for _, partition := range committed {
+		_, highWatermark, err := this.consumer.QueryWatermarkOffsets(*partition.Topic, partition.Partition, int(timeout.Milliseconds()))
+		if err != nil {
+			return status, err
+		}
+
+		// Without a committed offset the whole partition is considered as lag
+		committedOffset := int64(partition.Offset)
+		lag := highWatermark
+		if committedOffset >= 0 {
+			lag = highWatermark - committedOffset
+		}
+		status.Partitions = append(status.Partitions, PartitionStatus{
+			Topic:           *partition.Topic,
+			Partition:       partition.Partition,
+			CommittedOffset: committedOffset,
+			HighWatermark:   highWatermark,
+			Lag:             max(lag, 0),
+		})
 	}
+	return status, nil
 }
 
 func (this *SynchronousKafkaConsumer) Consume(consumerProperties properties.ConsumerProperties, topics []string, callback func(record commonKafka.Record) error) error {
@@ -58,11 +151,24 @@ func (this *SynchronousKafkaConsumer) Consume(consumerProperties properties.Cons
 				log.Trace().Msg("No termination signal received")
 			}
 
+			// Pause or resume the assigned partitions as requested
+			this.applyPauseState()
+
 			// Read next message
 			message, err := this.consumer.ReadMessage(readTimeout)
 
-			if err == nil {
+			if err == nil && this.state.paused.Load() {
+				// Rewind a message received from a partition assigned after pausing, it is read again when resumed
+				this.rewind(message)
+			} else if err == nil {
 				this.handleMessage(message, callback)
+				now := time.Now()
+				this.state.lastMessageTime.Store(&now)
+				this.updateLag([]kafka.TopicPartition{{
+					Topic:     message.TopicPartition.Topic,
+					Partition: message.TopicPartition.Partition,
+					Offset:    message.TopicPartition.Offset + 1,
+				}})
 			} else {
 				var kafkaErr kafka.Error
 				isKafkaError := errors.As(err, &kafkaErr)
@@ -72,6 +178,7 @@ func (this *SynchronousKafkaConsumer) Consume(consumerProperties properties.Cons
 					log.Debug().Msg("Connection to kafka broker refused. Retrying to connect...")
 				} else if isKafkaError && kafkaErr.IsTimeout() {
 					log.Trace().Msg("Kafka consumer timeout detected because no message was received")
+					this.updateAssignmentLag()
 				} else {
 					panic(app.NewFatalError("Consumer is in an unrepairable state and needs to be terminated", err))
 				}
@@ -82,17 +189,77 @@ func (this *SynchronousKafkaConsumer) Consume(consumerProperties properties.Cons
 	return nil
 }
 
-func (this *SynchronousKafkaConsumer) handleMessage(message *kafka.Message, callback func(record commonKafka.Record) error) {
+/*
+applyPauseState pauses the currently assigned partitions while the consumer is paused (repeatedly, as partitions
+can be assigned by a rebalance) and resumes them once the consumer is resumed
+*/
+func (this *SynchronousKafkaConsumer) applyPauseState() {
+	paused := this.state.paused.Load()
+	if !paused && !this.state.pauseApplied {
+		return
+	}
+
+	assignment, err := this.consumer.Assignment()
+	if err != nil {
+		log.Warn().Msg(fmt.Sprintf("Failed to get partition assignment: %s", err.Error()))
+		return
+	}
+	if paused {
+		err = this.consumer.Pause(assignment)
+	} else {
+		err = this.consumer.Resume(assignment)
+	}
+	if err != nil {
+		log.Warn().Msg(fmt.Sprintf("Failed to apply pause state %t to partitions: %s", paused, err.Error()))
+		return
+	}
+	this.state.pauseApplied = paused
+}
+
+/*
+updateAssignmentLag updates the lag metric of all assigned partitions from their current positions
+*/
+func (this *SynchronousKafkaConsumer) updateAssignmentLag() {
+	assignment, err := this.consumer.Assignment()
+	if err != nil || len(assignment) == 0 {
+		return
+	}
+	positions, err := this.consumer.Position(assignment)
+	if err != nil {
+		return
+	}
+	this.updateLag(positions)
+}
 
-	// Initialize tracing from kafka headers
-	datadogHeaders := make([]kafka.Header, 0)
-	for _, header := range message.Headers {
-		if slices.Contains(datadog.DatadogHeaders, header.Key) {
-			datadogHeaders = append(datadogHeaders, header)
+/*
+updateLag updates the lag metric of the given partitions from the next offsets to be consumed and the cached high
+watermarks (no request to the brokers is made)
+*/
+func (this *SynchronousKafkaConsumer) updateLag(positions []kafka.TopicPartition) {
+	for _, position := range positions {
+		if position.Topic == nil || position.Offset < 0 {
+			continue
+		}
+		_, highWatermark, err := this.consumer.GetWatermarkOffsets(*position.Topic, position.Partition)
+		if err != nil || highWatermark < 0 {
+			continue
 		}
+		metrics.ConsumerLag.WithLabelValues(*position.Topic, strconv.Itoa(int(position.Partition))).
+			Set(float64(max(highWatermark-int64(position.Offset), 0)))
+	}
+}
+
+func (this *SynchronousKafkaConsumer) rewind(message *kafka.Message) {
+	err := this.consumer.Seek(message.TopicPartition, 0)
+	if err != nil {
+		panic(app.NewFatalError("Failed to rewind kafka message received while paused", err))
 	}
+}
+
+func (this *SynchronousKafkaConsumer) handleMessage(message *kafka.Message, callback func(record commonKafka.Record) error) {
 
-	parentContext, err := tracer.Extract(datadog.NewKafkaHeaderCarrierFromHeaders(datadogHeaders))
+	// Initialize tracing from kafka headers (the carrier only considers tracing headers)
+	parentContext, err := tracer.Extract(datadog.NewKafkaHeaderCarrierFromHeaders(message.Headers))
 	if err != nil {
 		log.Warn().Msg("Couldn't extract tracing header from kafka message: " + err.Error())
 		parentContext = nil
@@ -0,0 +1,36 @@
+package consumer
+
+import (
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestSynchronousKafkaConsumer_PauseAndResume(t *testing.T) {
+
+	// prepare a consumer without assigned partitions
+	kafkaConsumer, err := kafka.NewConsumer(&kafka.ConfigMap{"bootstrap.servers": "localhost:1", "group.id": "test"})
+	assert.Nil(t, err)
+	defer func() { _ = kafkaConsumer.Close() }()
+	cut := NewSynchronousKafkaConsumer(kafkaConsumer, nil)
+
+	// execute and verify
+	cut.Pause()
+	status, err := cut.Status(time.Second)
+	assert.Nil(t, err)
+	assert.True(t, status.Paused)
+	assert.Nil(t, status.LastMessageTime)
+	assert.Empty(t, status.Partitions)
+
+	cut.applyPauseState()
+	assert.True(t, cut.state.pauseApplied)
+
+	cut.Resume()
+	status, err = cut.Status(time.Second)
+	assert.Nil(t, err)
+	assert.False(t, status.Paused)
+
+	cut.applyPauseState()
+	assert.False(t, cut.state.pauseApplied)
+}
@@ -1,8 +1,10 @@
 package configurer
 
 import (
+	"context"
 	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/app"
 	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/config/properties"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/health"
 	"fmt"
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
 	"github.com/rs/zerolog/log"
@@ -11,7 +13,7 @@ import (
 /*
 ConfigureKafkaProducer initializes the Kafka Producer which will run until the application is terminated.
 Uses shutdown hook to get terminated on Interrupt and SIGTERM signals so that the producer is closed in an orderly
-fashion. Fails fast (in panic) upon error.
+fashion. Registers a readiness check with the default health registry. Fails fast (in panic) upon error.
 */
 func ConfigureKafkaProducer(brokerProperties properties.BrokerProperties) *kafka.Producer {
 
@@ -28,6 +30,12 @@ func ConfigureKafkaProducer(brokerProperties properties.BrokerProperties) *kafka
 		log.Info().Msg("Kafka Producer closed")
 	})
 
+	// Register readiness check requesting the cluster metadata from the brokers
+	health.RegisterCheck("kafkaProducer", health.CheckOptions{}, func(ctx context.Context) error {
+		_, err := producer.GetMetadata(nil, false, health.TimeoutMillis(ctx))
+		return err
+	})
+
 	return producer
 }
 
@@ -2,6 +2,7 @@ package configurer
 
 import (
 	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/config/properties"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/health"
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
 	"github.com/stretchr/testify/assert"
 	"testing"
@@ -25,6 +26,7 @@ func TestConfigureKafkaProducer(t *testing.T) {
 
 	// verify
 	assert.IsType(t, &kafka.Producer{}, cut)
+	assert.Contains(t, health.DefaultRegistry().Names(), "kafkaProducer")
 }
 
 func TestConfigureKafkaProducer_PanicsWhenMisconfigured(t *testing.T) {
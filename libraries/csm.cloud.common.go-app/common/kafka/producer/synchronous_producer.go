@@ -5,10 +5,12 @@ import (
 	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/datadog"
 	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/kafka/producer/partitioner"
 	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/kafka/producer/serializer"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/metrics"
 	"fmt"
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
 	"github.com/rs/zerolog/log"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"time"
 )
 
 /*
@@ -84,6 +86,7 @@ func (this *SynchronousKafkaProducer) Produce(tracingContext context.Context, ke
 	}
 
 	// Send record asynchronously
+	producedAt := time.Now()
 	err = this.producer.Produce(&kafka.Message{
 		Headers:        headers,
 		TopicPartition: topicPartition,
@@ -96,6 +99,7 @@ func (this *SynchronousKafkaProducer) Produce(tracingContext context.Context, ke
 
 	// Block until the asynchronous Produce operation is finished and a result is available
 	e := <-deliveryChan
+	metrics.ProducerDeliveryLatency.WithLabelValues(this.topicName).Observe(time.Since(producedAt).Seconds())
 
 	// Cast the result to Message type and close the channel
 	m := e.(*kafka.Message)
@@ -108,6 +112,7 @@ func (this *SynchronousKafkaProducer) Produce(tracingContext context.Context, ke
 	} else {
 		log.Debug().Msg(fmt.Sprintf("Delivered kafka message to topic %s in partition %d at offset %v",
 			*m.TopicPartition.Topic, m.TopicPartition.Partition, m.TopicPartition.Offset))
+		metrics.MessagesProduced.WithLabelValues(this.topicName).Inc()
 		return nil
 	}
 }
@@ -1,7 +1,9 @@
 package schema_registry_client
 
 import (
+	"context"
 	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/config/properties"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/health"
 	"fmt"
 	"github.com/riferrei/srclient"
 	"github.com/rs/zerolog/log"
@@ -26,7 +28,8 @@ type defaultSchemaRegistryService struct {
 }
 
 /*
-NewDefaultSchemaRegistryService creates a default instance of SchemaRegistryService
+NewDefaultSchemaRegistryService creates a default instance of SchemaRegistryService and registers a readiness check
+with the default health registry
 */
 func NewDefaultSchemaRegistryService(
 	autoRegisterSchemas bool,
@@ -42,6 +45,13 @@ func NewDefaultSchemaRegistryService(
 			schemaRegistryConfig.Api.Secret)
 	}
 
+	// Register readiness check listing the subjects (the srclient doesn't support contexts, so the check is
+	// abandoned after the timeout)
+	health.RegisterCheck("schemaRegistry", health.CheckOptions{}, func(_ context.Context) error {
+		_, err := schemaRegistryClient.GetSubjects()
+		return err
+	})
+
 	// Return instance of "defaultSchemaRegistryService"
 	return &defaultSchemaRegistryService{
 		autoRegisterSchemas:  autoRegisterSchemas,
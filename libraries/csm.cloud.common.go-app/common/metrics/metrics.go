@@ -0,0 +1,136 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"time"
+)
+
+/*
+The instruments are shared by the services, so that dashboards and alerts use the same metric names. They are
+registered with the default prometheus registry (next to the go runtime and process metrics).
+*/
+
+const namespace = "csm"
+
+// Reasons for messages that are dropped (i.e. not processed any further)
+const (
+	ReasonDuplicate            = "duplicate"
+	ReasonInvalidPath          = "invalid_path"
+	ReasonMalicious            = "malicious"
+	ReasonMaxContentLength     = "max_content_length"
+	ReasonNotAnImage           = "not_an_image"
+	ReasonScalingFailed        = "scaling_failed"
+	ReasonUnexpectedEventType  = "unexpected_event_type"
+	ReasonUnexpectedScanResult = "unexpected_scan_result"
+)
+
+// Directions of processed bytes
+const (
+	DirectionDownloaded = "downloaded"
+	DirectionUploaded   = "uploaded"
+)
+
+var (
+	MessagesDequeued = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_dequeued_total",
+		Help:      "Number of messages received from the storage queue or pushed by Event Grid",
+	})
+
+	MessagesProduced = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_produced_total",
+		Help:      "Number of messages delivered to kafka",
+	}, []string{"topic"})
+
+	MessagesDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_dropped_total",
+		Help:      "Number of messages not processed any further",
+	}, []string{"reason"})
+
+	MalwareDetections = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "malware_detections_total",
+		Help:      "Number of uploads the malware scan detected malware in",
+	})
+
+	ScaleDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "image_scale_duration_seconds",
+		Help:      "Duration of scaling an image to a variant",
+		Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"variant"})
+
+	ScalesInProgress = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "image_scales_in_progress",
+		Help:      "Number of images being scaled, scales waiting for a free slot excluded",
+	})
+
+	VipsMemory = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "vips_memory_bytes",
+		Help:      "Memory allocated by libvips (pixel buffers and caches)",
+	})
+
+	VipsMemoryHigh = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "vips_memory_high_bytes",
+		Help:      "Peak of the memory allocated by libvips since start",
+	})
+
+	VipsAllocations = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "vips_allocations",
+		Help:      "Number of active memory allocations of libvips",
+	})
+
+	VipsFiles = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "vips_open_files",
+		Help:      "Number of files opened by libvips",
+	})
+
+	BytesProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bytes_processed_total",
+		Help:      "Number of bytes downloaded from or uploaded to the blob storage",
+	}, []string{"direction"})
+
+	Retries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "retries_total",
+		Help:      "Number of retries of failed operations",
+	}, []string{"operation"})
+
+	ConsumerLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "kafka_consumer_lag",
+		Help:      "Number of messages in an assigned partition not consumed yet",
+	}, []string{"topic", "partition"})
+
+	ProducerDeliveryLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "kafka_producer_delivery_latency_seconds",
+		Help:      "Duration from producing a message until the delivery report is received",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"topic"})
+)
+
+/*
+ObserveScaleDuration records the time elapsed since start as duration of scaling an image to the variant
+*/
+func ObserveScaleDuration(variant string, start time.Time) {
+	ScaleDuration.WithLabelValues(variant).Observe(time.Since(start).Seconds())
+}
+
+/*
+Handler exposes the metrics of the default registry in the prometheus text format
+*/
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
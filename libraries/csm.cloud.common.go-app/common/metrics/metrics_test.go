@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandler_ExposesSharedInstruments(t *testing.T) {
+
+	// prepare
+	MessagesDropped.WithLabelValues(ReasonMalicious).Inc()
+	MalwareDetections.Inc()
+	ScaleDuration.WithLabelValues("small").Observe(0.2)
+	VipsMemory.Set(1024)
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", "/metrics", nil)
+
+	// execute
+	Handler().ServeHTTP(recorder, request)
+
+	// verify
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	body, _ := io.ReadAll(recorder.Body)
+	assert.Contains(t, string(body), `csm_messages_dropped_total{reason="malicious"} 1`)
+	assert.Contains(t, string(body), "csm_malware_detections_total 1")
+	assert.Contains(t, string(body), `csm_image_scale_duration_seconds_count{variant="small"} 1`)
+	assert.Contains(t, string(body), "csm_vips_memory_bytes 1024")
+}
@@ -2,6 +2,7 @@ package retry
 
 import (
 	"context"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/metrics"
 	"fmt"
 	"github.com/avast/retry-go/v4"
 	"github.com/rs/zerolog/log"
@@ -29,5 +30,6 @@ func SimpleRetry(method retry.RetryableFunc, attempts uint, backoff time.Duratio
 		retry.OnRetry(func(numberOfAttempts uint, err error) {
 			log.Info().Msg(fmt.Sprintf(
 				"Retry %v the %d. time. Last seen error: %q", name, numberOfAttempts+1, err))
+			metrics.Retries.WithLabelValues(name).Inc()
 		}))
 }
@@ -8,16 +8,25 @@ import (
 )
 
 type Configuration struct {
-	HttpClient commonProperties.HttpClientProperties
-	Kafka      properties.KafkaProperties
-	Server     properties.ServerProperties
-	Storage    StorageConfiguration
+	Admin              properties.AdminProperties
+	Animation          properties.AnimationProperties
+	DuplicateDetection properties.DuplicateDetectionProperties
+	Erasure            properties.ErasureProperties
+	HttpClient         commonProperties.HttpClientProperties
+	Image              properties.ImageProperties
+	Kafka              properties.KafkaProperties
+	Resize             properties.ResizeProperties
+	Server             properties.ServerProperties
+	Storage            StorageConfiguration
+	Tiles              properties.TilesProperties
+	Watermark          properties.WatermarkProperties
 }
 
 type StorageConfiguration struct {
 	Quarantine properties.StorageProperties
 	User       properties.StorageProperties
 	Project    properties.StorageProperties
+	Derived    properties.StorageProperties //required if resize is enabled
 }
 
 func NewConfiguration(configRoot ...string) Configuration {
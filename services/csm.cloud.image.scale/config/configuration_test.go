@@ -1,9 +1,11 @@
 package config
 
 import (
+	"csm.cloud.image.scale/config/properties"
 	"github.com/stretchr/testify/assert"
 	"os"
 	"testing"
+	"time"
 )
 
 func TestConfigurationFailsWithWrongConfigPath(t *testing.T) {
@@ -24,4 +26,12 @@ func TestConfigurationSucceeds(t *testing.T) {
 
 	//verify
 	assert.Equal(t, 9041, config.Server.Port)
+	assert.Len(t, config.Resize.Presets, 3)
+	assert.Equal(t, properties.ResizePresetProperties{Width: 64, Height: 64, Fit: "attention"}, config.Resize.Presets[0])
+	assert.Equal(t, 24*time.Hour, config.Resize.MaxSignatureLifetime)
+	assert.Equal(t, 52428800, config.Image.MaxCacheMemory)
+	assert.Equal(t, 2, config.Image.MaxConcurrentScales)
+	assert.Equal(t, 15*time.Second, config.Image.MemoryStatsInterval)
+	assert.False(t, config.Erasure.Enabled)
+	assert.False(t, config.Erasure.ReferencesComplete)
 }
@@ -0,0 +1,10 @@
+package properties
+
+import "time"
+
+type AnimationProperties struct {
+	OwnerTypes  []string      //optional (owner types with an animated small image, others get the first frame)
+	Format      string        //optional (webp or gif, defaults to webp)
+	MaxFrames   int           //optional (animations with more frames get the first frame, defaults to 100)
+	MaxDuration time.Duration //optional (longer animations get the first frame, defaults to 10s)
+}
@@ -0,0 +1,6 @@
+package properties
+
+type DuplicateDetectionProperties struct {
+	Enabled   bool
+	Threshold int //optional (images with a smaller hamming distance are near-duplicates, defaults to 6, at most 64)
+}
@@ -0,0 +1,10 @@
+package properties
+
+type ErasureProperties struct {
+	Enabled            bool
+	GroupId            string //required if enabled (consumer group of the deletion events)
+	ProjectTopic       string //required if enabled (topic of the project, task, topic and message events)
+	UserTopic          string //required if enabled (topic of the user events)
+	ErasedTopic        string //required if enabled (topic of the image erased events of the deletion audit)
+	ReferencesComplete bool   //optional (all project images have references, confirms erasures of projects, topics and messages as complete)
+}
@@ -0,0 +1,12 @@
+package properties
+
+import "time"
+
+type ImageProperties struct {
+	Concurrency         int           //optional (threads per libvips operation, defaults to the number of cpus)
+	MaxCacheMemory      int           //optional (bytes of the libvips operation cache, defaults to 50 MiB)
+	MaxCacheFiles       int           //optional (files kept open by the libvips operation cache, defaults to 100)
+	MaxCacheOperations  int           //optional (operations in the libvips operation cache, defaults to 100)
+	MaxConcurrentScales int           `validate:"required"`
+	MemoryStatsInterval time.Duration `validate:"required"`
+}
@@ -21,7 +21,9 @@ type SchemaListProperties struct {
 	Key                 SchemaProperties
 	StringKey           SchemaProperties
 	Deleted             SchemaProperties
+	Erased              SchemaProperties
 	Uploaded            SchemaProperties
+	UploadedV1          SchemaProperties
 	Scaled              SchemaProperties
 }
 
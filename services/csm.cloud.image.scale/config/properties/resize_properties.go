@@ -0,0 +1,18 @@
+package properties
+
+import "time"
+
+type ResizeProperties struct {
+	Enabled              bool
+	MaxDimension         int                      //optional (defaults to 4096)
+	Presets              []ResizePresetProperties //optional (sizes allowed, all sizes up to the max dimension if empty)
+	SigningKey           string                   //required if enabled (hmac key of the signed requests)
+	MaxSignatureLifetime time.Duration            //optional (signatures expiring later are rejected, defaults to 24h)
+}
+
+type ResizePresetProperties struct {
+	Width  int    //optional (if height is set and fit is inside)
+	Height int    //optional (if width is set and fit is inside)
+	Fit    string //optional (inside, cover or attention, defaults to inside)
+	Format string //optional (jpeg, png or webp, defaults to jpeg)
+}
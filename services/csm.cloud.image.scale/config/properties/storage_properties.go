@@ -1,6 +1,29 @@
 package properties
 
+import (
+	commonProperties "dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/config/properties"
+)
+
 type StorageProperties struct {
-	ConnectionString string
+	Type             string //optional (azure, local or s3, defaults to azure)
+	ConnectionString string //required for type azure without credential
 	ContainerName    string
+	Local            LocalStorageProperties //required for type local
+	S3               S3StorageProperties    //required for type s3
+
+	// Token based authentication (instead of the connection string) is used for type azure if a credential type is configured
+	Credential commonProperties.AzureCredentialProperties //optional
+	AccountUrl string                                     //optional (blob service url, required with credential)
+}
+
+type LocalStorageProperties struct {
+	Directory string
+}
+
+type S3StorageProperties struct {
+	Endpoint        string
+	Region          string //optional
+	AccessKeyId     string
+	SecretAccessKey string
+	UseSsl          bool
 }
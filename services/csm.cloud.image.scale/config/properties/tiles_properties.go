@@ -0,0 +1,9 @@
+package properties
+
+type TilesProperties struct {
+	Enabled           bool
+	MinDimension      int //optional (longest side in px from which on a tile pyramid is generated, defaults to 6000)
+	TileSize          int //optional (edge length of a tile in px, defaults to 254)
+	Overlap           int //optional (overlap of neighbouring tiles in px, defaults to 1)
+	UploadConcurrency int //optional (tiles uploaded at the same time, defaults to 8)
+}
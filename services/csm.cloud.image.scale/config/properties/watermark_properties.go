@@ -0,0 +1,7 @@
+package properties
+
+type WatermarkProperties struct {
+	OwnerTypes []string //optional (owner types with watermarked fullhd images, e.g. TASK_ATTACHMENT)
+	Font       string   //optional (pango font description, defaults to sans 16)
+	LogoFile   string   //optional (image rendered next to the text)
+}
@@ -12,14 +12,47 @@ func (e ImageDeletedEvent) GetIdentifier() string {
 	return e.Identifier
 }
 
+/*
+ImageScaledEvent is the representation of ImageScaledEventAvro in version 6. The placeholder fields were added
+with version 2, the perceptual hash and duplicate fields with version 3, the tile manifest with version 4, the
+quality fields with version 5 and the animated flag with version 6. They are nil if they couldn't be computed (the tile
+manifest also for images below the size threshold, the quality fields for user images, the animated flag for stills).
+*/
 type ImageScaledEvent struct {
-	Identifier    string `json:"identifier"`
-	Path          string `json:"path"`
-	FileName      string `json:"filename"`
-	ContentType   string `json:"contentType"`
-	ContentLength int64  `json:"contentLength"`
+	Identifier            string           `json:"identifier"`
+	Path                  string           `json:"path"`
+	FileName              string           `json:"filename"`
+	ContentType           string           `json:"contentType"`
+	ContentLength         int64            `json:"contentLength"`
+	BlurHash              *OptionalString  `json:"blurHash"`
+	DominantColor         *OptionalString  `json:"dominantColor"`
+	PerceptualHash        *OptionalString  `json:"perceptualHash"`
+	RootContextIdentifier *OptionalString  `json:"rootContextIdentifier"`
+	DuplicateOf           *OptionalString  `json:"duplicateOf"`
+	TileManifest          *OptionalString  `json:"tileManifest"`
+	Sharpness             *OptionalDouble  `json:"sharpness"`
+	Brightness            *OptionalDouble  `json:"brightness"`
+	Contrast              *OptionalDouble  `json:"contrast"`
+	Animated              *OptionalBoolean `json:"animated"`
 }
 
 func (e ImageScaledEvent) GetIdentifier() string {
 	return e.Identifier
 }
+
+/*
+ImageErasedEvent confirms the deletion of the images of a deleted aggregate (project, task, topic, message or user)
+for the deletion audit. It is keyed by the message key of the deletion event. Complete is false if images uploaded
+before the references were introduced may remain.
+*/
+type ImageErasedEvent struct {
+	Identifier            string `json:"identifier"`
+	Type                  string `json:"type"`
+	RootContextIdentifier string `json:"rootContextIdentifier"`
+	DeletedBlobs          int64  `json:"deletedBlobs"`
+	Complete              bool   `json:"complete"`
+}
+
+func (e ImageErasedEvent) GetIdentifier() string {
+	return e.Identifier
+}
@@ -1,9 +1,65 @@
 package domain
 
+/*
+FileCreatedEvent is the representation of FileCreatedEventAvro in version 1 and 2. The scan provenance fields were
+added with version 2 and are nil for events of version 1.
+*/
 type FileCreatedEvent struct {
-	Identifier    string `json:"identifier"`
-	Path          string `json:"path"`
-	FileName      string `json:"filename"`
-	ContentType   string `json:"contentType"`
-	ContentLength int64  `json:"contentLength"`
+	Identifier       string          `json:"identifier"`
+	Path             string          `json:"path"`
+	FileName         string          `json:"filename"`
+	ContentType      string          `json:"contentType"`
+	ContentLength    int64           `json:"contentLength"`
+	StorageAccount   *OptionalString `json:"storageAccount"`
+	Container        *OptionalString `json:"container"`
+	ETag             *OptionalString `json:"eTag"`
+	Sha256           *OptionalString `json:"sha256"`
+	ScanFinishedTime *OptionalString `json:"scanFinishedTime"`
+	CorrelationId    *OptionalString `json:"correlationId"`
+	EventTime        *OptionalString `json:"eventTime"`
+}
+
+/*
+OptionalString is the avro JSON encoding of a ["null", "string"] union value. A nil pointer encodes null.
+*/
+type OptionalString struct {
+	String string `json:"string"`
+}
+
+/*
+NewOptionalString returns the union value for the given string or nil for an empty string
+*/
+func NewOptionalString(value string) *OptionalString {
+	if value == "" {
+		return nil
+	}
+	return &OptionalString{String: value}
+}
+
+/*
+OptionalDouble is the avro JSON encoding of a ["null", "double"] union value. A nil pointer encodes null.
+*/
+type OptionalDouble struct {
+	Double float64 `json:"double"`
+}
+
+/*
+NewOptionalDouble returns the union value for the given double
+*/
+func NewOptionalDouble(value float64) *OptionalDouble {
+	return &OptionalDouble{Double: value}
+}
+
+/*
+OptionalBoolean is the avro JSON encoding of a ["null", "boolean"] union value. A nil pointer encodes null.
+*/
+type OptionalBoolean struct {
+	Boolean bool `json:"boolean"`
+}
+
+/*
+NewOptionalBoolean returns the union value for the given boolean
+*/
+func NewOptionalBoolean(value bool) *OptionalBoolean {
+	return &OptionalBoolean{Boolean: value}
 }
@@ -0,0 +1,103 @@
+package rest
+
+import (
+	"crypto/subtle"
+	"csm.cloud.image.scale/config/properties"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/app"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/kafka/consumer"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const defaultAdminPath = "/admin"
+
+// Committed offsets and watermarks are requested from the brokers within this timeout
+const consumerStatusTimeout = 5 * time.Second
+
+/*
+KafkaConsumerControl controls the kafka consumer at runtime
+*/
+type KafkaConsumerControl interface {
+	Pause()
+	Resume()
+	Status(timeout time.Duration) (consumer.ConsumerStatus, error)
+}
+
+/*
+AdminApi provides endpoints for operators to pause and resume the consumption of FileCreatedEvents during
+incidents (instead of scaling the service to zero) and to inspect the consumer lag. Requests are authenticated
+by the configured token passed as bearer token.
+*/
+type AdminApi struct {
+	path                 string
+	token                string
+	kafkaConsumerControl KafkaConsumerControl
+}
+
+/*
+NewAdminApi creates the admin api for the given configuration. Fails fast (in panic) if no token is configured.
+*/
+func NewAdminApi(properties properties.AdminProperties, kafkaConsumerControl KafkaConsumerControl) AdminApi {
+	if properties.Token == "" {
+		panic(app.NewFatalError("Admin api requires a token", nil))
+	}
+
+	path := properties.Path
+	if path == "" {
+		path = defaultAdminPath
+	}
+
+	return AdminApi{
+		path:                 strings.TrimSuffix(path, "/"),
+		token:                properties.Token,
+		kafkaConsumerControl: kafkaConsumerControl,
+	}
+}
+
+/*
+RegisterRoutes adds the admin endpoints to the router
+*/
+func (this *AdminApi) RegisterRoutes(router *gin.Engine) {
+	group := router.Group(this.path, this.authenticate)
+	group.GET("/kafka-consumer", this.getKafkaConsumerStatus)
+	group.POST("/kafka-consumer/pause", this.pauseKafkaConsumer)
+	group.POST("/kafka-consumer/resume", this.resumeKafkaConsumer)
+}
+
+func (this *AdminApi) authenticate(context *gin.Context) {
+	token, found := strings.CutPrefix(context.GetHeader("Authorization"), "Bearer ")
+	if !found || subtle.ConstantTimeCompare([]byte(token), []byte(this.token)) != 1 {
+		log.Warn().Msg(fmt.Sprintf("Rejecting unauthenticated admin request %s %s", context.Request.Method, context.Request.URL.Path))
+		context.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	context.Next()
+}
+
+/*
+getKafkaConsumerStatus responds with the state of the consumer. The partitions are omitted if the offsets couldn't
+be requested from the brokers.
+*/
+func (this *AdminApi) getKafkaConsumerStatus(context *gin.Context) {
+	status, err := this.kafkaConsumerControl.Status(consumerStatusTimeout)
+	if err != nil {
+		log.Warn().Msg("Requesting kafka consumer offsets failed: " + err.Error())
+	}
+	context.JSON(http.StatusOK, status)
+}
+
+func (this *AdminApi) pauseKafkaConsumer(context *gin.Context) {
+	log.Info().Msg("Kafka consumer pause requested by admin api")
+	this.kafkaConsumerControl.Pause()
+	context.Status(http.StatusNoContent)
+}
+
+func (this *AdminApi) resumeKafkaConsumer(context *gin.Context) {
+	log.Info().Msg("Kafka consumer resume requested by admin api")
+	this.kafkaConsumerControl.Resume()
+	context.Status(http.StatusNoContent)
+}
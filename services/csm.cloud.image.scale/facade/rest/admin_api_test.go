@@ -0,0 +1,116 @@
+package rest
+
+import (
+	"csm.cloud.image.scale/config/properties"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/kafka/consumer"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Define KafkaConsumerControl mock
+
+type KafkaConsumerControlMock struct {
+	mock.Mock
+}
+
+func (this *KafkaConsumerControlMock) Pause() {
+	this.Called()
+}
+
+func (this *KafkaConsumerControlMock) Resume() {
+	this.Called()
+}
+
+func (this *KafkaConsumerControlMock) Status(timeout time.Duration) (consumer.ConsumerStatus, error) {
+	args := this.Called(timeout)
+	return args.Get(0).(consumer.ConsumerStatus), args.Error(1)
+}
+
+// Tests
+
+func TestAdminApi_PanicsWithoutToken(t *testing.T) {
+
+	assert.Panics(t, func() {
+		NewAdminApi(properties.AdminProperties{Enabled: true}, &KafkaConsumerControlMock{})
+	}, "Admin api without token configured should panic")
+}
+
+func TestAdminApi_RejectsWrongToken(t *testing.T) {
+
+	// prepare
+	controlMock := &KafkaConsumerControlMock{}
+	router := createTestAdminRouter(controlMock)
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest("POST", "/admin/kafka-consumer/pause", nil)
+	request.Header.Set("Authorization", "Bearer wrong")
+
+	// execute
+	router.ServeHTTP(recorder, request)
+
+	// verify
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	controlMock.AssertNumberOfCalls(t, "Pause", 0)
+}
+
+func TestAdminApi_PauseAndResume(t *testing.T) {
+
+	// prepare
+	controlMock := &KafkaConsumerControlMock{}
+	controlMock.On("Pause").Return()
+	controlMock.On("Resume").Return()
+	router := createTestAdminRouter(controlMock)
+
+	// execute
+	pauseRecorder := serveAdminRequest(router, "POST", "/admin/kafka-consumer/pause")
+	resumeRecorder := serveAdminRequest(router, "POST", "/admin/kafka-consumer/resume")
+
+	// verify
+	assert.Equal(t, http.StatusNoContent, pauseRecorder.Code)
+	assert.Equal(t, http.StatusNoContent, resumeRecorder.Code)
+	controlMock.AssertExpectations(t)
+}
+
+func TestAdminApi_Status(t *testing.T) {
+
+	// prepare
+	controlMock := &KafkaConsumerControlMock{}
+	controlMock.On("Status", consumerStatusTimeout).Return(consumer.ConsumerStatus{
+		Paused: true,
+		Partitions: []consumer.PartitionStatus{
+			{Topic: "csm.storage.event", Partition: 0, CommittedOffset: 40, HighWatermark: 42, Lag: 2},
+		},
+	}, nil)
+	router := createTestAdminRouter(controlMock)
+
+	// execute
+	recorder := serveAdminRequest(router, "GET", "/admin/kafka-consumer")
+
+	// verify
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{
+		"paused": true,
+		"partitions": [{"topic": "csm.storage.event", "partition": 0, "committedOffset": 40, "highWatermark": 42, "lag": 2}]
+	}`, recorder.Body.String())
+}
+
+func createTestAdminRouter(control KafkaConsumerControl) *gin.Engine {
+	adminApi := NewAdminApi(properties.AdminProperties{Enabled: true, Token: "admin-token"}, control)
+	router, err := initRouter(adminApi.RegisterRoutes)
+	if err != nil {
+		panic(err)
+	}
+	return router
+}
+
+func serveAdminRequest(router *gin.Engine, method string, path string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest(method, path, nil)
+	request.Header.Set("Authorization", "Bearer admin-token")
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
@@ -0,0 +1,253 @@
+package rest
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"csm.cloud.image.scale/config/properties"
+	"csm.cloud.image.scale/image"
+	"csm.cloud.image.scale/storage"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/app"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultMaxDimension = 4096
+	// Signatures expiring later are rejected, so that leaked urls can't be used for long
+	defaultMaxSignatureLifetime = 24 * time.Hour
+)
+
+// Resized images don't change unless the original is replaced, clients may cache them for a day
+const imageCacheControl = "private, max-age=86400"
+
+/*
+ImageResizer scales originals to sizes requested on demand
+*/
+type ImageResizer interface {
+	Resize(tracingContext context.Context, request image.ResizeRequest) (*image.ResizedImage, error)
+}
+
+/*
+ImageApi provides the endpoint to resize images on demand (e.g. avatars or retina variants). Requests are
+authenticated by an expiring signature created with the signing key by the services authorizing the access to the
+image (see README). If presets are configured, only their sizes are served.
+*/
+type ImageApi struct {
+	maxDimension         int
+	maxSignatureLifetime time.Duration
+	presets              map[string]bool
+	signingKey           []byte
+	imageResizer         ImageResizer
+	now                  func() time.Time
+}
+
+/*
+NewImageApi creates the image api for the given configuration. Fails fast (in panic) if no signing key is
+configured or a preset is invalid.
+*/
+func NewImageApi(properties properties.ResizeProperties, imageResizer ImageResizer) ImageApi {
+	if properties.SigningKey == "" {
+		panic(app.NewFatalError("Image api requires a signing key", nil))
+	}
+
+	maxDimension := properties.MaxDimension
+	if maxDimension == 0 {
+		maxDimension = defaultMaxDimension
+	}
+	maxSignatureLifetime := properties.MaxSignatureLifetime
+	if maxSignatureLifetime == 0 {
+		maxSignatureLifetime = defaultMaxSignatureLifetime
+	}
+
+	imageApi := ImageApi{
+		maxDimension:         maxDimension,
+		maxSignatureLifetime: maxSignatureLifetime,
+		presets:              make(map[string]bool),
+		signingKey:           []byte(properties.SigningKey),
+		imageResizer:         imageResizer,
+		now:                  time.Now,
+	}
+	for _, preset := range properties.Presets {
+		request, err := imageApi.normalize(image.ResizeRequest{
+			Width:  preset.Width,
+			Height: preset.Height,
+			Fit:    image.ImageFit(preset.Fit),
+			Format: image.ImageFormat(preset.Format),
+		})
+		if err != nil {
+			panic(app.NewFatalError(fmt.Sprintf("Invalid resize preset %+v", preset), err))
+		}
+		imageApi.presets[presetKeyOf(request)] = true
+	}
+	return imageApi
+}
+
+/*
+RegisterRoutes adds the image endpoint to the router
+*/
+func (this *ImageApi) RegisterRoutes(router *gin.Engine) {
+	router.GET("/images/:boundedContext/:parentId/:ownerId", this.getImage)
+}
+
+/*
+getImage responds with the original scaled to the size given by the query parameters w (width), h (height),
+fit (inside, cover or attention) and format (jpeg, png or webp). The request must be signed (expires and signature).
+*/
+func (this *ImageApi) getImage(context *gin.Context) {
+	request, err := this.parseResizeRequest(context)
+	if err != nil {
+		context.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Allow signed requests for the configured sizes only
+	if err = this.verifySignature(context); err != nil {
+		log.Warn().Msg(fmt.Sprintf("Rejecting image request %s: %s", context.Request.URL.Path, err.Error()))
+		context.Status(http.StatusForbidden)
+		return
+	}
+	if len(this.presets) > 0 && !this.presets[presetKeyOf(request)] {
+		log.Warn().Msg(fmt.Sprintf("Rejecting image request %s with size that isn't a preset", context.Request.URL.String()))
+		context.Status(http.StatusForbidden)
+		return
+	}
+
+	resizedImage, err := this.imageResizer.Resize(context.Request.Context(), request)
+	if errors.Is(err, storage.ErrBlobNotFound) || errors.Is(err, image.ErrUnsupportedBoundedContext) {
+		context.Status(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error().Msg(fmt.Sprintf("Resizing image %s failed: %s", context.Request.URL.Path, err.Error()))
+		context.Status(http.StatusInternalServerError)
+		return
+	}
+
+	context.Header("Cache-Control", imageCacheControl)
+	context.Data(http.StatusOK, resizedImage.ContentType, resizedImage.Content)
+}
+
+func (this *ImageApi) parseResizeRequest(context *gin.Context) (image.ResizeRequest, error) {
+	width, err := parseDimension(context.Query("w"))
+	if err != nil {
+		return image.ResizeRequest{}, fmt.Errorf("invalid width: %w", err)
+	}
+	height, err := parseDimension(context.Query("h"))
+	if err != nil {
+		return image.ResizeRequest{}, fmt.Errorf("invalid height: %w", err)
+	}
+
+	return this.normalize(image.ResizeRequest{
+		BoundedContext:   context.Param("boundedContext"),
+		ParentIdentifier: context.Param("parentId"),
+		OwnerIdentifier:  context.Param("ownerId"),
+		Width:            width,
+		Height:           height,
+		Fit:              image.ImageFit(context.Query("fit")),
+		Format:           image.ImageFormat(context.Query("format")),
+	})
+}
+
+/*
+normalize validates the requested size and applies the defaults, so that equal variants are cached once.
+A missing width or height is unbounded (limited by the max dimension) when fitting inside.
+*/
+func (this *ImageApi) normalize(request image.ResizeRequest) (image.ResizeRequest, error) {
+	if request.Fit == "" {
+		request.Fit = image.FitInside
+	}
+	if request.Format == "" {
+		request.Format = image.FormatJpeg
+	}
+
+	switch request.Fit {
+	case image.FitInside:
+		if request.Width == 0 && request.Height == 0 {
+			return request, errors.New("width or height is required")
+		}
+		if request.Width == 0 {
+			request.Width = this.maxDimension
+		}
+		if request.Height == 0 {
+			request.Height = this.maxDimension
+		}
+	case image.FitCover, image.FitAttention:
+		if request.Width == 0 || request.Height == 0 {
+			return request, fmt.Errorf("width and height are required with fit %s", request.Fit)
+		}
+	default:
+		return request, fmt.Errorf("unsupported fit %q", request.Fit)
+	}
+
+	switch request.Format {
+	case image.FormatJpeg, image.FormatPng, image.FormatWebp:
+	default:
+		return request, fmt.Errorf("unsupported format %q", request.Format)
+	}
+
+	if request.Width > this.maxDimension || request.Height > this.maxDimension {
+		return request, fmt.Errorf("width and height must not exceed %d", this.maxDimension)
+	}
+	return request, nil
+}
+
+/*
+verifySignature verifies the signature query parameter, the hex encoded HMAC-SHA256 of the path, the resize
+parameters as requested and the expiry (see signatureOf). Signatures are rejected once expired or if they expire
+later than the max signature lifetime.
+*/
+func (this *ImageApi) verifySignature(context *gin.Context) error {
+	signature, err := hex.DecodeString(context.Query("signature"))
+	if err != nil || len(signature) == 0 {
+		return errors.New("missing or malformed signature")
+	}
+	if !hmac.Equal(signature, signatureOf(this.signingKey, context)) {
+		return errors.New("invalid signature")
+	}
+
+	expires, err := strconv.ParseInt(context.Query("expires"), 10, 64)
+	if err != nil {
+		return errors.New("missing or malformed expiry")
+	}
+	now := this.now()
+	expiry := time.Unix(expires, 0)
+	if now.After(expiry) {
+		return errors.New("signature expired")
+	}
+	if expiry.After(now.Add(this.maxSignatureLifetime)) {
+		return errors.New("signature expires later than allowed")
+	}
+	return nil
+}
+
+func signatureOf(signingKey []byte, context *gin.Context) []byte {
+	mac := hmac.New(sha256.New, signingKey)
+	mac.Write([]byte(fmt.Sprintf("%s?w=%s&h=%s&fit=%s&format=%s&expires=%s", context.Request.URL.Path,
+		context.Query("w"), context.Query("h"), context.Query("fit"), context.Query("format"), context.Query("expires"))))
+	return mac.Sum(nil)
+}
+
+func parseDimension(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	dimension, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+	if dimension <= 0 {
+		return 0, errors.New("must be positive")
+	}
+	return dimension, nil
+}
+
+func presetKeyOf(request image.ResizeRequest) string {
+	return fmt.Sprintf("%dx%d/%s/%s", request.Width, request.Height, request.Fit, request.Format)
+}
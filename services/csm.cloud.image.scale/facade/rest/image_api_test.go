@@ -0,0 +1,202 @@
+package rest
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"csm.cloud.image.scale/config/properties"
+	"csm.cloud.image.scale/image"
+	"csm.cloud.image.scale/storage"
+	"encoding/hex"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Define ImageResizer mock
+
+type ImageResizerMock struct {
+	mock.Mock
+}
+
+func (this *ImageResizerMock) Resize(tracingContext context.Context, request image.ResizeRequest) (*image.ResizedImage, error) {
+	args := this.Called(request)
+	resizedImage, _ := args.Get(0).(*image.ResizedImage)
+	return resizedImage, args.Error(1)
+}
+
+// Tests
+
+const testSigningKey = "signing-key"
+
+var (
+	testNow     = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	testExpires = testNow.Add(time.Hour).Unix()
+)
+
+var avatarRequest = image.ResizeRequest{
+	BoundedContext:   image.BoundedContextUser,
+	ParentIdentifier: "1",
+	OwnerIdentifier:  "2",
+	Width:            64,
+	Height:           64,
+	Fit:              image.FitAttention,
+	Format:           image.FormatJpeg,
+}
+
+func TestImageApi_PanicsWithoutSigningKey(t *testing.T) {
+
+	assert.Panics(t, func() {
+		NewImageApi(properties.ResizeProperties{
+			Enabled: true,
+			Presets: []properties.ResizePresetProperties{{Width: 64, Height: 64, Fit: "attention"}},
+		}, &ImageResizerMock{})
+	}, "Image api without signing key should panic")
+}
+
+func TestImageApi_ServesSignedPreset(t *testing.T) {
+
+	// prepare
+	resizerMock := &ImageResizerMock{}
+	resizerMock.On("Resize", avatarRequest).Return(&image.ResizedImage{Content: []byte("avatar"), ContentType: "image/jpeg"}, nil)
+	router := createTestImageRouter(resizerMock)
+
+	// execute
+	recorder := serveImageRequest(router, signed("/images/user/1/2", "64", "64", "attention", "", testExpires))
+
+	// verify
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "avatar", recorder.Body.String())
+	assert.Equal(t, "image/jpeg", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, imageCacheControl, recorder.Header().Get("Cache-Control"))
+	resizerMock.AssertExpectations(t)
+}
+
+func TestImageApi_RejectsUnsignedAndInvalidSignatures(t *testing.T) {
+
+	// prepare
+	resizerMock := &ImageResizerMock{}
+	router := createTestImageRouter(resizerMock)
+	expiresTooLate := testNow.Add(25 * time.Hour).Unix()
+
+	for description, path := range map[string]string{
+		"unsigned":          "/images/user/1/2?w=64&h=64&fit=attention",
+		"wrongly signed":    "/images/user/1/2?w=64&h=64&fit=attention&expires=" + strconv.FormatInt(testExpires, 10) + "&signature=00",
+		"other size":        strings.Replace(signed("/images/user/1/2", "64", "64", "attention", "", testExpires), "w=64", "w=65", 1),
+		"expired":           signed("/images/user/1/2", "64", "64", "attention", "", testNow.Add(-time.Second).Unix()),
+		"expiring too late": signed("/images/user/1/2", "64", "64", "attention", "", expiresTooLate),
+		"not a preset":      signed("/images/user/1/2", "65", "64", "attention", "", testExpires),
+	} {
+
+		// execute
+		recorder := serveImageRequest(router, path)
+
+		// verify
+		assert.Equal(t, http.StatusForbidden, recorder.Code, "Request %s should be rejected", description)
+	}
+	resizerMock.AssertNumberOfCalls(t, "Resize", 0)
+}
+
+func TestImageApi_ServesSignedSizeWithoutPresets(t *testing.T) {
+
+	// prepare
+	resizerMock := &ImageResizerMock{}
+	request := image.ResizeRequest{
+		BoundedContext:   image.BoundedContextProject,
+		ParentIdentifier: "1",
+		OwnerIdentifier:  "2",
+		Width:            300,
+		Height:           defaultMaxDimension,
+		Fit:              image.FitInside,
+		Format:           image.FormatWebp,
+	}
+	resizerMock.On("Resize", request).Return(&image.ResizedImage{Content: []byte("image"), ContentType: "image/webp"}, nil)
+	router := createTestImageRouterWithPresets(resizerMock, nil)
+
+	// execute
+	recorder := serveImageRequest(router, signed("/images/project/1/2", "300", "", "", "webp", testExpires))
+
+	// verify
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "image/webp", recorder.Header().Get("Content-Type"))
+	resizerMock.AssertExpectations(t)
+}
+
+func TestImageApi_RejectsInvalidParameters(t *testing.T) {
+
+	// prepare
+	router := createTestImageRouter(&ImageResizerMock{})
+
+	for _, query := range []string{"", "w=abc", "w=-1", "w=64&fit=cover", "w=64&fit=fill", "w=64&format=gif", "w=5000"} {
+
+		// execute
+		recorder := serveImageRequest(router, "/images/user/1/2?"+query)
+
+		// verify
+		assert.Equal(t, http.StatusBadRequest, recorder.Code, "Query %q should be rejected", query)
+	}
+}
+
+func TestImageApi_OriginalNotFound(t *testing.T) {
+
+	// prepare
+	resizerMock := &ImageResizerMock{}
+	resizerMock.On("Resize", avatarRequest).Return(nil, storage.ErrBlobNotFound)
+	router := createTestImageRouter(resizerMock)
+
+	// execute
+	recorder := serveImageRequest(router, signed("/images/user/1/2", "64", "64", "attention", "", testExpires))
+
+	// verify
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func createTestImageRouter(imageResizer ImageResizer) *gin.Engine {
+	return createTestImageRouterWithPresets(imageResizer, []properties.ResizePresetProperties{{Width: 64, Height: 64, Fit: "attention"}})
+}
+
+func createTestImageRouterWithPresets(imageResizer ImageResizer, presets []properties.ResizePresetProperties) *gin.Engine {
+	imageApi := NewImageApi(properties.ResizeProperties{
+		Enabled:    true,
+		Presets:    presets,
+		SigningKey: testSigningKey,
+	}, imageResizer)
+	imageApi.now = func() time.Time { return testNow }
+	router, err := initRouter(imageApi.RegisterRoutes)
+	if err != nil {
+		panic(err)
+	}
+	return router
+}
+
+func serveImageRequest(router *gin.Engine, path string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", path, nil)
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// Signs the request like the services issuing the urls (parameters are omitted if empty)
+func signed(path string, width string, height string, fit string, format string, expires int64) string {
+	expiresValue := strconv.FormatInt(expires, 10)
+	mac := hmac.New(sha256.New, []byte(testSigningKey))
+	mac.Write([]byte(fmt.Sprintf("%s?w=%s&h=%s&fit=%s&format=%s&expires=%s", path, width, height, fit, format, expiresValue)))
+
+	query := url.Values{}
+	for name, value := range map[string]string{"w": width, "h": height, "fit": fit, "format": format} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	query.Set("expires", expiresValue)
+	query.Set("signature", hex.EncodeToString(mac.Sum(nil)))
+	return path + "?" + query.Encode()
+}
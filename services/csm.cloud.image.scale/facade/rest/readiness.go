@@ -1,10 +1,19 @@
 package rest
 
 import (
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/health"
 	"github.com/gin-gonic/gin"
-	"net/http"
 )
 
+/*
+ReadinessEndpoint evaluates the checks registered with the default health registry and returns a report of each
+check. Responds with 503 if any check fails, so that no traffic is routed to the instance.
+*/
 func ReadinessEndpoint(context *gin.Context) {
-	context.JSON(http.StatusOK, http.NoBody)
+	readiness(context, health.DefaultRegistry())
+}
+
+func readiness(context *gin.Context, registry *health.Registry) {
+	report := registry.Evaluate(context.Request.Context())
+	context.JSON(report.HttpStatus(), report)
 }
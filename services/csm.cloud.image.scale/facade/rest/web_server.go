@@ -3,6 +3,7 @@ package rest
 import (
 	"csm.cloud.image.scale/config/properties"
 	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/app"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/metrics"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
@@ -11,16 +12,22 @@ import (
 
 type WebServerRunner struct {
 	serverConfiguration properties.ServerProperties
+	routeRegistrations  []RouteRegistration
 }
 
-func NewWebServerRunner(configuration properties.ServerProperties) WebServerRunner {
-	return WebServerRunner{serverConfiguration: configuration}
+/*
+RouteRegistration adds optional endpoints to the router next to the health endpoints
+*/
+type RouteRegistration func(router *gin.Engine)
+
+func NewWebServerRunner(configuration properties.ServerProperties, routeRegistrations ...RouteRegistration) WebServerRunner {
+	return WebServerRunner{serverConfiguration: configuration, routeRegistrations: routeRegistrations}
 }
 
 func (this *WebServerRunner) Run() {
 
 	// Initialize web-server
-	router, err := initRouter()
+	router, err := initRouter(this.routeRegistrations...)
 	if err != nil {
 		panic(app.NewFatalError("Router initialization failed", err))
 	}
@@ -34,7 +41,7 @@ func (this *WebServerRunner) Run() {
 	}
 }
 
-func initRouter() (*gin.Engine, error) {
+func initRouter(routeRegistrations ...RouteRegistration) (*gin.Engine, error) {
 	// Configure logging of route-functions
 	gin.DebugPrintRouteFunc = func(httpMethod, absolutePath, handlerName string, nuHandlers int) {
 		log.Debug().Msg(fmt.Sprintf("endpoint: %v %v %v", httpMethod, absolutePath, handlerName))
@@ -55,6 +62,14 @@ func initRouter() (*gin.Engine, error) {
 	router.GET("/health/liveness", LivenessEndpoint)
 	router.GET("/health/readiness", ReadinessEndpoint)
 
+	// Add routing for the prometheus metrics
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
+
+	// Add routing for optional endpoints
+	for _, routeRegistration := range routeRegistrations {
+		routeRegistration(router)
+	}
+
 	// Return the router
 	return router, nil
 }
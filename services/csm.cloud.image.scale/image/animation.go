@@ -0,0 +1,131 @@
+package image
+
+import (
+	"csm.cloud.image.scale/config/properties"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/app"
+	"fmt"
+	"github.com/davidbyttow/govips/v2/vips"
+	"time"
+)
+
+const (
+	defaultAnimationMaxFrames   = 100
+	defaultAnimationMaxDuration = 10 * time.Second
+)
+
+/*
+Animation scales all frames of animated originals (gif or webp). Without it, only the first frame is scaled.
+*/
+type Animation struct {
+	ownerTypes  map[string]bool
+	format      ImageFormat
+	maxFrames   int
+	maxDuration time.Duration
+}
+
+/*
+NewAnimation creates the animation for the configured owner types, nil if no owner type is configured. Fails fast
+(in panic) on an unsupported format.
+*/
+func NewAnimation(properties properties.AnimationProperties) *Animation {
+	if len(properties.OwnerTypes) == 0 {
+		return nil
+	}
+
+	format := ImageFormat(properties.Format)
+	switch format {
+	case "":
+		format = FormatWebp
+	case FormatWebp, FormatGif:
+	default:
+		panic(app.NewFatalError(fmt.Sprintf("Unsupported animation format %q", properties.Format), nil))
+	}
+
+	maxFrames := properties.MaxFrames
+	if maxFrames == 0 {
+		maxFrames = defaultAnimationMaxFrames
+	}
+	maxDuration := properties.MaxDuration
+	if maxDuration == 0 {
+		maxDuration = defaultAnimationMaxDuration
+	}
+
+	ownerTypes := make(map[string]bool)
+	for _, ownerType := range properties.OwnerTypes {
+		ownerTypes[ownerType] = true
+	}
+	return &Animation{
+		ownerTypes:  ownerTypes,
+		format:      format,
+		maxFrames:   maxFrames,
+		maxDuration: maxDuration,
+	}
+}
+
+/*
+AppliesTo returns true if an original of the owner type with the given number of frames is animated
+*/
+func (a *Animation) AppliesTo(ownerType string, frames int) bool {
+	return a != nil && a.ownerTypes[ownerType] && frames > 1 && frames <= a.maxFrames
+}
+
+/*
+ContentType returns the mime type of the animated images
+*/
+func (a *Animation) ContentType() string {
+	return a.format.ContentType()
+}
+
+/*
+Scale scales all frames of the animated image file to fit into the size (animations aren't cropped). Returns nil
+if the animation exceeds the maximum duration, fails on files of other formats than gif and webp.
+*/
+func (a *Animation) Scale(file string, sizeProperties ImageSizeProperties) (*[]byte, error) {
+	defer acquireScaleSlot(scaleSlots)()
+
+	params := vips.NewImportParams()
+	params.NumPages.Set(-1)
+	image, err := vips.LoadThumbnailFromFile(file, sizeProperties.GetWidth(), sizeProperties.GetHeight(),
+		vips.InterestingNone, vips.SizeDown, params)
+	if err != nil {
+		return nil, err
+	}
+	defer image.Close()
+	if !isAnimatedFormat(image.Format()) {
+		return nil, fmt.Errorf("format %s isn't animated", vips.ImageTypes[image.Format()])
+	}
+
+	delays, err := image.PageDelay()
+	if err != nil {
+		return nil, err
+	}
+	if durationOf(delays) > a.maxDuration {
+		return nil, nil
+	}
+
+	return export(image, a.format)
+}
+
+/*
+framesOf returns the number of frames of the loaded image, 1 for formats other than gif and webp. The pages of other
+formats (e.g. multi-page tiff or heic) are separate images, not frames of an animation.
+*/
+func framesOf(image *vips.ImageRef) int {
+	if !isAnimatedFormat(image.Format()) {
+		return 1
+	}
+	return image.Pages()
+}
+
+func isAnimatedFormat(format vips.ImageType) bool {
+	return format == vips.ImageTypeGIF || format == vips.ImageTypeWEBP
+}
+
+// Sums up the delays (in milliseconds) of the frames
+func durationOf(delays []int) time.Duration {
+	duration := time.Duration(0)
+	for _, delay := range delays {
+		duration += time.Duration(delay) * time.Millisecond
+	}
+	return duration
+}
@@ -0,0 +1,146 @@
+package image
+
+import (
+	"csm.cloud.image.scale/config/properties"
+	"github.com/davidbyttow/govips/v2/vips"
+	"github.com/stretchr/testify/assert"
+	goimage "image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Writes an animated gif of 500x400 px, each frame filled with another color and shown for the delay
+func createTestGif(t *testing.T, frames int, delay time.Duration) string {
+	animation := &gif.GIF{}
+	for frame := 0; frame < frames; frame++ {
+		image := goimage.NewPaletted(goimage.Rect(0, 0, 500, 400), palette.Plan9)
+		for i := range image.Pix {
+			image.Pix[i] = uint8(image.Palette.Index(color.RGBA{R: uint8(80 * frame), G: 128, B: 255, A: 255}))
+		}
+		animation.Image = append(animation.Image, image)
+		animation.Delay = append(animation.Delay, int(delay/(10*time.Millisecond)))
+	}
+	file := filepath.Join(t.TempDir(), "animation.gif")
+	output, err := os.Create(file)
+	assert.Nil(t, err)
+	defer output.Close()
+	assert.Nil(t, gif.EncodeAll(output, animation))
+	return file
+}
+
+func TestNewAnimation_AppliesToConfiguredOwnerTypesWithinFrameLimit(t *testing.T) {
+
+	// execute
+	animation := NewAnimation(properties.AnimationProperties{OwnerTypes: []string{"TOPIC_ATTACHMENT"}, MaxFrames: 10})
+	disabledAnimation := NewAnimation(properties.AnimationProperties{})
+
+	// verify
+	assert.True(t, animation.AppliesTo("TOPIC_ATTACHMENT", 10))
+	assert.False(t, animation.AppliesTo("TOPIC_ATTACHMENT", 11))
+	assert.False(t, animation.AppliesTo("TOPIC_ATTACHMENT", 1))
+	assert.False(t, animation.AppliesTo("PROFILE_PICTURE", 2))
+	assert.Equal(t, "image/webp", animation.ContentType())
+	assert.Equal(t, defaultAnimationMaxDuration, animation.maxDuration)
+	assert.Nil(t, disabledAnimation)
+	assert.False(t, disabledAnimation.AppliesTo("TOPIC_ATTACHMENT", 2))
+}
+
+func TestNewAnimation_SupportsWebpAndGifOnly(t *testing.T) {
+
+	// execute
+	gifAnimation := NewAnimation(properties.AnimationProperties{OwnerTypes: []string{"TOPIC_ATTACHMENT"}, Format: "gif"})
+
+	// verify
+	assert.Equal(t, "image/gif", gifAnimation.ContentType())
+	assert.Panics(t, func() {
+		NewAnimation(properties.AnimationProperties{OwnerTypes: []string{"TOPIC_ATTACHMENT"}, Format: "jpeg"})
+	})
+}
+
+func TestDurationOf(t *testing.T) {
+
+	// execute and verify
+	assert.Equal(t, 250*time.Millisecond, durationOf([]int{100, 100, 50}))
+	assert.Equal(t, time.Duration(0), durationOf(nil))
+}
+
+func TestAnimation_ScalesAllFramesOfGif(t *testing.T) {
+
+	// prepare
+	startupTestVips()
+	file := createTestGif(t, 3, 100*time.Millisecond)
+	animation := NewAnimation(properties.AnimationProperties{OwnerTypes: []string{"TOPIC_ATTACHMENT"}})
+
+	// execute
+	scaled, scaledErr := ScaleImageFileToVariants(file, Variant{Name: VariantSmall, SizeProperties: &SmallImageSizeProperties})
+	content, err := animation.Scale(file, &SmallImageSizeProperties)
+
+	// verify
+	assert.Nil(t, scaledErr)
+	assert.Equal(t, 3, scaled.Frames)
+	assert.True(t, animation.AppliesTo("TOPIC_ATTACHMENT", scaled.Frames))
+	assert.Nil(t, err)
+	params := vips.NewImportParams()
+	params.NumPages.Set(-1)
+	image, err := vips.LoadImageFromBuffer(*content, params)
+	assert.Nil(t, err)
+	defer image.Close()
+	assert.Equal(t, vips.ImageTypeWEBP, image.Format())
+	assert.Equal(t, 3, image.Pages())
+	assert.Equal(t, 250, image.Width(), "The frames should fit into the small size without crop")
+	assert.Equal(t, 200, image.PageHeight())
+	delays, err := image.PageDelay()
+	assert.Nil(t, err)
+	assert.Equal(t, []int{100, 100, 100}, delays)
+}
+
+func TestAnimation_KeepsFirstFrameOfGifExceedingMaxDuration(t *testing.T) {
+
+	// prepare
+	startupTestVips()
+	file := createTestGif(t, 3, 100*time.Millisecond)
+	animation := NewAnimation(properties.AnimationProperties{OwnerTypes: []string{"TOPIC_ATTACHMENT"}, MaxDuration: 250 * time.Millisecond})
+
+	// execute
+	content, err := animation.Scale(file, &SmallImageSizeProperties)
+
+	// verify
+	assert.Nil(t, err)
+	assert.Nil(t, content)
+}
+
+func TestScaleImageFileToVariants_CountsFramesOfAnimatedFormatsOnly(t *testing.T) {
+
+	// prepare
+	startupTestVips()
+	gifFile := createTestGif(t, 1, 0)
+	// Multi-page tiff, the pages of a document aren't frames of an animation
+	params := vips.NewImportParams()
+	params.NumPages.Set(-1)
+	pages, err := vips.LoadImageFromFile(createTestGif(t, 3, 100*time.Millisecond), params)
+	assert.Nil(t, err)
+	tiff, _, err := pages.ExportTiff(vips.NewTiffExportParams())
+	pages.Close()
+	assert.Nil(t, err)
+	tiffFile := filepath.Join(t.TempDir(), "document.tif")
+	assert.Nil(t, os.WriteFile(tiffFile, tiff, 0600))
+	document, err := vips.LoadImageFromFile(tiffFile, params)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, document.Pages(), "The tiff should have a page per frame of the gif")
+	document.Close()
+
+	// execute
+	scaledGif, gifErr := ScaleImageFileToVariants(gifFile, Variant{Name: VariantSmall, SizeProperties: &SmallImageSizeProperties})
+	scaledTiff, tiffErr := ScaleImageFileToVariants(tiffFile, Variant{Name: VariantSmall, SizeProperties: &SmallImageSizeProperties})
+
+	// verify
+	assert.Nil(t, gifErr)
+	assert.Equal(t, 1, scaledGif.Frames)
+	assert.Nil(t, tiffErr)
+	assert.Equal(t, 1, scaledTiff.Frames)
+}
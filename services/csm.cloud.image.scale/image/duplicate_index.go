@@ -0,0 +1,159 @@
+package image
+
+import (
+	"csm.cloud.image.scale/config/properties"
+	"csm.cloud.image.scale/storage"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/app"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+)
+
+const (
+	defaultDuplicateThreshold = 6
+	contentTypeIndexEntry     = "application/octet-stream"
+)
+
+/*
+DuplicateIndex keeps the perceptual hashes of the images of a project to detect near-duplicates (e.g. the same photo
+uploaded to several tasks and topics). The hash is split into as many bands as the threshold, so that images with a
+smaller Hamming distance share at least one band. Each image is registered with an empty blob per band below
+project/image/phash/{projectId}/{band}-{bandValue}/{hash}/{ownerId}, therefore only the blobs of the bands of an
+image are listed to find its near-duplicates. The blobs are never modified, so images registered concurrently by
+several consumers don't overwrite each other's entries (they may miss each other as duplicates though). Erased
+images are marked by an empty blob below project/image/phash/{projectId}/erased/{ownerId} and never reported.
+*/
+type DuplicateIndex struct {
+	blobStore storage.BlobStore
+	threshold int
+}
+
+/*
+NewDuplicateIndex creates the index for the configured threshold. Fails fast (in panic) if the threshold exceeds the
+64 bits of the hash.
+*/
+func NewDuplicateIndex(properties properties.DuplicateDetectionProperties, blobStore storage.BlobStore) DuplicateIndex {
+	threshold := properties.Threshold
+	if threshold == 0 {
+		threshold = defaultDuplicateThreshold
+	}
+	if threshold < 0 || threshold > 64 {
+		panic(app.NewFatalError(fmt.Sprintf("Invalid duplicate detection threshold %d", threshold), nil))
+	}
+
+	return DuplicateIndex{
+		blobStore: blobStore,
+		threshold: threshold,
+	}
+}
+
+/*
+Register adds the hash of the image to the index of the project. Returns the owner identifier of the most similar
+image in the project that isn't erased if the Hamming distance is below the threshold, an empty string otherwise.
+Registering an image again (e.g. after a replay) writes the same blobs again.
+*/
+func (d *DuplicateIndex) Register(projectIdentifier string, ownerIdentifier string, hash PerceptualHash) (string, error) {
+	prefixes := d.bandPrefixesOf(projectIdentifier, hash)
+
+	// Find the images below the threshold among the images sharing a band
+	distances := make(map[string]int)
+	for _, prefix := range prefixes {
+		blobNames, err := d.blobStore.ListBlobs(prefix)
+		if err != nil {
+			return "", err
+		}
+		for _, blobName := range blobNames {
+			entryOwner := path.Base(blobName)
+			entryHash, err := ParsePerceptualHash(path.Base(path.Dir(blobName)))
+			if err != nil || entryOwner == ownerIdentifier {
+				continue
+			}
+			if distance := hash.Distance(entryHash); distance < d.threshold {
+				distances[entryOwner] = distance
+			}
+		}
+	}
+
+	// Report the nearest image that isn't erased
+	duplicateOf, err := d.nearestNotErased(projectIdentifier, distances)
+	if err != nil {
+		return "", err
+	}
+
+	// Register the image in all of its bands
+	for _, prefix := range prefixes {
+		err = d.blobStore.UploadBlob(prefix+hash.String(), ownerIdentifier, &[]byte{}, nil, contentTypeIndexEntry)
+		if err != nil {
+			return "", err
+		}
+	}
+	return duplicateOf, nil
+}
+
+/*
+Remove marks the owner of an erased image as erased in the index of the project and removes its entries. The entries
+can only be found with the hash of the image, without hash (e.g. if the original is gone already) only the mark
+excludes the owner from the duplicates.
+*/
+func (d *DuplicateIndex) Remove(projectIdentifier string, ownerIdentifier string, hash *PerceptualHash) error {
+	err := d.blobStore.UploadBlob(erasedPrefixOf(projectIdentifier), ownerIdentifier, &[]byte{}, nil, contentTypeIndexEntry)
+	if err != nil || hash == nil {
+		return err
+	}
+	for _, prefix := range d.bandPrefixesOf(projectIdentifier, *hash) {
+		err = d.blobStore.DeleteBlob(prefix+hash.String(), ownerIdentifier)
+		if err != nil && !errors.Is(err, storage.ErrBlobNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+nearestNotErased returns the owner with the smallest distance that isn't marked as erased, empty if there is none
+*/
+func (d *DuplicateIndex) nearestNotErased(projectIdentifier string, distances map[string]int) (string, error) {
+	owners := make([]string, 0, len(distances))
+	for owner := range distances {
+		owners = append(owners, owner)
+	}
+	sort.Slice(owners, func(a, b int) bool {
+		return distances[owners[a]] < distances[owners[b]] || (distances[owners[a]] == distances[owners[b]] && owners[a] < owners[b])
+	})
+
+	for _, owner := range owners {
+		_, err := d.blobStore.GetBlobProperties(erasedPrefixOf(projectIdentifier), owner)
+		if errors.Is(err, storage.ErrBlobNotFound) {
+			return owner, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+/*
+bandPrefixesOf returns the prefix of each band of the hash. With as many bands as the threshold, hashes differing
+in less bits than the threshold are equal in at least one band (pigeonhole principle).
+*/
+func (d *DuplicateIndex) bandPrefixesOf(projectIdentifier string, hash PerceptualHash) []string {
+	prefixes := make([]string, d.threshold)
+	for band := range prefixes {
+		from, to := band*64/d.threshold, (band+1)*64/d.threshold
+		bandValue := (uint64(hash) >> from) & (1<<(to-from) - 1)
+		prefixes[band] = fmt.Sprintf("%s%d-%x/", duplicateIndexPrefixOf(projectIdentifier), band, bandValue)
+	}
+	return prefixes
+}
+
+// Returns the prefix of the index of the project (e.g. to erase it)
+func duplicateIndexPrefixOf(projectIdentifier string) string {
+	return fmt.Sprintf("project/image/phash/%s/", projectIdentifier)
+}
+
+// Returns the path of the marks of the erased images of the project
+func erasedPrefixOf(projectIdentifier string) string {
+	return duplicateIndexPrefixOf(projectIdentifier) + "erased"
+}
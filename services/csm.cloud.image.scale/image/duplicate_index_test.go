@@ -0,0 +1,141 @@
+package image
+
+import (
+	"csm.cloud.image.scale/config/properties"
+	"csm.cloud.image.scale/storage"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+func newTestDuplicateIndex(t *testing.T, duplicateProperties properties.DuplicateDetectionProperties) *DuplicateIndex {
+	blobStore := storage.NewLocalBlobStore(properties.StorageProperties{
+		Type:          storage.BlobStoreTypeLocal,
+		ContainerName: "csm",
+		Local:         properties.LocalStorageProperties{Directory: t.TempDir()},
+	})
+	duplicateIndex := NewDuplicateIndex(duplicateProperties, blobStore)
+	return &duplicateIndex
+}
+
+func TestDuplicateIndex_ReportsNearestDuplicateInProject(t *testing.T) {
+
+	// prepare
+	duplicateIndex := newTestDuplicateIndex(t, properties.DuplicateDetectionProperties{Enabled: true, Threshold: 6})
+	hash := PerceptualHash(0xf0f0f0f0f0f0f0f0)
+	_, err := duplicateIndex.Register("project1", "far", hash^0xff)
+	assert.Nil(t, err)
+	_, err = duplicateIndex.Register("project1", "near", hash^0x1)
+	assert.Nil(t, err)
+	_, err = duplicateIndex.Register("project2", "other-project", hash)
+	assert.Nil(t, err)
+
+	// execute
+	duplicateOf, err := duplicateIndex.Register("project1", "new", hash)
+
+	// verify
+	assert.Nil(t, err)
+	assert.Equal(t, "near", duplicateOf)
+}
+
+func TestDuplicateIndex_IgnoresSameImageAndDistantImages(t *testing.T) {
+
+	// prepare
+	duplicateIndex := newTestDuplicateIndex(t, properties.DuplicateDetectionProperties{Enabled: true, Threshold: 6})
+	hash := PerceptualHash(0xf0f0f0f0f0f0f0f0)
+	_, err := duplicateIndex.Register("project1", "distant", hash^0x3f)
+	assert.Nil(t, err)
+	_, err = duplicateIndex.Register("project1", "replayed", hash)
+	assert.Nil(t, err)
+
+	// execute
+	duplicateOf, err := duplicateIndex.Register("project1", "replayed", hash)
+
+	// verify
+	assert.Nil(t, err)
+	assert.Empty(t, duplicateOf)
+}
+
+func TestDuplicateIndex_FindsDuplicatesDifferingInEachBand(t *testing.T) {
+
+	// prepare
+	duplicateIndex := newTestDuplicateIndex(t, properties.DuplicateDetectionProperties{Enabled: true, Threshold: 6})
+	hash := PerceptualHash(0xf0f0f0f0f0f0f0f0)
+
+	for bit := 0; bit < 64; bit += 5 {
+		ownerIdentifier := fmt.Sprintf("image%d", bit)
+		_, err := duplicateIndex.Register("project1", ownerIdentifier, hash^(0x1f<<bit))
+		assert.Nil(t, err)
+
+		// execute
+		duplicateOf, err := duplicateIndex.Register("project1", "new"+ownerIdentifier, hash^(0x1f<<bit)^(1<<((bit+32)%64)))
+
+		// verify
+		assert.Nil(t, err)
+		assert.Equal(t, ownerIdentifier, duplicateOf, "Hashes differing in one bit should be found")
+	}
+}
+
+func TestDuplicateIndex_KeepsImagesRegisteredConcurrently(t *testing.T) {
+
+	// prepare
+	duplicateIndex := newTestDuplicateIndex(t, properties.DuplicateDetectionProperties{Enabled: true, Threshold: 6})
+	hash := PerceptualHash(0xf0f0f0f0f0f0f0f0)
+	var waitGroup sync.WaitGroup
+
+	// execute
+	for index := 0; index < 10; index++ {
+		waitGroup.Add(1)
+		go func(index int) {
+			defer waitGroup.Done()
+			_, err := duplicateIndex.Register("project1", fmt.Sprintf("image%d", index), hash)
+			assert.Nil(t, err)
+		}(index)
+	}
+	waitGroup.Wait()
+
+	// verify
+	duplicateOf, err := duplicateIndex.Register("project1", "new", hash)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, duplicateOf)
+	blobNames, err := duplicateIndex.blobStore.ListBlobs(duplicateIndexPrefixOf("project1"))
+	assert.Nil(t, err)
+	assert.Len(t, blobNames, 11*6, "Each image should be registered in each of the 6 bands")
+}
+
+func TestDuplicateIndex_IgnoresRemovedImages(t *testing.T) {
+
+	// prepare
+	duplicateIndex := newTestDuplicateIndex(t, properties.DuplicateDetectionProperties{Enabled: true, Threshold: 6})
+	hash := PerceptualHash(0xf0f0f0f0f0f0f0f0)
+	removedHash := hash ^ 0x1
+	_, err := duplicateIndex.Register("project1", "removed", removedHash)
+	assert.Nil(t, err)
+	_, err = duplicateIndex.Register("project1", "removed-without-hash", hash^0x2)
+	assert.Nil(t, err)
+	_, err = duplicateIndex.Register("project1", "kept", hash^0x7)
+	assert.Nil(t, err)
+
+	// execute
+	assert.Nil(t, duplicateIndex.Remove("project1", "removed", &removedHash))
+	assert.Nil(t, duplicateIndex.Remove("project1", "removed-without-hash", nil))
+	duplicateOf, err := duplicateIndex.Register("project1", "new", hash)
+
+	// verify
+	assert.Nil(t, err)
+	assert.Equal(t, "kept", duplicateOf, "Removed images should not be reported even if nearer")
+	for _, prefix := range duplicateIndex.bandPrefixesOf("project1", removedHash) {
+		blobNames, err := duplicateIndex.blobStore.ListBlobs(prefix + removedHash.String())
+		assert.Nil(t, err)
+		assert.Empty(t, blobNames, "Entries of the removed image should be deleted")
+	}
+}
+
+func TestNewDuplicateIndex_PanicsOnThresholdExceedingHash(t *testing.T) {
+
+	// execute and verify
+	assert.Panics(t, func() {
+		newTestDuplicateIndex(t, properties.DuplicateDetectionProperties{Enabled: true, Threshold: 65})
+	})
+}
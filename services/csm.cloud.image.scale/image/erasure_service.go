@@ -0,0 +1,303 @@
+package image
+
+import (
+	"context"
+	"csm.cloud.image.scale/config/properties"
+	"csm.cloud.image.scale/domain"
+	"csm.cloud.image.scale/image/model"
+	"csm.cloud.image.scale/kafka/producer"
+	"csm.cloud.image.scale/storage"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/datadog"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"path"
+	"slices"
+	"strings"
+)
+
+const (
+	AggregateTypeProject = "PROJECT"
+	AggregateTypeTask    = "TASK"
+	AggregateTypeTopic   = "TOPIC"
+	AggregateTypeMessage = "MESSAGE"
+	AggregateTypeUser    = "USER"
+
+	// References of the project images (empty blobs), named by the identifiers from the project to the owner
+	referencesPath       = "project/image/references"
+	contentTypeReference = "application/octet-stream"
+)
+
+// Kinds of images written per parent and owner (small, fullhd and original are blobs, tiles are directories)
+var imageKinds = []string{"small", "fullhd", "original", "tiles"}
+
+/*
+ErasureService deletes all images of deleted aggregates (GDPR). Images are stored by their parent identifier (the
+project, task or user), so images of topics and messages (stored by their task) and of the tasks of a project are
+found by the references written with each project image. Images uploaded before the references were introduced
+can't be found that way, so these erasures are reported as incomplete until all project images have references.
+Erased images of tasks, topics and messages are removed from the duplicate index of their project.
+*/
+type ErasureService struct {
+	referencesComplete       bool
+	projectBlobStore         storage.BlobStore
+	userBlobStore            storage.BlobStore
+	derivedBlobStore         storage.BlobStore
+	imageErasedEventProducer producer.EventKafkaProducer[domain.MessageKey, domain.ImageErasedEvent]
+	duplicateIndex           *DuplicateIndex
+}
+
+/*
+NewErasureService creates the erasure service, the derived blob store is nil if the resize api is disabled and the
+duplicate index is nil if the duplicate detection is disabled
+*/
+func NewErasureService(properties properties.ErasureProperties, projectBlobStore storage.BlobStore, userBlobStore storage.BlobStore, derivedBlobStore storage.BlobStore,
+	imageErasedEventProducer producer.EventKafkaProducer[domain.MessageKey, domain.ImageErasedEvent], duplicateIndex *DuplicateIndex) ErasureService {
+	return ErasureService{
+		referencesComplete:       properties.ReferencesComplete,
+		projectBlobStore:         projectBlobStore,
+		userBlobStore:            userBlobStore,
+		derivedBlobStore:         derivedBlobStore,
+		imageErasedEventProducer: imageErasedEventProducer,
+		duplicateIndex:           duplicateIndex,
+	}
+}
+
+// Project image identified by its parent (the project or task) and owner
+type erasedImage struct {
+	parent string
+	owner  string
+}
+
+/*
+Erase deletes all images (including tiles and cached variants) of the deleted aggregate identified by the key and
+confirms the deletion with an image erased event. Deletions of other aggregate types are ignored. Erasures of
+projects, topics and messages are only complete if all project images have references, as images of tasks, topics
+and messages without references can't be assigned to them.
+*/
+func (e *ErasureService) Erase(tracingContext context.Context, key domain.MessageKey) error {
+	aggregate := key.AggregateIdentifier
+
+	var prefixes []blobPrefix
+	var images []erasedImage
+	var err error
+	switch aggregate.Type {
+	case AggregateTypeProject, AggregateTypeTask, AggregateTypeTopic, AggregateTypeMessage:
+		prefixes, images, err = e.projectPrefixesOf(key.RootContextIdentifier, aggregate)
+	case AggregateTypeUser:
+		prefixes = e.prefixesOf(e.userBlobStore, BoundedContextUser, aggregate.Identifier, "")
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Remove the images from the duplicate index before their originals (holding the perceptual hash) are deleted
+	_, err = datadog.TraceWithContext(tracingContext, "removeFromDuplicateIndex", func() (any, error) {
+		return nil, e.removeFromDuplicateIndex(key.RootContextIdentifier, images)
+	})
+	if err != nil {
+		return err
+	}
+
+	deletedBlobs, err := datadog.TraceWithContext(tracingContext, "eraseImages", func() (int64, error) {
+		return deleteBlobs(prefixes)
+	})
+	if err != nil {
+		return err
+	}
+	log.Info().Msg(fmt.Sprintf("Erased %d blobs of deleted %s %s", deletedBlobs, aggregate.Type, aggregate.Identifier))
+
+	// Images of tasks and users are deleted by their parent, others only by their references
+	complete := e.referencesComplete || aggregate.Type == AggregateTypeTask || aggregate.Type == AggregateTypeUser
+	if !complete {
+		log.Warn().Msg(fmt.Sprintf("Erasure of deleted %s %s is incomplete, images without references may remain", aggregate.Type, aggregate.Identifier))
+	}
+
+	_, err = datadog.TraceWithContext(tracingContext, "sendImageErasedEvent", func() (any, error) {
+		err := e.imageErasedEventProducer.Produce(tracingContext, key, domain.ImageErasedEvent{
+			Identifier:            aggregate.Identifier,
+			Type:                  aggregate.Type,
+			RootContextIdentifier: key.RootContextIdentifier,
+			DeletedBlobs:          deletedBlobs,
+			Complete:              complete,
+		})
+		return nil, err
+	})
+	return err
+}
+
+/*
+projectPrefixesOf returns the prefixes of the images referencing the aggregate and of the references themselves,
+and the images to remove from the duplicate index (none for projects, their whole index is deleted).
+Images of deleted projects and tasks are deleted by their parent, which includes images of the task or project itself
+uploaded before the references were introduced (but not those of the tasks of a project). Images of deleted topics
+and messages share their parent (the task) with other images and are deleted by their owner.
+*/
+func (e *ErasureService) projectPrefixesOf(projectIdentifier string, aggregate domain.AggregateIdentifier) ([]blobPrefix, []erasedImage, error) {
+	projectReferencesPath := fmt.Sprintf("%s/%s/", referencesPath, projectIdentifier)
+	references, err := e.projectBlobStore.ListBlobs(projectReferencesPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	byParent := aggregate.Type == AggregateTypeProject || aggregate.Type == AggregateTypeTask
+	parents := make(map[string]bool)
+	if byParent {
+		parents[aggregate.Identifier] = true
+	}
+
+	var prefixes, referencePrefixes []blobPrefix
+	var images []erasedImage
+	for _, reference := range references {
+		identifiers := strings.Split(strings.TrimPrefix(reference, projectReferencesPath), "/")
+		owner := identifiers[len(identifiers)-1]
+		if aggregate.Type != AggregateTypeProject && !slices.Contains(identifiers[:len(identifiers)-1], aggregate.Identifier) {
+			continue
+		}
+
+		// Project pictures are stored by the project, all other images by their task
+		parent := projectIdentifier
+		if len(identifiers) > 1 {
+			parent = identifiers[0]
+		}
+		if byParent {
+			parents[parent] = true
+		} else {
+			prefixes = append(prefixes, e.prefixesOf(e.projectBlobStore, BoundedContextProject, parent, owner)...)
+			images = append(images, erasedImage{parent: parent, owner: owner})
+		}
+		referencePrefixes = append(referencePrefixes, blobPrefix{blobStore: e.projectBlobStore, prefix: reference})
+	}
+
+	for parent := range parents {
+		prefixes = append(prefixes, e.prefixesOf(e.projectBlobStore, BoundedContextProject, parent, "")...)
+	}
+	if aggregate.Type == AggregateTypeProject {
+		prefixes = append(prefixes, blobPrefix{
+			blobStore: e.projectBlobStore,
+			prefix:    duplicateIndexPrefixOf(aggregate.Identifier),
+		})
+	}
+
+	// The images of a task are its originals, including those uploaded before the references were introduced
+	if aggregate.Type == AggregateTypeTask {
+		originalsPath := fmt.Sprintf("%s/image/original/%s/", BoundedContextProject, aggregate.Identifier)
+		originals, err := e.projectBlobStore.ListBlobs(originalsPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, original := range originals {
+			images = append(images, erasedImage{parent: aggregate.Identifier, owner: strings.TrimPrefix(original, originalsPath)})
+		}
+	}
+
+	// Delete the references last, so that they are found again if the deletion of an image fails
+	return append(prefixes, referencePrefixes...), images, nil
+}
+
+/*
+removeFromDuplicateIndex removes the images from the duplicate index of the project, the perceptual hash is read from
+the metadata of their original
+*/
+func (e *ErasureService) removeFromDuplicateIndex(projectIdentifier string, images []erasedImage) error {
+	if e.duplicateIndex == nil {
+		return nil
+	}
+	removed := make(map[erasedImage]bool)
+	for _, image := range images {
+		// Images of a task are found both by their references and their originals
+		if removed[image] {
+			continue
+		}
+		removed[image] = true
+		var hash *PerceptualHash
+		properties, err := e.projectBlobStore.GetBlobProperties(fmt.Sprintf("%s/image/original/%s", BoundedContextProject, image.parent), image.owner)
+		if err != nil && !errors.Is(err, storage.ErrBlobNotFound) {
+			return err
+		}
+		if err == nil {
+			if perceptualHash, err := ParsePerceptualHash(valueOrEmpty(properties.Metadata["perceptual_hash"])); err == nil {
+				hash = &perceptualHash
+			}
+		}
+		if err = e.duplicateIndex.Remove(projectIdentifier, image.owner, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+prefixesOf returns the prefixes of all kinds of images of the owner (or of all owners of the parent if the owner is
+empty), including the variants cached by the resize api
+*/
+func (e *ErasureService) prefixesOf(blobStore storage.BlobStore, boundedContext string, parent string, owner string) []blobPrefix {
+	kinds := imageKinds
+	if e.derivedBlobStore != nil {
+		kinds = append(slices.Clip(kinds), "derived")
+	}
+
+	prefixes := make([]blobPrefix, 0, len(kinds))
+	for _, kind := range kinds {
+		prefix := fmt.Sprintf("%s/image/%s/%s/%s", boundedContext, kind, parent, owner)
+		if kind == "derived" {
+			prefixes = append(prefixes, blobPrefix{blobStore: e.derivedBlobStore, prefix: prefix})
+		} else {
+			prefixes = append(prefixes, blobPrefix{blobStore: blobStore, prefix: prefix})
+		}
+	}
+	return prefixes
+}
+
+/*
+referenceOf returns the path and file name of the reference of a project image, named by the identifiers from the
+project to the owner (e.g. project/task/topic/message/owner for a message attachment)
+*/
+func referenceOf(image model.Image) (string, string) {
+	var identifiers []string
+	switch attachment := image.(type) {
+	case *model.TopicAttachment:
+		identifiers = []string{attachment.ProjectIdentifier, attachment.TaskIdentifier, attachment.TopicIdentifier}
+	case *model.MessageAttachment:
+		identifiers = []string{attachment.ProjectIdentifier, attachment.TaskIdentifier, attachment.TopicIdentifier, attachment.MessageIdentifier}
+	default:
+		// Project pictures are owned by the project itself, task attachments by their task
+		identifiers = []string{image.GetRootContextIdentifier()}
+		if image.GetParentIdentifier() != image.GetRootContextIdentifier() {
+			identifiers = append(identifiers, image.GetParentIdentifier())
+		}
+	}
+	return path.Join(append([]string{referencesPath}, identifiers...)...), image.GetOwnerIdentifier()
+}
+
+type blobPrefix struct {
+	blobStore storage.BlobStore
+	prefix    string
+}
+
+/*
+deleteBlobs deletes all blobs starting with the prefixes and returns their number. Blobs deleted in the meantime
+(e.g. by the project service) are skipped.
+*/
+func deleteBlobs(prefixes []blobPrefix) (int64, error) {
+	deletedBlobs := int64(0)
+	for _, prefix := range prefixes {
+		blobNames, err := prefix.blobStore.ListBlobs(prefix.prefix)
+		if err != nil {
+			return deletedBlobs, err
+		}
+		for _, blobName := range blobNames {
+			err = prefix.blobStore.DeleteBlob(path.Dir(blobName), path.Base(blobName))
+			if errors.Is(err, storage.ErrBlobNotFound) {
+				continue
+			}
+			if err != nil {
+				return deletedBlobs, err
+			}
+			deletedBlobs++
+		}
+	}
+	return deletedBlobs, nil
+}
@@ -0,0 +1,257 @@
+package image
+
+import (
+	"context"
+	"csm.cloud.image.scale/config/properties"
+	"csm.cloud.image.scale/domain"
+	"csm.cloud.image.scale/image/model"
+	"csm.cloud.image.scale/storage"
+	"github.com/stretchr/testify/assert"
+	"path"
+	"testing"
+)
+
+type fakeImageErasedEventProducer struct {
+	keys   []domain.MessageKey
+	events []domain.ImageErasedEvent
+}
+
+func (f *fakeImageErasedEventProducer) Produce(_ context.Context, key domain.MessageKey, event domain.ImageErasedEvent) error {
+	f.keys = append(f.keys, key)
+	f.events = append(f.events, event)
+	return nil
+}
+
+type testErasure struct {
+	service          ErasureService
+	producer         *fakeImageErasedEventProducer
+	projectBlobStore storage.BlobStore
+	userBlobStore    storage.BlobStore
+	derivedBlobStore storage.BlobStore
+}
+
+func newTestErasure(t *testing.T) *testErasure {
+	newLocalBlobStore := func(containerName string) storage.BlobStore {
+		return storage.NewLocalBlobStore(properties.StorageProperties{
+			Type:          storage.BlobStoreTypeLocal,
+			ContainerName: containerName,
+			Local:         properties.LocalStorageProperties{Directory: t.TempDir()},
+		})
+	}
+	erasure := &testErasure{
+		producer:         &fakeImageErasedEventProducer{},
+		projectBlobStore: newLocalBlobStore("csm"),
+		userBlobStore:    newLocalBlobStore("csm"),
+		derivedBlobStore: newLocalBlobStore("csm-derived"),
+	}
+	erasure.service = NewErasureService(properties.ErasureProperties{}, erasure.projectBlobStore, erasure.userBlobStore, erasure.derivedBlobStore, erasure.producer, nil)
+	return erasure
+}
+
+// Uploads the blobs written by the processor (and a cached variant of the resize api) for the project image
+func (e *testErasure) uploadProjectImage(t *testing.T, image model.Image) {
+	content := []byte("image")
+	parent := image.GetParentIdentifier()
+	owner := image.GetOwnerIdentifier()
+	for _, kind := range []string{"small", "fullhd", "original"} {
+		assert.Nil(t, e.projectBlobStore.UploadBlob("project/image/"+kind+"/"+parent, owner, &content, nil, contentTypeJpeg))
+	}
+	assert.Nil(t, e.projectBlobStore.UploadBlob("project/image/tiles/"+parent+"/"+owner, tilesManifestFileName, &content, nil, contentTypeDzi))
+	assert.Nil(t, e.derivedBlobStore.UploadBlob("project/image/derived/"+parent+"/"+owner, "64x64-cover.webp", &content, nil, "image/webp"))
+	referencePath, referenceName := referenceOf(image)
+	assert.Nil(t, e.projectBlobStore.UploadBlob(referencePath, referenceName, &[]byte{}, nil, contentTypeReference))
+}
+
+func (e *testErasure) exists(blobStore storage.BlobStore, blobName string) bool {
+	_, err := blobStore.GetBlobProperties(path.Dir(blobName), path.Base(blobName))
+	return err == nil
+}
+
+func projectKey(aggregateType string, identifier string) domain.MessageKey {
+	return domain.MessageKey{
+		RootContextIdentifier: "project1",
+		AggregateIdentifier:   domain.AggregateIdentifier{Identifier: identifier, Version: 3, Type: aggregateType},
+	}
+}
+
+var (
+	testProjectPicture    = &model.ProjectPicture{ProjectIdentifier: "project1", ProjectPictureIdentifier: "picture1"}
+	testTaskAttachment    = &model.TaskAttachment{ProjectIdentifier: "project1", TaskIdentifier: "task1", TaskAttachmentIdentifier: "attachment1"}
+	testTopicAttachment   = &model.TopicAttachment{ProjectIdentifier: "project1", TaskIdentifier: "task1", TopicIdentifier: "topic1", TopicAttachmentIdentifier: "attachment2"}
+	testMessageAttachment = &model.MessageAttachment{ProjectIdentifier: "project1", TaskIdentifier: "task1", TopicIdentifier: "topic1", MessageIdentifier: "message1", MessageAttachmentIdentifier: "attachment3"}
+)
+
+func TestReferenceOf_NamedByIdentifiersFromProjectToOwner(t *testing.T) {
+
+	// execute and verify
+	for image, expected := range map[model.Image]string{
+		testProjectPicture:    "project/image/references/project1/picture1",
+		testTaskAttachment:    "project/image/references/project1/task1/attachment1",
+		testTopicAttachment:   "project/image/references/project1/task1/topic1/attachment2",
+		testMessageAttachment: "project/image/references/project1/task1/topic1/message1/attachment3",
+	} {
+		referencePath, referenceName := referenceOf(image)
+		assert.Equal(t, expected, path.Join(referencePath, referenceName))
+	}
+}
+
+func TestErasureService_ErasesImagesOfDeletedTopicOnly(t *testing.T) {
+
+	// prepare
+	erasure := newTestErasure(t)
+	erasure.uploadProjectImage(t, testTaskAttachment)
+	erasure.uploadProjectImage(t, testTopicAttachment)
+	erasure.uploadProjectImage(t, testMessageAttachment)
+	key := projectKey(AggregateTypeTopic, "topic1")
+
+	// execute
+	err := erasure.service.Erase(context.Background(), key)
+
+	// verify
+	assert.Nil(t, err)
+	assert.False(t, erasure.exists(erasure.projectBlobStore, "project/image/original/task1/attachment2"))
+	assert.False(t, erasure.exists(erasure.projectBlobStore, "project/image/tiles/task1/attachment3/image.dzi"))
+	assert.False(t, erasure.exists(erasure.derivedBlobStore, "project/image/derived/task1/attachment3/64x64-cover.webp"))
+	assert.False(t, erasure.exists(erasure.projectBlobStore, "project/image/references/project1/task1/topic1/message1/attachment3"))
+	assert.True(t, erasure.exists(erasure.projectBlobStore, "project/image/original/task1/attachment1"), "Images of the task should be kept")
+	assert.Equal(t, []domain.MessageKey{key}, erasure.producer.keys)
+	assert.Equal(t, []domain.ImageErasedEvent{{
+		Identifier:            "topic1",
+		Type:                  AggregateTypeTopic,
+		RootContextIdentifier: "project1",
+		DeletedBlobs:          12,
+		Complete:              false,
+	}}, erasure.producer.events)
+}
+
+func TestErasureService_ConfirmsErasureOfTopicOnceAllImagesHaveReferences(t *testing.T) {
+
+	// prepare
+	erasure := newTestErasure(t)
+	erasure.service = NewErasureService(properties.ErasureProperties{ReferencesComplete: true},
+		erasure.projectBlobStore, erasure.userBlobStore, erasure.derivedBlobStore, erasure.producer, nil)
+
+	// execute
+	err := erasure.service.Erase(context.Background(), projectKey(AggregateTypeTopic, "topic1"))
+
+	// verify
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), erasure.producer.events[0].DeletedBlobs)
+	assert.True(t, erasure.producer.events[0].Complete)
+}
+
+func TestErasureService_ErasesImagesOfDeletedProjectIncludingTasks(t *testing.T) {
+
+	// prepare
+	erasure := newTestErasure(t)
+	erasure.uploadProjectImage(t, testProjectPicture)
+	erasure.uploadProjectImage(t, testMessageAttachment)
+	assert.Nil(t, erasure.projectBlobStore.UploadBlob("project/image/phash/project1/0-0/f0f0f0f0f0f0f0f0", "picture1", &[]byte{}, nil, contentTypeIndexEntry))
+	otherProject := []byte("image")
+	assert.Nil(t, erasure.projectBlobStore.UploadBlob("project/image/original/project2", "picture2", &otherProject, nil, contentTypeJpeg))
+
+	// execute
+	err := erasure.service.Erase(context.Background(), projectKey(AggregateTypeProject, "project1"))
+
+	// verify
+	assert.Nil(t, err)
+	projectBlobs, err := erasure.projectBlobStore.ListBlobs("project/")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"project/image/original/project2/picture2"}, projectBlobs)
+	derivedBlobs, err := erasure.derivedBlobStore.ListBlobs("project/")
+	assert.Nil(t, err)
+	assert.Empty(t, derivedBlobs)
+	assert.Equal(t, int64(13), erasure.producer.events[0].DeletedBlobs)
+	assert.False(t, erasure.producer.events[0].Complete, "Images of tasks without references may remain")
+}
+
+func TestErasureService_ErasesImagesOfDeletedTaskWithoutReferences(t *testing.T) {
+
+	// prepare
+	erasure := newTestErasure(t)
+	content := []byte("image")
+	assert.Nil(t, erasure.projectBlobStore.UploadBlob("project/image/small/task1", "attachment1", &content, nil, contentTypeJpeg))
+
+	// execute
+	err := erasure.service.Erase(context.Background(), projectKey(AggregateTypeTask, "task1"))
+
+	// verify
+	assert.Nil(t, err)
+	assert.False(t, erasure.exists(erasure.projectBlobStore, "project/image/small/task1/attachment1"))
+	assert.Equal(t, int64(1), erasure.producer.events[0].DeletedBlobs)
+	assert.True(t, erasure.producer.events[0].Complete)
+}
+
+func TestErasureService_RemovesErasedImagesFromDuplicateIndex(t *testing.T) {
+	for aggregateType, identifier := range map[string]string{AggregateTypeTask: "task1", AggregateTypeTopic: "topic1"} {
+		t.Run(aggregateType, func(t *testing.T) {
+
+			// prepare
+			erasure := newTestErasure(t)
+			duplicateIndex := NewDuplicateIndex(properties.DuplicateDetectionProperties{Enabled: true}, erasure.projectBlobStore)
+			erasure.service = NewErasureService(properties.ErasureProperties{}, erasure.projectBlobStore, erasure.userBlobStore,
+				erasure.derivedBlobStore, erasure.producer, &duplicateIndex)
+			hash := PerceptualHash(0xf0f0f0f0f0f0f0f0)
+			perceptualHash := hash.String()
+			content := []byte("image")
+			assert.Nil(t, erasure.projectBlobStore.UploadBlob("project/image/original/task1", "attachment2", &content,
+				map[string]*string{"perceptual_hash": &perceptualHash}, contentTypeJpeg))
+			referencePath, referenceName := referenceOf(testTopicAttachment)
+			assert.Nil(t, erasure.projectBlobStore.UploadBlob(referencePath, referenceName, &[]byte{}, nil, contentTypeReference))
+			_, err := duplicateIndex.Register("project1", "attachment2", hash)
+			assert.Nil(t, err)
+
+			// execute
+			err = erasure.service.Erase(context.Background(), projectKey(aggregateType, identifier))
+
+			// verify
+			assert.Nil(t, err)
+			indexBlobs, err := erasure.projectBlobStore.ListBlobs(duplicateIndexPrefixOf("project1"))
+			assert.Nil(t, err)
+			assert.Equal(t, []string{erasedPrefixOf("project1") + "/attachment2"}, indexBlobs)
+			duplicateOf, err := duplicateIndex.Register("project1", "attachment4", hash)
+			assert.Nil(t, err)
+			assert.Empty(t, duplicateOf)
+		})
+	}
+}
+
+func TestErasureService_ErasesImagesOfDeletedUser(t *testing.T) {
+
+	// prepare
+	erasure := newTestErasure(t)
+	content := []byte("image")
+	assert.Nil(t, erasure.userBlobStore.UploadBlob("user/image/small/user1", "picture1", &content, nil, contentTypeJpeg))
+	assert.Nil(t, erasure.userBlobStore.UploadBlob("user/image/original/user1", "picture1", &content, nil, contentTypeJpeg))
+	assert.Nil(t, erasure.userBlobStore.UploadBlob("user/image/original/user2", "picture2", &content, nil, contentTypeJpeg))
+	key := domain.MessageKey{
+		RootContextIdentifier: "user1",
+		AggregateIdentifier:   domain.AggregateIdentifier{Identifier: "user1", Version: 2, Type: AggregateTypeUser},
+	}
+
+	// execute
+	err := erasure.service.Erase(context.Background(), key)
+
+	// verify
+	assert.Nil(t, err)
+	userBlobs, err := erasure.userBlobStore.ListBlobs("user/")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"user/image/original/user2/picture2"}, userBlobs)
+	assert.Equal(t, int64(2), erasure.producer.events[0].DeletedBlobs)
+	assert.True(t, erasure.producer.events[0].Complete)
+}
+
+func TestErasureService_IgnoresOtherAggregateTypes(t *testing.T) {
+
+	// prepare
+	erasure := newTestErasure(t)
+	erasure.uploadProjectImage(t, testTaskAttachment)
+
+	// execute
+	err := erasure.service.Erase(context.Background(), projectKey("WORKAREA", "task1"))
+
+	// verify
+	assert.Nil(t, err)
+	assert.True(t, erasure.exists(erasure.projectBlobStore, "project/image/original/task1/attachment1"))
+	assert.Empty(t, erasure.producer.events)
+}
@@ -0,0 +1,86 @@
+package image
+
+import (
+	"fmt"
+	goimage "image"
+	"math/bits"
+	"strconv"
+)
+
+const (
+	// The image is reduced to 9x8 gray values, comparing horizontal neighbours results in 64 bits
+	dHashWidth  = 9
+	dHashHeight = 8
+)
+
+/*
+PerceptualHash is the difference hash (dHash) of an image. Similar images (e.g. the same photo re-encoded or
+scaled differently) have hashes with a small Hamming distance.
+*/
+type PerceptualHash uint64
+
+/*
+NewPerceptualHash computes the difference hash of a decoded image (e.g. the small variant). Each bit is set if
+a gray value of the reduced image is brighter than its right neighbour.
+*/
+func NewPerceptualHash(image goimage.Image) PerceptualHash {
+	gray := reduceToGray(image, dHashWidth, dHashHeight)
+
+	var hash PerceptualHash
+	for y := 0; y < dHashHeight; y++ {
+		for x := 0; x < dHashWidth-1; x++ {
+			hash <<= 1
+			if gray[y][x] > gray[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+/*
+ParsePerceptualHash parses the hex representation returned by String
+*/
+func ParsePerceptualHash(value string) (PerceptualHash, error) {
+	hash, err := strconv.ParseUint(value, 16, 64)
+	return PerceptualHash(hash), err
+}
+
+/*
+Distance returns the Hamming distance (the number of different bits) of both hashes, 0 for identical images
+*/
+func (h PerceptualHash) Distance(other PerceptualHash) int {
+	return bits.OnesCount64(uint64(h ^ other))
+}
+
+func (h PerceptualHash) String() string {
+	return fmt.Sprintf("%016x", uint64(h))
+}
+
+// Reduce the image to the given size by averaging the luminance of the covered pixels
+func reduceToGray(image goimage.Image, width int, height int) [][]float64 {
+	bounds := image.Bounds()
+	gray := make([][]float64, height)
+	for y := 0; y < height; y++ {
+		gray[y] = make([]float64, width)
+		minY := bounds.Min.Y + y*bounds.Dy()/height
+		maxY := max(bounds.Min.Y+(y+1)*bounds.Dy()/height, minY+1)
+		for x := 0; x < width; x++ {
+			minX := bounds.Min.X + x*bounds.Dx()/width
+			maxX := max(bounds.Min.X+(x+1)*bounds.Dx()/width, minX+1)
+
+			sum, count := 0.0, 0
+			for py := minY; py < maxY && py < bounds.Max.Y; py++ {
+				for px := minX; px < maxX && px < bounds.Max.X; px++ {
+					r, g, b, _ := image.At(px, py).RGBA()
+					sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+					count++
+				}
+			}
+			if count > 0 {
+				gray[y][x] = sum / float64(count)
+			}
+		}
+	}
+	return gray
+}
@@ -0,0 +1,48 @@
+package image
+
+import (
+	"github.com/stretchr/testify/assert"
+	"image/color"
+	"testing"
+)
+
+func diagonalGradient(x int, y int) color.Color {
+	return color.RGBA{R: uint8((x + y) * 2), G: uint8(x * 3), B: uint8(y * 3), A: 255}
+}
+
+func TestNewPerceptualHash_SimilarForScaledImage(t *testing.T) {
+
+	// prepare
+	original := createTestImage(t, 80, 64, diagonalGradient)
+	scaled := createTestImage(t, 40, 32, func(x int, y int) color.Color {
+		return diagonalGradient(x*2, y*2)
+	})
+	inverted := createTestImage(t, 80, 64, func(x int, y int) color.Color {
+		return diagonalGradient(79-x, 63-y)
+	})
+
+	// execute
+	originalHash := NewPerceptualHash(original)
+	scaledHash := NewPerceptualHash(scaled)
+	invertedHash := NewPerceptualHash(inverted)
+
+	// verify
+	assert.LessOrEqual(t, originalHash.Distance(scaledHash), 4)
+	assert.Greater(t, originalHash.Distance(invertedHash), 32)
+}
+
+func TestPerceptualHash_StringAndParse(t *testing.T) {
+
+	// prepare
+	hash := PerceptualHash(0x00ff00ff00ff00ff)
+
+	// execute
+	parsed, err := ParsePerceptualHash(hash.String())
+
+	// verify
+	assert.Nil(t, err)
+	assert.Equal(t, "00ff00ff00ff00ff", hash.String())
+	assert.Equal(t, hash, parsed)
+	assert.Equal(t, 0, hash.Distance(parsed))
+	assert.Equal(t, 64, hash.Distance(^hash))
+}
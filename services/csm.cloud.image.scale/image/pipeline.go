@@ -0,0 +1,134 @@
+package image
+
+import (
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/metrics"
+	"github.com/davidbyttow/govips/v2/vips"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	VariantFullHd = "fullhd"
+	VariantSmall  = "small"
+
+	// Exif fields of the original (e.g. the capture time) kept for the stages, the blob "exif-data" isn't needed
+	exifFieldPrefix = "exif-ifd"
+)
+
+/*
+Variant is a scaled image generated by ScaleImageFileToVariants, the stages are applied to this variant only
+*/
+type Variant struct {
+	Name           string
+	SizeProperties ImageSizeProperties
+	Stages         []ImageStage
+}
+
+/*
+ScaledVariants contains the exported variants by name
+*/
+type ScaledVariants struct {
+	Images map[string]*[]byte
+	// Number of frames of the original, greater than 1 for animations (gif or webp, the variants contain the first
+	// frame only)
+	Frames int
+}
+
+/*
+ScaleImageFileToVariants decodes the image file only once and generates all variants from the decoded image.
+libvips shrinks the image while reading the file to the size needed by the largest variant (crops included), so
+the full resolution original is never held in memory. The variants are generated from largest to smallest in a single
+scale slot and exported as jpeg.
+*/
+func ScaleImageFileToVariants(file string, variants ...Variant) (*ScaledVariants, error) {
+	defer acquireScaleSlot(scaleSlots)()
+
+	base, frames, err := decodeForVariants(file, variants)
+	if err != nil {
+		return nil, err
+	}
+	defer base.Close()
+
+	// Generate the largest variant first, the smaller ones are cheaper and benefit from the warm cache of libvips
+	ordered := make([]Variant, len(variants))
+	copy(ordered, variants)
+	sort.SliceStable(ordered, func(a, b int) bool {
+		return longestSideOf(ordered[a].SizeProperties) > longestSideOf(ordered[b].SizeProperties)
+	})
+
+	images := make(map[string]*[]byte, len(ordered))
+	for _, variant := range ordered {
+		image, err := scaleVariant(base, variant)
+		if err != nil {
+			return nil, err
+		}
+		images[variant.Name] = image
+	}
+	return &ScaledVariants{Images: images, Frames: frames}, nil
+}
+
+/*
+decodeForVariants loads the image shrunk to cover the bounding box of all variants. The loaded image is read
+sequentially from the file and can only be evaluated once, therefore it is kept uncompressed in memory. Only the
+first frame of animations is loaded, the number of frames of the file is returned.
+*/
+func decodeForVariants(file string, variants []Variant) (*vips.ImageRef, int, error) {
+	width, height := 0, 0
+	for _, variant := range variants {
+		width = max(width, variant.SizeProperties.GetWidth())
+		height = max(height, variant.SizeProperties.GetHeight())
+	}
+
+	// Cover the bounding box so that cropped variants keep their resolution, smaller images aren't enlarged
+	loaded, err := vips.LoadThumbnailFromFile(file, width, height, vips.InterestingAll, vips.SizeDown, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer loaded.Close()
+
+	buffer, _, err := loaded.ExportTiff(&vips.TiffExportParams{Compression: vips.TiffCompressionNone})
+	if err != nil {
+		return nil, 0, err
+	}
+	base, err := vips.NewImageFromBuffer(buffer)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Restore the exif fields, tiff doesn't keep them
+	for _, field := range loaded.ImageFields() {
+		if strings.HasPrefix(field, exifFieldPrefix) {
+			base.SetString(field, loaded.GetAsString(field))
+		}
+	}
+	return base, framesOf(loaded), nil
+}
+
+func scaleVariant(base *vips.ImageRef, variant Variant) (*[]byte, error) {
+	defer metrics.ObserveScaleDuration(variant.Name, time.Now())
+
+	image, err := base.Copy()
+	if err != nil {
+		return nil, err
+	}
+	defer image.Close()
+
+	sizeProperties := variant.SizeProperties
+	err = image.ThumbnailWithSize(sizeProperties.GetWidth(), sizeProperties.GetHeight(), sizeProperties.GetInteresting(), vips.SizeBoth)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, stage := range variant.Stages {
+		if err = stage(image); err != nil {
+			return nil, err
+		}
+	}
+
+	return export(image, FormatJpeg)
+}
+
+func longestSideOf(sizeProperties ImageSizeProperties) int {
+	return max(sizeProperties.GetWidth(), sizeProperties.GetHeight())
+}
@@ -0,0 +1,105 @@
+//go:build vips
+
+package image
+
+import (
+	"bytes"
+	"github.com/davidbyttow/govips/v2/vips"
+	goimage "image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The benchmarks need libvips and are excluded from the default build. The peak memory of libvips is a high-water
+// mark of the process, therefore run each benchmark in its own process with scripts/benchmark-report.sh.
+
+var (
+	// Peak memory of libvips after startup, the benchmarks report their peak above it
+	vipsStartupPeak int64
+	// Name of the benchmark the peak memory of this process belongs to
+	vipsPeakBenchmark string
+)
+
+func TestMain(m *testing.M) {
+	vips.LoggingSettings(nil, vips.LogLevelWarning)
+	vips.Startup(nil)
+	stats := vips.MemoryStats{}
+	vips.ReadVipsMemStats(&stats)
+	vipsStartupPeak = stats.MemHigh
+	code := m.Run()
+	vips.Shutdown()
+	os.Exit(code)
+}
+
+/*
+BenchmarkScaleImage_DecodePerVariant measures the path before the pipeline: the original is read into memory and
+ScaleImage decodes it in full resolution (and rotates it) for each variant.
+*/
+func BenchmarkScaleImage_DecodePerVariant(b *testing.B) {
+	file := createBenchmarkJpeg(b, 6000, 4000)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		buffer, err := os.ReadFile(file)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err = ScaleImage(&buffer, &PreviewImageSizeProperties); err != nil {
+			b.Fatal(err)
+		}
+		if _, err = ScaleImage(&buffer, &SmallImageSizeProperties); err != nil {
+			b.Fatal(err)
+		}
+	}
+	reportVipsMemory(b)
+}
+
+func BenchmarkScaleImageFileToVariants_SingleDecode(b *testing.B) {
+	file := createBenchmarkJpeg(b, 6000, 4000)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		_, err := ScaleImageFileToVariants(file,
+			Variant{Name: VariantFullHd, SizeProperties: &PreviewImageSizeProperties},
+			Variant{Name: VariantSmall, SizeProperties: &SmallImageSizeProperties})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	reportVipsMemory(b)
+}
+
+/*
+reportVipsMemory reports the peak memory of libvips above the startup peak, it isn't allocated by go and not covered
+by -benchmem. The peak can't be reset, so it is omitted for further benchmarks run in the same process.
+*/
+func reportVipsMemory(b *testing.B) {
+	if vipsPeakBenchmark != "" && vipsPeakBenchmark != b.Name() {
+		b.Logf("vips-peak-MB omitted, the peak of %s can't be reset (run each benchmark in its own process)", vipsPeakBenchmark)
+		return
+	}
+	vipsPeakBenchmark = b.Name()
+
+	stats := vips.MemoryStats{}
+	vips.ReadVipsMemStats(&stats)
+	b.ReportMetric(float64(stats.MemHigh-vipsStartupPeak)/(1024*1024), "vips-peak-MB")
+}
+
+func createBenchmarkJpeg(b *testing.B, width int, height int) string {
+	image := goimage.NewRGBA(goimage.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			image.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: uint8(x + y), A: 255})
+		}
+	}
+	buffer := bytes.Buffer{}
+	if err := jpeg.Encode(&buffer, image, &jpeg.Options{Quality: 90}); err != nil {
+		b.Fatal(err)
+	}
+	file := filepath.Join(b.TempDir(), "original.jpg")
+	if err := os.WriteFile(file, buffer.Bytes(), 0600); err != nil {
+		b.Fatal(err)
+	}
+	return file
+}
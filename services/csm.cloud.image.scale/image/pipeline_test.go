@@ -0,0 +1,107 @@
+package image
+
+import (
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	goimage "image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Exif orientation rotating the stored image by 90° clockwise for display
+const exifOrientationRotate90 = 6
+
+/*
+withExifOrientation inserts an APP1 segment with the exif orientation after the start of image marker of the jpeg
+*/
+func withExifOrientation(content *[]byte, orientation uint16) *[]byte {
+	// Big endian tiff header with a single ifd entry: orientation (0x0112), short, count 1
+	exif := []byte("Exif\x00\x00MM\x00\x2a\x00\x00\x00\x08\x00\x01\x01\x12\x00\x03\x00\x00\x00\x01\x00\x00\x00\x00\x00\x00\x00\x00")
+	binary.BigEndian.PutUint16(exif[24:], orientation)
+	return withJpegSegment(content, 0xe1, exif)
+}
+
+// Inserts the application segment (e.g. 0xe1 for exif) after the start of image marker of the jpeg
+func withJpegSegment(content *[]byte, marker byte, data []byte) *[]byte {
+	segment := []byte{0xff, marker, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(data)+2))
+
+	result := append([]byte{}, (*content)[:2]...)
+	result = append(result, segment...)
+	result = append(result, data...)
+	result = append(result, (*content)[2:]...)
+	return &result
+}
+
+// Returns the mean absolute difference of the color channels (0-255) of two images of the same size
+func meanDifferenceOf(a goimage.Image, b goimage.Image) float64 {
+	bounds := a.Bounds()
+	difference := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r1, g1, b1, _ := a.At(x, y).RGBA()
+			r2, g2, b2, _ := b.At(x, y).RGBA()
+			difference += abs(int(r1>>8)-int(r2>>8)) + abs(int(g1>>8)-int(g2>>8)) + abs(int(b1>>8)-int(b2>>8))
+		}
+	}
+	return float64(difference) / float64(3*bounds.Dx()*bounds.Dy())
+}
+
+func abs(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
+
+func TestScaleImageFileToVariants_MatchesScaleImage(t *testing.T) {
+
+	// prepare
+	startupTestVips()
+	// Stored landscape with a red left and a blue right half, displayed as portrait with red on top
+	content := withExifOrientation(createTestJpeg(t, 800, 600, func(x int, y int) color.Color {
+		if x < 400 {
+			return color.RGBA{R: 255, A: 255}
+		}
+		return color.RGBA{B: 255, A: 255}
+	}), exifOrientationRotate90)
+	file := filepath.Join(t.TempDir(), "original.jpg")
+	assert.Nil(t, os.WriteFile(file, *content, 0600))
+
+	// execute
+	scaled, err := ScaleImageFileToVariants(file,
+		Variant{Name: VariantFullHd, SizeProperties: &PreviewImageSizeProperties},
+		Variant{Name: VariantSmall, SizeProperties: &SmallImageSizeProperties})
+
+	// verify
+	assert.Nil(t, err)
+	assert.Equal(t, 1, scaled.Frames)
+	for name, sizeProperties := range map[string]ImageSizeProperties{
+		VariantFullHd: &PreviewImageSizeProperties,
+		VariantSmall:  &SmallImageSizeProperties,
+	} {
+		expectedContent, err := ScaleImage(content, sizeProperties)
+		assert.Nil(t, err)
+		expected, err := DecodeJpeg(expectedContent)
+		assert.Nil(t, err)
+		variant, err := DecodeJpeg(scaled.Images[name])
+		assert.Nil(t, err)
+
+		assert.Equal(t, expected.Bounds(), variant.Bounds(), "Variant %s should have the size of ScaleImage", name)
+		assert.Less(t, meanDifferenceOf(expected, variant), 8.0, "Variant %s should have the crop of ScaleImage", name)
+
+		// The exif orientation is applied, red is on top
+		top, _, _, _ := variant.At(variant.Bounds().Dx()/2, variant.Bounds().Dy()/8).RGBA()
+		bottom, _, _, _ := variant.At(variant.Bounds().Dx()/2, variant.Bounds().Dy()*7/8).RGBA()
+		assert.Greater(t, top>>8, uint32(200), "Variant %s should be rotated", name)
+		assert.Less(t, bottom>>8, uint32(55), "Variant %s should be rotated", name)
+	}
+	fullHd, err := DecodeJpeg(scaled.Images[VariantFullHd])
+	assert.Nil(t, err)
+	assert.Equal(t, goimage.Rect(0, 0, 1440, 1920), fullHd.Bounds(), "The portrait should fit into 1920x1920")
+	small, err := DecodeJpeg(scaled.Images[VariantSmall])
+	assert.Nil(t, err)
+	assert.Equal(t, goimage.Rect(0, 0, 250, 250), small.Bounds())
+}
@@ -0,0 +1,94 @@
+package image
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/buckket/go-blurhash"
+	goimage "image"
+	_ "image/jpeg"
+)
+
+const (
+	// Components of the longer side of the image, BlurHash supports 1 to 9
+	blurHashComponentsLong = 4
+	// Components of the shorter side of the image
+	blurHashComponentsShort = 3
+)
+
+/*
+Placeholder is shown by clients while the thumbnail is loading: the BlurHash (https://blurha.sh) of the image
+and its dominant color as hex RGB (e.g. #7f6a55).
+*/
+type Placeholder struct {
+	BlurHash      string
+	DominantColor string
+}
+
+/*
+NewPlaceholder computes the placeholder of a decoded image (e.g. the small variant). The computation doesn't use
+libvips, so the image should be small to keep it cheap.
+*/
+func NewPlaceholder(image goimage.Image) (*Placeholder, error) {
+
+	// Use more components along the longer side so that the blur follows the image ratio
+	xComponents, yComponents := blurHashComponentsLong, blurHashComponentsShort
+	if image.Bounds().Dy() > image.Bounds().Dx() {
+		xComponents, yComponents = blurHashComponentsShort, blurHashComponentsLong
+	}
+	hash, err := blurhash.Encode(xComponents, yComponents, image)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Placeholder{
+		BlurHash:      hash,
+		DominantColor: dominantColorOf(image),
+	}, nil
+}
+
+/*
+DecodeJpeg decodes a scaled jpeg image (without libvips) to analyze it
+*/
+func DecodeJpeg(content *[]byte) (goimage.Image, error) {
+	image, _, err := goimage.Decode(bytes.NewReader(*content))
+	return image, err
+}
+
+/*
+dominantColorOf returns the mean color of the most frequent color bucket. Colors are reduced to 4 bits per channel
+for counting, so that slightly different shades count as the same color.
+*/
+func dominantColorOf(image goimage.Image) string {
+	type bucket struct {
+		count   int
+		r, g, b int
+	}
+	buckets := make(map[uint32]*bucket)
+	var dominant *bucket
+
+	bounds := image.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r32, g32, b32, _ := image.At(x, y).RGBA()
+			r, g, b := int(r32>>8), int(g32>>8), int(b32>>8)
+			key := uint32(r>>4)<<8 | uint32(g>>4)<<4 | uint32(b>>4)
+			current, exists := buckets[key]
+			if !exists {
+				current = &bucket{}
+				buckets[key] = current
+			}
+			current.count++
+			current.r += r
+			current.g += g
+			current.b += b
+			if dominant == nil || current.count > dominant.count {
+				dominant = current
+			}
+		}
+	}
+
+	if dominant == nil {
+		return "#000000"
+	}
+	return fmt.Sprintf("#%02x%02x%02x", dominant.r/dominant.count, dominant.g/dominant.count, dominant.b/dominant.count)
+}
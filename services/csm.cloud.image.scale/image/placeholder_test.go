@@ -0,0 +1,77 @@
+package image
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	goimage "image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+func createTestImage(t *testing.T, width int, height int, colorAt func(x int, y int) color.Color) goimage.Image {
+	image, err := DecodeJpeg(createTestJpeg(t, width, height, colorAt))
+	assert.Nil(t, err)
+	return image
+}
+
+func createTestJpeg(t *testing.T, width int, height int, colorAt func(x int, y int) color.Color) *[]byte {
+	image := goimage.NewRGBA(goimage.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			image.Set(x, y, colorAt(x, y))
+		}
+	}
+	buffer := bytes.Buffer{}
+	assert.Nil(t, jpeg.Encode(&buffer, image, &jpeg.Options{Quality: 100}))
+	content := buffer.Bytes()
+	return &content
+}
+
+func TestNewPlaceholder_DominantColor(t *testing.T) {
+
+	// prepare (three quarters blue, one quarter red)
+	image := createTestImage(t, 64, 32, func(x int, y int) color.Color {
+		if x < 16 {
+			return color.RGBA{R: 200, A: 255}
+		}
+		return color.RGBA{B: 200, A: 255}
+	})
+
+	// execute
+	placeholder, err := NewPlaceholder(image)
+
+	// verify
+	assert.Nil(t, err)
+	assert.Equal(t, "#0000c8", placeholder.DominantColor)
+}
+
+func TestNewPlaceholder_BlurHashFollowsRatio(t *testing.T) {
+
+	// prepare
+	gradient := func(x int, y int) color.Color {
+		return color.RGBA{R: uint8(x * 4), G: uint8(y * 4), B: 100, A: 255}
+	}
+
+	// execute
+	landscape, landscapeErr := NewPlaceholder(createTestImage(t, 60, 40, gradient))
+	portrait, portraitErr := NewPlaceholder(createTestImage(t, 40, 60, gradient))
+
+	// verify (the first character encodes the components, (x - 1) + (y - 1) * 9)
+	assert.Nil(t, landscapeErr)
+	assert.Nil(t, portraitErr)
+	assert.Equal(t, byte('L'), landscape.BlurHash[0])
+	assert.Equal(t, byte('T'), portrait.BlurHash[0])
+}
+
+func TestDecodeJpeg_FailsForInvalidImage(t *testing.T) {
+
+	// prepare
+	content := []byte("no image")
+
+	// execute
+	_, err := DecodeJpeg(&content)
+
+	// verify
+	assert.NotNil(t, err)
+}
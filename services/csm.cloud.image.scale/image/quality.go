@@ -0,0 +1,120 @@
+package image
+
+import (
+	goimage "image"
+)
+
+const (
+	// Percentiles of the luminance histogram the contrast is measured between, outliers (e.g. specular highlights)
+	// don't count
+	contrastLowPercentile  = 0.05
+	contrastHighPercentile = 0.95
+)
+
+/*
+Quality contains indicators to detect unusable photos (e.g. motion-blurred, black or pocket shots). The indicators
+depend on the resolution and are computed from the fullhd variant.
+*/
+type Quality struct {
+	// Variance of the Laplacian of the luminance, blurred images have few edges and a low variance
+	Sharpness float64
+	// Mean luminance from 0 (black) to 1 (white)
+	Brightness float64
+	// Spread of the luminance histogram (5th to 95th percentile) from 0 (single gray value) to 1
+	Contrast float64
+}
+
+/*
+NewQuality computes the quality indicators of a decoded image
+*/
+func NewQuality(image goimage.Image) *Quality {
+	luminance, width, height := luminanceOf(image)
+	if width == 0 || height == 0 {
+		return &Quality{}
+	}
+
+	var histogram [256]int
+	sum := 0
+	for _, value := range luminance {
+		histogram[value]++
+		sum += int(value)
+	}
+	pixels := len(luminance)
+
+	return &Quality{
+		Sharpness:  laplacianVariance(luminance, width, height),
+		Brightness: float64(sum) / float64(pixels) / 255,
+		Contrast: float64(percentileOf(histogram, pixels, contrastHighPercentile)-
+			percentileOf(histogram, pixels, contrastLowPercentile)) / 255,
+	}
+}
+
+/*
+cropBottom removes the given number of rows from the bottom of the image (e.g. the bar of the watermark)
+*/
+func cropBottom(image goimage.Image, rows int) goimage.Image {
+	subImager, ok := image.(interface {
+		SubImage(r goimage.Rectangle) goimage.Image
+	})
+	bounds := image.Bounds()
+	if !ok || rows <= 0 || rows >= bounds.Dy() {
+		return image
+	}
+	return subImager.SubImage(goimage.Rect(bounds.Min.X, bounds.Min.Y, bounds.Max.X, bounds.Max.Y-rows))
+}
+
+// Returns the luminance (0 to 255) of the pixels row by row, decoded jpegs provide it directly
+func luminanceOf(image goimage.Image) ([]uint8, int, int) {
+	bounds := image.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	luminance := make([]uint8, 0, width*height)
+
+	if ycbcr, ok := image.(*goimage.YCbCr); ok {
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			offset := ycbcr.YOffset(bounds.Min.X, y)
+			luminance = append(luminance, ycbcr.Y[offset:offset+width]...)
+		}
+		return luminance, width, height
+	}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := image.At(x, y).RGBA()
+			luminance = append(luminance, uint8((0.299*float64(r)+0.587*float64(g)+0.114*float64(b))/257))
+		}
+	}
+	return luminance, width, height
+}
+
+// Variance of the 4-neighbour Laplacian over the inner pixels
+func laplacianVariance(luminance []uint8, width int, height int) float64 {
+	if width < 3 || height < 3 {
+		return 0
+	}
+
+	sum, sumOfSquares := 0.0, 0.0
+	for y := 1; y < height-1; y++ {
+		for x := 1; x < width-1; x++ {
+			index := y*width + x
+			laplacian := float64(luminance[index-width]) + float64(luminance[index+width]) +
+				float64(luminance[index-1]) + float64(luminance[index+1]) - 4*float64(luminance[index])
+			sum += laplacian
+			sumOfSquares += laplacian * laplacian
+		}
+	}
+	count := float64((width - 2) * (height - 2))
+	mean := sum / count
+	return sumOfSquares/count - mean*mean
+}
+
+func percentileOf(histogram [256]int, pixels int, percentile float64) int {
+	threshold := int(percentile * float64(pixels))
+	cumulated := 0
+	for value, count := range histogram {
+		cumulated += count
+		if cumulated > threshold {
+			return value
+		}
+	}
+	return len(histogram) - 1
+}
@@ -0,0 +1,91 @@
+package image
+
+import (
+	"github.com/stretchr/testify/assert"
+	goimage "image"
+	"image/color"
+	"testing"
+)
+
+func TestNewQuality_SharpImageHasHigherSharpnessThanBlurredImage(t *testing.T) {
+
+	// prepare (a checkerboard of 2px squares and a smooth gradient)
+	sharp := createTestImage(t, 64, 64, func(x int, y int) color.Color {
+		if (x/2+y/2)%2 == 0 {
+			return color.Gray{Y: 255}
+		}
+		return color.Gray{}
+	})
+	blurred := createTestImage(t, 64, 64, func(x int, y int) color.Color {
+		return color.Gray{Y: uint8(x * 4)}
+	})
+
+	// execute
+	sharpQuality := NewQuality(sharp)
+	blurredQuality := NewQuality(blurred)
+
+	// verify
+	assert.Greater(t, sharpQuality.Sharpness, 100*blurredQuality.Sharpness)
+}
+
+func TestNewQuality_BrightnessAndContrast(t *testing.T) {
+
+	// prepare
+	black := createTestImage(t, 32, 32, func(x int, y int) color.Color {
+		return color.Gray{}
+	})
+	halfWhite := createTestImage(t, 32, 32, func(x int, y int) color.Color {
+		if x < 16 {
+			return color.Gray{}
+		}
+		return color.Gray{Y: 255}
+	})
+
+	// execute
+	blackQuality := NewQuality(black)
+	halfWhiteQuality := NewQuality(halfWhite)
+
+	// verify (decoded jpegs deviate slightly from the encoded values)
+	assert.InDelta(t, 0, blackQuality.Brightness, 0.01)
+	assert.InDelta(t, 0, blackQuality.Contrast, 0.01)
+	assert.InDelta(t, 0, blackQuality.Sharpness, 0.01)
+	assert.InDelta(t, 0.5, halfWhiteQuality.Brightness, 0.02)
+	assert.InDelta(t, 1, halfWhiteQuality.Contrast, 0.02)
+}
+
+func TestNewQuality_ComputesLuminanceOfOtherImageTypes(t *testing.T) {
+
+	// prepare
+	image := goimage.NewRGBA(goimage.Rect(0, 0, 8, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			image.Set(x, y, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+		}
+	}
+
+	// execute
+	quality := NewQuality(image)
+
+	// verify
+	assert.InDelta(t, 1, quality.Brightness, 0.01)
+	assert.Equal(t, 0.0, quality.Contrast)
+}
+
+func TestCropBottom_RemovesWatermarkBar(t *testing.T) {
+
+	// prepare (a white image with a black bar below)
+	image := createTestImage(t, 64, 64+watermarkBarHeight, func(x int, y int) color.Color {
+		if y >= 64 {
+			return color.Gray{}
+		}
+		return color.Gray{Y: 255}
+	})
+
+	// execute
+	cropped := cropBottom(image, watermarkBarHeight)
+
+	// verify
+	assert.Equal(t, goimage.Rect(0, 0, 64, 64), cropped.Bounds())
+	assert.Greater(t, NewQuality(cropped).Brightness, 0.95)
+	assert.Equal(t, image, cropBottom(image, 0))
+}
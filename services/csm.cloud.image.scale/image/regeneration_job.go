@@ -0,0 +1,384 @@
+package image
+
+import (
+	"csm.cloud.image.scale/storage"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Checkpoints of the regeneration job, containing the name of the last regenerated original
+	regenerationCheckpointPath = "project/image/regeneration"
+	contentTypeCheckpoint      = "text/plain"
+
+	// Project pictures are stored by their project, which identifies them without reference, user pictures are
+	// stored in the user blob store
+	ownerTypeProjectPicture = "PROJECT_PICTURE"
+	ownerTypeUserPicture    = "USER_PICTURE"
+)
+
+/*
+RegenerationOptions controls which originals are regenerated and how fast
+*/
+type RegenerationOptions struct {
+	// Log the images to regenerate without downloading, scaling and uploading them
+	DryRun bool
+	// Minimum interval between two originals, 0 doesn't limit the rate
+	Interval time.Duration
+	// Name of the checkpoint to resume from and to update, empty to regenerate all originals
+	Checkpoint string
+	// Regenerate the images of this project only (user pictures are skipped), all projects if empty
+	ProjectIdentifier string
+	// Regenerate the images of these owner types only (e.g. TASK_ATTACHMENT), all owner types if empty
+	OwnerTypes []string
+}
+
+/*
+RegenerationResult counts the originals by outcome, skipped originals don't match the owner types or lack the
+project identifier needed for the watermark
+*/
+type RegenerationResult struct {
+	Regenerated int
+	Skipped     int
+	Failed      int
+}
+
+/*
+RegenerationJob scales the stored originals again and replaces their small and fullhd images and tile pyramids, e.g.
+after the sizes or the quality of the variants changed. The variants are generated by the same pipeline (including
+watermark and animation) as by the consumer and uploaded with the metadata of the original, the placeholder and the
+perceptual hash are computed again from the new small image.
+*/
+type RegenerationJob struct {
+	projectBlobStore storage.BlobStore
+	userBlobStore    storage.BlobStore
+	watermark        *Watermark
+	animation        *Animation
+	tilePyramid      *TilePyramid
+	scaleImageFile   func(file string, variants ...Variant) (*ScaledVariants, error)
+}
+
+/*
+NewRegenerationJob creates the regeneration job, the tile pyramid is nil if the tiles are disabled
+*/
+func NewRegenerationJob(projectBlobStore storage.BlobStore, userBlobStore storage.BlobStore, watermark *Watermark, animation *Animation, tilePyramid *TilePyramid) RegenerationJob {
+	return RegenerationJob{
+		projectBlobStore: projectBlobStore,
+		userBlobStore:    userBlobStore,
+		watermark:        watermark,
+		animation:        animation,
+		tilePyramid:      tilePyramid,
+		scaleImageFile:   ScaleImageFileToVariants,
+	}
+}
+
+// Original stored below {boundedContext}/image/original/{parent}/{owner}
+type storedOriginal struct {
+	blobStore      storage.BlobStore
+	boundedContext string
+	parent         string
+	owner          string
+	name           string
+}
+
+/*
+Run regenerates the originals in the order of their names, listed page by page after the checkpoint. Originals failing
+to regenerate are logged and counted, the checkpoint only advances up to the first failure so that resuming retries it.
+*/
+func (r *RegenerationJob) Run(options RegenerationOptions) (*RegenerationResult, error) {
+	checkpoint, err := r.readCheckpoint(options.Checkpoint)
+	if err != nil {
+		return nil, err
+	}
+	projects, err := r.projectsByOwner(options.ProjectIdentifier)
+	if err != nil {
+		return nil, err
+	}
+	if checkpoint != "" {
+		log.Info().Msg(fmt.Sprintf("Resume regeneration after %s", checkpoint))
+	}
+
+	var ticker *time.Ticker
+	if options.Interval > 0 {
+		ticker = time.NewTicker(options.Interval)
+		defer ticker.Stop()
+	}
+
+	result := &RegenerationResult{}
+	checkpointed := true
+	err = r.walkOriginals(options, projects, checkpoint, func(original storedOriginal) error {
+		if ticker != nil {
+			<-ticker.C
+		}
+
+		regenerated, err := r.regenerate(original, projects, options.OwnerTypes, options.DryRun)
+		switch {
+		case err != nil:
+			log.Warn().Msg(fmt.Sprintf("Regenerating image %s failed: %s", original.name, err.Error()))
+			result.Failed++
+			checkpointed = false
+		case regenerated:
+			result.Regenerated++
+		default:
+			result.Skipped++
+		}
+
+		if checkpointed && !options.DryRun && options.Checkpoint != "" {
+			return r.writeCheckpoint(options.Checkpoint, original.name)
+		}
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	log.Info().Msg(fmt.Sprintf("Regenerated %d images, skipped %d and failed %d (dry run: %t)",
+		result.Regenerated, result.Skipped, result.Failed, options.DryRun))
+	return result, nil
+}
+
+/*
+regenerate scales the original and uploads the variants, returns false if the original is skipped
+*/
+func (r *RegenerationJob) regenerate(original storedOriginal, projects map[string]string, ownerTypes []string, dryRun bool) (bool, error) {
+	originalPath := path.Dir(original.name)
+	properties, err := original.blobStore.GetBlobProperties(originalPath, original.owner)
+	if err != nil {
+		return false, err
+	}
+	ownerType := valueOrEmpty(properties.Metadata["owner_type"])
+	if len(ownerTypes) > 0 && !slices.Contains(ownerTypes, ownerType) {
+		return false, nil
+	}
+
+	// The watermark contains the project identifier, which is only known from the reference (or the project picture)
+	isProjectImage := original.boundedContext == BoundedContextProject
+	watermarked := isProjectImage && r.watermark.AppliesTo(ownerType)
+	projectIdentifier := projects[original.owner]
+	if projectIdentifier == "" && ownerType == ownerTypeProjectPicture {
+		projectIdentifier = original.parent
+	}
+	if watermarked && projectIdentifier == "" {
+		log.Warn().Msg(fmt.Sprintf("Skip image %s, the project of the watermark is unknown", original.name))
+		return false, nil
+	}
+
+	if dryRun {
+		log.Info().Msg(fmt.Sprintf("Regenerate image %s (dry run)", original.name))
+		return true, nil
+	}
+
+	blob, err := storage.DownloadToTemporaryFile(original.blobStore, originalPath, original.owner)
+	if err != nil {
+		return false, err
+	}
+	defer blob.Remove()
+
+	// Scale full (project images only) and small image from a single decode of the original
+	variants := []Variant{{Name: VariantSmall, SizeProperties: &SmallImageSizeProperties}}
+	if isProjectImage {
+		var stages []ImageStage
+		if watermarked {
+			timezone := valueOrEmpty(blob.Metadata["timezone"])
+			stages = []ImageStage{r.watermark.Stage(projectIdentifier, timezone, blob.LastModified)}
+		}
+		variants = append(variants, Variant{Name: VariantFullHd, SizeProperties: &PreviewImageSizeProperties, Stages: stages})
+	}
+	scaled, err := r.scaleImageFile(blob.File, variants...)
+	if err != nil {
+		return false, err
+	}
+	animation := r.animate(original, ownerType, blob.File, scaled.Frames)
+
+	// Keep the metadata of the original with the file name of the variants and the analysis of the new small image
+	fileName := original.owner
+	if originalFileName := blob.Metadata["filename"]; originalFileName != nil {
+		fileName = *originalFileName
+	}
+	metadata := withFileName(blob.Metadata, fileNameAsJpg(fileName))
+	r.analyze(original, scaled.Images[VariantSmall], metadata)
+	if animated := animatedOf(animation); animated != nil {
+		animatedValue := strconv.FormatBool(*animated)
+		metadata["animated"] = &animatedValue
+	}
+	smallContent, smallContentType := smallImageOf(scaled.Images[VariantSmall], animation)
+
+	uploads := []func() error{
+		func() error {
+			return original.blobStore.UploadBlob(fmt.Sprintf("%s/image/small/%s", original.boundedContext, original.parent), original.owner, smallContent, metadata, smallContentType)
+		},
+	}
+	if isProjectImage {
+		uploads = append(uploads, func() error {
+			return original.blobStore.UploadBlob(fmt.Sprintf("%s/image/fullhd/%s", original.boundedContext, original.parent), original.owner, scaled.Images[VariantFullHd], metadata, contentTypeJpeg)
+		})
+	}
+	if err = uploadConcurrently(uploads...); err != nil {
+		return false, err
+	}
+
+	// Replace the tile pyramid of large project images (the tiles are uploaded to the same path again)
+	if isProjectImage {
+		if _, err = r.tilePyramid.Generate(blob.File, original.parent, original.owner); err != nil {
+			return false, err
+		}
+	}
+	log.Info().Msg(fmt.Sprintf("Regenerated image %s", original.name))
+	return true, nil
+}
+
+/*
+analyze replaces the placeholder and the perceptual hash copied from the original by those of the new small image.
+They are removed if the small image can't be decoded, like the consumer doesn't write them in that case.
+*/
+func (r *RegenerationJob) analyze(original storedOriginal, smallImage *[]byte, metadata map[string]*string) {
+	for _, key := range []string{"blurhash", "dominant_color", "perceptual_hash"} {
+		delete(metadata, key)
+	}
+	decodedImage, err := DecodeJpeg(smallImage)
+	if err != nil {
+		log.Warn().Msg(fmt.Sprintf("Decoding small image of %s failed: %s", original.name, err.Error()))
+		return
+	}
+
+	placeholder, err := NewPlaceholder(decodedImage)
+	if err != nil {
+		log.Warn().Msg(fmt.Sprintf("Computing placeholder of image %s failed: %s", original.name, err.Error()))
+	} else {
+		metadata["blurhash"] = &placeholder.BlurHash
+		metadata["dominant_color"] = &placeholder.DominantColor
+	}
+	perceptualHash := NewPerceptualHash(decodedImage).String()
+	metadata["perceptual_hash"] = &perceptualHash
+}
+
+/*
+animate scales all frames of animated originals like the consumer, the first frame is used if that isn't possible
+*/
+func (r *RegenerationJob) animate(original storedOriginal, ownerType string, file string, frames int) *AnimatedImage {
+	if frames <= 1 {
+		return nil
+	}
+	if !r.animation.AppliesTo(ownerType, frames) {
+		return &AnimatedImage{}
+	}
+	content, err := r.animation.Scale(file, &SmallImageSizeProperties)
+	if err != nil {
+		log.Warn().Msg(fmt.Sprintf("Scaling animation of image %s failed, using the first frame: %s", original.name, err.Error()))
+		return &AnimatedImage{}
+	}
+	if content == nil {
+		return &AnimatedImage{}
+	}
+	return &AnimatedImage{Content: content, ContentType: r.animation.ContentType()}
+}
+
+/*
+walkOriginals passes the originals of the project and user blob store after the given name to the function in the
+order of their names, the blobs are listed page by page. Only the originals of the project (by parent or reference)
+are passed if a project is given, user pictures only if their owner type is requested.
+*/
+func (r *RegenerationJob) walkOriginals(options RegenerationOptions, projects map[string]string, startAfter string, walkFn func(original storedOriginal) error) error {
+	// Project blob names sort before user blob names, both are in the order of the checkpoint therefore
+	boundedContexts := []string{BoundedContextProject}
+	if options.ProjectIdentifier == "" && (len(options.OwnerTypes) == 0 || slices.Contains(options.OwnerTypes, ownerTypeUserPicture)) {
+		boundedContexts = append(boundedContexts, BoundedContextUser)
+	}
+
+	for _, boundedContext := range boundedContexts {
+		blobStore := r.projectBlobStore
+		if boundedContext == BoundedContextUser {
+			blobStore = r.userBlobStore
+		}
+		prefix := fmt.Sprintf("%s/image/original/", boundedContext)
+		err := blobStore.WalkBlobs(prefix, startAfter, func(blobNames []string) error {
+			for _, blobName := range blobNames {
+				identifiers := strings.Split(strings.TrimPrefix(blobName, prefix), "/")
+				if len(identifiers) != 2 {
+					continue
+				}
+				parent, owner := identifiers[0], identifiers[1]
+				if options.ProjectIdentifier != "" && parent != options.ProjectIdentifier && projects[owner] != options.ProjectIdentifier {
+					continue
+				}
+				err := walkFn(storedOriginal{
+					blobStore:      blobStore,
+					boundedContext: boundedContext,
+					parent:         parent,
+					owner:          owner,
+					name:           blobName,
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+projectsByOwner maps the owners of project images to their project by the references (of the project, if given). The
+map is only needed to filter by project and for the watermark, it is empty otherwise.
+*/
+func (r *RegenerationJob) projectsByOwner(projectIdentifier string) (map[string]string, error) {
+	projects := make(map[string]string)
+	if projectIdentifier == "" && r.watermark == nil {
+		return projects, nil
+	}
+
+	prefix := referencesPath + "/"
+	if projectIdentifier != "" {
+		prefix = fmt.Sprintf("%s%s/", prefix, projectIdentifier)
+	}
+	err := r.projectBlobStore.WalkBlobs(prefix, "", func(references []string) error {
+		for _, reference := range references {
+			identifiers := strings.Split(strings.TrimPrefix(reference, referencesPath+"/"), "/")
+			if len(identifiers) < 2 {
+				continue
+			}
+			projects[identifiers[len(identifiers)-1]] = identifiers[0]
+		}
+		return nil
+	})
+	return projects, err
+}
+
+/*
+readCheckpoint returns the name of the last regenerated original, empty if there is no checkpoint (yet)
+*/
+func (r *RegenerationJob) readCheckpoint(checkpoint string) (string, error) {
+	if checkpoint == "" {
+		return "", nil
+	}
+	blob, err := r.projectBlobStore.DownloadBlob(regenerationCheckpointPath, checkpoint)
+	if errors.Is(err, storage.ErrBlobNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(blob.Buffer)), nil
+}
+
+func (r *RegenerationJob) writeCheckpoint(checkpoint string, blobName string) error {
+	content := []byte(blobName)
+	return r.projectBlobStore.UploadBlob(regenerationCheckpointPath, checkpoint, &content, nil, contentTypeCheckpoint)
+}
+
+func valueOrEmpty(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
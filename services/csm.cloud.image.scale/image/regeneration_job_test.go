@@ -0,0 +1,251 @@
+package image
+
+import (
+	"csm.cloud.image.scale/config/properties"
+	"csm.cloud.image.scale/storage"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"image/color"
+	"testing"
+)
+
+type testRegeneration struct {
+	job              *RegenerationJob
+	projectBlobStore storage.BlobStore
+	userBlobStore    storage.BlobStore
+	// Number of stages of the scaled variants by variant name
+	stages map[string]int
+}
+
+func newTestRegeneration(t *testing.T, watermark *Watermark) *testRegeneration {
+	newLocalBlobStore := func(containerName string) storage.BlobStore {
+		return storage.NewLocalBlobStore(properties.StorageProperties{
+			Type:          storage.BlobStoreTypeLocal,
+			ContainerName: containerName,
+			Local:         properties.LocalStorageProperties{Directory: t.TempDir()},
+		})
+	}
+	regeneration := &testRegeneration{
+		projectBlobStore: newLocalBlobStore("csm"),
+		userBlobStore:    newLocalBlobStore("csm"),
+		stages:           make(map[string]int),
+	}
+	job := NewRegenerationJob(regeneration.projectBlobStore, regeneration.userBlobStore, watermark, nil, nil)
+
+	// Scaling requires libvips, the stub returns the variant name as content
+	job.scaleImageFile = func(file string, variants ...Variant) (*ScaledVariants, error) {
+		images := make(map[string]*[]byte, len(variants))
+		for _, variant := range variants {
+			content := []byte(variant.Name)
+			images[variant.Name] = &content
+			regeneration.stages[variant.Name] = len(variant.Stages)
+		}
+		return &ScaledVariants{Images: images, Frames: 1}, nil
+	}
+	regeneration.job = &job
+	return regeneration
+}
+
+// Uploads an original with the metadata written by the processor
+func (r *testRegeneration) uploadOriginal(t *testing.T, blobStore storage.BlobStore, boundedContext string, parent string, owner string, ownerType string) {
+	content := []byte("original")
+	fileName := "photo.png"
+	timezone := "Europe/Berlin"
+	blurHash := "LEHV6nWB2yk8"
+	metadata := map[string]*string{
+		"filename":         &fileName,
+		"timezone":         &timezone,
+		"owner_identifier": &owner,
+		"owner_type":       &ownerType,
+		"blurhash":         &blurHash,
+	}
+	assert.Nil(t, blobStore.UploadBlob(boundedContext+"/image/original/"+parent, owner, &content, metadata, "image/png"))
+}
+
+func (r *testRegeneration) content(blobStore storage.BlobStore, path string, fileName string) string {
+	blob, err := blobStore.DownloadBlob(path, fileName)
+	if err != nil {
+		return ""
+	}
+	return string(blob.Buffer)
+}
+
+func TestRegenerationJob_RegeneratesVariantsWithMetadataOfOriginal(t *testing.T) {
+
+	// prepare
+	regeneration := newTestRegeneration(t, nil)
+	regeneration.uploadOriginal(t, regeneration.projectBlobStore, BoundedContextProject, "task1", "attachment1", "TASK_ATTACHMENT")
+	regeneration.uploadOriginal(t, regeneration.userBlobStore, BoundedContextUser, "user1", "picture1", ownerTypeUserPicture)
+
+	// execute
+	result, err := regeneration.job.Run(RegenerationOptions{Checkpoint: "sizes"})
+
+	// verify
+	assert.Nil(t, err)
+	assert.Equal(t, &RegenerationResult{Regenerated: 2}, result)
+	assert.Equal(t, VariantSmall, regeneration.content(regeneration.projectBlobStore, "project/image/small/task1", "attachment1"))
+	assert.Equal(t, VariantFullHd, regeneration.content(regeneration.projectBlobStore, "project/image/fullhd/task1", "attachment1"))
+	assert.Equal(t, VariantSmall, regeneration.content(regeneration.userBlobStore, "user/image/small/user1", "picture1"))
+	assert.Equal(t, "", regeneration.content(regeneration.userBlobStore, "user/image/fullhd/user1", "picture1"))
+
+	small, err := regeneration.projectBlobStore.GetBlobProperties("project/image/small/task1", "attachment1")
+	assert.Nil(t, err)
+	assert.Equal(t, "photo.jpg", *small.Metadata["filename"])
+	assert.Nil(t, small.Metadata["blurhash"], "Placeholder of the original should be dropped if the small image can't be decoded")
+	assert.Equal(t, "TASK_ATTACHMENT", *small.Metadata["owner_type"])
+	assert.Equal(t, "user/image/original/user1/picture1", regeneration.content(regeneration.projectBlobStore, regenerationCheckpointPath, "sizes"))
+}
+
+func TestRegenerationJob_ResumesAfterCheckpoint(t *testing.T) {
+
+	// prepare
+	regeneration := newTestRegeneration(t, nil)
+	regeneration.uploadOriginal(t, regeneration.projectBlobStore, BoundedContextProject, "task1", "attachment1", "TASK_ATTACHMENT")
+	regeneration.uploadOriginal(t, regeneration.projectBlobStore, BoundedContextProject, "task1", "attachment2", "TASK_ATTACHMENT")
+	checkpoint := []byte("project/image/original/task1/attachment1")
+	assert.Nil(t, regeneration.projectBlobStore.UploadBlob(regenerationCheckpointPath, "sizes", &checkpoint, nil, contentTypeCheckpoint))
+
+	// execute
+	result, err := regeneration.job.Run(RegenerationOptions{Checkpoint: "sizes"})
+
+	// verify
+	assert.Nil(t, err)
+	assert.Equal(t, &RegenerationResult{Regenerated: 1}, result)
+	assert.Equal(t, "", regeneration.content(regeneration.projectBlobStore, "project/image/small/task1", "attachment1"))
+	assert.Equal(t, VariantSmall, regeneration.content(regeneration.projectBlobStore, "project/image/small/task1", "attachment2"))
+}
+
+func TestRegenerationJob_DryRunUploadsNothing(t *testing.T) {
+
+	// prepare
+	regeneration := newTestRegeneration(t, nil)
+	regeneration.uploadOriginal(t, regeneration.projectBlobStore, BoundedContextProject, "task1", "attachment1", "TASK_ATTACHMENT")
+
+	// execute
+	result, err := regeneration.job.Run(RegenerationOptions{DryRun: true, Checkpoint: "sizes"})
+
+	// verify
+	assert.Nil(t, err)
+	assert.Equal(t, &RegenerationResult{Regenerated: 1}, result)
+	blobNames, err := regeneration.projectBlobStore.ListBlobs("project/")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"project/image/original/task1/attachment1"}, blobNames)
+}
+
+func TestRegenerationJob_FiltersByProjectAndOwnerType(t *testing.T) {
+
+	// prepare
+	regeneration := newTestRegeneration(t, nil)
+	regeneration.uploadOriginal(t, regeneration.projectBlobStore, BoundedContextProject, "project1", "picture1", ownerTypeProjectPicture)
+	regeneration.uploadOriginal(t, regeneration.projectBlobStore, BoundedContextProject, "task1", "attachment1", "TASK_ATTACHMENT")
+	regeneration.uploadOriginal(t, regeneration.projectBlobStore, BoundedContextProject, "task1", "attachment2", "TOPIC_ATTACHMENT")
+	regeneration.uploadOriginal(t, regeneration.projectBlobStore, BoundedContextProject, "task2", "attachment3", "TASK_ATTACHMENT")
+	regeneration.uploadOriginal(t, regeneration.userBlobStore, BoundedContextUser, "user1", "picture2", ownerTypeUserPicture)
+	for _, reference := range []string{"project1/task1/attachment1", "project1/task1/topic1/attachment2", "project2/task2/attachment3"} {
+		assert.Nil(t, regeneration.projectBlobStore.UploadBlob(referencesPath, reference, &[]byte{}, nil, contentTypeReference))
+	}
+
+	// execute
+	result, err := regeneration.job.Run(RegenerationOptions{ProjectIdentifier: "project1", OwnerTypes: []string{"TASK_ATTACHMENT"}})
+
+	// verify
+	assert.Nil(t, err)
+	assert.Equal(t, &RegenerationResult{Regenerated: 1, Skipped: 2}, result)
+	assert.Equal(t, VariantSmall, regeneration.content(regeneration.projectBlobStore, "project/image/small/task1", "attachment1"))
+	assert.Equal(t, "", regeneration.content(regeneration.projectBlobStore, "project/image/small/task2", "attachment3"))
+	assert.Equal(t, "", regeneration.content(regeneration.userBlobStore, "user/image/small/user1", "picture2"))
+}
+
+func TestRegenerationJob_WatermarksWithProjectOfReference(t *testing.T) {
+
+	// prepare
+	regeneration := newTestRegeneration(t, NewWatermark(properties.WatermarkProperties{OwnerTypes: []string{"TASK_ATTACHMENT"}}))
+	regeneration.uploadOriginal(t, regeneration.projectBlobStore, BoundedContextProject, "task1", "attachment1", "TASK_ATTACHMENT")
+	regeneration.uploadOriginal(t, regeneration.projectBlobStore, BoundedContextProject, "task2", "attachment2", "TASK_ATTACHMENT")
+	assert.Nil(t, regeneration.projectBlobStore.UploadBlob(referencesPath+"/project1/task1", "attachment1", &[]byte{}, nil, contentTypeReference))
+
+	// execute
+	result, err := regeneration.job.Run(RegenerationOptions{})
+
+	// verify
+	assert.Nil(t, err)
+	assert.Equal(t, &RegenerationResult{Regenerated: 1, Skipped: 1}, result, "Images without reference can't be watermarked")
+	assert.Equal(t, 1, regeneration.stages[VariantFullHd])
+	assert.Equal(t, 0, regeneration.stages[VariantSmall])
+	assert.Equal(t, "", regeneration.content(regeneration.projectBlobStore, "project/image/fullhd/task2", "attachment2"))
+}
+
+func TestRegenerationJob_CheckpointStopsAtFirstFailure(t *testing.T) {
+
+	// prepare
+	regeneration := newTestRegeneration(t, nil)
+	regeneration.uploadOriginal(t, regeneration.projectBlobStore, BoundedContextProject, "task1", "attachment1", "TASK_ATTACHMENT")
+	regeneration.uploadOriginal(t, regeneration.projectBlobStore, BoundedContextProject, "task1", "attachment2", "TASK_ATTACHMENT")
+	regeneration.uploadOriginal(t, regeneration.projectBlobStore, BoundedContextProject, "task1", "attachment3", "TASK_ATTACHMENT")
+	scaleImageFile := regeneration.job.scaleImageFile
+	scales := 0
+	regeneration.job.scaleImageFile = func(file string, variants ...Variant) (*ScaledVariants, error) {
+		scales++
+		if scales == 2 {
+			return nil, errors.New("corrupt image")
+		}
+		return scaleImageFile(file, variants...)
+	}
+
+	// execute
+	result, err := regeneration.job.Run(RegenerationOptions{Checkpoint: "sizes"})
+
+	// verify
+	assert.Nil(t, err)
+	assert.Equal(t, &RegenerationResult{Regenerated: 2, Failed: 1}, result)
+	assert.Equal(t, "project/image/original/task1/attachment1", regeneration.content(regeneration.projectBlobStore, regenerationCheckpointPath, "sizes"))
+}
+
+func TestRegenerationJob_RecomputesPlaceholderAndPerceptualHash(t *testing.T) {
+
+	// prepare
+	regeneration := newTestRegeneration(t, nil)
+	regeneration.uploadOriginal(t, regeneration.projectBlobStore, BoundedContextProject, "task1", "attachment1", "TASK_ATTACHMENT")
+	smallImage := createTestJpeg(t, 32, 32, func(x int, y int) color.Color {
+		return color.RGBA{R: 255, A: 255}
+	})
+	regeneration.job.scaleImageFile = func(file string, variants ...Variant) (*ScaledVariants, error) {
+		return &ScaledVariants{Images: map[string]*[]byte{VariantSmall: smallImage, VariantFullHd: smallImage}, Frames: 1}, nil
+	}
+
+	// execute
+	result, err := regeneration.job.Run(RegenerationOptions{})
+
+	// verify
+	assert.Nil(t, err)
+	assert.Equal(t, &RegenerationResult{Regenerated: 1}, result)
+	small, err := regeneration.projectBlobStore.GetBlobProperties("project/image/small/task1", "attachment1")
+	assert.Nil(t, err)
+	decodedImage, err := DecodeJpeg(smallImage)
+	assert.Nil(t, err)
+	placeholder, err := NewPlaceholder(decodedImage)
+	assert.Nil(t, err)
+	assert.Equal(t, placeholder.BlurHash, *small.Metadata["blurhash"])
+	assert.Equal(t, placeholder.DominantColor, *small.Metadata["dominant_color"])
+	assert.Equal(t, NewPerceptualHash(decodedImage).String(), *small.Metadata["perceptual_hash"])
+}
+
+func TestRegenerationJob_RegeneratesTilesOfLargeProjectImages(t *testing.T) {
+
+	// prepare
+	regeneration := newTestRegeneration(t, nil)
+	regeneration.uploadOriginal(t, regeneration.projectBlobStore, BoundedContextProject, "task1", "attachment1", "TASK_ATTACHMENT")
+	regeneration.uploadOriginal(t, regeneration.userBlobStore, BoundedContextUser, "user1", "picture1", ownerTypeUserPicture)
+	commands := &fakeVipsCommands{width: "20000", height: "14000", dzsaveFn: writeTestPyramid}
+	regeneration.job.tilePyramid = NewTilePyramid(properties.TilesProperties{Enabled: true}, properties.ImageProperties{}, regeneration.projectBlobStore)
+	regeneration.job.tilePyramid.runCommand = commands.run
+
+	// execute
+	result, err := regeneration.job.Run(RegenerationOptions{})
+
+	// verify
+	assert.Nil(t, err)
+	assert.Equal(t, &RegenerationResult{Regenerated: 2}, result)
+	assert.Len(t, commands.dzsave, 1, "User pictures have no tiles")
+	assert.Equal(t, "image.dzi", regeneration.content(regeneration.projectBlobStore, "project/image/tiles/task1/attachment1", "image.dzi"))
+}
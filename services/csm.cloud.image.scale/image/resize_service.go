@@ -0,0 +1,163 @@
+package image
+
+import (
+	"context"
+	"csm.cloud.image.scale/storage"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/datadog"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/metrics"
+	"errors"
+	"fmt"
+	"github.com/davidbyttow/govips/v2/vips"
+	"github.com/rs/zerolog/log"
+	"time"
+)
+
+const (
+	BoundedContextProject = "project"
+	BoundedContextUser    = "user"
+)
+
+/*
+ImageFit defines how an image is fitted into the requested size
+*/
+type ImageFit string
+
+const (
+	// Preserve the ratio, width and height are the maximum size
+	FitInside ImageFit = "inside"
+	// Fill the requested size, cutting the edges away
+	FitCover ImageFit = "cover"
+	// Fill the requested size, keeping the most interesting part of the image
+	FitAttention ImageFit = "attention"
+)
+
+// Metadata key of the derived variant referencing the version of the original it was scaled from
+const originalETagMetadataKey = "original_etag"
+
+// ErrUnsupportedBoundedContext is returned for originals of other bounded contexts than project and user
+var ErrUnsupportedBoundedContext = errors.New("unsupported bounded context")
+
+/*
+ResizeRequest identifies the original image (as stored by the ImageScalingProcessor) and the requested variant
+*/
+type ResizeRequest struct {
+	BoundedContext   string
+	ParentIdentifier string
+	OwnerIdentifier  string
+	Width            int
+	Height           int
+	Fit              ImageFit
+	Format           ImageFormat
+}
+
+type ResizedImage struct {
+	Content     []byte
+	ContentType string
+}
+
+/*
+ResizeService scales originals to sizes requested on demand. The variants are cached in the derived blob store and
+scaled again if the original changed since.
+*/
+type ResizeService struct {
+	projectBlobStore storage.BlobStore
+	userBlobStore    storage.BlobStore
+	derivedBlobStore storage.BlobStore
+	scaleImageFile   func(file string, sizeProperties ImageSizeProperties, format ImageFormat) (*[]byte, error)
+}
+
+func NewResizeService(projectBlobStore storage.BlobStore, userBlobStore storage.BlobStore, derivedBlobStore storage.BlobStore) ResizeService {
+	return ResizeService{
+		projectBlobStore: projectBlobStore,
+		userBlobStore:    userBlobStore,
+		derivedBlobStore: derivedBlobStore,
+		scaleImageFile:   ScaleImageFileAs,
+	}
+}
+
+/*
+Resize returns the requested variant of the original, storage.ErrBlobNotFound is returned if the original doesn't exist.
+*/
+func (r *ResizeService) Resize(tracingContext context.Context, request ResizeRequest) (*ResizedImage, error) {
+	originalBlobStore, err := r.originalBlobStoreOf(request.BoundedContext)
+	if err != nil {
+		return nil, err
+	}
+	originalPath := fmt.Sprintf("%s/image/original/%s", request.BoundedContext, request.ParentIdentifier)
+	derivedPath := fmt.Sprintf("%s/image/derived/%s/%s", request.BoundedContext, request.ParentIdentifier, request.OwnerIdentifier)
+	variant := request.variantName()
+
+	// Get the version of the original
+	original, err := datadog.TraceWithContext(tracingContext, "getOriginalProperties", func() (*storage.BlobProperties, error) {
+		return originalBlobStore.GetBlobProperties(originalPath, request.OwnerIdentifier)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Respond with the cached variant if it was scaled from the current original
+	cached, err := datadog.TraceWithContext(tracingContext, "downloadDerivedImage", func() (*storage.Blob, error) {
+		return r.derivedBlobStore.DownloadBlob(derivedPath, variant)
+	})
+	if err == nil && cached.Metadata[originalETagMetadataKey] != nil && *cached.Metadata[originalETagMetadataKey] == original.ETag {
+		return &ResizedImage{Content: cached.Buffer, ContentType: request.Format.ContentType()}, nil
+	}
+	if err != nil && !errors.Is(err, storage.ErrBlobNotFound) {
+		log.Warn().Msg(fmt.Sprintf("Reading cached image %s/%s failed: %s", derivedPath, variant, err.Error()))
+	}
+
+	// Scale the original
+	blob, err := datadog.TraceWithContext(tracingContext, "downloadOriginalImage", func() (*storage.DownloadedBlob, error) {
+		return storage.DownloadToTemporaryFile(originalBlobStore, originalPath, request.OwnerIdentifier)
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer blob.Remove()
+	sizeProperties := NewImageSizeProperties(request.Width, request.Height, request.Fit.interesting())
+	scaled, err := datadog.TraceWithContext(tracingContext, "scaleOnDemand", func() (*[]byte, error) {
+		defer metrics.ObserveScaleDuration("ondemand", time.Now())
+		return r.scaleImageFile(blob.File, &sizeProperties, request.Format)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Cache the variant, the scaled image is returned even if caching fails
+	metadata := map[string]*string{originalETagMetadataKey: &blob.ETag}
+	_, err = datadog.TraceWithContext(tracingContext, "uploadDerivedImage", func() (any, error) {
+		return nil, r.derivedBlobStore.UploadBlob(derivedPath, variant, scaled, metadata, request.Format.ContentType())
+	})
+	if err != nil {
+		log.Warn().Msg(fmt.Sprintf("Caching image %s/%s failed: %s", derivedPath, variant, err.Error()))
+	}
+
+	return &ResizedImage{Content: *scaled, ContentType: request.Format.ContentType()}, nil
+}
+
+func (r *ResizeService) originalBlobStoreOf(boundedContext string) (storage.BlobStore, error) {
+	switch boundedContext {
+	case BoundedContextProject:
+		return r.projectBlobStore, nil
+	case BoundedContextUser:
+		return r.userBlobStore, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedBoundedContext, boundedContext)
+	}
+}
+
+// File name of the variant in the derived blob store, e.g. 64x64-cover.jpeg
+func (r ResizeRequest) variantName() string {
+	return fmt.Sprintf("%dx%d-%s.%s", r.Width, r.Height, r.Fit, r.Format)
+}
+
+func (f ImageFit) interesting() vips.Interesting {
+	switch f {
+	case FitCover:
+		return vips.InterestingCentre
+	case FitAttention:
+		return vips.InterestingAttention
+	default:
+		return vips.InterestingNone
+	}
+}
@@ -0,0 +1,106 @@
+package image
+
+import (
+	"context"
+	"csm.cloud.image.scale/config/properties"
+	"csm.cloud.image.scale/storage"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func newTestResizeService(t *testing.T) (*ResizeService, storage.BlobStore, *int) {
+	newLocalBlobStore := func(containerName string) storage.BlobStore {
+		return storage.NewLocalBlobStore(properties.StorageProperties{
+			Type:          storage.BlobStoreTypeLocal,
+			ContainerName: containerName,
+			Local:         properties.LocalStorageProperties{Directory: t.TempDir()},
+		})
+	}
+	projectBlobStore := newLocalBlobStore("csm")
+	resizeService := NewResizeService(projectBlobStore, newLocalBlobStore("csm"), newLocalBlobStore("csm-derived"))
+
+	// Scaling requires libvips, the stub returns the size as content
+	scaleCount := 0
+	resizeService.scaleImageFile = func(file string, sizeProperties ImageSizeProperties, format ImageFormat) (*[]byte, error) {
+		scaleCount++
+		content := []byte(fmt.Sprintf("%dx%d.%s", sizeProperties.GetWidth(), sizeProperties.GetHeight(), format))
+		return &content, nil
+	}
+	return &resizeService, projectBlobStore, &scaleCount
+}
+
+var testResizeRequest = ResizeRequest{
+	BoundedContext:   BoundedContextProject,
+	ParentIdentifier: "1",
+	OwnerIdentifier:  "2",
+	Width:            64,
+	Height:           64,
+	Fit:              FitCover,
+	Format:           FormatWebp,
+}
+
+func TestResizeService_ScalesAndCachesVariant(t *testing.T) {
+
+	// prepare
+	resizeService, projectBlobStore, scaleCount := newTestResizeService(t)
+	original := []byte("original")
+	assert.Nil(t, projectBlobStore.UploadBlob("project/image/original/1", "2", &original, nil, "image/png"))
+
+	// execute
+	first, firstErr := resizeService.Resize(context.Background(), testResizeRequest)
+	second, secondErr := resizeService.Resize(context.Background(), testResizeRequest)
+
+	// verify
+	assert.Nil(t, firstErr)
+	assert.Nil(t, secondErr)
+	assert.Equal(t, "64x64.webp", string(first.Content))
+	assert.Equal(t, "image/webp", first.ContentType)
+	assert.Equal(t, first, second)
+	assert.Equal(t, 1, *scaleCount, "Cached variant should be returned without scaling again")
+}
+
+func TestResizeService_ScalesAgainIfOriginalChanged(t *testing.T) {
+
+	// prepare
+	resizeService, projectBlobStore, scaleCount := newTestResizeService(t)
+	original := []byte("original")
+	assert.Nil(t, projectBlobStore.UploadBlob("project/image/original/1", "2", &original, nil, "image/png"))
+	_, err := resizeService.Resize(context.Background(), testResizeRequest)
+	assert.Nil(t, err)
+	changed := []byte("changed original")
+	assert.Nil(t, projectBlobStore.UploadBlob("project/image/original/1", "2", &changed, nil, "image/png"))
+
+	// execute
+	_, err = resizeService.Resize(context.Background(), testResizeRequest)
+
+	// verify
+	assert.Nil(t, err)
+	assert.Equal(t, 2, *scaleCount)
+}
+
+func TestResizeService_OriginalNotFound(t *testing.T) {
+
+	// prepare
+	resizeService, _, _ := newTestResizeService(t)
+
+	// execute
+	_, err := resizeService.Resize(context.Background(), testResizeRequest)
+
+	// verify
+	assert.ErrorIs(t, err, storage.ErrBlobNotFound)
+}
+
+func TestResizeService_UnsupportedBoundedContext(t *testing.T) {
+
+	// prepare
+	resizeService, _, _ := newTestResizeService(t)
+	request := testResizeRequest
+	request.BoundedContext = "company"
+
+	// execute
+	_, err := resizeService.Resize(context.Background(), request)
+
+	// verify
+	assert.ErrorIs(t, err, ErrUnsupportedBoundedContext)
+}
@@ -1,9 +1,23 @@
 package image
 
 import (
+	"fmt"
 	"github.com/davidbyttow/govips/v2/vips"
 )
 
+/*
+ImageFormat is the format a scaled image is exported in
+*/
+type ImageFormat string
+
+const (
+	FormatJpeg ImageFormat = "jpeg"
+	FormatPng  ImageFormat = "png"
+	FormatWebp ImageFormat = "webp"
+	// Used for animations only, scaled stills aren't exported as gif
+	FormatGif ImageFormat = "gif"
+)
+
 type ImageSizeProperties interface {
 	GetHeight() int
 	GetWidth() int
@@ -28,6 +42,22 @@ var PreviewImageSizeProperties = DefaultImageSizeProperties{
 	interesting: vips.InterestingNone,
 }
 
+/*
+NewImageSizeProperties creates size properties of a custom size (e.g. requested on demand)
+*/
+func NewImageSizeProperties(width int, height int, interesting vips.Interesting) DefaultImageSizeProperties {
+	return DefaultImageSizeProperties{
+		height:      height,
+		width:       width,
+		interesting: interesting,
+	}
+}
+
+/*
+ImageStage processes the scaled image before it is exported (e.g. stamping a watermark)
+*/
+type ImageStage func(image *vips.ImageRef) error
+
 func (d *DefaultImageSizeProperties) GetHeight() int {
 	return d.height
 }
@@ -41,6 +71,8 @@ func (d *DefaultImageSizeProperties) GetInteresting() vips.Interesting {
 }
 
 func ScaleImage(buffer *[]byte, sizeProperties ImageSizeProperties) (*[]byte, error) {
+	defer acquireScaleSlot(scaleSlots)()
+
 	image, err := vips.NewImageFromBuffer(*buffer)
 	if err != nil {
 		return nil, err
@@ -58,6 +90,48 @@ func ScaleImage(buffer *[]byte, sizeProperties ImageSizeProperties) (*[]byte, er
 	return bytes, err
 }
 
+/*
+ScaleImageFile scales an image file without loading the original into memory. libvips shrinks the image while
+reading the file and applies the exif orientation like AutoRotate does for buffers. The stages are applied to the
+scaled image in the given order.
+*/
+func ScaleImageFile(file string, sizeProperties ImageSizeProperties, stages ...ImageStage) (*[]byte, error) {
+	return scaleImageFile(file, sizeProperties, FormatJpeg, stages)
+}
+
+/*
+ScaleImageFileAs scales an image file like ScaleImageFile and exports it in the given format
+*/
+func ScaleImageFileAs(file string, sizeProperties ImageSizeProperties, format ImageFormat) (*[]byte, error) {
+	return scaleImageFile(file, sizeProperties, format, nil)
+}
+
+func scaleImageFile(file string, sizeProperties ImageSizeProperties, format ImageFormat, stages []ImageStage) (*[]byte, error) {
+	defer acquireScaleSlot(scaleSlots)()
+
+	image, err := vips.LoadThumbnailFromFile(file, sizeProperties.GetWidth(), sizeProperties.GetHeight(),
+		sizeProperties.GetInteresting(), vips.SizeBoth, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer image.Close()
+
+	for _, stage := range stages {
+		if err = stage(image); err != nil {
+			return nil, err
+		}
+	}
+
+	return export(image, format)
+}
+
+/*
+ContentType returns the mime type of the format
+*/
+func (f ImageFormat) ContentType() string {
+	return "image/" + string(f)
+}
+
 func resize(image *vips.ImageRef, width int, height int, crop vips.Interesting) (*[]byte, error) {
 
 	// do resize the image
@@ -66,6 +140,35 @@ func resize(image *vips.ImageRef, width int, height int, crop vips.Interesting)
 		return nil, err
 	}
 
+	return export(image, FormatJpeg)
+}
+
+/*
+export converts the image to sRGB and exports it in the format. The metadata is stripped after the conversion, so
+images with a wide gamut profile (e.g. Adobe RGB or Display P3) don't look washed out in browsers assuming sRGB.
+*/
+func export(image *vips.ImageRef, format ImageFormat) (*[]byte, error) {
+	// Transform from the embedded profile (CMYK images without profile from a generic CMYK profile), images without
+	// profile are sRGB already. WebP gets a compact sRGB profile embedded.
+	if err := image.OptimizeICCProfile(); err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case FormatJpeg:
+		return exportJpeg(image)
+	case FormatPng:
+		return exportPng(image)
+	case FormatWebp:
+		return exportWebp(image)
+	case FormatGif:
+		return exportGif(image)
+	default:
+		return nil, fmt.Errorf("unsupported image format %q", format)
+	}
+}
+
+func exportJpeg(image *vips.ImageRef) (*[]byte, error) {
 	blob, _, err := image.ExportJpeg(&vips.JpegExportParams{
 		StripMetadata: true,
 		Quality:       90,
@@ -82,3 +185,42 @@ func resize(image *vips.ImageRef, width int, height int, crop vips.Interesting)
 
 	return &blob, nil
 }
+
+func exportPng(image *vips.ImageRef) (*[]byte, error) {
+	blob, _, err := image.ExportPng(&vips.PngExportParams{
+		StripMetadata: true,
+		Compression:   6,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &blob, nil
+}
+
+func exportWebp(image *vips.ImageRef) (*[]byte, error) {
+	blob, _, err := image.ExportWebp(&vips.WebpExportParams{
+		StripMetadata:   true,
+		Quality:         85,
+		ReductionEffort: 4,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &blob, nil
+}
+
+func exportGif(image *vips.ImageRef) (*[]byte, error) {
+	blob, _, err := image.ExportGIF(&vips.GifExportParams{
+		StripMetadata: true,
+		Quality:       75,
+		Effort:        7,
+		Bitdepth:      8,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &blob, nil
+}
@@ -0,0 +1,105 @@
+package image
+
+import (
+	"encoding/binary"
+	"github.com/davidbyttow/govips/v2/vips"
+	"github.com/stretchr/testify/assert"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// Colorants of Adobe RGB (1998) adapted to the D50 illuminant of the profile connection space
+var adobeRgbColorants = [3][3]float64{
+	{0.6097559, 0.3111145, 0.0194702},
+	{0.2052401, 0.6256714, 0.0608902},
+	{0.1492240, 0.0632141, 0.7445396},
+}
+
+/*
+newTestAdobeRgbProfile creates a minimal matrix/TRC icc profile (version 2) of Adobe RGB (1998), as embedded by
+cameras in their Adobe RGB mode
+*/
+func newTestAdobeRgbProfile() []byte {
+	xyzTag := func(x float64, y float64, z float64) []byte {
+		tag := append([]byte("XYZ "), make([]byte, 16)...)
+		for i, value := range []float64{x, y, z} {
+			binary.BigEndian.PutUint32(tag[8+4*i:], uint32(int32(math.Round(value*65536))))
+		}
+		return tag
+	}
+	description := "Adobe RGB (1998) test profile"
+	descriptionTag := append([]byte("desc"), make([]byte, 8)...)
+	binary.BigEndian.PutUint32(descriptionTag[8:], uint32(len(description)+1))
+	descriptionTag = append(descriptionTag, append([]byte(description), 0)...)
+	descriptionTag = append(descriptionTag, make([]byte, 4+4+2+1+67)...)
+	// Gamma 563/256 (2.2) as u8Fixed8, shared by the three channels
+	curveTag := append([]byte("curv"), 0, 0, 0, 0, 0, 0, 0, 1, 0x02, 0x33)
+
+	tags := []struct {
+		signature string
+		data      []byte
+	}{
+		{"desc", descriptionTag},
+		{"wtpt", xyzTag(0.9642, 1, 0.8249)},
+		{"rXYZ", xyzTag(adobeRgbColorants[0][0], adobeRgbColorants[0][1], adobeRgbColorants[0][2])},
+		{"gXYZ", xyzTag(adobeRgbColorants[1][0], adobeRgbColorants[1][1], adobeRgbColorants[1][2])},
+		{"bXYZ", xyzTag(adobeRgbColorants[2][0], adobeRgbColorants[2][1], adobeRgbColorants[2][2])},
+		{"rTRC", curveTag},
+		{"gTRC", curveTag},
+		{"bTRC", curveTag},
+	}
+
+	// Header, tag table and the tag data aligned to 4 bytes
+	profile := make([]byte, 128+4+12*len(tags))
+	binary.BigEndian.PutUint32(profile[128:], uint32(len(tags)))
+	for i, tag := range tags {
+		entry := profile[132+12*i:]
+		copy(entry, tag.signature)
+		binary.BigEndian.PutUint32(entry[4:], uint32(len(profile)))
+		binary.BigEndian.PutUint32(entry[8:], uint32(len(tag.data)))
+		profile = append(profile, tag.data...)
+		for len(profile)%4 != 0 {
+			profile = append(profile, 0)
+		}
+	}
+	binary.BigEndian.PutUint32(profile[0:], uint32(len(profile)))
+	binary.BigEndian.PutUint32(profile[8:], 0x02100000)
+	copy(profile[12:], "mntrRGB XYZ ")
+	copy(profile[36:], "acsp")
+	copy(profile[68:], xyzTag(0.9642, 1, 0.8249)[8:])
+	return profile
+}
+
+func TestScaleImage_ConvertsWideGamutToSrgbWithoutProfile(t *testing.T) {
+
+	// prepare
+	startupTestVips()
+	// A red of Adobe RGB, more saturated than the same values in sRGB (231, 57, 57 in sRGB)
+	content := createTestJpeg(t, 400, 300, func(x int, y int) color.Color {
+		return color.RGBA{R: 200, G: 60, B: 60, A: 255}
+	})
+	iccProfile := append([]byte("ICC_PROFILE\x00\x01\x01"), newTestAdobeRgbProfile()...)
+	content = withJpegSegment(content, 0xe2, iccProfile)
+	original, err := vips.NewImageFromBuffer(*content)
+	assert.Nil(t, err)
+	assert.True(t, original.HasICCProfile(), "The fixture should embed the Adobe RGB profile")
+	original.Close()
+
+	// execute
+	scaled, err := ScaleImage(content, &SmallImageSizeProperties)
+
+	// verify
+	assert.Nil(t, err)
+	image, err := vips.NewImageFromBuffer(*scaled)
+	assert.Nil(t, err)
+	defer image.Close()
+	assert.False(t, image.HasICCProfile(), "Browsers assume sRGB for images without profile")
+	assert.Equal(t, vips.InterpretationSRGB, image.Interpretation())
+	decoded, err := DecodeJpeg(scaled)
+	assert.Nil(t, err)
+	r, g, b, _ := decoded.At(125, 125).RGBA()
+	assert.InDelta(t, 231, int(r>>8), 6, "The color should be converted from Adobe RGB to sRGB")
+	assert.InDelta(t, 57, int(g>>8), 6)
+	assert.InDelta(t, 57, int(b>>8), 6)
+}
@@ -7,6 +7,7 @@ import (
 	"csm.cloud.image.scale/kafka/producer"
 	"csm.cloud.image.scale/storage"
 	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/datadog"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/metrics"
 	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/retry"
 	"errors"
 	"fmt"
@@ -16,41 +17,115 @@ import (
 	"golang.org/x/text/language"
 	"path"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 const contentTypeJpeg = "image/jpeg"
 
+const (
+	// Duration of the lease on the quarantine blob (Azure supports 15 to 60 seconds)
+	leaseDuration = 60 * time.Second
+	// Interval the lease is renewed in while the image is processed
+	leaseRenewalInterval = 20 * time.Second
+	// Time a conflicting lease is retried for, the lease of a consumer that crashed while scaling expires within it
+	leaseConflictTimeout = leaseDuration + leaseRenewalInterval
+	// Interval a conflicting lease is retried in
+	leaseConflictRetryInterval = 5 * time.Second
+)
+
 type ImageScalingProcessor struct {
-	quarantineBlobStorageClient storage.BlobStorageClient
-	projectBlobStorageClient    storage.BlobStorageClient
-	userBlobStorageClient       storage.BlobStorageClient
-	imageDeletedEventProducer   producer.EventKafkaProducer[domain.MessageKey, domain.ImageDeletedEvent]
-	imageScaledEventProducer    producer.EventKafkaProducer[domain.MessageKey, domain.ImageScaledEvent]
+	quarantineBlobStore       storage.BlobStore
+	projectBlobStore          storage.BlobStore
+	userBlobStore             storage.BlobStore
+	imageDeletedEventProducer producer.EventKafkaProducer[domain.MessageKey, domain.ImageDeletedEvent]
+	imageScaledEventProducer  producer.EventKafkaProducer[domain.MessageKey, domain.ImageScaledEvent]
+	duplicateIndex            *DuplicateIndex
+	watermark                 *Watermark
+	tilePyramid               *TilePyramid
+	animation                 *Animation
+	leaseConflictTimeout      time.Duration
+	leaseRetryInterval        time.Duration
+}
+
+/*
+AnimatedImage is the small image of an animated original. Content is nil if the small image is the first frame
+(animation not configured for the owner type, limits exceeded or scaling the frames failed).
+*/
+type AnimatedImage struct {
+	Content     *[]byte
+	ContentType string
 }
 
-func NewImageScalingProcessor(quarantineBlobStorageClient storage.BlobStorageClient,
-	projectBlobStorageClient storage.BlobStorageClient,
-	userBlobStorageClient storage.BlobStorageClient,
+/*
+ImageAnalysis contains the results of analyzing the small image, the fields are nil (or empty) if it fails.
+*/
+type ImageAnalysis struct {
+	Placeholder    *Placeholder
+	PerceptualHash *PerceptualHash
+	// Owner identifier of a near-duplicate image in the same project
+	DuplicateOf string
+	// Quality of the fullhd image (project images only)
+	Quality *Quality
+}
+
+func NewImageScalingProcessor(quarantineBlobStore storage.BlobStore,
+	projectBlobStore storage.BlobStore,
+	userBlobStore storage.BlobStore,
 	imageDeletedEventProducer producer.EventKafkaProducer[domain.MessageKey, domain.ImageDeletedEvent],
 	imageScaledEventProducer producer.EventKafkaProducer[domain.MessageKey, domain.ImageScaledEvent],
+	duplicateIndex *DuplicateIndex,
+	watermark *Watermark,
+	tilePyramid *TilePyramid,
+	animation *Animation,
 ) ImageScalingProcessor {
 	return ImageScalingProcessor{
-		quarantineBlobStorageClient: quarantineBlobStorageClient,
-		projectBlobStorageClient:    projectBlobStorageClient,
-		userBlobStorageClient:       userBlobStorageClient,
-		imageDeletedEventProducer:   imageDeletedEventProducer,
-		imageScaledEventProducer:    imageScaledEventProducer,
+		quarantineBlobStore:       quarantineBlobStore,
+		projectBlobStore:          projectBlobStore,
+		userBlobStore:             userBlobStore,
+		imageDeletedEventProducer: imageDeletedEventProducer,
+		imageScaledEventProducer:  imageScaledEventProducer,
+		duplicateIndex:            duplicateIndex,
+		watermark:                 watermark,
+		tilePyramid:               tilePyramid,
+		animation:                 animation,
+		leaseConflictTimeout:      leaseConflictTimeout,
+		leaseRetryInterval:        leaseConflictRetryInterval,
 	}
 }
 
 func (i *ImageScalingProcessor) ScaleImageWithRetry(tracingContext context.Context, event domain.FileCreatedEvent) error {
-	key, err := i.scaleWithRetry(tracingContext, event)
+
+	// Lease the quarantine blob so that it isn't processed concurrently (e.g. after a rebalance or a replay). A lease
+	// still held by another consumer fails the record, so that it is delivered again.
+	quarantineLease, err := i.leaseImageInQuarantineBlobStorage(tracingContext, event)
+	if errors.Is(err, storage.ErrLeaseConflict) {
+		log.Warn().Msg(fmt.Sprintf("Image %s/%s is still leased by another consumer", event.Path, event.FileName))
+		return err
+	}
+	if errors.Is(err, storage.ErrBlobNotFound) {
+		log.Info().Msg(fmt.Sprintf("Skip image %s/%s, it doesn't exist (anymore) in quarantine blob storage", event.Path, event.FileName))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	stopRenewalFn := storage.KeepRenewed(quarantineLease, leaseRenewalInterval)
+	defer func() {
+		stopRenewalFn()
+		if releaseErr := quarantineLease.Release(); releaseErr != nil {
+			log.Warn().Msg(fmt.Sprintf("Releasing lease of image %s/%s failed: %s", event.Path, event.FileName, releaseErr.Error()))
+		}
+	}()
+
+	key, err := i.scaleWithRetry(tracingContext, event, quarantineLease)
 	if err != nil {
 		// If the image couldn't be scaled repetitive, delete it
 		log.Warn().Msg(fmt.Sprintf("Deleting image that couldn't be scaled repetitive %s/%s for reason: %s", event.Path, event.FileName, err))
-		deleteErr := i.deleteImageFromQuarantineBlobStorage(tracingContext, event)
+		metrics.MessagesDropped.WithLabelValues(metrics.ReasonScalingFailed).Inc()
+		deleteErr := i.deleteImageFromQuarantineBlobStorage(tracingContext, quarantineLease)
 		if deleteErr != nil {
 			log.Error().Msg(fmt.Sprintf("File couldn't be delete from quarantine blob storage repetitive %s/%s", event.Path, event.FileName))
 		}
@@ -63,15 +138,16 @@ func (i *ImageScalingProcessor) ScaleImageWithRetry(tracingContext context.Conte
 	return nil
 }
 
-func (i *ImageScalingProcessor) scaleWithRetry(tracingContext context.Context, event domain.FileCreatedEvent) (*domain.MessageKey, error) {
+func (i *ImageScalingProcessor) scaleWithRetry(tracingContext context.Context, event domain.FileCreatedEvent, quarantineLease storage.Lease) (*domain.MessageKey, error) {
 	var key *domain.MessageKey
 	err := retry.SimpleRetryWithTracingContext(func(tracingContext context.Context) error {
-		// Download image
+		// Download image into a temporary file
 		log.Info().Msg(fmt.Sprintf("Download image: %s", event.FileName))
 		blob, err := i.downloadImage(tracingContext, event)
 		if err != nil {
 			return err
 		}
+		defer blob.Remove()
 		timezone := i.getTimezone(blob)
 
 		// Extract image metadata from event parameters
@@ -80,28 +156,37 @@ func (i *ImageScalingProcessor) scaleWithRetry(tracingContext context.Context, e
 			return err
 		}
 		var image = imageMetadata.(model.Image)
+		var analysis *ImageAnalysis
+		var tileManifest string
+		var animation *AnimatedImage
 		caser := cases.Title(language.English)
 		objectType := strings.Replace(caser.String(strings.ToLower(strings.Replace(image.GetOwnerType(), "_", " ", -1))), " ", "", -1)
 
 		if image.GetBoundedContext() == model.PROJECT {
 			log.Info().Msg(fmt.Sprintf("Scale %s: %s", objectType, event.FileName))
-			original, fullSize, small, err := i.scaleProjectPicture(tracingContext, blob, objectType)
+			original, fullSize, small, frames, err := i.scaleProjectPicture(tracingContext, blob, objectType, i.fullSizeStagesOf(image, *timezone, blob))
 			if err != nil {
 				return err
 			}
+			animation = i.animate(tracingContext, image, blob, frames, event)
+			analysis = i.analyzeImage(tracingContext, image, small, event)
+			analysis.Quality = i.analyzeQuality(tracingContext, image, fullSize, event)
 			log.Info().Msg(fmt.Sprintf("Upload %s: %s", objectType, event.FileName))
-			err = i.uploadProjectPicture(tracingContext, image, original, fullSize, small, objectType, *timezone)
+			err = i.uploadProjectPicture(tracingContext, image, original, fullSize, small, animation, analysis, objectType, *timezone)
 			if err != nil {
 				return err
 			}
+			tileManifest = i.generateTiles(tracingContext, image, blob, event)
 		} else if image.GetBoundedContext() == model.USER {
 			log.Info().Msg(fmt.Sprintf("Scale %s: %s", objectType, event.FileName))
-			original, small, err := i.scaleUserPicture(tracingContext, blob, objectType)
+			original, small, frames, err := i.scaleUserPicture(tracingContext, blob, objectType)
 			if err != nil {
 				return err
 			}
+			animation = i.animate(tracingContext, image, blob, frames, event)
+			analysis = i.analyzeImage(tracingContext, image, small, event)
 			log.Info().Msg(fmt.Sprintf("Upload %s: %s", objectType, event.FileName))
-			err = i.uploadUserPicture(tracingContext, image, original, small, objectType, *timezone)
+			err = i.uploadUserPicture(tracingContext, image, original, small, animation, analysis, objectType, *timezone)
 			if err != nil {
 				return err
 			}
@@ -111,18 +196,18 @@ func (i *ImageScalingProcessor) scaleWithRetry(tracingContext context.Context, e
 
 		log.Info().Msg(fmt.Sprintf("Send kafka event for %s: %s", objectType, event.FileName))
 		key = i.getMessageKey(imageMetadata)
-		err = i.sendImageScaledEvent(tracingContext, *key, event)
+		err = i.sendImageScaledEvent(tracingContext, *key, event, analysis, tileManifest, animation)
 		if err != nil {
 			return err
 		}
 		log.Info().Msg(fmt.Sprintf("Delete %s from quarantine blob storage: %s", objectType, event.FileName))
-		return i.deleteImageFromQuarantineBlobStorage(tracingContext, event)
+		return i.deleteImageFromQuarantineBlobStorage(tracingContext, quarantineLease)
 	}, tracingContext, 5, 1*time.Second, "ScaleWithRetry")
 
 	return key, err
 }
 
-func (i *ImageScalingProcessor) getTimezone(blob *storage.Blob) *string {
+func (i *ImageScalingProcessor) getTimezone(blob *storage.DownloadedBlob) *string {
 	timezone := blob.Metadata["timezone"]
 	if timezone == nil {
 		utc := "UTC"
@@ -131,9 +216,9 @@ func (i *ImageScalingProcessor) getTimezone(blob *storage.Blob) *string {
 	return timezone
 }
 
-func (i *ImageScalingProcessor) downloadImage(tracingContext context.Context, event domain.FileCreatedEvent) (*storage.Blob, error) {
-	blob, err := datadog.TraceWithContext(tracingContext, "downloadImage", func() (*storage.Blob, error) {
-		return i.quarantineBlobStorageClient.DownloadBlob(event.Path, event.FileName)
+func (i *ImageScalingProcessor) downloadImage(tracingContext context.Context, event domain.FileCreatedEvent) (*storage.DownloadedBlob, error) {
+	blob, err := datadog.TraceWithContext(tracingContext, "downloadImage", func() (*storage.DownloadedBlob, error) {
+		return storage.DownloadToTemporaryFile(i.quarantineBlobStore, event.Path, event.FileName)
 	})
 	if err != nil {
 		return nil, err
@@ -153,83 +238,231 @@ func (i ImageScalingProcessor) getMessageKey(imageMetadata interface{}) *domain.
 	}
 }
 
-func (i ImageScalingProcessor) scaleProjectPicture(tracingContext context.Context, blob *storage.Blob, objectType string) (*[]byte, *[]byte, *[]byte, error) {
+/*
+fullSizeStagesOf returns the stages applied to the full image, the watermark if configured for the owner type
+*/
+func (i ImageScalingProcessor) fullSizeStagesOf(image model.Image, timezone string, blob *storage.DownloadedBlob) []ImageStage {
+	if !i.watermark.AppliesTo(image.GetOwnerType()) {
+		return nil
+	}
+	return []ImageStage{i.watermark.Stage(image.GetRootContextIdentifier(), timezone, blob.LastModified)}
+}
+
+func (i ImageScalingProcessor) scaleProjectPicture(tracingContext context.Context, blob *storage.DownloadedBlob, objectType string, fullSizeStages []ImageStage) (*storage.DownloadedBlob, *[]byte, *[]byte, int, error) {
 
-	// Scale full image
-	fullImage, err := datadog.TraceWithContext(tracingContext, fmt.Sprintf("scale%sFull", objectType), func() (*[]byte, error) {
-		return ScaleImage(&blob.Buffer, &PreviewImageSizeProperties)
+	// Scale full and small image from a single decode of the original
+	scaled, err := datadog.TraceWithContext(tracingContext, fmt.Sprintf("scale%s", objectType), func() (*ScaledVariants, error) {
+		return ScaleImageFileToVariants(blob.File,
+			Variant{Name: VariantFullHd, SizeProperties: &PreviewImageSizeProperties, Stages: fullSizeStages},
+			Variant{Name: VariantSmall, SizeProperties: &SmallImageSizeProperties})
 	})
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, nil, 0, err
 	}
 
+	return blob, scaled.Images[VariantFullHd], scaled.Images[VariantSmall], scaled.Frames, nil
+}
+
+func (i ImageScalingProcessor) scaleUserPicture(tracingContext context.Context, blob *storage.DownloadedBlob, objectType string) (*storage.DownloadedBlob, *[]byte, int, error) {
+
 	// Scale small image
-	smallImage, err := datadog.TraceWithContext(tracingContext, fmt.Sprintf("scale%sSmall", objectType), func() (*[]byte, error) {
-		return ScaleImage(&blob.Buffer, &SmallImageSizeProperties)
+	scaled, err := datadog.TraceWithContext(tracingContext, fmt.Sprintf("scale%s", objectType), func() (*ScaledVariants, error) {
+		return ScaleImageFileToVariants(blob.File, Variant{Name: VariantSmall, SizeProperties: &SmallImageSizeProperties})
 	})
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, 0, err
 	}
 
-	return &blob.Buffer, fullImage, smallImage, nil
+	return blob, scaled.Images[VariantSmall], scaled.Frames, nil
 }
 
-func (i ImageScalingProcessor) scaleUserPicture(tracingContext context.Context, blob *storage.Blob, objectType string) (*[]byte, *[]byte, error) {
+/*
+animate scales all frames of animated originals of the owner types configured for animation. Returns nil for stills.
+The first frame is used if the animation can't be scaled.
+*/
+func (i ImageScalingProcessor) animate(tracingContext context.Context, image model.Image, blob *storage.DownloadedBlob, frames int, event domain.FileCreatedEvent) *AnimatedImage {
+	if frames <= 1 {
+		return nil
+	}
+	if !i.animation.AppliesTo(image.GetOwnerType(), frames) {
+		log.Info().Msg(fmt.Sprintf("Use first of %d frames of image %s/%s", frames, event.Path, event.FileName))
+		return &AnimatedImage{}
+	}
 
-	// Scale small image
-	smallImage, err := datadog.TraceWithContext(tracingContext, fmt.Sprintf("scale%sSmall", objectType), func() (*[]byte, error) {
-		return ScaleImage(&blob.Buffer, &SmallImageSizeProperties)
+	content, err := datadog.TraceWithContext(tracingContext, "scaleAnimation", func() (*[]byte, error) {
+		defer metrics.ObserveScaleDuration("animation", time.Now())
+		return i.animation.Scale(blob.File, &SmallImageSizeProperties)
 	})
 	if err != nil {
-		return nil, nil, err
+		log.Warn().Msg(fmt.Sprintf("Scaling animation of image %s/%s failed, using the first frame: %s", event.Path, event.FileName, err.Error()))
+		return &AnimatedImage{}
+	}
+	if content == nil {
+		log.Info().Msg(fmt.Sprintf("Use first frame of image %s/%s, the animation exceeds the maximum duration", event.Path, event.FileName))
+		return &AnimatedImage{}
 	}
+	return &AnimatedImage{Content: content, ContentType: i.animation.ContentType()}
+}
 
-	return &blob.Buffer, smallImage, nil
+/*
+smallImageOf returns the small image to upload and its content type, the animated one if available
+*/
+func smallImageOf(smallImage *[]byte, animation *AnimatedImage) (*[]byte, string) {
+	if animation != nil && animation.Content != nil {
+		return animation.Content, animation.ContentType
+	}
+	return smallImage, contentTypeJpeg
 }
 
-func (i ImageScalingProcessor) uploadProjectPicture(tracingContext context.Context, image model.Image, originalImage *[]byte, fullSizeImage *[]byte, smallImage *[]byte, objectType string, timezone string) error {
-	fileName := image.GetFileName()
-	jpgFileName := i.fileNameAsJpg(fileName)
-	ownerIdentifier := image.GetOwnerIdentifier()
-	ownerType := image.GetOwnerType()
+/*
+animatedOf returns true if the small image is animated, false if it is the first frame of an animation and nil for
+stills
+*/
+func animatedOf(animation *AnimatedImage) *bool {
+	if animation == nil {
+		return nil
+	}
+	animated := animation.Content != nil
+	return &animated
+}
 
-	metadata := make(map[string]*string)
-	metadata["filename"] = &jpgFileName
-	metadata["timezone"] = &timezone
-	metadata["owner_identifier"] = &ownerIdentifier
-	metadata["owner_type"] = &ownerType
+/*
+analyzeImage computes the placeholder and the perceptual hash from the small image and looks up near-duplicates
+in the project. Images are scaled without the results that couldn't be computed.
+*/
+func (i ImageScalingProcessor) analyzeImage(tracingContext context.Context, image model.Image, smallImage *[]byte, event domain.FileCreatedEvent) *ImageAnalysis {
+	analysis := &ImageAnalysis{}
+	decodedImage, err := DecodeJpeg(smallImage)
+	if err != nil {
+		log.Warn().Msg(fmt.Sprintf("Decoding small image %s/%s failed: %s", event.Path, event.FileName, err.Error()))
+		return analysis
+	}
 
-	// Upload small image
-	_, err := datadog.TraceWithContext(tracingContext, fmt.Sprintf("upload%sSmall", objectType), func() (any, error) {
-		err := i.projectBlobStorageClient.UploadBlob(fmt.Sprintf("project/image/small/%s", image.GetParentIdentifier()), ownerIdentifier, smallImage, metadata, contentTypeJpeg)
-		return nil, err
+	// Compute placeholder
+	analysis.Placeholder, err = datadog.TraceWithContext(tracingContext, "createPlaceholder", func() (*Placeholder, error) {
+		return NewPlaceholder(decodedImage)
 	})
 	if err != nil {
-		return err
+		log.Warn().Msg(fmt.Sprintf("Computing placeholder of image %s/%s failed: %s", event.Path, event.FileName, err.Error()))
 	}
 
-	// Upload full image
-	_, err = datadog.TraceWithContext(tracingContext, fmt.Sprintf("upload%sFull", objectType), func() (any, error) {
-		err := i.projectBlobStorageClient.UploadBlob(fmt.Sprintf("project/image/fullhd/%s", image.GetParentIdentifier()), ownerIdentifier, fullSizeImage, metadata, contentTypeJpeg)
-		return nil, err
+	// Compute perceptual hash and register it in the duplicate index of the project
+	perceptualHash := NewPerceptualHash(decodedImage)
+	analysis.PerceptualHash = &perceptualHash
+	if i.duplicateIndex != nil && image.GetBoundedContext() == model.PROJECT {
+		analysis.DuplicateOf, err = datadog.TraceWithContext(tracingContext, "registerPerceptualHash", func() (string, error) {
+			return i.duplicateIndex.Register(image.GetRootContextIdentifier(), image.GetOwnerIdentifier(), perceptualHash)
+		})
+		if err != nil {
+			log.Warn().Msg(fmt.Sprintf("Registering image %s/%s in duplicate index failed: %s", event.Path, event.FileName, err.Error()))
+		}
+		if analysis.DuplicateOf != "" {
+			log.Info().Msg(fmt.Sprintf("Image %s/%s is a near-duplicate of %s", event.Path, event.FileName, analysis.DuplicateOf))
+		}
+	}
+	return analysis
+}
+
+/*
+generateTiles generates and uploads the tile pyramid of large images, returns the path of the manifest. Images are
+scaled without tiles if the generation fails.
+*/
+func (i ImageScalingProcessor) generateTiles(tracingContext context.Context, image model.Image, blob *storage.DownloadedBlob, event domain.FileCreatedEvent) string {
+	tileManifest, err := datadog.TraceWithContext(tracingContext, "generateTiles", func() (string, error) {
+		return i.tilePyramid.Generate(blob.File, image.GetParentIdentifier(), image.GetOwnerIdentifier())
 	})
 	if err != nil {
-		return err
+		log.Warn().Msg(fmt.Sprintf("Generating tiles of image %s/%s failed: %s", event.Path, event.FileName, err.Error()))
+		return ""
 	}
+	return tileManifest
+}
 
-	// Upload original image
-	metadata["filename"] = &fileName
-	_, err = datadog.TraceWithContext(tracingContext, fmt.Sprintf("upload%s", objectType), func() (any, error) {
-		err := i.projectBlobStorageClient.UploadBlob(fmt.Sprintf("project/image/original/%s", image.GetParentIdentifier()), ownerIdentifier, originalImage, metadata, image.GetContentType())
-		return nil, err
+/*
+analyzeQuality computes the quality indicators from the fullhd image without the bar of the watermark, nil if the
+image can't be decoded
+*/
+func (i ImageScalingProcessor) analyzeQuality(tracingContext context.Context, image model.Image, fullSizeImage *[]byte, event domain.FileCreatedEvent) *Quality {
+	quality, err := datadog.TraceWithContext(tracingContext, "analyzeQuality", func() (*Quality, error) {
+		decodedImage, err := DecodeJpeg(fullSizeImage)
+		if err != nil {
+			return nil, err
+		}
+		if i.watermark.AppliesTo(image.GetOwnerType()) {
+			decodedImage = cropBottom(decodedImage, watermarkBarHeight)
+		}
+		return NewQuality(decodedImage), nil
 	})
+	if err != nil {
+		log.Warn().Msg(fmt.Sprintf("Computing quality of image %s/%s failed: %s", event.Path, event.FileName, err.Error()))
+	}
+	return quality
+}
 
-	return err
+func (i ImageScalingProcessor) uploadProjectPicture(tracingContext context.Context, image model.Image, originalImage *storage.DownloadedBlob, fullSizeImage *[]byte, smallImage *[]byte, animation *AnimatedImage, analysis *ImageAnalysis, objectType string, timezone string) error {
+	fileName := image.GetFileName()
+	jpgFileName := fileNameAsJpg(fileName)
+	ownerIdentifier := image.GetOwnerIdentifier()
+	ownerType := image.GetOwnerType()
+
+	metadata := make(map[string]*string)
+	metadata["filename"] = &jpgFileName
+	metadata["timezone"] = &timezone
+	metadata["owner_identifier"] = &ownerIdentifier
+	metadata["owner_type"] = &ownerType
+	if analysis.Placeholder != nil {
+		metadata["blurhash"] = &analysis.Placeholder.BlurHash
+		metadata["dominant_color"] = &analysis.Placeholder.DominantColor
+	}
+	if analysis.PerceptualHash != nil {
+		perceptualHash := analysis.PerceptualHash.String()
+		metadata["perceptual_hash"] = &perceptualHash
+	}
+	if animated := animatedOf(animation); animated != nil {
+		animatedValue := strconv.FormatBool(*animated)
+		metadata["animated"] = &animatedValue
+	}
+	smallContent, smallContentType := smallImageOf(smallImage, animation)
+
+	// Upload small, full and original image (streamed from the temporary file) and the reference to find the image
+	// for erasure concurrently
+	originalMetadata := withFileName(metadata, fileName)
+	referencePath, referenceName := referenceOf(image)
+	return uploadConcurrently(
+		func() error {
+			_, err := datadog.TraceWithContext(tracingContext, fmt.Sprintf("upload%sSmall", objectType), func() (any, error) {
+				err := i.projectBlobStore.UploadBlob(fmt.Sprintf("project/image/small/%s", image.GetParentIdentifier()), ownerIdentifier, smallContent, metadata, smallContentType)
+				return nil, err
+			})
+			return err
+		},
+		func() error {
+			_, err := datadog.TraceWithContext(tracingContext, fmt.Sprintf("upload%sFull", objectType), func() (any, error) {
+				err := i.projectBlobStore.UploadBlob(fmt.Sprintf("project/image/fullhd/%s", image.GetParentIdentifier()), ownerIdentifier, fullSizeImage, metadata, contentTypeJpeg)
+				return nil, err
+			})
+			return err
+		},
+		func() error {
+			_, err := datadog.TraceWithContext(tracingContext, fmt.Sprintf("upload%s", objectType), func() (any, error) {
+				err := storage.UploadFile(i.projectBlobStore, fmt.Sprintf("project/image/original/%s", image.GetParentIdentifier()), ownerIdentifier, originalImage.File, originalMetadata, image.GetContentType())
+				return nil, err
+			})
+			return err
+		},
+		func() error {
+			_, err := datadog.TraceWithContext(tracingContext, fmt.Sprintf("upload%sReference", objectType), func() (any, error) {
+				err := i.projectBlobStore.UploadBlob(referencePath, referenceName, &[]byte{}, nil, contentTypeReference)
+				return nil, err
+			})
+			return err
+		},
+	)
 }
 
-func (i ImageScalingProcessor) uploadUserPicture(tracingContext context.Context, image model.Image, originalImage *[]byte, smallImage *[]byte, objectType string, timezone string) error {
+func (i ImageScalingProcessor) uploadUserPicture(tracingContext context.Context, image model.Image, originalImage *storage.DownloadedBlob, smallImage *[]byte, animation *AnimatedImage, analysis *ImageAnalysis, objectType string, timezone string) error {
 	fileName := image.GetFileName()
-	jpgFileName := i.fileNameAsJpg(fileName)
+	jpgFileName := fileNameAsJpg(fileName)
 	ownerIdentifier := image.GetOwnerIdentifier()
 	ownerType := image.GetOwnerType()
 
@@ -238,41 +471,146 @@ func (i ImageScalingProcessor) uploadUserPicture(tracingContext context.Context,
 	metadata["timezone"] = &timezone
 	metadata["owner_identifier"] = &ownerIdentifier
 	metadata["owner_type"] = &ownerType
+	if analysis.Placeholder != nil {
+		metadata["blurhash"] = &analysis.Placeholder.BlurHash
+		metadata["dominant_color"] = &analysis.Placeholder.DominantColor
+	}
+	if analysis.PerceptualHash != nil {
+		perceptualHash := analysis.PerceptualHash.String()
+		metadata["perceptual_hash"] = &perceptualHash
+	}
+	if animated := animatedOf(animation); animated != nil {
+		animatedValue := strconv.FormatBool(*animated)
+		metadata["animated"] = &animatedValue
+	}
+	smallContent, smallContentType := smallImageOf(smallImage, animation)
+
+	// Upload small and original image (streamed from the temporary file) concurrently
+	originalMetadata := withFileName(metadata, fileName)
+	return uploadConcurrently(
+		func() error {
+			_, err := datadog.TraceWithContext(tracingContext, fmt.Sprintf("upload%sSmall", objectType), func() (any, error) {
+				err := i.userBlobStore.UploadBlob(fmt.Sprintf("user/image/small/%s", image.GetParentIdentifier()), ownerIdentifier, smallContent, metadata, smallContentType)
+				return nil, err
+			})
+			return err
+		},
+		func() error {
+			_, err := datadog.TraceWithContext(tracingContext, fmt.Sprintf("upload%s", objectType), func() (any, error) {
+				err := storage.UploadFile(i.userBlobStore, fmt.Sprintf("user/image/original/%s", image.GetParentIdentifier()), ownerIdentifier, originalImage.File, originalMetadata, image.GetContentType())
+				return nil, err
+			})
+			return err
+		},
+	)
+}
 
-	// Upload small image
-	_, err := datadog.TraceWithContext(tracingContext, fmt.Sprintf("upload%sSmall", objectType), func() (any, error) {
-		err := i.userBlobStorageClient.UploadBlob(fmt.Sprintf("user/image/small/%s", image.GetParentIdentifier()), ownerIdentifier, smallImage, metadata, contentTypeJpeg)
-		return nil, err
-	})
-	if err != nil {
-		return err
+/*
+withFileName returns a copy of the metadata with the file name replaced, the uploads share the metadata concurrently
+*/
+func withFileName(metadata map[string]*string, fileName string) map[string]*string {
+	copied := make(map[string]*string, len(metadata))
+	for key, value := range metadata {
+		copied[key] = value
 	}
+	copied["filename"] = &fileName
+	return copied
+}
 
-	// Upload original image
-	metadata["filename"] = &fileName
-	_, err = datadog.TraceWithContext(tracingContext, fmt.Sprintf("upload%s", objectType), func() (any, error) {
-		err := i.userBlobStorageClient.UploadBlob(fmt.Sprintf("user/image/original/%s", image.GetParentIdentifier()), ownerIdentifier, originalImage, metadata, image.GetContentType())
-		return nil, err
-	})
+/*
+uploadConcurrently runs the uploads in parallel and waits for all of them, the errors of failed uploads are joined
+*/
+func uploadConcurrently(uploads ...func() error) error {
+	errs := make([]error, len(uploads))
+	var waitGroup sync.WaitGroup
+	for index, upload := range uploads {
+		waitGroup.Add(1)
+		go func(index int, upload func() error) {
+			defer waitGroup.Done()
+			errs[index] = upload()
+		}(index, upload)
+	}
+	waitGroup.Wait()
+	return errors.Join(errs...)
+}
 
-	return err
+/*
+leaseImageInQuarantineBlobStorage leases the quarantine blob. A conflicting lease is retried until it expires, as it
+may be held by a consumer that crashed while scaling. A consumer still scaling keeps renewing its lease, deletes the
+blob when done (ErrBlobNotFound) or outlasts the retries (ErrLeaseConflict).
+*/
+func (i *ImageScalingProcessor) leaseImageInQuarantineBlobStorage(tracingContext context.Context, event domain.FileCreatedEvent) (storage.Lease, error) {
+	deadline := time.Now().Add(i.leaseConflictTimeout)
+	for {
+		quarantineLease, err := i.acquireLease(tracingContext, event)
+		if !errors.Is(err, storage.ErrLeaseConflict) || time.Now().After(deadline) {
+			return quarantineLease, err
+		}
+		log.Info().Msg(fmt.Sprintf("Image %s/%s is leased by another consumer, retrying", event.Path, event.FileName))
+		time.Sleep(i.leaseRetryInterval)
+	}
 }
 
-func (i *ImageScalingProcessor) deleteImageFromQuarantineBlobStorage(tracingContext context.Context, event domain.FileCreatedEvent) error {
+func (i *ImageScalingProcessor) acquireLease(tracingContext context.Context, event domain.FileCreatedEvent) (storage.Lease, error) {
+	var quarantineLease storage.Lease
+	var leaseErr error
+	err := retry.SimpleRetryWithTracingContext(func(tracingContext context.Context) error {
+		_, leaseErr = datadog.TraceWithContext(tracingContext, "leaseImage", func() (any, error) {
+			var err error
+			quarantineLease, err = storage.AcquireLease(i.quarantineBlobStore, event.Path, event.FileName, leaseDuration)
+			return nil, err
+		})
+		// Conflicts and missing blobs won't resolve by retrying
+		if errors.Is(leaseErr, storage.ErrLeaseConflict) || errors.Is(leaseErr, storage.ErrBlobNotFound) {
+			return nil
+		}
+		return leaseErr
+	}, tracingContext, 3, 1*time.Second, "LeaseImage")
+	if err != nil {
+		return nil, err
+	}
+	return quarantineLease, leaseErr
+}
+
+func (i *ImageScalingProcessor) deleteImageFromQuarantineBlobStorage(tracingContext context.Context, quarantineLease storage.Lease) error {
 	_, err := datadog.TraceWithContext(tracingContext, "deleteImage", func() (any, error) {
-		return nil, i.quarantineBlobStorageClient.DeleteBlob(event.Path, event.FileName)
+		return nil, quarantineLease.DeleteBlob()
 	})
 	return err
 }
 
-func (i *ImageScalingProcessor) fileNameAsJpg(fileName string) string {
+func fileNameAsJpg(fileName string) string {
 	fileExtension := path.Ext(fileName)
 	return fileName[0:len(fileName)-len(fileExtension)] + ".jpg"
 }
 
-func (i *ImageScalingProcessor) sendImageScaledEvent(tracingContext context.Context, key domain.MessageKey, event domain.FileCreatedEvent) error {
+func (i *ImageScalingProcessor) sendImageScaledEvent(tracingContext context.Context, key domain.MessageKey, event domain.FileCreatedEvent, analysis *ImageAnalysis, tileManifest string, animation *AnimatedImage) error {
 	_, err := datadog.TraceWithContext(tracingContext, "sendImageScaledEvent", func() (any, error) {
-		imageScaledEvent := domain.ImageScaledEvent(event)
+		imageScaledEvent := domain.ImageScaledEvent{
+			Identifier:    event.Identifier,
+			Path:          event.Path,
+			FileName:      event.FileName,
+			ContentType:   event.ContentType,
+			ContentLength: event.ContentLength,
+		}
+		if analysis.Placeholder != nil {
+			imageScaledEvent.BlurHash = domain.NewOptionalString(analysis.Placeholder.BlurHash)
+			imageScaledEvent.DominantColor = domain.NewOptionalString(analysis.Placeholder.DominantColor)
+		}
+		if analysis.PerceptualHash != nil {
+			imageScaledEvent.PerceptualHash = domain.NewOptionalString(analysis.PerceptualHash.String())
+		}
+		imageScaledEvent.RootContextIdentifier = domain.NewOptionalString(key.RootContextIdentifier)
+		imageScaledEvent.DuplicateOf = domain.NewOptionalString(analysis.DuplicateOf)
+		imageScaledEvent.TileManifest = domain.NewOptionalString(tileManifest)
+		if animated := animatedOf(animation); animated != nil {
+			imageScaledEvent.Animated = domain.NewOptionalBoolean(*animated)
+		}
+		if analysis.Quality != nil {
+			imageScaledEvent.Sharpness = domain.NewOptionalDouble(analysis.Quality.Sharpness)
+			imageScaledEvent.Brightness = domain.NewOptionalDouble(analysis.Quality.Brightness)
+			imageScaledEvent.Contrast = domain.NewOptionalDouble(analysis.Quality.Contrast)
+		}
 		err := i.imageScaledEventProducer.Produce(tracingContext, key, imageScaledEvent)
 		return nil, err
 	})
@@ -281,14 +619,20 @@ func (i *ImageScalingProcessor) sendImageScaledEvent(tracingContext context.Cont
 
 func (i *ImageScalingProcessor) sendImageDeletedEvent(tracingContext context.Context, key domain.MessageKey, event domain.FileCreatedEvent) error {
 	_, err := datadog.TraceWithContext(tracingContext, "sendImageDeletedEvent", func() (any, error) {
-		imageDeletedEvent := domain.ImageDeletedEvent(event)
+		imageDeletedEvent := domain.ImageDeletedEvent{
+			Identifier:    event.Identifier,
+			Path:          event.Path,
+			FileName:      event.FileName,
+			ContentType:   event.ContentType,
+			ContentLength: event.ContentLength,
+		}
 		err := i.imageDeletedEventProducer.Produce(tracingContext, key, imageDeletedEvent)
 		return nil, err
 	})
 	return err
 }
 
-func (i *ImageScalingProcessor) getImageMetadata(blob *storage.Blob, path string, eventFileName string, eventId string, eventContentType string) (interface{}, error) {
+func (i *ImageScalingProcessor) getImageMetadata(blob *storage.DownloadedBlob, path string, eventFileName string, eventId string, eventContentType string) (interface{}, error) {
 	// Get metadata from blob metadata. If a file is uploaded with the azure storage explorer
 	// to test the converter, no metadata is set. Therefore, data is taken from event parameters or random generated.
 	fileName, blobHasFileName := blob.Metadata["filename"]
@@ -0,0 +1,143 @@
+package image
+
+import (
+	"context"
+	"csm.cloud.image.scale/domain"
+	"csm.cloud.image.scale/storage"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestUploadConcurrently_RunsAllUploadsAndJoinsErrors(t *testing.T) {
+
+	// prepare
+	var uploaded atomic.Int32
+	smallErr := errors.New("small failed")
+	originalErr := errors.New("original failed")
+	upload := func(err error) func() error {
+		return func() error {
+			uploaded.Add(1)
+			return err
+		}
+	}
+
+	// execute
+	err := uploadConcurrently(upload(smallErr), upload(nil), upload(originalErr))
+
+	// verify
+	assert.Equal(t, int32(3), uploaded.Load())
+	assert.ErrorIs(t, err, smallErr)
+	assert.ErrorIs(t, err, originalErr)
+	assert.Nil(t, uploadConcurrently(upload(nil), upload(nil)))
+}
+
+func TestWithFileName_KeepsSharedMetadata(t *testing.T) {
+
+	// prepare
+	jpgFileName := "image.jpg"
+	ownerType := "TASK_ATTACHMENT"
+	metadata := map[string]*string{"filename": &jpgFileName, "owner_type": &ownerType}
+
+	// execute
+	originalMetadata := withFileName(metadata, "image.png")
+
+	// verify
+	assert.Equal(t, "image.jpg", *metadata["filename"])
+	assert.Equal(t, "image.png", *originalMetadata["filename"])
+	assert.Equal(t, "TASK_ATTACHMENT", *originalMetadata["owner_type"])
+}
+
+func TestSmallImageOf_PrefersAnimation(t *testing.T) {
+
+	// prepare
+	still := []byte("still")
+	animated := []byte("animated")
+
+	// execute
+	animatedContent, animatedContentType := smallImageOf(&still, &AnimatedImage{Content: &animated, ContentType: "image/webp"})
+	firstFrameContent, firstFrameContentType := smallImageOf(&still, &AnimatedImage{})
+	stillContent, stillContentType := smallImageOf(&still, nil)
+
+	// verify
+	assert.Equal(t, &animated, animatedContent)
+	assert.Equal(t, "image/webp", animatedContentType)
+	assert.Equal(t, &still, firstFrameContent)
+	assert.Equal(t, contentTypeJpeg, firstFrameContentType)
+	assert.Equal(t, &still, stillContent)
+	assert.Equal(t, contentTypeJpeg, stillContentType)
+	assert.False(t, *animatedOf(&AnimatedImage{}))
+	assert.True(t, *animatedOf(&AnimatedImage{Content: &animated}))
+	assert.Nil(t, animatedOf(nil))
+}
+
+// Quarantine blob store with a blob leased by another consumer until the lease expires (zero time never expires)
+type fakeLeasedBlobStore struct {
+	storage.BlobStore
+	leaseExpiresAt time.Time
+	attempts       int
+}
+
+func (f *fakeLeasedBlobStore) AcquireLease(_ string, _ string, _ time.Duration) (storage.Lease, error) {
+	f.attempts++
+	if f.leaseExpiresAt.IsZero() || time.Now().Before(f.leaseExpiresAt) {
+		return nil, fmt.Errorf("%w: there is already a lease present", storage.ErrLeaseConflict)
+	}
+	return &fakeLease{}, nil
+}
+
+type fakeLease struct{}
+
+func (f *fakeLease) Renew() error {
+	return nil
+}
+
+func (f *fakeLease) Release() error {
+	return nil
+}
+
+func (f *fakeLease) DeleteBlob() error {
+	return nil
+}
+
+func newTestLeasingProcessor(quarantineBlobStore storage.BlobStore, leaseConflictTimeout time.Duration) *ImageScalingProcessor {
+	return &ImageScalingProcessor{
+		quarantineBlobStore:  quarantineBlobStore,
+		leaseConflictTimeout: leaseConflictTimeout,
+		leaseRetryInterval:   10 * time.Millisecond,
+	}
+}
+
+var testLeasedEvent = domain.FileCreatedEvent{Path: "/images/projects/project1/tasks/task1/attachments", FileName: "attachment1"}
+
+func TestLeaseImageInQuarantineBlobStorage_TakesOverStaleLeaseOfCrashedConsumer(t *testing.T) {
+
+	// prepare (the consumer holding the lease crashed, its lease isn't renewed anymore)
+	quarantineBlobStore := &fakeLeasedBlobStore{leaseExpiresAt: time.Now().Add(50 * time.Millisecond)}
+	processor := newTestLeasingProcessor(quarantineBlobStore, time.Second)
+
+	// execute
+	lease, err := processor.leaseImageInQuarantineBlobStorage(context.Background(), testLeasedEvent)
+
+	// verify
+	assert.Nil(t, err)
+	assert.NotNil(t, lease)
+	assert.Greater(t, quarantineBlobStore.attempts, 1)
+}
+
+func TestScaleImageWithRetry_FailsWhileLeaseIsRenewedByAnotherConsumer(t *testing.T) {
+
+	// prepare
+	quarantineBlobStore := &fakeLeasedBlobStore{}
+	processor := newTestLeasingProcessor(quarantineBlobStore, 50*time.Millisecond)
+
+	// execute
+	err := processor.ScaleImageWithRetry(context.Background(), testLeasedEvent)
+
+	// verify (the record must not be committed, so that it is delivered again)
+	assert.ErrorIs(t, err, storage.ErrLeaseConflict)
+	assert.Greater(t, quarantineBlobStore.attempts, 1)
+}
@@ -0,0 +1,249 @@
+package image
+
+import (
+	"csm.cloud.image.scale/config/properties"
+	"csm.cloud.image.scale/storage"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/metrics"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTilesMinDimension      = 6000
+	defaultTileSize               = 254
+	defaultTileOverlap            = 1
+	defaultTilesUploadConcurrency = 8
+
+	// govips has no binding of dzsave, the command line tools of libvips (vips-tools) are used instead
+	vipsCommand       = "vips"
+	vipsHeaderCommand = "vipsheader"
+
+	// Uncompressed image in the vips format, rotated by the exif orientation (dzsave doesn't apply it)
+	rotatedFileName = "rotated.v"
+	// Base name of the tile pyramid, dzsave writes the manifest {name}.dzi and the tiles to {name}_files/{level}/
+	tilesBaseName         = "image"
+	tilesManifestFileName = tilesBaseName + ".dzi"
+	contentTypeDzi        = "application/xml"
+)
+
+/*
+TilePyramid generates a deep zoom tile pyramid of large images (e.g. construction plans), that are unreadable as
+fullhd image and too large to be loaded on mobile devices as original. Viewers (e.g. OpenSeadragon) load the tiles
+of the visible region in the zoom level needed only. The commands run in a scale slot with the concurrency and cache
+limits of libvips in this process.
+*/
+type TilePyramid struct {
+	blobStore         storage.BlobStore
+	minDimension      int
+	tileSize          int
+	overlap           int
+	uploadConcurrency int
+	vipsOptions       []string
+	runCommand        func(name string, args ...string) ([]byte, error)
+}
+
+/*
+NewTilePyramid creates the tile pyramid generation uploading to the project blob store, nil if it is disabled
+*/
+func NewTilePyramid(properties properties.TilesProperties, imageProperties properties.ImageProperties, projectBlobStore storage.BlobStore) *TilePyramid {
+	if !properties.Enabled {
+		return nil
+	}
+	return &TilePyramid{
+		blobStore:         projectBlobStore,
+		minDimension:      valueOrDefault(properties.MinDimension, defaultTilesMinDimension),
+		tileSize:          valueOrDefault(properties.TileSize, defaultTileSize),
+		overlap:           valueOrDefault(properties.Overlap, defaultTileOverlap),
+		uploadConcurrency: valueOrDefault(properties.UploadConcurrency, defaultTilesUploadConcurrency),
+		vipsOptions:       vipsOptionsOf(imageProperties),
+		runCommand:        runCommand,
+	}
+}
+
+/*
+Generate creates the tile pyramid of the image file if its longest side reaches the minimum dimension and uploads it
+to project/image/tiles/{parent}/{owner}/. Returns the path of the manifest, an empty string for smaller images.
+*/
+func (t *TilePyramid) Generate(file string, parentIdentifier string, ownerIdentifier string) (string, error) {
+	if t == nil {
+		return "", nil
+	}
+
+	width, height, err := t.dimensionsOf(file)
+	if err != nil {
+		return "", err
+	}
+	if max(width, height) < t.minDimension {
+		return "", nil
+	}
+
+	// Write the rotated image and the pyramid to a temporary directory, it is removed after the upload
+	directory, err := os.MkdirTemp("", "tiles-")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = os.RemoveAll(directory)
+	}()
+
+	pyramidDirectory := filepath.Join(directory, tilesBaseName)
+	if err = t.generatePyramid(file, filepath.Join(directory, rotatedFileName), pyramidDirectory); err != nil {
+		return "", err
+	}
+
+	tilesPath := fmt.Sprintf("project/image/tiles/%s/%s", parentIdentifier, ownerIdentifier)
+	if err = t.upload(pyramidDirectory, tilesPath); err != nil {
+		return "", err
+	}
+	return path.Join(tilesPath, tilesManifestFileName), nil
+}
+
+/*
+generatePyramid rotates the image by its exif orientation like the scaled images and writes its pyramid to the
+directory. Both commands hold a scale slot, so that tiles don't exceed the concurrent scales.
+*/
+func (t *TilePyramid) generatePyramid(file string, rotatedFile string, pyramidDirectory string) error {
+	defer acquireScaleSlot(scaleSlots)()
+	start := time.Now()
+
+	_, err := t.runVips("autorot", file, rotatedFile)
+	if err != nil {
+		return err
+	}
+	if err = os.Mkdir(pyramidDirectory, 0700); err != nil {
+		return err
+	}
+	_, err = t.runVips("dzsave", rotatedFile, filepath.Join(pyramidDirectory, tilesBaseName),
+		"--layout", "dz",
+		"--tile-size", strconv.Itoa(t.tileSize),
+		"--overlap", strconv.Itoa(t.overlap),
+		"--suffix", ".jpg[Q=85,strip]")
+	if err != nil {
+		return err
+	}
+
+	metrics.ObserveScaleDuration("tiles", start)
+	return nil
+}
+
+// Runs the operation with the options of libvips (concurrency and cache limits) preceding it
+func (t *TilePyramid) runVips(operation string, args ...string) ([]byte, error) {
+	return t.runCommand(vipsCommand, append(append(append([]string{}, t.vipsOptions...), operation), args...)...)
+}
+
+func (t *TilePyramid) dimensionsOf(file string) (int, int, error) {
+	width, err := t.headerField(file, "width")
+	if err != nil {
+		return 0, 0, err
+	}
+	height, err := t.headerField(file, "height")
+	if err != nil {
+		return 0, 0, err
+	}
+	return width, height, nil
+}
+
+func (t *TilePyramid) headerField(file string, field string) (int, error) {
+	output, err := t.runCommand(vipsHeaderCommand, "-f", field, file)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(output)))
+}
+
+/*
+upload uploads the files of the directory keeping their relative path, the manifest is uploaded last so that
+viewers don't find it before all tiles exist
+*/
+func (t *TilePyramid) upload(directory string, tilesPath string) error {
+	var tiles []string
+	err := filepath.WalkDir(directory, func(file string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() && entry.Name() != tilesManifestFileName {
+			tiles = append(tiles, file)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	uploadFn := func(file string, contentType string) error {
+		relativePath, err := filepath.Rel(directory, file)
+		if err != nil {
+			return err
+		}
+		blobPath, fileName := path.Split(filepath.ToSlash(relativePath))
+		return storage.UploadFile(t.blobStore, path.Join(tilesPath, blobPath), fileName, file, nil, contentType)
+	}
+
+	// Upload the tiles with a bounded number of workers, a pyramid of a plan has thousands of tiles
+	files := make(chan string)
+	errs := make(chan error, t.uploadConcurrency)
+	for worker := 0; worker < t.uploadConcurrency; worker++ {
+		go func() {
+			var workerErr error
+			for file := range files {
+				if workerErr == nil {
+					workerErr = uploadFn(file, contentTypeJpeg)
+				}
+			}
+			errs <- workerErr
+		}()
+	}
+	for _, file := range tiles {
+		files <- file
+	}
+	close(files)
+
+	var uploadErrs []error
+	for worker := 0; worker < t.uploadConcurrency; worker++ {
+		uploadErrs = append(uploadErrs, <-errs)
+	}
+	if err = errors.Join(uploadErrs...); err != nil {
+		return err
+	}
+
+	return uploadFn(filepath.Join(directory, tilesManifestFileName), contentTypeDzi)
+}
+
+/*
+vipsOptionsOf returns the command line options applying the concurrency and cache limits of this process (see
+vipsConfigOf) to the command line tools of libvips
+*/
+func vipsOptionsOf(properties properties.ImageProperties) []string {
+	config := vipsConfigOf(properties)
+	var options []string
+	if config.ConcurrencyLevel > 0 {
+		options = append(options, "--vips-concurrency", strconv.Itoa(config.ConcurrencyLevel))
+	}
+	return append(options,
+		"--vips-cache-max", strconv.Itoa(config.MaxCacheSize),
+		"--vips-cache-max-memory", strconv.Itoa(config.MaxCacheMem),
+		"--vips-cache-max-files", strconv.Itoa(config.MaxCacheFiles))
+}
+
+func runCommand(name string, args ...string) ([]byte, error) {
+	output, err := exec.Command(name, args...).Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return nil, fmt.Errorf("%s failed: %w: %s", name, err, strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return output, err
+}
+
+func valueOrDefault(value int, defaultValue int) int {
+	if value == 0 {
+		return defaultValue
+	}
+	return value
+}
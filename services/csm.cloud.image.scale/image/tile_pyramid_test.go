@@ -0,0 +1,168 @@
+package image
+
+import (
+	"csm.cloud.image.scale/config/properties"
+	"csm.cloud.image.scale/storage"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+type fakeVipsCommands struct {
+	width    string
+	height   string
+	autorot  [][]string
+	dzsave   [][]string
+	dzsaveFn func(base string) error
+}
+
+func (f *fakeVipsCommands) run(name string, args ...string) ([]byte, error) {
+	if name == vipsHeaderCommand {
+		if args[1] == "width" {
+			return []byte(f.width + "\n"), nil
+		}
+		return []byte(f.height + "\n"), nil
+	}
+
+	// The operation follows the options of libvips
+	operation := slices.IndexFunc(args, func(arg string) bool {
+		return arg == "autorot" || arg == "dzsave"
+	})
+	if args[operation] == "autorot" {
+		f.autorot = append(f.autorot, args)
+		return nil, os.WriteFile(args[len(args)-1], []byte("rotated"), 0600)
+	}
+	f.dzsave = append(f.dzsave, args)
+	return nil, f.dzsaveFn(args[operation+2])
+}
+
+// Writes a pyramid like dzsave does with the dz layout
+func writeTestPyramid(base string) error {
+	for _, file := range []string{base + ".dzi", base + "_files/0/0_0.jpg", base + "_files/1/0_0.jpg", base + "_files/1/1_0.jpg"} {
+		if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			return err
+		}
+		if err := os.WriteFile(file, []byte(filepath.Base(file)), 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newTestTilePyramid(t *testing.T, commands *fakeVipsCommands) (*TilePyramid, storage.BlobStore) {
+	blobStore := storage.NewLocalBlobStore(properties.StorageProperties{
+		Type:          storage.BlobStoreTypeLocal,
+		ContainerName: "csm",
+		Local:         properties.LocalStorageProperties{Directory: t.TempDir()},
+	})
+	tilePyramid := NewTilePyramid(properties.TilesProperties{Enabled: true, MinDimension: 10000, UploadConcurrency: 2},
+		properties.ImageProperties{Concurrency: 2}, blobStore)
+	tilePyramid.runCommand = commands.run
+	return tilePyramid, blobStore
+}
+
+func TestTilePyramid_GeneratesAndUploadsPyramidOfLargeImages(t *testing.T) {
+
+	// prepare
+	commands := &fakeVipsCommands{width: "20000", height: "14000", dzsaveFn: writeTestPyramid}
+	tilePyramid, blobStore := newTestTilePyramid(t, commands)
+
+	// execute
+	manifest, err := tilePyramid.Generate("/tmp/plan.png", "task1", "image1")
+
+	// verify
+	assert.Nil(t, err)
+	assert.Equal(t, "project/image/tiles/task1/image1/image.dzi", manifest)
+	vipsOptions := []string{"--vips-concurrency", "2", "--vips-cache-max", "100", "--vips-cache-max-memory", "52428800", "--vips-cache-max-files", "100"}
+	assert.Len(t, commands.autorot, 1)
+	assert.Equal(t, append(vipsOptions, "autorot", "/tmp/plan.png"), commands.autorot[0][:len(commands.autorot[0])-1])
+	rotatedFile := commands.autorot[0][len(commands.autorot[0])-1]
+	assert.Len(t, commands.dzsave, 1)
+	assert.Equal(t, append(vipsOptions, "dzsave", rotatedFile), commands.dzsave[0][:len(vipsOptions)+2], "The rotated image should be tiled")
+	assert.Equal(t, []string{"--layout", "dz", "--tile-size", "254", "--overlap", "1", "--suffix", ".jpg[Q=85,strip]"}, commands.dzsave[0][len(vipsOptions)+3:])
+	manifestBlob, err := blobStore.DownloadBlob("project/image/tiles/task1/image1", "image.dzi")
+	assert.Nil(t, err)
+	assert.Equal(t, "image.dzi", string(manifestBlob.Buffer))
+	tileBlob, err := blobStore.DownloadBlob("project/image/tiles/task1/image1/image_files/1", "1_0.jpg")
+	assert.Nil(t, err)
+	assert.Equal(t, "1_0.jpg", string(tileBlob.Buffer))
+	blobNames, err := blobStore.ListBlobs("project/image/tiles/task1/image1/")
+	assert.Nil(t, err)
+	assert.Len(t, blobNames, 4, "The rotated image should not be uploaded")
+}
+
+func TestTilePyramid_WaitsForFreeScaleSlot(t *testing.T) {
+
+	// prepare
+	commands := &fakeVipsCommands{width: "20000", height: "14000", dzsaveFn: writeTestPyramid}
+	tilePyramid, _ := newTestTilePyramid(t, commands)
+	scaleSlots = newScaleSlots(1)
+	defer func() {
+		scaleSlots = nil
+	}()
+	releaseFn := acquireScaleSlot(scaleSlots)
+	generated := make(chan error)
+
+	// execute
+	go func() {
+		_, err := tilePyramid.Generate("/tmp/plan.png", "task1", "image1")
+		generated <- err
+	}()
+
+	// verify
+	select {
+	case <-generated:
+		t.Fatal("tiles were generated while all scale slots are in use")
+	case <-time.After(50 * time.Millisecond):
+	}
+	releaseFn()
+	select {
+	case err := <-generated:
+		assert.Nil(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("tiles weren't generated after the scale slot was released")
+	}
+}
+
+func TestTilePyramid_SkipsSmallImages(t *testing.T) {
+
+	// prepare
+	commands := &fakeVipsCommands{width: "4000", height: "9999", dzsaveFn: writeTestPyramid}
+	tilePyramid, _ := newTestTilePyramid(t, commands)
+
+	// execute
+	manifest, err := tilePyramid.Generate("/tmp/photo.jpg", "task1", "image1")
+	var disabledTilePyramid *TilePyramid
+	disabledManifest, disabledErr := disabledTilePyramid.Generate("/tmp/plan.png", "task1", "image1")
+
+	// verify
+	assert.Nil(t, err)
+	assert.Empty(t, manifest)
+	assert.Empty(t, commands.dzsave)
+	assert.Nil(t, NewTilePyramid(properties.TilesProperties{}, properties.ImageProperties{}, nil))
+	assert.Nil(t, disabledErr)
+	assert.Empty(t, disabledManifest)
+}
+
+func TestTilePyramid_ReturnsErrorOfDzsave(t *testing.T) {
+
+	// prepare
+	dzsaveErr := errors.New("dzsave failed")
+	commands := &fakeVipsCommands{width: "20000", height: "14000", dzsaveFn: func(base string) error {
+		return dzsaveErr
+	}}
+	tilePyramid, blobStore := newTestTilePyramid(t, commands)
+
+	// execute
+	manifest, err := tilePyramid.Generate("/tmp/plan.png", "task1", "image1")
+
+	// verify
+	assert.ErrorIs(t, err, dzsaveErr)
+	assert.Empty(t, manifest)
+	_, err = blobStore.DownloadBlob("project/image/tiles/task1/image1", "image.dzi")
+	assert.ErrorIs(t, err, storage.ErrBlobNotFound)
+}
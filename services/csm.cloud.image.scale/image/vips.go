@@ -0,0 +1,98 @@
+package image
+
+import (
+	"csm.cloud.image.scale/config/properties"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/metrics"
+	"github.com/davidbyttow/govips/v2/vips"
+	"time"
+)
+
+// Defaults of the operation cache, govips passes 0 to libvips (disabling the cache) instead of keeping its defaults
+const (
+	defaultMaxCacheMemory     = 50 * 1024 * 1024
+	defaultMaxCacheFiles      = 100
+	defaultMaxCacheOperations = 100
+)
+
+// Slots of concurrent scales, scales aren't limited until StartupVips is called (e.g. in tests)
+var scaleSlots chan struct{}
+
+/*
+StartupVips starts libvips with the configured concurrency and cache limits and limits the number of concurrent
+scales. The returned function stops exporting the memory statistics and shuts libvips down.
+*/
+func StartupVips(properties properties.ImageProperties) func() {
+	vips.LoggingSettings(nil, vips.LogLevelWarning)
+	vips.Startup(vipsConfigOf(properties))
+	scaleSlots = newScaleSlots(properties.MaxConcurrentScales)
+
+	stopStatsFn := exportVipsMemoryStats(properties.MemoryStatsInterval)
+	return func() {
+		stopStatsFn()
+		vips.Shutdown()
+	}
+}
+
+/*
+vipsConfigOf returns the libvips configuration with the defaults applied to the cache limits that aren't set (0).
+A concurrency of 0 lets libvips use the number of cpus.
+*/
+func vipsConfigOf(properties properties.ImageProperties) *vips.Config {
+	return &vips.Config{
+		ConcurrencyLevel: properties.Concurrency,
+		MaxCacheMem:      valueOrDefault(properties.MaxCacheMemory, defaultMaxCacheMemory),
+		MaxCacheFiles:    valueOrDefault(properties.MaxCacheFiles, defaultMaxCacheFiles),
+		MaxCacheSize:     valueOrDefault(properties.MaxCacheOperations, defaultMaxCacheOperations),
+	}
+}
+
+func newScaleSlots(maxConcurrentScales int) chan struct{} {
+	if maxConcurrentScales <= 0 {
+		return nil
+	}
+	return make(chan struct{}, maxConcurrentScales)
+}
+
+/*
+acquireScaleSlot blocks until a scale slot is free, the returned function releases the slot
+*/
+func acquireScaleSlot(slots chan struct{}) func() {
+	if slots != nil {
+		slots <- struct{}{}
+	}
+	metrics.ScalesInProgress.Inc()
+	return func() {
+		metrics.ScalesInProgress.Dec()
+		if slots != nil {
+			<-slots
+		}
+	}
+}
+
+/*
+exportVipsMemoryStats exports the memory statistics of libvips in the given interval until the returned function
+is called
+*/
+func exportVipsMemoryStats(interval time.Duration) func() {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				stats := vips.MemoryStats{}
+				vips.ReadVipsMemStats(&stats)
+				metrics.VipsMemory.Set(float64(stats.Mem))
+				metrics.VipsMemoryHigh.Set(float64(stats.MemHigh))
+				metrics.VipsAllocations.Set(float64(stats.Allocs))
+				metrics.VipsFiles.Set(float64(stats.Files))
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
@@ -0,0 +1,76 @@
+package image
+
+import (
+	"csm.cloud.image.scale/config/properties"
+	"github.com/davidbyttow/govips/v2/vips"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+var startupTestVipsOnce sync.Once
+
+// Starts libvips once for the tests scaling real images, it is shut down with the test process
+func startupTestVips() {
+	startupTestVipsOnce.Do(func() {
+		vips.LoggingSettings(nil, vips.LogLevelWarning)
+		vips.Startup(nil)
+	})
+}
+
+func TestAcquireScaleSlot_WaitsForFreeSlot(t *testing.T) {
+
+	// prepare
+	slots := newScaleSlots(1)
+	releaseFn := acquireScaleSlot(slots)
+	acquired := make(chan struct{})
+
+	// execute
+	go func() {
+		defer acquireScaleSlot(slots)()
+		close(acquired)
+	}()
+
+	// verify
+	select {
+	case <-acquired:
+		t.Fatal("second scale acquired a slot while the first one is running")
+	case <-time.After(50 * time.Millisecond):
+	}
+	releaseFn()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("second scale didn't acquire the released slot")
+	}
+}
+
+func TestAcquireScaleSlot_UnlimitedWithoutSlots(t *testing.T) {
+
+	// prepare
+	slots := newScaleSlots(0)
+
+	// execute
+	releaseFns := []func(){acquireScaleSlot(slots), acquireScaleSlot(slots)}
+
+	// verify
+	assert.Nil(t, slots)
+	for _, releaseFn := range releaseFns {
+		releaseFn()
+	}
+}
+
+func TestVipsConfigOf_AppliesCacheDefaults(t *testing.T) {
+
+	// execute
+	config := vipsConfigOf(properties.ImageProperties{MaxCacheFiles: 20})
+
+	// verify
+	assert.Equal(t, &vips.Config{
+		ConcurrencyLevel: 0,
+		MaxCacheMem:      defaultMaxCacheMemory,
+		MaxCacheFiles:    20,
+		MaxCacheSize:     defaultMaxCacheOperations,
+	}, config, "Unset cache limits (0) must not disable the operation cache")
+}
@@ -0,0 +1,162 @@
+package image
+
+import (
+	"csm.cloud.image.scale/config/properties"
+	"fmt"
+	"github.com/davidbyttow/govips/v2/vips"
+	"time"
+)
+
+const (
+	defaultWatermarkFont = "sans 16"
+	// Height of the bar below the image holding the text and logo
+	watermarkBarHeight = 48
+	watermarkMargin    = 8
+
+	// Capture time (local time of the camera) and its offset to UTC (if written by the camera)
+	exifDateTimeOriginal   = "exif-ifd2-DateTimeOriginal"
+	exifOffsetTimeOriginal = "exif-ifd2-OffsetTimeOriginal"
+	exifDateTimeLayout     = "2006:01:02 15:04:05"
+	exifOffsetLayout       = "-07:00"
+)
+
+/*
+Watermark stamps the capture time and the project onto scaled images, so that they can serve as evidence.
+The stamp is rendered into a bar added below the image, the image content isn't covered. The image is shrunk by the
+height of the bar, so that the watermarked image keeps the size of the scaled image (e.g. fits the fullhd box).
+*/
+type Watermark struct {
+	ownerTypes map[string]bool
+	font       string
+	logoFile   string
+}
+
+/*
+NewWatermark creates the watermark for the configured owner types, nil if no owner type is configured
+*/
+func NewWatermark(properties properties.WatermarkProperties) *Watermark {
+	if len(properties.OwnerTypes) == 0 {
+		return nil
+	}
+
+	font := properties.Font
+	if font == "" {
+		font = defaultWatermarkFont
+	}
+
+	ownerTypes := make(map[string]bool)
+	for _, ownerType := range properties.OwnerTypes {
+		ownerTypes[ownerType] = true
+	}
+	return &Watermark{
+		ownerTypes: ownerTypes,
+		font:       font,
+		logoFile:   properties.LogoFile,
+	}
+}
+
+/*
+AppliesTo returns true if images of the owner type (e.g. TASK_ATTACHMENT) are watermarked
+*/
+func (w *Watermark) AppliesTo(ownerType string) bool {
+	return w != nil && w.ownerTypes[ownerType]
+}
+
+/*
+Stage returns the stage stamping the capture time in the timezone of the uploader and the project identifier.
+Images without capture time in the exif data are stamped with the upload time.
+*/
+func (w *Watermark) Stage(projectIdentifier string, timezone string, uploadTime time.Time) ImageStage {
+	return func(image *vips.ImageRef) error {
+		location, err := time.LoadLocation(timezone)
+		if err != nil {
+			location = time.UTC
+		}
+		captureTime, captured := captureTimeOf(image.GetString(exifDateTimeOriginal), image.GetString(exifOffsetTimeOriginal), location)
+		if !captured {
+			captureTime = uploadTime.In(location)
+		}
+		return w.render(image, watermarkText(captureTime, captured, projectIdentifier))
+	}
+}
+
+func (w *Watermark) render(image *vips.ImageRef, text string) error {
+	width := image.Width()
+	height := image.Height()
+
+	// Shrink the image to make room for the bar, tiny images are extended by the bar only
+	if height > 2*watermarkBarHeight {
+		err := image.ThumbnailWithSize(width, height-watermarkBarHeight, vips.InterestingNone, vips.SizeDown)
+		if err != nil {
+			return err
+		}
+		width, height = image.Width(), image.Height()
+	}
+
+	// Extend the canvas by a black bar below the image
+	err := image.EmbedBackground(0, 0, width, height+watermarkBarHeight, &vips.Color{})
+	if err != nil {
+		return err
+	}
+
+	// Render the logo right-aligned into the bar
+	logoWidth := 0
+	if w.logoFile != "" {
+		logo, err := vips.NewThumbnailFromFile(w.logoFile, width/4, watermarkBarHeight-2*watermarkMargin, vips.InterestingNone)
+		if err != nil {
+			return err
+		}
+		defer logo.Close()
+		logoWidth = logo.Width() + watermarkMargin
+		err = image.Composite(logo, vips.BlendModeOver, width-watermarkMargin-logo.Width(), height+watermarkMargin)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Render the text left-aligned into the bar
+	return image.Label(&vips.LabelParams{
+		Text:      text,
+		Font:      w.font,
+		Width:     vips.ValueOf(float64(width - 2*watermarkMargin - logoWidth)),
+		Height:    vips.ValueOf(float64(watermarkBarHeight - 2*watermarkMargin)),
+		OffsetX:   vips.ValueOf(float64(watermarkMargin)),
+		OffsetY:   vips.ValueOf(float64(height + watermarkMargin)),
+		Opacity:   1,
+		Color:     vips.Color{R: 255, G: 255, B: 255},
+		Alignment: vips.AlignLow,
+	})
+}
+
+/*
+captureTimeOf parses the exif capture time as formatted by libvips (e.g. "2023:10:18 12:37:42 (2023:10:18 12:37:42,
+ASCII, 20 components, 20 bytes)"). Without offset the capture time is taken as local time of the location.
+*/
+func captureTimeOf(exifDateTime string, exifOffset string, location *time.Location) (time.Time, bool) {
+	if len(exifDateTime) < len(exifDateTimeLayout) {
+		return time.Time{}, false
+	}
+
+	// Apply the offset if the camera has written it
+	if len(exifOffset) >= len(exifOffsetLayout) {
+		captureTime, err := time.Parse(exifDateTimeLayout+exifOffsetLayout,
+			exifDateTime[:len(exifDateTimeLayout)]+exifOffset[:len(exifOffsetLayout)])
+		if err == nil {
+			return captureTime.In(location), true
+		}
+	}
+
+	captureTime, err := time.ParseInLocation(exifDateTimeLayout, exifDateTime[:len(exifDateTimeLayout)], location)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return captureTime, true
+}
+
+func watermarkText(captureTime time.Time, captured bool, projectIdentifier string) string {
+	label := "Captured"
+	if !captured {
+		label = "Uploaded"
+	}
+	return fmt.Sprintf("%s %s | Project %s", label, captureTime.Format("2006-01-02 15:04:05 MST"), projectIdentifier)
+}
@@ -0,0 +1,98 @@
+package image
+
+import (
+	"csm.cloud.image.scale/config/properties"
+	"github.com/davidbyttow/govips/v2/vips"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestNewWatermark_AppliesToConfiguredOwnerTypes(t *testing.T) {
+
+	// execute
+	watermark := NewWatermark(properties.WatermarkProperties{OwnerTypes: []string{"TASK_ATTACHMENT"}})
+	disabledWatermark := NewWatermark(properties.WatermarkProperties{})
+
+	// verify
+	assert.True(t, watermark.AppliesTo("TASK_ATTACHMENT"))
+	assert.False(t, watermark.AppliesTo("USER_PICTURE"))
+	assert.Equal(t, defaultWatermarkFont, watermark.font)
+	assert.Nil(t, disabledWatermark)
+	assert.False(t, disabledWatermark.AppliesTo("TASK_ATTACHMENT"))
+}
+
+func TestCaptureTimeOf(t *testing.T) {
+
+	// prepare
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	assert.Nil(t, err)
+	exifDateTime := "2023:10:18 12:37:42 (2023:10:18 12:37:42, ASCII, 20 components, 20 bytes)"
+
+	// execute
+	localTime, localCaptured := captureTimeOf(exifDateTime, "", berlin)
+	offsetTime, offsetCaptured := captureTimeOf(exifDateTime, "+00:00 (+00:00, ASCII, 7 components, 7 bytes)", berlin)
+	_, missingCaptured := captureTimeOf("", "", berlin)
+	_, invalidCaptured := captureTimeOf("0000:00:00 00:00:00", "", berlin)
+
+	// verify
+	assert.True(t, localCaptured)
+	assert.Equal(t, "2023-10-18 12:37:42 CEST", localTime.Format("2006-01-02 15:04:05 MST"))
+	assert.True(t, offsetCaptured)
+	assert.Equal(t, "2023-10-18 14:37:42 CEST", offsetTime.Format("2006-01-02 15:04:05 MST"))
+	assert.False(t, missingCaptured)
+	assert.False(t, invalidCaptured)
+}
+
+func TestWatermarkText(t *testing.T) {
+
+	// prepare
+	captureTime := time.Date(2023, 10, 18, 12, 37, 42, 0, time.UTC)
+
+	// execute and verify
+	assert.Equal(t, "Captured 2023-10-18 12:37:42 UTC | Project 1", watermarkText(captureTime, true, "1"))
+	assert.Equal(t, "Uploaded 2023-10-18 12:37:42 UTC | Project 1", watermarkText(captureTime, false, "1"))
+}
+
+func TestWatermark_RenderKeepsSizeOfScaledImage(t *testing.T) {
+	startupTestVips()
+	watermark := NewWatermark(properties.WatermarkProperties{OwnerTypes: []string{"TASK_ATTACHMENT"}})
+
+	for _, size := range []struct{ width, height, expectedWidth int }{
+		{width: 1920, height: 1440, expectedWidth: 1856},
+		{width: 1440, height: 1920, expectedWidth: 1404},
+		{width: 1920, height: 1920, expectedWidth: 1872},
+	} {
+
+		// prepare
+		image, err := vips.Black(size.width, size.height)
+		assert.Nil(t, err)
+
+		// execute
+		err = watermark.render(image, "Captured 2023-10-18 12:37:42 CEST | Project project1")
+
+		// verify
+		assert.Nil(t, err)
+		assert.Equal(t, size.expectedWidth, image.Width())
+		assert.Equal(t, size.height, image.Height(), "The bar must not extend the image beyond the fullhd box")
+		image.Close()
+	}
+}
+
+func TestWatermark_RenderExtendsTinyImageByBar(t *testing.T) {
+
+	// prepare
+	startupTestVips()
+	watermark := NewWatermark(properties.WatermarkProperties{OwnerTypes: []string{"TASK_ATTACHMENT"}})
+	image, err := vips.Black(64, 64)
+	assert.Nil(t, err)
+	defer image.Close()
+
+	// execute
+	err = watermark.render(image, "Captured 2023-10-18 12:37:42 CEST | Project project1")
+
+	// verify
+	assert.Nil(t, err)
+	assert.Equal(t, 64, image.Width())
+	assert.Equal(t, 64+watermarkBarHeight, image.Height())
+}
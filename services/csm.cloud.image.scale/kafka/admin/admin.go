@@ -22,6 +22,15 @@ func CreateTopicsIfNeeded(configuration config.Configuration) {
 		topicSpecifications := make([]kafka.TopicSpecification, 0)
 		topicSpecifications = append(topicSpecifications, topicSpecification)
 
+		// The image erased events are sent to a topic of their own (with the settings of the scaled topic)
+		if configuration.Erasure.Enabled {
+			topicSpecifications = append(topicSpecifications, kafka.TopicSpecification{
+				Topic:             configuration.Erasure.ErasedTopic,
+				NumPartitions:     scaledTopic.Partitions,
+				ReplicationFactor: scaledTopic.ReplicationFactor,
+			})
+		}
+
 		kafkaAdmin := configurer.ConfigureKafkaAdminClient(configuration.Kafka.Broker)
 		admin.CreateTopics(kafkaAdmin, topicSpecifications)
 	}
@@ -0,0 +1,92 @@
+package consumer
+
+import (
+	"context"
+	"csm.cloud.image.scale/config/properties"
+	"csm.cloud.image.scale/domain"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/app"
+	commonProperties "dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/config/properties"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/kafka"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/kafka/consumer"
+	consumerConfigurer "dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/kafka/consumer/configurer"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/kafka/consumer/deserializer"
+)
+
+// Name of the events of the project and user services deleting their aggregate
+const eventNameDeleted = "DELETED"
+
+/*
+ListenToDeletions consumes the events of the project and user topics with a separate consumer group and passes the
+deletions of aggregates to the callback. Other events, tombstones and records with other keys are skipped. Fails
+fast (in panic) if the erasure properties are incomplete.
+*/
+func ListenToDeletions(kafkaProperties properties.KafkaProperties, erasureProperties properties.ErasureProperties,
+	deserializer deserializer.Deserializer, callback func(event AggregateDeletedEvent) error) *consumer.SynchronousKafkaConsumer {
+	if erasureProperties.GroupId == "" || erasureProperties.ProjectTopic == "" || erasureProperties.UserTopic == "" {
+		panic(app.NewFatalError("Erasure requires a consumer group id and the project and user topics", nil))
+	}
+	consumerProperties := commonProperties.ConsumerProperties{
+		GroupId:     erasureProperties.GroupId,
+		ReadTimeout: kafkaProperties.Consumer.ReadTimeout,
+	}
+
+	kafkaConsumer := consumerConfigurer.ConfigureKafkaConsumer(kafkaProperties.Broker, consumerProperties)
+	listener := consumer.NewSynchronousKafkaConsumer(kafkaConsumer, deserializer)
+	topics := []string{erasureProperties.ProjectTopic, erasureProperties.UserTopic}
+	err := listener.Consume(consumerProperties, topics, func(record kafka.Record) error {
+		key, ok := messageKeyOf(record.Message.Key)
+		if !ok || !isDeletion(record.Message.Value) {
+			return nil
+		}
+		return callback(AggregateDeletedEvent{
+			Ctx: record.Ctx,
+			Key: key,
+		})
+	})
+	if err != nil {
+		panic(app.NewFatalError("Failed to register kafka deletion listener", err))
+	}
+	return &listener
+}
+
+type AggregateDeletedEvent struct {
+	Ctx context.Context
+	Key domain.MessageKey
+}
+
+// Converts a deserialized MessageKeyAvro, false for other keys
+func messageKeyOf(value any) (domain.MessageKey, bool) {
+	record, ok := value.(map[string]any)
+	if !ok {
+		return domain.MessageKey{}, false
+	}
+	rootContextIdentifier, ok := record["rootContextIdentifier"].(string)
+	if !ok {
+		return domain.MessageKey{}, false
+	}
+	aggregateIdentifier, ok := record["aggregateIdentifier"].(map[string]any)
+	if !ok {
+		return domain.MessageKey{}, false
+	}
+	identifier, identifierOk := aggregateIdentifier["identifier"].(string)
+	version, versionOk := aggregateIdentifier["version"].(int64)
+	aggregateType, typeOk := aggregateIdentifier["type"].(string)
+	if !identifierOk || !versionOk || !typeOk {
+		return domain.MessageKey{}, false
+	}
+
+	return domain.MessageKey{
+		RootContextIdentifier: rootContextIdentifier,
+		AggregateIdentifier: domain.AggregateIdentifier{
+			Identifier: identifier,
+			Version:    version,
+			Type:       aggregateType,
+		},
+	}, true
+}
+
+// Returns true for deserialized events (e.g. ProjectEventAvro or UserEventAvro) named DELETED
+func isDeletion(value any) bool {
+	record, ok := value.(map[string]any)
+	return ok && record["name"] == eventNameDeleted
+}
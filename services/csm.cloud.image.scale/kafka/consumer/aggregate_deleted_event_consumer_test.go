@@ -0,0 +1,91 @@
+package consumer
+
+import (
+	"csm.cloud.image.scale/domain"
+	serializer "dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/kafka/producer/serializer/avro"
+	"github.com/riferrei/srclient"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+// Reduced schema of the events of the project and user services (e.g. TaskEventAvro)
+const testAggregateEventSchema = `{
+  "type": "record",
+  "name": "TaskEventAvro",
+  "namespace": "com.bosch.pt.csm.cloud.projectmanagement.task.messages",
+  "fields": [
+    {"name": "name", "type": {"type": "enum", "name": "TaskEventEnumAvro", "symbols": ["CREATED", "UPDATED", "DELETED"]}},
+    {"name": "aggregate", "type": {"type": "record", "name": "TaskAggregateAvro", "fields": [{"name": "name", "type": "string"}]}}
+  ]
+}`
+
+func registerTestSchemas(t *testing.T) (srclient.ISchemaRegistryClient, *srclient.Schema, *srclient.Schema) {
+	client := srclient.CreateMockSchemaRegistryClient("mock://registry")
+	keySchemaBytes, err := os.ReadFile("../../resources/avro/MessageKeyAvro.avsc")
+	assert.Nil(t, err)
+	keySchema, err := client.CreateSchema("csm.test.project-key", string(keySchemaBytes), srclient.Avro)
+	assert.Nil(t, err)
+	valueSchema, err := client.CreateSchema("csm.test.project-value", testAggregateEventSchema, srclient.Avro)
+	assert.Nil(t, err)
+	return client, keySchema, valueSchema
+}
+
+func TestWriterSchemaDeserializer_DeserializesDeletionWithRegisteredSchema(t *testing.T) {
+
+	// prepare
+	client, keySchema, valueSchema := registerTestSchemas(t)
+	key, err := serializer.NewAvroSerializer(keySchema).Serialize(&domain.MessageKey{
+		RootContextIdentifier: "project1",
+		AggregateIdentifier:   domain.AggregateIdentifier{Identifier: "task1", Version: 2, Type: "TASK"},
+	})
+	assert.Nil(t, err)
+	value, err := serializer.NewAvroSerializer(valueSchema).Serialize(map[string]any{
+		"name":      "DELETED",
+		"aggregate": map[string]any{"name": "Task"},
+	})
+	assert.Nil(t, err)
+	deserializer := NewWriterSchemaDeserializer(client)
+
+	// execute
+	deserializedKey, keyErr := deserializer.Deserialize(key)
+	deserializedValue, valueErr := deserializer.Deserialize(value)
+
+	// verify
+	assert.Nil(t, keyErr)
+	assert.Nil(t, valueErr)
+	messageKey, ok := messageKeyOf(deserializedKey)
+	assert.True(t, ok)
+	assert.Equal(t, domain.MessageKey{
+		RootContextIdentifier: "project1",
+		AggregateIdentifier:   domain.AggregateIdentifier{Identifier: "task1", Version: 2, Type: "TASK"},
+	}, messageKey)
+	assert.True(t, isDeletion(deserializedValue))
+}
+
+func TestWriterSchemaDeserializer_TombstonesAndInvalidData(t *testing.T) {
+
+	// prepare
+	client, _, _ := registerTestSchemas(t)
+	deserializer := NewWriterSchemaDeserializer(client)
+
+	// execute
+	tombstone, tombstoneErr := deserializer.Deserialize(nil)
+	_, invalidErr := deserializer.Deserialize([]byte("{}"))
+	_, unknownSchemaErr := deserializer.Deserialize([]byte{0, 0, 0, 0, 99, 2})
+
+	// verify
+	assert.Nil(t, tombstone)
+	assert.Nil(t, tombstoneErr)
+	assert.NotNil(t, invalidErr)
+	assert.NotNil(t, unknownSchemaErr)
+	assert.False(t, isDeletion(tombstone))
+}
+
+func TestIsDeletion_OtherEventsAndKeys(t *testing.T) {
+
+	// execute and verify
+	assert.False(t, isDeletion(map[string]any{"name": "UPDATED"}))
+	_, ok := messageKeyOf(map[string]any{"identifier": "file1"})
+	assert.False(t, ok, "String message keys should be skipped")
+}
@@ -13,8 +13,12 @@ import (
 	"reflect"
 )
 
+/*
+Listen consumes FileCreatedEvents asynchronously and passes them to the callback. The returned consumer can be
+paused and resumed at runtime.
+*/
 func Listen(properties properties.KafkaProperties,
-	deserializers []avro.AvroTypeDeserializer, callback func(event Event) error) {
+	deserializers []avro.AvroTypeDeserializer, callback func(event Event) error) *consumer.SynchronousKafkaConsumer {
 	deserializer := avro.NewAvroDeserializer(deserializers)
 
 	kafkaConsumer := consumerConfigurer.ConfigureKafkaConsumer(properties.Broker, properties.Consumer)
@@ -40,6 +44,7 @@ func Listen(properties properties.KafkaProperties,
 	if err != nil {
 		panic(app.NewFatalError("Failed to register kafka message listener", err))
 	}
+	return &listener
 }
 
 type Event struct {
@@ -0,0 +1,76 @@
+package consumer
+
+import (
+	"csm.cloud.image.scale/domain"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/kafka/consumer/deserializer/avro"
+	serializer "dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/kafka/producer/serializer/avro"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/test"
+	"github.com/riferrei/srclient"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestFileCreatedEventDeserialization_BothSchemaVersions(t *testing.T) {
+
+	// prepare
+	schemaV1 := createSchema("../../resources/avro/FileCreatedEventAvroV1.avsc", 1)
+	schemaV2 := createSchema("../../resources/avro/FileCreatedEventAvro.avsc", 2)
+	deserializer := avro.NewAvroDeserializer([]avro.AvroTypeDeserializer{
+		avro.NewAvroTypeDeserializer[domain.FileCreatedEvent](schemaV2),
+		avro.NewAvroTypeDeserializer[domain.FileCreatedEvent](schemaV1),
+	})
+
+	// Serialize events as produced by the storage event service before and after the schema change
+	valueV1, err := serializer.NewAvroSerializer(schemaV1).Serialize(map[string]any{
+		"identifier":    "/images/file.png",
+		"path":          "/images",
+		"filename":      "file.png",
+		"contentType":   "image/png",
+		"contentLength": 100,
+	})
+	assert.Nil(t, err)
+	valueV2, err := serializer.NewAvroSerializer(schemaV2).Serialize(map[string]any{
+		"identifier":       "/images/file.png",
+		"path":             "/images",
+		"filename":         "file.png",
+		"contentType":      "image/png",
+		"contentLength":    100,
+		"storageAccount":   map[string]any{"string": "defendermalwaretest"},
+		"container":        nil,
+		"eTag":             map[string]any{"string": "0x8DBCFD701F78E3B"},
+		"sha256":           nil,
+		"scanFinishedTime": nil,
+		"correlationId":    nil,
+		"eventTime":        nil,
+	})
+	assert.Nil(t, err)
+
+	// execute
+	eventV1, errV1 := deserializer.Deserialize(valueV1)
+	eventV2, errV2 := deserializer.Deserialize(valueV2)
+
+	// verify
+	assert.Nil(t, errV1)
+	assert.Equal(t, "/images/file.png", eventV1.(domain.FileCreatedEvent).Identifier)
+	assert.Nil(t, eventV1.(domain.FileCreatedEvent).StorageAccount)
+
+	assert.Nil(t, errV2)
+	assert.Equal(t, "/images/file.png", eventV2.(domain.FileCreatedEvent).Identifier)
+	assert.Equal(t, "defendermalwaretest", eventV2.(domain.FileCreatedEvent).StorageAccount.String)
+	assert.Equal(t, "0x8DBCFD701F78E3B", eventV2.(domain.FileCreatedEvent).ETag.String)
+	assert.Nil(t, eventV2.(domain.FileCreatedEvent).Container)
+}
+
+func createSchema(schemaFile string, id int) *srclient.Schema {
+	schemaBytes, err := os.ReadFile(schemaFile)
+	if err != nil {
+		panic(err)
+	}
+
+	schema := &srclient.Schema{}
+	test.SetFieldValueForTesting(schema, "schema", string(schemaBytes))
+	test.SetFieldValueForTesting(schema, "id", id)
+	test.SetFieldValueForTesting(schema, "version", id)
+	return schema
+}
@@ -0,0 +1,49 @@
+package consumer
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/riferrei/srclient"
+)
+
+/*
+WriterSchemaDeserializer deserializes records of other services into generic values (maps for records) with the
+schema they were written with. Unlike the type deserializers, the schemas (and their versions) don't have to be known
+in advance, they are resolved from the schema registry by the id in the record.
+*/
+type WriterSchemaDeserializer struct {
+	client srclient.ISchemaRegistryClient
+}
+
+func NewWriterSchemaDeserializer(client srclient.ISchemaRegistryClient) *WriterSchemaDeserializer {
+	return &WriterSchemaDeserializer{
+		client: client,
+	}
+}
+
+/*
+Deserialize decodes data in the wire format of the schema registry (magic byte, schema id and avro payload). Returns
+nil for tombstones.
+*/
+func (this *WriterSchemaDeserializer) Deserialize(data []byte) (any, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	if len(data) < 5 || data[0] != 0 {
+		return nil, errors.New("data isn't in the wire format of the schema registry")
+	}
+
+	schemaId := int(binary.BigEndian.Uint32(data[1:5]))
+	schema, err := this.client.GetSchema(schemaId)
+	if err != nil {
+		return nil, err
+	}
+	codec := schema.Codec()
+	if codec == nil {
+		return nil, fmt.Errorf("schema with id %d isn't an avro schema", schemaId)
+	}
+
+	value, _, err := codec.NativeFromBinary(data[5:])
+	return value, err
+}
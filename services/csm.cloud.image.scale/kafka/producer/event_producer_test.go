@@ -0,0 +1,97 @@
+package producer
+
+import (
+	"csm.cloud.image.scale/domain"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/kafka/consumer/deserializer/avro"
+	serializer "dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/kafka/producer/serializer/avro"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/test"
+	"github.com/riferrei/srclient"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestImageScaledEventSerialization_OptionalFields(t *testing.T) {
+
+	// prepare
+	schema := createSchema("../../resources/avro/ImageScaledEventAvro.avsc", 6)
+	deserializer := avro.NewAvroDeserializer([]avro.AvroTypeDeserializer{
+		avro.NewAvroTypeDeserializer[domain.ImageScaledEvent](schema),
+	})
+	withOptionalFields := domain.ImageScaledEvent{
+		Identifier:            "/images/file.png",
+		Path:                  "/images",
+		FileName:              "file.png",
+		ContentType:           "image/png",
+		ContentLength:         100,
+		BlurHash:              domain.NewOptionalString("LEHV6nWB2yk8pyo0adR*.7kCMdnj"),
+		DominantColor:         domain.NewOptionalString("#7f6a55"),
+		PerceptualHash:        domain.NewOptionalString("00ff00ff00ff00ff"),
+		RootContextIdentifier: domain.NewOptionalString("6d5c3ff4-0d1a-4a2b-8f4e-2a5b3c7d9e01"),
+		DuplicateOf:           domain.NewOptionalString("0e8f7a6b-5c4d-4e3f-9a2b-1c0d9e8f7a6b"),
+		TileManifest:          domain.NewOptionalString("project/image/tiles/task1/image1/image.dzi"),
+		Sharpness:             domain.NewOptionalDouble(412.5),
+		Brightness:            domain.NewOptionalDouble(0.45),
+		Contrast:              domain.NewOptionalDouble(0.8),
+		Animated:              domain.NewOptionalBoolean(false),
+	}
+	withoutOptionalFields := domain.ImageScaledEvent{
+		Identifier:    withOptionalFields.Identifier,
+		Path:          withOptionalFields.Path,
+		FileName:      withOptionalFields.FileName,
+		ContentType:   withOptionalFields.ContentType,
+		ContentLength: withOptionalFields.ContentLength,
+	}
+
+	// execute
+	valueWithOptionalFields, errWithOptionalFields := serializer.NewAvroSerializer(schema).Serialize(&withOptionalFields)
+	valueWithoutOptionalFields, errWithoutOptionalFields := serializer.NewAvroSerializer(schema).Serialize(&withoutOptionalFields)
+
+	// verify
+	assert.Nil(t, errWithOptionalFields)
+	assert.Nil(t, errWithoutOptionalFields)
+	deserializedWithOptionalFields, err := deserializer.Deserialize(valueWithOptionalFields)
+	assert.Nil(t, err)
+	assert.Equal(t, withOptionalFields, deserializedWithOptionalFields)
+	deserializedWithoutOptionalFields, err := deserializer.Deserialize(valueWithoutOptionalFields)
+	assert.Nil(t, err)
+	assert.Equal(t, withoutOptionalFields, deserializedWithoutOptionalFields)
+}
+
+func TestImageErasedEventSerialization(t *testing.T) {
+
+	// prepare
+	schema := createSchema("../../resources/avro/ImageErasedEventAvro.avsc", 1)
+	deserializer := avro.NewAvroDeserializer([]avro.AvroTypeDeserializer{
+		avro.NewAvroTypeDeserializer[domain.ImageErasedEvent](schema),
+	})
+	event := domain.ImageErasedEvent{
+		Identifier:            "0e8f7a6b-5c4d-4e3f-9a2b-1c0d9e8f7a6b",
+		Type:                  "TOPIC",
+		RootContextIdentifier: "6d5c3ff4-0d1a-4a2b-8f4e-2a5b3c7d9e01",
+		DeletedBlobs:          12,
+		Complete:              true,
+	}
+
+	// execute
+	value, err := serializer.NewAvroSerializer(schema).Serialize(&event)
+
+	// verify
+	assert.Nil(t, err)
+	deserialized, err := deserializer.Deserialize(value)
+	assert.Nil(t, err)
+	assert.Equal(t, event, deserialized)
+}
+
+func createSchema(schemaFile string, id int) *srclient.Schema {
+	schemaBytes, err := os.ReadFile(schemaFile)
+	if err != nil {
+		panic(err)
+	}
+
+	schema := &srclient.Schema{}
+	test.SetFieldValueForTesting(schema, "schema", string(schemaBytes))
+	test.SetFieldValueForTesting(schema, "id", id)
+	test.SetFieldValueForTesting(schema, "version", id)
+	return schema
+}
@@ -3,9 +3,11 @@ package schema_registry
 import "github.com/riferrei/srclient"
 
 type KnownSchemas struct {
-	FileCreatedEvent  srclient.Schema
-	ImageDeletedEvent srclient.Schema
-	ImageScaledEvent  srclient.Schema
-	StringMessageKey  srclient.Schema
-	MessageKey        srclient.Schema
+	FileCreatedEvent   srclient.Schema
+	FileCreatedEventV1 srclient.Schema
+	ImageDeletedEvent  srclient.Schema
+	ImageErasedEvent   srclient.Schema
+	ImageScaledEvent   srclient.Schema
+	StringMessageKey   srclient.Schema
+	MessageKey         srclient.Schema
 }
@@ -43,12 +43,24 @@ func (this *defaultSchemaRegistryClient) LoadSchemas() KnownSchemas {
 		panic(err)
 	}
 
+	// Read value schema file
+	fileCreatedEventV1File, err := os.ReadFile(this.kafkaProperties.Schema.UploadedV1.SchemaFile)
+	if err != nil {
+		panic(err)
+	}
+
 	// Read value schema file
 	imageDeletedEventFile, err := os.ReadFile(this.kafkaProperties.Schema.Deleted.SchemaFile)
 	if err != nil {
 		panic(err)
 	}
 
+	// Read value schema file
+	imageErasedEventFile, err := os.ReadFile(this.kafkaProperties.Schema.Erased.SchemaFile)
+	if err != nil {
+		panic(err)
+	}
+
 	// Read value schema file
 	imageScaledEventFile, err := os.ReadFile(this.kafkaProperties.Schema.Scaled.SchemaFile)
 	if err != nil {
@@ -77,6 +89,16 @@ func (this *defaultSchemaRegistryClient) LoadSchemas() KnownSchemas {
 		panic(err)
 	}
 
+	// Load version 1 of the file created event schema (before the current version to keep the registration order)
+	var fileCreatedEventV1Schema *srclient.Schema
+	err = retry.SimpleRetry(func() error {
+		fileCreatedEventV1Schema, err = this.schemaRegistryService.LoadAvroSchema(this.kafkaProperties.Schema.UploadedV1.SchemaSubject, fileCreatedEventV1File)
+		return err
+	}, 20, 1*time.Second, "loading file created event v1 schema")
+	if err != nil {
+		panic(err)
+	}
+
 	// Load file created event schema
 	var fileCreatedEventSchema *srclient.Schema
 	err = retry.SimpleRetry(func() error {
@@ -96,6 +118,16 @@ func (this *defaultSchemaRegistryClient) LoadSchemas() KnownSchemas {
 		panic(err)
 	}
 
+	// Load image erased event schema
+	var imageErasedEventSchema *srclient.Schema
+	err = retry.SimpleRetry(func() error {
+		imageErasedEventSchema, err = this.schemaRegistryService.LoadAvroSchema(this.kafkaProperties.Schema.Erased.SchemaSubject, imageErasedEventFile)
+		return err
+	}, 20, 1*time.Second, "loading image erased event schema")
+	if err != nil {
+		panic(err)
+	}
+
 	// Load image scaled created event schema
 	var imageScaledEventSchema *srclient.Schema
 	err = retry.SimpleRetry(func() error {
@@ -107,10 +139,12 @@ func (this *defaultSchemaRegistryClient) LoadSchemas() KnownSchemas {
 	}
 
 	return KnownSchemas{
-		FileCreatedEvent:  *fileCreatedEventSchema,
-		ImageDeletedEvent: *imageDeletedEventSchema,
-		ImageScaledEvent:  *imageScaledEventSchema,
-		StringMessageKey:  *stringMessageKeySchema,
-		MessageKey:        *messageKeySchema,
+		FileCreatedEvent:   *fileCreatedEventSchema,
+		FileCreatedEventV1: *fileCreatedEventV1Schema,
+		ImageDeletedEvent:  *imageDeletedEventSchema,
+		ImageErasedEvent:   *imageErasedEventSchema,
+		ImageScaledEvent:   *imageScaledEventSchema,
+		StringMessageKey:   *stringMessageKeySchema,
+		MessageKey:         *messageKeySchema,
 	}
 }
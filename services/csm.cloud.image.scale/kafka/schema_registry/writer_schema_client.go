@@ -0,0 +1,18 @@
+package schema_registry
+
+import (
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/config/properties"
+	"github.com/riferrei/srclient"
+)
+
+/*
+NewWriterSchemaClient creates a schema registry client resolving the schemas that events of other services are
+written with by their id. The resolved schemas are cached by the client.
+*/
+func NewWriterSchemaClient(schemaRegistryProperties properties.SchemaRegistryProperties) srclient.ISchemaRegistryClient {
+	client := srclient.CreateSchemaRegistryClient(schemaRegistryProperties.Urls)
+	if schemaRegistryProperties.Api.Key != "" && schemaRegistryProperties.Api.Secret != "" {
+		client.SetCredentials(schemaRegistryProperties.Api.Key, schemaRegistryProperties.Api.Secret)
+	}
+	return client
+}
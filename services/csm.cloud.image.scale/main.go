@@ -15,10 +15,13 @@ import (
 	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/http/interceptor/request_host_rewrite"
 	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/kafka/consumer/deserializer/avro"
 	producerConfigurer "dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/kafka/producer/configurer"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/metrics"
 	"fmt"
-	"github.com/davidbyttow/govips/v2/vips"
 	"github.com/rs/zerolog/log"
+	"os"
 	"strings"
+	// Embed the timezone database, the watermark renders times in the timezone of the uploader
+	_ "time/tzdata"
 )
 
 func main() {
@@ -36,15 +39,25 @@ func main() {
 	// Initialize datadog tracer
 	datadog.ApplyDefaultTracingConfiguration()
 
-	// Initialize vips image processing and scaling library
+	// Initialize vips image processing and scaling library (with resource limits)
 	// requires libvips and C compiler as per https://github.com/davidbyttow/govips
-	vips.LoggingSettings(nil, vips.LogLevelWarning)
-	vips.Startup(nil)
-	defer vips.Shutdown()
-
-	quarantineBlobStorageClient := storage.NewBlobStorageClient(configuration.Storage.Quarantine)
-	projectBlobStorageClient := storage.NewBlobStorageClient(configuration.Storage.Project)
-	userBlobStorageClient := storage.NewBlobStorageClient(configuration.Storage.User)
+	shutdownVipsFn := image.StartupVips(configuration.Image)
+	defer shutdownVipsFn()
+
+	// Initialize blob stores (type per storage, the derived blob store is only used with the resize api)
+	quarantineBlobStore := storage.NewBlobStore(configuration.Storage.Quarantine)
+	projectBlobStore := storage.NewBlobStore(configuration.Storage.Project)
+	userBlobStore := storage.NewBlobStore(configuration.Storage.User)
+	var derivedBlobStore storage.BlobStore
+	if configuration.Resize.Enabled {
+		derivedBlobStore = storage.NewBlobStore(configuration.Storage.Derived)
+	}
+
+	// Regenerate the scaled images of the stored originals and exit (e.g. after changing the sizes of the variants)
+	if len(os.Args) > 1 && os.Args[1] == regenerateCommand {
+		regenerate(os.Args[2:], configuration, projectBlobStore, userBlobStore)
+		return
+	}
 
 	// Create topics if needed (on localhost)
 	admin.CreateTopicsIfNeeded(configuration)
@@ -68,20 +81,32 @@ func main() {
 		configuration.Kafka.Topic.Scaled.Name,
 	)
 
-	imageEventProcessor := image.NewImageScalingProcessor(quarantineBlobStorageClient, projectBlobStorageClient, userBlobStorageClient, &imageDeletedEventProducer, &imageScaledEventProducer)
+	// Initialize index of perceptual hashes per project to report near-duplicates
+	var duplicateIndex *image.DuplicateIndex
+	if configuration.DuplicateDetection.Enabled {
+		index := image.NewDuplicateIndex(configuration.DuplicateDetection, projectBlobStore)
+		duplicateIndex = &index
+	}
+
+	// Initialize tile pyramid generation of large project images (nil if disabled)
+	tilePyramid := image.NewTilePyramid(configuration.Tiles, configuration.Image, projectBlobStore)
+
+	imageEventProcessor := image.NewImageScalingProcessor(quarantineBlobStore, projectBlobStore, userBlobStore, &imageDeletedEventProducer, &imageScaledEventProducer, duplicateIndex, image.NewWatermark(configuration.Watermark), tilePyramid, image.NewAnimation(configuration.Animation))
 
 	stringMessageKeyDeserializer := avro.NewAvroTypeDeserializer[domain.StringMessageKey](&schemas.StringMessageKey)
 	fileCreatedEventDeserializer := avro.NewAvroTypeDeserializer[domain.FileCreatedEvent](&schemas.FileCreatedEvent)
+	fileCreatedEventV1Deserializer := avro.NewAvroTypeDeserializer[domain.FileCreatedEvent](&schemas.FileCreatedEventV1)
 
 	// Configure kafka consumer and listen asynchronously
-	consumer.Listen(configuration.Kafka,
-		[]avro.AvroTypeDeserializer{stringMessageKeyDeserializer, fileCreatedEventDeserializer},
+	fileCreatedEventConsumer := consumer.Listen(configuration.Kafka,
+		[]avro.AvroTypeDeserializer{stringMessageKeyDeserializer, fileCreatedEventDeserializer, fileCreatedEventV1Deserializer},
 		func(record consumer.Event) error {
 			tracingContext := record.Ctx
 			event := record.Event
 
 			if !strings.HasPrefix(event.Path, "/images") {
 				log.Info().Msg(fmt.Sprintf("Ignore file uploaded to other container: %s/%s", event.Path, event.FileName))
+				metrics.MessagesDropped.WithLabelValues(metrics.ReasonNotAnImage).Inc()
 				return nil
 			}
 
@@ -90,7 +115,40 @@ func main() {
 			return err
 		})
 
+	// Configure kafka consumer of the deletion events of the project and user services to erase their images (GDPR)
+	if configuration.Erasure.Enabled {
+		if configuration.Erasure.ErasedTopic == "" {
+			panic(app.NewFatalError("Erasure requires the topic of the image erased events", nil))
+		}
+		imageErasedEventProducer := producer.NewAvroEventKafkaProducer[domain.MessageKey, domain.ImageErasedEvent](
+			&schemas.MessageKey,
+			&schemas.ImageErasedEvent,
+			kafkaProducer,
+			configuration.Erasure.ErasedTopic,
+		)
+		erasureService := image.NewErasureService(configuration.Erasure, projectBlobStore, userBlobStore, derivedBlobStore, &imageErasedEventProducer, duplicateIndex)
+		writerSchemaDeserializer := consumer.NewWriterSchemaDeserializer(schema_registry.NewWriterSchemaClient(configuration.Kafka.SchemaRegistry))
+		consumer.ListenToDeletions(configuration.Kafka, configuration.Erasure, writerSchemaDeserializer,
+			func(record consumer.AggregateDeletedEvent) error {
+				return erasureService.Erase(record.Ctx, record.Key)
+			})
+	}
+
+	// Initialize admin api to control the kafka consumer at runtime
+	var routeRegistrations []rest.RouteRegistration
+	if configuration.Admin.Enabled {
+		adminApi := rest.NewAdminApi(configuration.Admin, fileCreatedEventConsumer)
+		routeRegistrations = append(routeRegistrations, adminApi.RegisterRoutes)
+	}
+
+	// Initialize image api to resize images on demand (variants are cached in the derived blob store)
+	if configuration.Resize.Enabled {
+		resizeService := image.NewResizeService(projectBlobStore, userBlobStore, derivedBlobStore)
+		imageApi := rest.NewImageApi(configuration.Resize, &resizeService)
+		routeRegistrations = append(routeRegistrations, imageApi.RegisterRoutes)
+	}
+
 	// Initialize and run the blocking web-server
-	webServerRunner := rest.NewWebServerRunner(configuration.Server)
+	webServerRunner := rest.NewWebServerRunner(configuration.Server, routeRegistrations...)
 	webServerRunner.Run()
 }
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"csm.cloud.image.scale/config"
+	"csm.cloud.image.scale/image"
+	"csm.cloud.image.scale/storage"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/app"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Subcommand regenerating the scaled images of the stored originals instead of consuming
+const regenerateCommand = "regenerate"
+
+/*
+regenerate runs the regeneration job with the options passed as flags (e.g. regenerate -rate 5 -checkpoint sizes).
+Fails (in panic) on invalid flags or if any image failed to regenerate, so that the job can be run again.
+*/
+func regenerate(args []string, configuration config.Configuration, projectBlobStore storage.BlobStore, userBlobStore storage.BlobStore) {
+	flags := flag.NewFlagSet(regenerateCommand, flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "log the images to regenerate without uploading them")
+	rate := flags.Float64("rate", 0, "maximum number of originals per second, 0 doesn't limit the rate")
+	checkpoint := flags.String("checkpoint", "", "name of the checkpoint to resume from and to update")
+	project := flags.String("project", "", "regenerate the images of this project only")
+	ownerTypes := flags.String("owner-types", "", "comma separated owner types to regenerate (e.g. TASK_ATTACHMENT)")
+	if err := flags.Parse(args); err != nil {
+		panic(app.NewFatalError("Invalid arguments of the regenerate command", err))
+	}
+	if *rate < 0 {
+		panic(app.NewFatalError(fmt.Sprintf("Invalid rate %f of the regenerate command", *rate), nil))
+	}
+
+	options := image.RegenerationOptions{
+		DryRun:            *dryRun,
+		Checkpoint:        *checkpoint,
+		ProjectIdentifier: *project,
+	}
+	if *rate > 0 {
+		options.Interval = time.Duration(float64(time.Second) / *rate)
+	}
+	if *ownerTypes != "" {
+		options.OwnerTypes = strings.Split(*ownerTypes, ",")
+	}
+
+	job := image.NewRegenerationJob(projectBlobStore, userBlobStore, image.NewWatermark(configuration.Watermark), image.NewAnimation(configuration.Animation),
+		image.NewTilePyramid(configuration.Tiles, configuration.Image, projectBlobStore))
+	result, err := job.Run(options)
+	if err != nil {
+		panic(app.NewFatalError("Regeneration of the images failed", err))
+	}
+	if result.Failed > 0 {
+		panic(app.NewFatalError(fmt.Sprintf("Regeneration of %d images failed", result.Failed), nil))
+	}
+}
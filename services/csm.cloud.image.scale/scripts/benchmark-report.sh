@@ -0,0 +1,11 @@
+#!/bin/bash
+
+# Runs each scaling benchmark in its own process, the peak memory of libvips is a high-water mark of the process
+SCRIPT_DIR=$(cd -- "$(dirname -- "${BASH_SOURCE[0]}")" &>/dev/null && pwd)
+cd $SCRIPT_DIR/..
+
+for benchmark in BenchmarkScaleImage_DecodePerVariant BenchmarkScaleImageFileToVariants_SingleDecode; do
+  go test -tags vips -run '^$' -bench "^${benchmark}\$" -benchmem -count 5 ./image/
+done | tee benchmark-report.out
+
+cd -
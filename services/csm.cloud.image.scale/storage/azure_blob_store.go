@@ -0,0 +1,230 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"csm.cloud.image.scale/config/properties"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/app"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/azure"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/health"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/metrics"
+	"fmt"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/rs/zerolog/log"
+	"io"
+	"net/http"
+)
+
+type AzureBlobStore struct {
+	client        *azblob.Client
+	containerName string
+}
+
+func NewAzureBlobStore(properties properties.StorageProperties) *AzureBlobStore {
+	// Register DefaultClient as transport for AzureBlob client so that request interceptors apply
+	clientOptions := &azblob.ClientOptions{
+		ClientOptions: policy.ClientOptions{
+			Transport: http.DefaultClient,
+		},
+	}
+
+	// Instantiate the blob-client (token based if a credential is configured, with the connection string otherwise)
+	var client *azblob.Client
+	if azure.UsesTokenCredential(properties.Credential) {
+		if properties.AccountUrl == "" {
+			panic(app.NewFatalError("Account url is required for token authentication", nil))
+		}
+		credential, err := azure.NewTokenCredential(properties.Credential)
+		if err != nil {
+			panic(app.NewFatalError("Unable to create token credential", err))
+		}
+		client, err = azblob.NewClient(properties.AccountUrl, credential, clientOptions)
+		if err != nil {
+			panic(app.NewFatalError("Unable to create client for account url", err))
+		}
+	} else {
+		var err error
+		client, err = azblob.NewClientFromConnectionString(properties.ConnectionString, clientOptions)
+		if err != nil {
+			panic(app.NewFatalError("Unable to create client from connection string", err))
+		}
+	}
+
+	// Register readiness check reading the container properties (a check per container)
+	containerClient := client.ServiceClient().NewContainerClient(properties.ContainerName)
+	health.RegisterCheck("blobStorage."+properties.ContainerName, health.CheckOptions{}, func(ctx context.Context) error {
+		_, err := containerClient.GetProperties(ctx, nil)
+		return err
+	})
+
+	return &AzureBlobStore{
+		client:        client,
+		containerName: properties.ContainerName,
+	}
+}
+
+func (b *AzureBlobStore) DownloadBlob(path string, fileName string) (*Blob, error) {
+	return downloadToBuffer(b, path, fileName)
+}
+
+func (b *AzureBlobStore) DownloadStream(path string, fileName string, writer io.Writer) (*BlobProperties, error) {
+	ctx, extendTimeoutFn, cancelFn := newTransferContext()
+	defer cancelFn()
+
+	// Download blob as stream, the timeout is extended by the content length as soon as it's known
+	response, err := b.client.DownloadStream(ctx, b.containerName, blobName(path, fileName), nil)
+	if err != nil {
+		return nil, wrapAzureError(err)
+	}
+	blobProperties := BlobProperties{
+		ContentType: response.ContentType,
+		Metadata:    lowercaseMetadata(response.Metadata),
+	}
+	if response.ContentLength != nil {
+		blobProperties.ContentLength = *response.ContentLength
+		extendTimeoutFn(blobProperties.ContentLength)
+	}
+	if response.ETag != nil {
+		blobProperties.ETag = string(*response.ETag)
+	}
+	if response.LastModified != nil {
+		blobProperties.LastModified = *response.LastModified
+	}
+
+	// The retry reader resumes interrupted downloads from the last read position
+	readCloser := response.NewRetryReader(ctx, &blob.RetryReaderOptions{MaxRetries: 3})
+	// Close the stream
+	defer func() {
+		err = readCloser.Close()
+		if err != nil {
+			log.Warn().Msg(fmt.Sprintf("Error closing download stream %s", err.Error()))
+		}
+	}()
+
+	// Copy stream into the writer
+	bytesRead, err := io.Copy(writer, readCloser)
+	if err != nil {
+		return nil, err
+	}
+	metrics.BytesProcessed.WithLabelValues(metrics.DirectionDownloaded).Add(float64(bytesRead))
+	return &blobProperties, nil
+}
+
+func (b *AzureBlobStore) UploadBlob(path string, fileName string, buffer *[]byte, metadata map[string]*string, contentType string) error {
+	return b.UploadStream(path, fileName, bytes.NewReader(*buffer), int64(len(*buffer)), metadata, contentType)
+}
+
+func (b *AzureBlobStore) UploadStream(path string, fileName string, reader io.Reader, contentLength int64, metadata map[string]*string, contentType string) error {
+	ctx, cancelFn := context.WithTimeout(context.Background(), transferTimeout(contentLength))
+	defer cancelFn()
+
+	// Upload stream in blocks
+	contentDisposition := contentDispositionOf(fileName, metadata)
+	options := azblob.UploadStreamOptions{
+		HTTPHeaders: &blob.HTTPHeaders{BlobContentType: &contentType, BlobContentDisposition: &contentDisposition},
+		Metadata:    metadata,
+	}
+	_, err := b.client.UploadStream(ctx, b.containerName, blobName(path, fileName), reader, &options)
+	if err != nil {
+		return err
+	}
+	metrics.BytesProcessed.WithLabelValues(metrics.DirectionUploaded).Add(float64(contentLength))
+	return nil
+}
+
+func (b *AzureBlobStore) DeleteBlob(path string, fileName string) error {
+	ctx, cancelFn := context.WithTimeout(context.Background(), baseTimeout)
+	defer cancelFn()
+
+	// Delete blob
+	_, err := b.client.DeleteBlob(ctx, b.containerName, blobName(path, fileName), nil)
+	return wrapAzureError(err)
+}
+
+func (b *AzureBlobStore) GetBlobProperties(path string, fileName string) (*BlobProperties, error) {
+	ctx, cancelFn := context.WithTimeout(context.Background(), baseTimeout)
+	defer cancelFn()
+
+	// Read the blob properties
+	blobClient := b.client.ServiceClient().NewContainerClient(b.containerName).NewBlobClient(blobName(path, fileName))
+	response, err := blobClient.GetProperties(ctx, nil)
+	if err != nil {
+		return nil, wrapAzureError(err)
+	}
+
+	blobProperties := BlobProperties{
+		ContentType: response.ContentType,
+		Metadata:    lowercaseMetadata(response.Metadata),
+	}
+	if response.ContentLength != nil {
+		blobProperties.ContentLength = *response.ContentLength
+	}
+	if response.ETag != nil {
+		blobProperties.ETag = string(*response.ETag)
+	}
+	if response.LastModified != nil {
+		blobProperties.LastModified = *response.LastModified
+	}
+	return &blobProperties, nil
+}
+
+func (b *AzureBlobStore) ListBlobs(prefix string) ([]string, error) {
+	ctx, cancelFn := context.WithTimeout(context.Background(), baseTimeout)
+	defer cancelFn()
+
+	// Page through the blobs with the given prefix
+	blobNames := make([]string, 0)
+	pager := b.client.NewListBlobsFlatPager(b.containerName, &container.ListBlobsFlatOptions{Prefix: &prefix})
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range page.Segment.BlobItems {
+			blobNames = append(blobNames, *item.Name)
+		}
+	}
+	return blobNames, nil
+}
+
+/*
+WalkBlobs lists the blobs page by page with a timeout per page. The listing can't start at a name (the marker is
+opaque), therefore the names up to startAfter are listed but skipped.
+*/
+func (b *AzureBlobStore) WalkBlobs(prefix string, startAfter string, walkFn func(blobNames []string) error) error {
+	maxResults := int32(listPageSize)
+	pager := b.client.NewListBlobsFlatPager(b.containerName, &container.ListBlobsFlatOptions{Prefix: &prefix, MaxResults: &maxResults})
+	for pager.More() {
+		ctx, cancelFn := context.WithTimeout(context.Background(), baseTimeout)
+		page, err := pager.NextPage(ctx)
+		cancelFn()
+		if err != nil {
+			return err
+		}
+
+		blobNames := make([]string, 0, len(page.Segment.BlobItems))
+		for _, item := range page.Segment.BlobItems {
+			if *item.Name > startAfter {
+				blobNames = append(blobNames, *item.Name)
+			}
+		}
+		if len(blobNames) > 0 {
+			if err = walkFn(blobNames); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Translate the azure error code for missing blobs into ErrBlobNotFound
+func wrapAzureError(err error) error {
+	if bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return fmt.Errorf("%w: %s", ErrBlobNotFound, err.Error())
+	}
+	return err
+}
@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"csm.cloud.image.scale/config/properties"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/azure"
+	commonProperties "dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/config/properties"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var testCredential = commonProperties.AzureCredentialProperties{
+	Type:          azure.CredentialTypeClientSecret,
+	TenantId:      "00000000-0000-0000-0000-000000000001",
+	ClientId:      "00000000-0000-0000-0000-000000000002",
+	ClientSecret:  "secret",
+	AuthorityHost: "https://localhost:8443/",
+}
+
+func TestNewAzureBlobStore_UsesTokenCredentialWithAccountUrl(t *testing.T) {
+
+	// execute
+	blobStore := NewAzureBlobStore(properties.StorageProperties{
+		ContainerName: "csm",
+		Credential:    testCredential,
+		AccountUrl:    "https://account.blob.core.windows.net/",
+	})
+
+	// verify
+	assert.Equal(t, "https://account.blob.core.windows.net/", blobStore.client.URL())
+}
+
+func TestNewAzureBlobStore_PanicsWithTokenCredentialWithoutAccountUrl(t *testing.T) {
+
+	// execute and verify
+	assert.Panics(t, func() {
+		NewAzureBlobStore(properties.StorageProperties{ContainerName: "csm", Credential: testCredential})
+	})
+}
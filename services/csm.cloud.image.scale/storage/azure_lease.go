@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/lease"
+	"time"
+)
+
+type azureLease struct {
+	blobClient  *blob.Client
+	leaseClient *lease.BlobClient
+}
+
+/*
+AcquireLease leases the blob for the given duration (15 to 60 seconds, Azure doesn't support other durations).
+*/
+func (b *AzureBlobStore) AcquireLease(path string, fileName string, duration time.Duration) (Lease, error) {
+	ctx, cancelFn := context.WithTimeout(context.Background(), baseTimeout)
+	defer cancelFn()
+
+	// Create lease client with a random lease id
+	blobClient := b.client.ServiceClient().NewContainerClient(b.containerName).NewBlobClient(blobName(path, fileName))
+	leaseClient, err := lease.NewBlobClient(blobClient, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Acquire the lease
+	_, err = leaseClient.AcquireLease(ctx, int32(duration.Seconds()), nil)
+	if bloberror.HasCode(err, bloberror.LeaseAlreadyPresent) {
+		return nil, fmt.Errorf("%w: %s", ErrLeaseConflict, err.Error())
+	}
+	if err != nil {
+		return nil, wrapAzureError(err)
+	}
+	return &azureLease{blobClient: blobClient, leaseClient: leaseClient}, nil
+}
+
+func (l *azureLease) Renew() error {
+	ctx, cancelFn := context.WithTimeout(context.Background(), baseTimeout)
+	defer cancelFn()
+
+	_, err := l.leaseClient.RenewLease(ctx, nil)
+	return wrapAzureError(err)
+}
+
+/*
+Release ends the lease. Releasing the lease of a deleted blob succeeds.
+*/
+func (l *azureLease) Release() error {
+	ctx, cancelFn := context.WithTimeout(context.Background(), baseTimeout)
+	defer cancelFn()
+
+	_, err := l.leaseClient.ReleaseLease(ctx, nil)
+	if bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return nil
+	}
+	return err
+}
+
+/*
+DeleteBlob deletes the leased blob, which ends the lease as well.
+*/
+func (l *azureLease) DeleteBlob() error {
+	ctx, cancelFn := context.WithTimeout(context.Background(), baseTimeout)
+	defer cancelFn()
+
+	_, err := l.blobClient.Delete(ctx, &blob.DeleteOptions{
+		AccessConditions: &blob.AccessConditions{
+			LeaseAccessConditions: &blob.LeaseAccessConditions{LeaseID: l.leaseClient.LeaseID()},
+		},
+	})
+	return wrapAzureError(err)
+}
@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"csm.cloud.image.scale/config/properties"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/app"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	BlobStoreTypeAzure = "azure"
+	BlobStoreTypeLocal = "local"
+	BlobStoreTypeS3    = "s3"
+)
+
+const (
+	// Timeout of requests without content and minimum timeout of transfers
+	baseTimeout = 30 * time.Second
+	// Transfer rate (bytes per second) the timeout of a transfer is calculated with in addition to the base timeout
+	minimumTransferRate = 1 << 20
+	// Maximum number of blob names per page of WalkBlobs, each page is listed with the base timeout
+	listPageSize = 1000
+)
+
+/*
+ErrBlobNotFound is returned (wrapped) by all BlobStore implementations if the requested blob doesn't exist.
+*/
+var ErrBlobNotFound = errors.New("blob not found")
+
+/*
+BlobStore abstracts the storage backend of a single container (or bucket / directory) holding images.
+Blobs are addressed by a path and a file name, metadata keys are lowercase. The stream variants don't buffer
+the content in memory, their timeout is scaled by the content length. WalkBlobs passes the names after startAfter
+page by page in the order of their names, so that containers too large to be listed at once can be processed (and
+resumed after the last processed name).
+*/
+type BlobStore interface {
+	DownloadBlob(path string, fileName string) (*Blob, error)
+	DownloadStream(path string, fileName string, writer io.Writer) (*BlobProperties, error)
+	UploadBlob(path string, fileName string, buffer *[]byte, metadata map[string]*string, contentType string) error
+	UploadStream(path string, fileName string, reader io.Reader, contentLength int64, metadata map[string]*string, contentType string) error
+	DeleteBlob(path string, fileName string) error
+	GetBlobProperties(path string, fileName string) (*BlobProperties, error)
+	ListBlobs(prefix string) ([]string, error)
+	WalkBlobs(prefix string, startAfter string, walkFn func(blobNames []string) error) error
+}
+
+type Blob struct {
+	Buffer      []byte
+	ContentType *string
+	Metadata    map[string]*string
+}
+
+type BlobProperties struct {
+	ContentLength int64
+	ContentType   *string
+	ETag          string
+	LastModified  time.Time
+	Metadata      map[string]*string
+}
+
+/*
+DownloadedBlob is a blob downloaded into a temporary file, which has to be removed after processing.
+*/
+type DownloadedBlob struct {
+	BlobProperties
+	File string
+}
+
+/*
+NewBlobStore creates the blob store selected by the type of the storage properties (azure if not set).
+*/
+func NewBlobStore(storageProperties properties.StorageProperties) BlobStore {
+	switch storageProperties.Type {
+	case "", BlobStoreTypeAzure:
+		return NewAzureBlobStore(storageProperties)
+	case BlobStoreTypeLocal:
+		return NewLocalBlobStore(storageProperties)
+	case BlobStoreTypeS3:
+		return NewS3BlobStore(storageProperties)
+	default:
+		panic(app.NewFatalError(fmt.Sprintf("Unsupported blob store type %q", storageProperties.Type), nil))
+	}
+}
+
+/*
+DownloadToTemporaryFile streams a blob into a new temporary file.
+*/
+func DownloadToTemporaryFile(blobStore BlobStore, path string, fileName string) (*DownloadedBlob, error) {
+	file, err := os.CreateTemp("", "blob-*")
+	if err != nil {
+		return nil, err
+	}
+	blobProperties, err := blobStore.DownloadStream(path, fileName, file)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(file.Name())
+		return nil, err
+	}
+	return &DownloadedBlob{BlobProperties: *blobProperties, File: file.Name()}, nil
+}
+
+/*
+Remove deletes the temporary file of the downloaded blob.
+*/
+func (d *DownloadedBlob) Remove() {
+	if err := os.Remove(d.File); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Warn().Msg(fmt.Sprintf("Error removing temporary file %s: %s", d.File, err.Error()))
+	}
+}
+
+/*
+UploadFile streams the content of a (downloaded) file to the blob store.
+*/
+func UploadFile(blobStore BlobStore, path string, fileName string, file string, metadata map[string]*string, contentType string) error {
+	reader, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	fileInfo, err := reader.Stat()
+	if err != nil {
+		return err
+	}
+	return blobStore.UploadStream(path, fileName, reader, fileInfo.Size(), metadata, contentType)
+}
+
+// Download a blob into memory using the stream download of the blob store
+func downloadToBuffer(blobStore BlobStore, path string, fileName string) (*Blob, error) {
+	byteBuffer := new(bytes.Buffer)
+	blobProperties, err := blobStore.DownloadStream(path, fileName, byteBuffer)
+	if err != nil {
+		return nil, err
+	}
+	return &Blob{
+		Buffer:      byteBuffer.Bytes(),
+		ContentType: blobProperties.ContentType,
+		Metadata:    blobProperties.Metadata,
+	}, nil
+}
+
+// Calculate the timeout of a transfer from the content length
+func transferTimeout(contentLength int64) time.Duration {
+	return baseTimeout + time.Duration(contentLength/minimumTransferRate)*time.Second
+}
+
+// Create a context for a transfer of unknown size. It's cancelled after the base timeout unless the deadline is
+// extended with the returned function as soon as the content length is known.
+func newTransferContext() (context.Context, func(contentLength int64), context.CancelFunc) {
+	ctx, cancelFn := context.WithCancelCause(context.Background())
+	timer := time.AfterFunc(baseTimeout, func() {
+		cancelFn(context.DeadlineExceeded)
+	})
+	extendFn := func(contentLength int64) {
+		timer.Reset(transferTimeout(contentLength))
+	}
+	return ctx, extendFn, func() {
+		timer.Stop()
+		cancelFn(context.Canceled)
+	}
+}
+
+// Determine the name of a blob from its path and file name
+func blobName(path string, fileName string) string {
+	return strings.TrimPrefix(fmt.Sprintf("%s/%s", path, fileName), "/")
+}
+
+// Determine content disposition header (original file name from the metadata if available)
+func contentDispositionOf(fileName string, metadata map[string]*string) string {
+	originalFileName := metadata["filename"]
+	if originalFileName == nil {
+		originalFileName = &fileName
+	}
+	return fmt.Sprintf("attachment; filename=\"%s\"", *originalFileName)
+}
+
+// Convert metadata keys to lowercase
+func lowercaseMetadata(metadata map[string]*string) map[string]*string {
+	result := make(map[string]*string)
+	for entry := range metadata {
+		result[strings.ToLower(entry)] = metadata[entry]
+	}
+	return result
+}
@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"context"
+	"csm.cloud.image.scale/config/properties"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestNewBlobStore_SelectsImplementationByType(t *testing.T) {
+
+	// execute
+	localBlobStore := NewBlobStore(properties.StorageProperties{
+		Type:          BlobStoreTypeLocal,
+		ContainerName: "csm",
+		Local:         properties.LocalStorageProperties{Directory: t.TempDir()},
+	})
+	s3BlobStore := NewBlobStore(properties.StorageProperties{
+		Type:          BlobStoreTypeS3,
+		ContainerName: "csm",
+		S3:            properties.S3StorageProperties{Endpoint: "localhost:9000"},
+	})
+
+	// verify
+	assert.IsType(t, &LocalBlobStore{}, localBlobStore)
+	assert.IsType(t, &S3BlobStore{}, s3BlobStore)
+}
+
+func TestNewBlobStore_PanicsOnUnsupportedType(t *testing.T) {
+
+	// execute and verify
+	assert.Panics(t, func() {
+		NewBlobStore(properties.StorageProperties{Type: "ftp"})
+	})
+}
+
+func TestContentDispositionOf(t *testing.T) {
+
+	// prepare
+	originalFileName := "holiday.png"
+
+	// execute and verify
+	assert.Equal(t, "attachment; filename=\"holiday.png\"", contentDispositionOf("1", map[string]*string{"filename": &originalFileName}))
+	assert.Equal(t, "attachment; filename=\"1\"", contentDispositionOf("1", nil))
+}
+
+func TestDownloadToTemporaryFileAndUploadFile(t *testing.T) {
+
+	// prepare
+	blobStore := newTestLocalBlobStore(t)
+	content := []byte("image")
+	timezone := "Europe/Berlin"
+	assert.Nil(t, blobStore.UploadBlob("images", "1", &content, map[string]*string{"timezone": &timezone}, "image/png"))
+
+	// execute
+	downloadedBlob, err := DownloadToTemporaryFile(blobStore, "images", "1")
+	assert.Nil(t, err)
+	err = UploadFile(blobStore, "project/image/original/1", "2", downloadedBlob.File, nil, "image/png")
+	assert.Nil(t, err)
+	downloadedBlob.Remove()
+
+	// verify
+	assert.Equal(t, int64(len(content)), downloadedBlob.ContentLength)
+	assert.Equal(t, timezone, *downloadedBlob.Metadata["timezone"])
+	_, err = os.Stat(downloadedBlob.File)
+	assert.True(t, os.IsNotExist(err), "Temporary file should be removed")
+	uploadedBlob, err := blobStore.DownloadBlob("project/image/original/1", "2")
+	assert.Nil(t, err)
+	assert.Equal(t, content, uploadedBlob.Buffer)
+}
+
+func TestDownloadToTemporaryFile_NotFound(t *testing.T) {
+
+	// execute
+	_, err := DownloadToTemporaryFile(newTestLocalBlobStore(t), "images", "missing")
+
+	// verify
+	assert.ErrorIs(t, err, ErrBlobNotFound)
+}
+
+func TestTransferTimeout_ScalesWithContentLength(t *testing.T) {
+
+	// execute and verify
+	assert.Equal(t, baseTimeout, transferTimeout(0))
+	assert.Equal(t, baseTimeout+500*time.Second, transferTimeout(500*minimumTransferRate))
+}
+
+func TestNewTransferContext_ExtendsDeadline(t *testing.T) {
+
+	// prepare
+	ctx, extendTimeoutFn, cancelFn := newTransferContext()
+
+	// execute
+	extendTimeoutFn(10 * minimumTransferRate)
+
+	// verify
+	assert.Nil(t, ctx.Err())
+	cancelFn()
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+}
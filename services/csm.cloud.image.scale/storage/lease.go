@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"time"
+)
+
+/*
+ErrLeaseConflict is returned (wrapped) when a blob is already leased, i.e. it's processed by another consumer.
+*/
+var ErrLeaseConflict = errors.New("blob is already leased")
+
+/*
+Lease grants exclusive write access to a blob. A leased blob can only be deleted with its lease.
+*/
+type Lease interface {
+	Renew() error
+	Release() error
+	DeleteBlob() error
+}
+
+/*
+BlobLeaser is implemented by blob stores supporting leases.
+*/
+type BlobLeaser interface {
+	AcquireLease(path string, fileName string, duration time.Duration) (Lease, error)
+}
+
+/*
+AcquireLease leases a blob if the blob store supports leases. For other blob stores a lease is returned that
+only deletes the blob (without protection against concurrent processing).
+*/
+func AcquireLease(blobStore BlobStore, path string, fileName string, duration time.Duration) (Lease, error) {
+	if blobLeaser, ok := blobStore.(BlobLeaser); ok {
+		return blobLeaser.AcquireLease(path, fileName, duration)
+	}
+	return &unsupportedLease{blobStore: blobStore, path: path, fileName: fileName}, nil
+}
+
+/*
+KeepRenewed renews the lease in the given interval until the returned function is called.
+*/
+func KeepRenewed(lease Lease, interval time.Duration) func() {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := lease.Renew(); err != nil {
+					log.Warn().Msg(fmt.Sprintf("Renewing blob lease failed: %s", err.Error()))
+				}
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
+
+type unsupportedLease struct {
+	blobStore BlobStore
+	path      string
+	fileName  string
+}
+
+func (l *unsupportedLease) Renew() error {
+	return nil
+}
+
+func (l *unsupportedLease) Release() error {
+	return nil
+}
+
+func (l *unsupportedLease) DeleteBlob() error {
+	return l.blobStore.DeleteBlob(l.path, l.fileName)
+}
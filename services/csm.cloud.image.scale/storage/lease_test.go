@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"github.com/stretchr/testify/assert"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type countingLease struct {
+	renewals atomic.Int32
+}
+
+func (l *countingLease) Renew() error {
+	l.renewals.Add(1)
+	return nil
+}
+
+func (l *countingLease) Release() error {
+	return nil
+}
+
+func (l *countingLease) DeleteBlob() error {
+	return nil
+}
+
+func TestAcquireLease_DeletesBlobWithoutLeaseSupport(t *testing.T) {
+
+	// prepare
+	blobStore := newTestLocalBlobStore(t)
+	content := []byte("image")
+	assert.Nil(t, blobStore.UploadBlob("images", "1", &content, nil, "image/jpeg"))
+
+	// execute
+	lease, err := AcquireLease(blobStore, "images", "1", time.Minute)
+	assert.Nil(t, err)
+	assert.Nil(t, lease.Renew())
+	assert.Nil(t, lease.DeleteBlob())
+	assert.Nil(t, lease.Release())
+
+	// verify
+	_, err = blobStore.GetBlobProperties("images", "1")
+	assert.ErrorIs(t, err, ErrBlobNotFound)
+}
+
+func TestKeepRenewed_RenewsUntilStopped(t *testing.T) {
+
+	// prepare
+	lease := &countingLease{}
+
+	// execute
+	stopFn := KeepRenewed(lease, 5*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		return lease.renewals.Load() >= 2
+	}, time.Second, time.Millisecond)
+	stopFn()
+	renewals := lease.renewals.Load()
+	time.Sleep(20 * time.Millisecond)
+
+	// verify
+	assert.LessOrEqual(t, lease.renewals.Load(), renewals+1, "Lease shouldn't be renewed after stopping")
+}
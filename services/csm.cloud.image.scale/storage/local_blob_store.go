@@ -0,0 +1,255 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"csm.cloud.image.scale/config/properties"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/app"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/health"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/metrics"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Directory (below the container directory) holding the content type and metadata of the blobs
+const localPropertiesDirectory = ".properties"
+
+/*
+LocalBlobStore keeps blobs as files below {directory}/{containerName}. Content type and metadata are stored
+as json file with the same name below the .properties directory of the container.
+*/
+type LocalBlobStore struct {
+	root string
+}
+
+type localBlobProperties struct {
+	ContentType string             `json:"contentType"`
+	Metadata    map[string]*string `json:"metadata"`
+}
+
+func NewLocalBlobStore(properties properties.StorageProperties) *LocalBlobStore {
+	if properties.Local.Directory == "" {
+		panic(app.NewFatalError("Directory of local blob store is not configured", nil))
+	}
+
+	// Create the container directory
+	root := filepath.Join(properties.Local.Directory, properties.ContainerName)
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		panic(app.NewFatalError(fmt.Sprintf("Unable to create directory %s of local blob store", root), err))
+	}
+
+	// Register readiness check accessing the container directory
+	health.RegisterCheck("blobStorage."+properties.ContainerName, health.CheckOptions{}, func(ctx context.Context) error {
+		_, err := os.Stat(root)
+		return err
+	})
+
+	return &LocalBlobStore{root: root}
+}
+
+func (b *LocalBlobStore) DownloadBlob(path string, fileName string) (*Blob, error) {
+	return downloadToBuffer(b, path, fileName)
+}
+
+func (b *LocalBlobStore) DownloadStream(path string, fileName string, writer io.Writer) (*BlobProperties, error) {
+	blobProperties, err := b.GetBlobProperties(path, fileName)
+	if err != nil {
+		return nil, err
+	}
+	contentFile, _, err := b.files(path, fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	// Copy the content into the writer
+	reader, err := os.Open(contentFile)
+	if err != nil {
+		return nil, wrapLocalError(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	bytesRead, err := io.Copy(writer, reader)
+	if err != nil {
+		return nil, err
+	}
+	metrics.BytesProcessed.WithLabelValues(metrics.DirectionDownloaded).Add(float64(bytesRead))
+	return blobProperties, nil
+}
+
+func (b *LocalBlobStore) UploadBlob(path string, fileName string, buffer *[]byte, metadata map[string]*string, contentType string) error {
+	return b.UploadStream(path, fileName, bytes.NewReader(*buffer), int64(len(*buffer)), metadata, contentType)
+}
+
+func (b *LocalBlobStore) UploadStream(path string, fileName string, reader io.Reader, contentLength int64, metadata map[string]*string, contentType string) error {
+	contentFile, propertiesFile, err := b.files(path, fileName)
+	if err != nil {
+		return err
+	}
+
+	// Write properties first so that a blob is never visible without them
+	serializedProperties, err := json.Marshal(localBlobProperties{ContentType: contentType, Metadata: metadata})
+	if err != nil {
+		return err
+	}
+	if err = writeFileAtomically(propertiesFile, bytes.NewReader(serializedProperties)); err != nil {
+		return err
+	}
+	if err = writeFileAtomically(contentFile, reader); err != nil {
+		return err
+	}
+	metrics.BytesProcessed.WithLabelValues(metrics.DirectionUploaded).Add(float64(contentLength))
+	return nil
+}
+
+func (b *LocalBlobStore) DeleteBlob(path string, fileName string) error {
+	contentFile, propertiesFile, err := b.files(path, fileName)
+	if err != nil {
+		return err
+	}
+
+	// Delete content and properties
+	if err = os.Remove(contentFile); err != nil {
+		return wrapLocalError(err)
+	}
+	if err = os.Remove(propertiesFile); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (b *LocalBlobStore) GetBlobProperties(path string, fileName string) (*BlobProperties, error) {
+	contentFile, propertiesFile, err := b.files(path, fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read file info and properties
+	fileInfo, err := os.Stat(contentFile)
+	if err != nil {
+		return nil, wrapLocalError(err)
+	}
+	localProperties, err := readLocalBlobProperties(propertiesFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BlobProperties{
+		ContentLength: fileInfo.Size(),
+		ContentType:   &localProperties.ContentType,
+		ETag:          fmt.Sprintf("\"%x-%x\"", fileInfo.ModTime().UnixNano(), fileInfo.Size()),
+		LastModified:  fileInfo.ModTime(),
+		Metadata:      lowercaseMetadata(localProperties.Metadata),
+	}, nil
+}
+
+func (b *LocalBlobStore) ListBlobs(prefix string) ([]string, error) {
+	blobNames := make([]string, 0)
+	err := filepath.WalkDir(b.root, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if entry.Name() == localPropertiesDirectory {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// Blob names use slashes independent of the operating system
+		relativePath, err := filepath.Rel(b.root, file)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(relativePath)
+		if strings.HasPrefix(name, prefix) && !strings.HasPrefix(entry.Name(), ".tmp-") {
+			blobNames = append(blobNames, name)
+		}
+		return nil
+	})
+	return blobNames, err
+}
+
+/*
+WalkBlobs passes the blob names sorted by name in pages, as the directories are walked in the order of the names of
+their entries (which differs from the order of the blob names)
+*/
+func (b *LocalBlobStore) WalkBlobs(prefix string, startAfter string, walkFn func(blobNames []string) error) error {
+	blobNames, err := b.ListBlobs(prefix)
+	if err != nil {
+		return err
+	}
+	sort.Strings(blobNames)
+	blobNames = blobNames[sort.Search(len(blobNames), func(i int) bool {
+		return blobNames[i] > startAfter
+	}):]
+
+	for len(blobNames) > 0 {
+		page := blobNames[:min(listPageSize, len(blobNames))]
+		if err = walkFn(page); err != nil {
+			return err
+		}
+		blobNames = blobNames[len(page):]
+	}
+	return nil
+}
+
+// Determine the content and properties file of a blob, names escaping the container directory are rejected
+func (b *LocalBlobStore) files(path string, fileName string) (string, string, error) {
+	name := filepath.FromSlash(blobName(path, fileName))
+	contentFile := filepath.Join(b.root, name)
+	if !strings.HasPrefix(contentFile, b.root+string(filepath.Separator)) ||
+		strings.HasPrefix(name, localPropertiesDirectory+string(filepath.Separator)) {
+		return "", "", fmt.Errorf("invalid blob name %s/%s", path, fileName)
+	}
+	return contentFile, filepath.Join(b.root, localPropertiesDirectory, name+".json"), nil
+}
+
+func readLocalBlobProperties(propertiesFile string) (*localBlobProperties, error) {
+	serializedProperties, err := os.ReadFile(propertiesFile)
+	if err != nil {
+		return nil, wrapLocalError(err)
+	}
+	var localProperties localBlobProperties
+	if err = json.Unmarshal(serializedProperties, &localProperties); err != nil {
+		return nil, err
+	}
+	return &localProperties, nil
+}
+
+// Write to a temporary file which is renamed afterwards, so that readers never see partially written files
+func writeFileAtomically(file string, content io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	temporaryFile, err := os.CreateTemp(filepath.Dir(file), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(temporaryFile.Name())
+	}()
+	if _, err = io.Copy(temporaryFile, content); err != nil {
+		_ = temporaryFile.Close()
+		return err
+	}
+	if err = temporaryFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temporaryFile.Name(), file)
+}
+
+// Translate errors of missing files into ErrBlobNotFound
+func wrapLocalError(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrBlobNotFound, err.Error())
+	}
+	return err
+}
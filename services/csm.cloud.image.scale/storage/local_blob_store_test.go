@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"csm.cloud.image.scale/config/properties"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func newTestLocalBlobStore(t *testing.T) *LocalBlobStore {
+	return NewLocalBlobStore(properties.StorageProperties{
+		Type:          BlobStoreTypeLocal,
+		ContainerName: "csm",
+		Local:         properties.LocalStorageProperties{Directory: t.TempDir()},
+	})
+}
+
+func TestLocalBlobStore_UploadAndDownload(t *testing.T) {
+
+	// prepare
+	blobStore := newTestLocalBlobStore(t)
+	content := []byte("image")
+	fileName := "original.jpg"
+
+	// execute
+	err := blobStore.UploadBlob("project/image/small/1", "2", &content, map[string]*string{"FileName": &fileName}, "image/jpeg")
+	assert.Nil(t, err)
+	blob, err := blobStore.DownloadBlob("project/image/small/1", "2")
+
+	// verify
+	assert.Nil(t, err)
+	assert.Equal(t, content, blob.Buffer)
+	assert.Equal(t, "image/jpeg", *blob.ContentType)
+	assert.Equal(t, fileName, *blob.Metadata["filename"])
+}
+
+func TestLocalBlobStore_GetBlobProperties(t *testing.T) {
+
+	// prepare
+	blobStore := newTestLocalBlobStore(t)
+	content := []byte("image")
+	assert.Nil(t, blobStore.UploadBlob("images", "1", &content, nil, "image/png"))
+
+	// execute
+	blobProperties, err := blobStore.GetBlobProperties("images", "1")
+
+	// verify
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(content)), blobProperties.ContentLength)
+	assert.Equal(t, "image/png", *blobProperties.ContentType)
+	assert.NotEmpty(t, blobProperties.ETag)
+	assert.False(t, blobProperties.LastModified.IsZero())
+}
+
+func TestLocalBlobStore_ListBlobsWithPrefix(t *testing.T) {
+
+	// prepare
+	blobStore := newTestLocalBlobStore(t)
+	content := []byte("image")
+	assert.Nil(t, blobStore.UploadBlob("project/image/small/1", "2", &content, nil, "image/jpeg"))
+	assert.Nil(t, blobStore.UploadBlob("project/image/fullhd/1", "2", &content, nil, "image/jpeg"))
+	assert.Nil(t, blobStore.UploadBlob("user/image/small/3", "4", &content, nil, "image/jpeg"))
+
+	// execute
+	blobNames, err := blobStore.ListBlobs("project/")
+
+	// verify
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"project/image/small/1/2", "project/image/fullhd/1/2"}, blobNames)
+}
+
+func TestLocalBlobStore_WalkBlobsAfterName(t *testing.T) {
+
+	// prepare
+	blobStore := newTestLocalBlobStore(t)
+	content := []byte("image")
+	for _, owner := range []string{"1", "2", "3"} {
+		assert.Nil(t, blobStore.UploadBlob("project/image/original/task1", owner, &content, nil, "image/jpeg"))
+	}
+	assert.Nil(t, blobStore.UploadBlob("project/image/original/task1-2", "4", &content, nil, "image/jpeg"))
+	assert.Nil(t, blobStore.UploadBlob("project/image/original/task2", "5", &content, nil, "image/jpeg"))
+	assert.Nil(t, blobStore.UploadBlob("project/image/small/task1", "1", &content, nil, "image/jpeg"))
+
+	// execute
+	var blobNames []string
+	err := blobStore.WalkBlobs("project/image/original/", "project/image/original/task1/1", func(page []string) error {
+		blobNames = append(blobNames, page...)
+		return nil
+	})
+
+	// verify
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"project/image/original/task1/2", "project/image/original/task1/3", "project/image/original/task2/5"}, blobNames)
+}
+
+func TestLocalBlobStore_DeleteBlob(t *testing.T) {
+
+	// prepare
+	blobStore := newTestLocalBlobStore(t)
+	content := []byte("image")
+	assert.Nil(t, blobStore.UploadBlob("images", "1", &content, nil, "image/jpeg"))
+
+	// execute
+	err := blobStore.DeleteBlob("images", "1")
+
+	// verify
+	assert.Nil(t, err)
+	_, err = blobStore.DownloadBlob("images", "1")
+	assert.ErrorIs(t, err, ErrBlobNotFound)
+	assert.ErrorIs(t, blobStore.DeleteBlob("images", "1"), ErrBlobNotFound)
+}
+
+func TestLocalBlobStore_RejectsNamesOutsideOfContainer(t *testing.T) {
+
+	// prepare
+	blobStore := newTestLocalBlobStore(t)
+	content := []byte("image")
+
+	// execute
+	err := blobStore.UploadBlob("../other", "1", &content, nil, "image/jpeg")
+
+	// verify
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,230 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"csm.cloud.image.scale/config/properties"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/app"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/health"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/metrics"
+	"fmt"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/rs/zerolog/log"
+	"io"
+	"net/http"
+)
+
+/*
+S3BlobStore keeps blobs in a bucket (named like the container) of an S3 compatible object storage (e.g. MinIO).
+*/
+type S3BlobStore struct {
+	client     *minio.Client
+	bucketName string
+}
+
+func NewS3BlobStore(properties properties.StorageProperties) *S3BlobStore {
+	if properties.S3.Endpoint == "" {
+		panic(app.NewFatalError("Endpoint of S3 blob store is not configured", nil))
+	}
+
+	// Instantiate the client, DefaultClient's transport is used so that request interceptors apply
+	client, err := minio.New(properties.S3.Endpoint, &minio.Options{
+		Creds:     credentials.NewStaticV4(properties.S3.AccessKeyId, properties.S3.SecretAccessKey, ""),
+		Secure:    properties.S3.UseSsl,
+		Region:    properties.S3.Region,
+		Transport: http.DefaultClient.Transport,
+	})
+	if err != nil {
+		panic(app.NewFatalError("Unable to create S3 client", err))
+	}
+
+	// Register readiness check verifying that the bucket exists
+	bucketName := properties.ContainerName
+	health.RegisterCheck("blobStorage."+bucketName, health.CheckOptions{}, func(ctx context.Context) error {
+		exists, err := client.BucketExists(ctx, bucketName)
+		if err == nil && !exists {
+			err = fmt.Errorf("bucket %s doesn't exist", bucketName)
+		}
+		return err
+	})
+
+	return &S3BlobStore{
+		client:     client,
+		bucketName: bucketName,
+	}
+}
+
+func (b *S3BlobStore) DownloadBlob(path string, fileName string) (*Blob, error) {
+	return downloadToBuffer(b, path, fileName)
+}
+
+func (b *S3BlobStore) DownloadStream(path string, fileName string, writer io.Writer) (*BlobProperties, error) {
+	ctx, extendTimeoutFn, cancelFn := newTransferContext()
+	defer cancelFn()
+
+	// Read the object info first, the timeout is extended by the content length
+	objectInfo, err := b.client.StatObject(ctx, b.bucketName, blobName(path, fileName), minio.StatObjectOptions{})
+	if err != nil {
+		return nil, wrapS3Error(err)
+	}
+	extendTimeoutFn(objectInfo.Size)
+
+	// Download the object (pinned to the ETag of the object info), the request is sent on the first read
+	getObjectOptions := minio.GetObjectOptions{}
+	if err = getObjectOptions.SetMatchETag(objectInfo.ETag); err != nil {
+		return nil, err
+	}
+	object, err := b.client.GetObject(ctx, b.bucketName, blobName(path, fileName), getObjectOptions)
+	if err != nil {
+		return nil, wrapS3Error(err)
+	}
+	// Close the stream
+	defer func() {
+		err = object.Close()
+		if err != nil {
+			log.Warn().Msg(fmt.Sprintf("Error closing download stream %s", err.Error()))
+		}
+	}()
+
+	// Copy stream into the writer
+	bytesRead, err := io.Copy(writer, object)
+	if err != nil {
+		return nil, wrapS3Error(err)
+	}
+	metrics.BytesProcessed.WithLabelValues(metrics.DirectionDownloaded).Add(float64(bytesRead))
+	return s3BlobProperties(objectInfo), nil
+}
+
+func (b *S3BlobStore) UploadBlob(path string, fileName string, buffer *[]byte, metadata map[string]*string, contentType string) error {
+	return b.UploadStream(path, fileName, bytes.NewReader(*buffer), int64(len(*buffer)), metadata, contentType)
+}
+
+func (b *S3BlobStore) UploadStream(path string, fileName string, reader io.Reader, contentLength int64, metadata map[string]*string, contentType string) error {
+	ctx, cancelFn := context.WithTimeout(context.Background(), transferTimeout(contentLength))
+	defer cancelFn()
+
+	// Convert metadata (nil values are skipped)
+	userMetadata := make(map[string]string)
+	for key, value := range metadata {
+		if value != nil {
+			userMetadata[key] = *value
+		}
+	}
+
+	// Upload stream (large objects are uploaded in parts)
+	options := minio.PutObjectOptions{
+		ContentType:        contentType,
+		ContentDisposition: contentDispositionOf(fileName, metadata),
+		UserMetadata:       userMetadata,
+	}
+	_, err := b.client.PutObject(ctx, b.bucketName, blobName(path, fileName), reader, contentLength, options)
+	if err != nil {
+		return err
+	}
+	metrics.BytesProcessed.WithLabelValues(metrics.DirectionUploaded).Add(float64(contentLength))
+	return nil
+}
+
+func (b *S3BlobStore) DeleteBlob(path string, fileName string) error {
+	ctx, cancelFn := context.WithTimeout(context.Background(), baseTimeout)
+	defer cancelFn()
+
+	// Delete object (S3 doesn't report missing objects on delete)
+	return wrapS3Error(b.client.RemoveObject(ctx, b.bucketName, blobName(path, fileName), minio.RemoveObjectOptions{}))
+}
+
+func (b *S3BlobStore) GetBlobProperties(path string, fileName string) (*BlobProperties, error) {
+	ctx, cancelFn := context.WithTimeout(context.Background(), baseTimeout)
+	defer cancelFn()
+
+	// Read the object info
+	objectInfo, err := b.client.StatObject(ctx, b.bucketName, blobName(path, fileName), minio.StatObjectOptions{})
+	if err != nil {
+		return nil, wrapS3Error(err)
+	}
+
+	return s3BlobProperties(objectInfo), nil
+}
+
+func (b *S3BlobStore) ListBlobs(prefix string) ([]string, error) {
+	ctx, cancelFn := context.WithTimeout(context.Background(), baseTimeout)
+	defer cancelFn()
+
+	// Page through the objects with the given prefix
+	blobNames := make([]string, 0)
+	for objectInfo := range b.client.ListObjects(ctx, b.bucketName, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if objectInfo.Err != nil {
+			return nil, objectInfo.Err
+		}
+		blobNames = append(blobNames, objectInfo.Key)
+	}
+	return blobNames, nil
+}
+
+/*
+WalkBlobs lists the objects page by page (starting after the last name of the previous page) with a timeout per page
+*/
+func (b *S3BlobStore) WalkBlobs(prefix string, startAfter string, walkFn func(blobNames []string) error) error {
+	for {
+		blobNames, err := b.listBlobsPage(prefix, startAfter)
+		if err != nil {
+			return err
+		}
+		if len(blobNames) == 0 {
+			return nil
+		}
+		if err = walkFn(blobNames); err != nil {
+			return err
+		}
+		startAfter = blobNames[len(blobNames)-1]
+	}
+}
+
+// Lists a page of objects after the name, the client stops fetching further pages once the context is canceled
+func (b *S3BlobStore) listBlobsPage(prefix string, startAfter string) ([]string, error) {
+	ctx, cancelFn := context.WithTimeout(context.Background(), baseTimeout)
+	defer cancelFn()
+
+	blobNames := make([]string, 0, listPageSize)
+	options := minio.ListObjectsOptions{Prefix: prefix, StartAfter: startAfter, MaxKeys: listPageSize, Recursive: true}
+	for objectInfo := range b.client.ListObjects(ctx, b.bucketName, options) {
+		if objectInfo.Err != nil {
+			return nil, objectInfo.Err
+		}
+		blobNames = append(blobNames, objectInfo.Key)
+		if len(blobNames) == listPageSize {
+			break
+		}
+	}
+	return blobNames, nil
+}
+
+// Convert the object info into blob properties
+func s3BlobProperties(objectInfo minio.ObjectInfo) *BlobProperties {
+	return &BlobProperties{
+		ContentLength: objectInfo.Size,
+		ContentType:   &objectInfo.ContentType,
+		ETag:          objectInfo.ETag,
+		LastModified:  objectInfo.LastModified,
+		Metadata:      s3Metadata(objectInfo),
+	}
+}
+
+// Convert user metadata of an object (the x-amz-meta- prefix is already removed by the client)
+func s3Metadata(objectInfo minio.ObjectInfo) map[string]*string {
+	metadata := make(map[string]*string)
+	for key, value := range objectInfo.UserMetadata {
+		metadataValue := value
+		metadata[key] = &metadataValue
+	}
+	return lowercaseMetadata(metadata)
+}
+
+// Translate the S3 error code for missing objects into ErrBlobNotFound
+func wrapS3Error(err error) error {
+	if err != nil && minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return fmt.Errorf("%w: %s", ErrBlobNotFound, err.Error())
+	}
+	return err
+}
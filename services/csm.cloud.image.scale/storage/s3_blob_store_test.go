@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"context"
+	"csm.cloud.image.scale/config/properties"
+	"fmt"
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+/*
+newTestS3BlobStore connects to the MinIO (or other S3 compatible storage) configured by S3_TEST_ENDPOINT,
+S3_TEST_ACCESS_KEY_ID and S3_TEST_SECRET_ACCESS_KEY and creates a bucket removed after the test. The test is skipped
+without endpoint.
+*/
+func newTestS3BlobStore(t *testing.T) *S3BlobStore {
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT is not set (e.g. localhost:9000 of a MinIO container)")
+	}
+	blobStore := NewS3BlobStore(properties.StorageProperties{
+		Type:          BlobStoreTypeS3,
+		ContainerName: fmt.Sprintf("csm-test-%d", time.Now().UnixNano()),
+		S3: properties.S3StorageProperties{
+			Endpoint:        endpoint,
+			AccessKeyId:     os.Getenv("S3_TEST_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_TEST_SECRET_ACCESS_KEY"),
+		},
+	})
+
+	ctx := context.Background()
+	assert.Nil(t, blobStore.client.MakeBucket(ctx, blobStore.bucketName, minio.MakeBucketOptions{}))
+	t.Cleanup(func() {
+		for objectInfo := range blobStore.client.ListObjects(ctx, blobStore.bucketName, minio.ListObjectsOptions{Recursive: true}) {
+			_ = blobStore.client.RemoveObject(ctx, blobStore.bucketName, objectInfo.Key, minio.RemoveObjectOptions{})
+		}
+		_ = blobStore.client.RemoveBucket(ctx, blobStore.bucketName)
+	})
+	return blobStore
+}
+
+func TestS3BlobStore_UploadAndDownload(t *testing.T) {
+
+	// prepare
+	blobStore := newTestS3BlobStore(t)
+	content := []byte("image")
+	fileName := "original.jpg"
+
+	// execute
+	err := blobStore.UploadBlob("project/image/small/1", "2", &content, map[string]*string{"FileName": &fileName}, "image/jpeg")
+	assert.Nil(t, err)
+	blob, err := blobStore.DownloadBlob("project/image/small/1", "2")
+
+	// verify
+	assert.Nil(t, err)
+	assert.Equal(t, content, blob.Buffer)
+	assert.Equal(t, "image/jpeg", *blob.ContentType)
+	assert.Equal(t, fileName, *blob.Metadata["filename"])
+}
+
+func TestS3BlobStore_GetBlobProperties(t *testing.T) {
+
+	// prepare
+	blobStore := newTestS3BlobStore(t)
+	content := []byte("image")
+	assert.Nil(t, blobStore.UploadBlob("images", "1", &content, nil, "image/png"))
+
+	// execute
+	blobProperties, err := blobStore.GetBlobProperties("images", "1")
+
+	// verify
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(content)), blobProperties.ContentLength)
+	assert.Equal(t, "image/png", *blobProperties.ContentType)
+	assert.NotEmpty(t, blobProperties.ETag)
+	assert.False(t, blobProperties.LastModified.IsZero())
+}
+
+func TestS3BlobStore_ListBlobsWithPrefix(t *testing.T) {
+
+	// prepare
+	blobStore := newTestS3BlobStore(t)
+	content := []byte("image")
+	assert.Nil(t, blobStore.UploadBlob("project/image/small/1", "2", &content, nil, "image/jpeg"))
+	assert.Nil(t, blobStore.UploadBlob("project/image/fullhd/1", "2", &content, nil, "image/jpeg"))
+	assert.Nil(t, blobStore.UploadBlob("user/image/small/3", "4", &content, nil, "image/jpeg"))
+
+	// execute
+	blobNames, err := blobStore.ListBlobs("project/")
+
+	// verify
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"project/image/small/1/2", "project/image/fullhd/1/2"}, blobNames)
+}
+
+func TestS3BlobStore_WalkBlobsAfterName(t *testing.T) {
+
+	// prepare
+	blobStore := newTestS3BlobStore(t)
+	content := []byte("image")
+	for _, owner := range []string{"1", "2", "3"} {
+		assert.Nil(t, blobStore.UploadBlob("project/image/original/task1", owner, &content, nil, "image/jpeg"))
+	}
+	assert.Nil(t, blobStore.UploadBlob("project/image/original/task1-2", "4", &content, nil, "image/jpeg"))
+	assert.Nil(t, blobStore.UploadBlob("project/image/original/task2", "5", &content, nil, "image/jpeg"))
+	assert.Nil(t, blobStore.UploadBlob("project/image/small/task1", "1", &content, nil, "image/jpeg"))
+
+	// execute
+	var blobNames []string
+	err := blobStore.WalkBlobs("project/image/original/", "project/image/original/task1/1", func(page []string) error {
+		blobNames = append(blobNames, page...)
+		return nil
+	})
+
+	// verify
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"project/image/original/task1/2", "project/image/original/task1/3", "project/image/original/task2/5"}, blobNames)
+}
+
+func TestS3BlobStore_DeleteBlob(t *testing.T) {
+
+	// prepare
+	blobStore := newTestS3BlobStore(t)
+	content := []byte("image")
+	assert.Nil(t, blobStore.UploadBlob("images", "1", &content, nil, "image/jpeg"))
+
+	// execute
+	err := blobStore.DeleteBlob("images", "1")
+
+	// verify
+	assert.Nil(t, err)
+	_, err = blobStore.DownloadBlob("images", "1")
+	assert.ErrorIs(t, err, ErrBlobNotFound)
+	_, err = blobStore.GetBlobProperties("images", "1")
+	assert.ErrorIs(t, err, ErrBlobNotFound)
+}
@@ -8,10 +8,13 @@ import (
 )
 
 type Configuration struct {
-	HttpClient commonProperties.HttpClientProperties
-	Kafka      properties.KafkaProperties
-	Server     properties.ServerProperties
-	Storage    properties.StorageProperties
+	Admin         properties.AdminProperties
+	Deduplication properties.DeduplicationProperties
+	EventGrid     properties.EventGridProperties
+	HttpClient    commonProperties.HttpClientProperties
+	Kafka         properties.KafkaProperties
+	Server        properties.ServerProperties
+	Storage       properties.StorageProperties
 }
 
 func NewConfiguration(configRoot ...string) Configuration {
@@ -0,0 +1,7 @@
+package properties
+
+type AdminProperties struct {
+	Enabled bool
+	Path    string //optional
+	Token   string //required if enabled
+}
@@ -0,0 +1,10 @@
+package properties
+
+import "time"
+
+type DeduplicationProperties struct {
+	Store      string        `validate:"required,oneof=memory table none"`
+	Ttl        time.Duration `validate:"required"`
+	MaxEntries int           //optional (memory store only)
+	TableName  string        //optional (table store only)
+}
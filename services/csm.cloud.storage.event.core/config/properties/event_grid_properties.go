@@ -0,0 +1,18 @@
+package properties
+
+type EventGridProperties struct {
+	Webhook WebhookProperties
+}
+
+type WebhookProperties struct {
+	Enabled      bool
+	Path         string
+	SharedSecret string
+	Aad          AadProperties
+}
+
+type AadProperties struct {
+	TenantId string
+	Audience string
+	JwksUrl  string //optional
+}
@@ -1,9 +1,12 @@
 package properties
 
-import "time"
+import (
+	commonProperties "dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/config/properties"
+	"time"
+)
 
 type StorageProperties struct {
-	ConnectionString                       string        `validate:"required"`
+	ConnectionString                       string        `validate:"required_without=Credential.Type"`
 	MaxAllowedContentLength                int64         `validate:"required"`
 	QueueName                              string        `validate:"required"`
 	QueueBatchNumberOfMessages             int32         `validate:"required"`
@@ -11,6 +14,13 @@ type StorageProperties struct {
 	QueuePollingInterval                   time.Duration `validate:"required"`
 	QueuePollingRetryBackoff               time.Duration `validate:"required"`
 	QueuePollingRetryAttempts              uint          `validate:"required"`
+	QueuePollingEnabled                    bool
+
+	// Token based authentication (instead of the connection string) is used if a credential type is configured
+	Credential      commonProperties.AzureCredentialProperties //optional
+	BlobAccountUrl  string                                     //optional (required with credential)
+	QueueAccountUrl string                                     //optional (required with credential)
+	TableAccountUrl string                                     //optional (required with credential and table deduplication)
 }
 
 type SharedKey struct {
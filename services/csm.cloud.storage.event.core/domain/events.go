@@ -1,11 +1,39 @@
 package domain
 
+/*
+FileCreatedEvent is the representation of FileCreatedEventAvro. The scan provenance fields were added with version 2
+of the schema and are optional, so that consumers can still read events of version 1.
+*/
 type FileCreatedEvent struct {
-	Identifier    string `json:"identifier"`
-	Path          string `json:"path"`
-	FileName      string `json:"filename"`
-	ContentType   string `json:"contentType"`
-	ContentLength int64  `json:"contentLength"`
+	Identifier       string          `json:"identifier"`
+	Path             string          `json:"path"`
+	FileName         string          `json:"filename"`
+	ContentType      string          `json:"contentType"`
+	ContentLength    int64           `json:"contentLength"`
+	StorageAccount   *OptionalString `json:"storageAccount"`
+	Container        *OptionalString `json:"container"`
+	ETag             *OptionalString `json:"eTag"`
+	Sha256           *OptionalString `json:"sha256"`
+	ScanFinishedTime *OptionalString `json:"scanFinishedTime"`
+	CorrelationId    *OptionalString `json:"correlationId"`
+	EventTime        *OptionalString `json:"eventTime"`
+}
+
+/*
+OptionalString is the avro JSON encoding of a ["null", "string"] union value. A nil pointer encodes null.
+*/
+type OptionalString struct {
+	String string `json:"string"`
+}
+
+/*
+NewOptionalString returns the union value for the given string or nil for an empty string
+*/
+func NewOptionalString(value string) *OptionalString {
+	if value == "" {
+		return nil
+	}
+	return &OptionalString{String: value}
 }
 
 type StringMessageKey struct {
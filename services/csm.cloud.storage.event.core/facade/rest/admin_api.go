@@ -0,0 +1,111 @@
+package rest
+
+import (
+	"crypto/subtle"
+	"csm.cloud.storage.event.core/config/properties"
+	"csm.cloud.storage.event.core/storage/queue"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/app"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"strings"
+)
+
+const defaultAdminPath = "/admin"
+
+/*
+QueueListenerControl controls the storage queue listener at runtime
+*/
+type QueueListenerControl interface {
+	Pause()
+	Resume()
+	PollNow() error
+	Status() (queue.ListenerStatus, error)
+}
+
+/*
+AdminApi provides endpoints for operators to pause and resume the ingestion during incidents (instead of scaling
+the service to zero), to inspect the queue listener and to trigger an immediate poll. Requests are authenticated
+by the configured token passed as bearer token.
+*/
+type AdminApi struct {
+	path                 string
+	token                string
+	queueListenerControl QueueListenerControl
+}
+
+/*
+NewAdminApi creates the admin api for the given configuration. Fails fast (in panic) if no token is configured.
+*/
+func NewAdminApi(properties properties.AdminProperties, queueListenerControl QueueListenerControl) AdminApi {
+	if properties.Token == "" {
+		panic(app.NewFatalError("Admin api requires a token", nil))
+	}
+
+	path := properties.Path
+	if path == "" {
+		path = defaultAdminPath
+	}
+
+	return AdminApi{
+		path:                 strings.TrimSuffix(path, "/"),
+		token:                properties.Token,
+		queueListenerControl: queueListenerControl,
+	}
+}
+
+/*
+RegisterRoutes adds the admin endpoints to the router
+*/
+func (this *AdminApi) RegisterRoutes(router *gin.Engine) {
+	group := router.Group(this.path, this.authenticate)
+	group.GET("/queue-listener", this.getQueueListenerStatus)
+	group.POST("/queue-listener/pause", this.pauseQueueListener)
+	group.POST("/queue-listener/resume", this.resumeQueueListener)
+	group.POST("/queue-listener/poll", this.pollQueueListener)
+}
+
+func (this *AdminApi) authenticate(context *gin.Context) {
+	token, found := strings.CutPrefix(context.GetHeader("Authorization"), "Bearer ")
+	if !found || subtle.ConstantTimeCompare([]byte(token), []byte(this.token)) != 1 {
+		log.Warn().Msg(fmt.Sprintf("Rejecting unauthenticated admin request %s %s", context.Request.Method, context.Request.URL.Path))
+		context.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	context.Next()
+}
+
+/*
+getQueueListenerStatus responds with the state of the listener. The approximate message count is omitted if the
+queue properties couldn't be read.
+*/
+func (this *AdminApi) getQueueListenerStatus(context *gin.Context) {
+	status, err := this.queueListenerControl.Status()
+	if err != nil {
+		log.Warn().Msg("Reading storage queue properties failed: " + err.Error())
+	}
+	context.JSON(http.StatusOK, status)
+}
+
+func (this *AdminApi) pauseQueueListener(context *gin.Context) {
+	log.Info().Msg("Queue listener pause requested by admin api")
+	this.queueListenerControl.Pause()
+	context.Status(http.StatusNoContent)
+}
+
+func (this *AdminApi) resumeQueueListener(context *gin.Context) {
+	log.Info().Msg("Queue listener resume requested by admin api")
+	this.queueListenerControl.Resume()
+	context.Status(http.StatusNoContent)
+}
+
+func (this *AdminApi) pollQueueListener(context *gin.Context) {
+	err := this.queueListenerControl.PollNow()
+	if errors.Is(err, queue.ErrListenerPaused) {
+		context.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	context.Status(http.StatusAccepted)
+}
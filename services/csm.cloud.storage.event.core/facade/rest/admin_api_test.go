@@ -0,0 +1,164 @@
+package rest
+
+import (
+	"csm.cloud.storage.event.core/config/properties"
+	"csm.cloud.storage.event.core/storage/queue"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Define QueueListenerControl mock
+
+type QueueListenerControlMock struct {
+	mock.Mock
+}
+
+func (this *QueueListenerControlMock) Pause() {
+	this.Called()
+}
+
+func (this *QueueListenerControlMock) Resume() {
+	this.Called()
+}
+
+func (this *QueueListenerControlMock) PollNow() error {
+	args := this.Called()
+	return args.Error(0)
+}
+
+func (this *QueueListenerControlMock) Status() (queue.ListenerStatus, error) {
+	args := this.Called()
+	return args.Get(0).(queue.ListenerStatus), args.Error(1)
+}
+
+// Tests
+
+func TestAdminApi_PanicsWithoutToken(t *testing.T) {
+
+	assert.Panics(t, func() {
+		NewAdminApi(properties.AdminProperties{Enabled: true}, &QueueListenerControlMock{})
+	}, "Admin api without token configured should panic")
+}
+
+func TestAdminApi_RejectsWrongToken(t *testing.T) {
+
+	// prepare
+	controlMock := &QueueListenerControlMock{}
+	router := createTestAdminRouter(controlMock)
+
+	for _, authorization := range []string{"", "Bearer wrong", "admin-token"} {
+		recorder := httptest.NewRecorder()
+		request, _ := http.NewRequest("POST", "/admin/queue-listener/pause", nil)
+		request.Header.Set("Authorization", authorization)
+
+		// execute
+		router.ServeHTTP(recorder, request)
+
+		// verify
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	}
+	controlMock.AssertNumberOfCalls(t, "Pause", 0)
+}
+
+func TestAdminApi_PauseAndResume(t *testing.T) {
+
+	// prepare
+	controlMock := &QueueListenerControlMock{}
+	controlMock.On("Pause").Return()
+	controlMock.On("Resume").Return()
+	router := createTestAdminRouter(controlMock)
+
+	// execute
+	pauseRecorder := serveAdminRequest(router, "POST", "/admin/queue-listener/pause")
+	resumeRecorder := serveAdminRequest(router, "POST", "/admin/queue-listener/resume")
+
+	// verify
+	assert.Equal(t, http.StatusNoContent, pauseRecorder.Code)
+	assert.Equal(t, http.StatusNoContent, resumeRecorder.Code)
+	controlMock.AssertExpectations(t)
+}
+
+func TestAdminApi_Status(t *testing.T) {
+
+	// prepare
+	messageCount := int32(42)
+	lastBatchTime := time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC)
+	controlMock := &QueueListenerControlMock{}
+	controlMock.On("Status").Return(queue.ListenerStatus{
+		Paused:                   true,
+		PollingEnabled:           true,
+		ApproximateMessageCount:  &messageCount,
+		LastSuccessfulBatchTime:  &lastBatchTime,
+		LastSuccessfulBatchCount: 1,
+	}, nil)
+	router := createTestAdminRouter(controlMock)
+
+	// execute
+	recorder := serveAdminRequest(router, "GET", "/admin/queue-listener")
+
+	// verify
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{
+		"paused": true,
+		"pollingEnabled": true,
+		"approximateMessageCount": 42,
+		"lastSuccessfulBatchTime": "2024-01-31T12:00:00Z",
+		"lastSuccessfulBatchCount": 1
+	}`, recorder.Body.String())
+}
+
+func TestAdminApi_StatusWithoutMessageCount(t *testing.T) {
+
+	// prepare
+	controlMock := &QueueListenerControlMock{}
+	controlMock.On("Status").Return(queue.ListenerStatus{PollingEnabled: true}, errors.New("queue not found"))
+	router := createTestAdminRouter(controlMock)
+
+	// execute
+	recorder := serveAdminRequest(router, "GET", "/admin/queue-listener")
+
+	// verify
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"paused": false, "pollingEnabled": true, "lastSuccessfulBatchCount": 0}`, recorder.Body.String())
+}
+
+func TestAdminApi_Poll(t *testing.T) {
+
+	// prepare
+	controlMock := &QueueListenerControlMock{}
+	controlMock.On("PollNow").Return(nil).Once()
+	controlMock.On("PollNow").Return(queue.ErrListenerPaused).Once()
+	router := createTestAdminRouter(controlMock)
+
+	// execute
+	acceptedRecorder := serveAdminRequest(router, "POST", "/admin/queue-listener/poll")
+	pausedRecorder := serveAdminRequest(router, "POST", "/admin/queue-listener/poll")
+
+	// verify
+	assert.Equal(t, http.StatusAccepted, acceptedRecorder.Code)
+	assert.Equal(t, http.StatusConflict, pausedRecorder.Code)
+	controlMock.AssertExpectations(t)
+}
+
+func createTestAdminRouter(control QueueListenerControl) *gin.Engine {
+	adminApi := NewAdminApi(properties.AdminProperties{Enabled: true, Token: "admin-token"}, control)
+	router, err := initRouter(adminApi.RegisterRoutes)
+	if err != nil {
+		panic(err)
+	}
+	return router
+}
+
+func serveAdminRequest(router *gin.Engine, method string, path string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest(method, path, nil)
+	request.Header.Set("Authorization", "Bearer admin-token")
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
@@ -0,0 +1,195 @@
+package rest
+
+import (
+	"crypto/rsa"
+	"crypto/subtle"
+	"csm.cloud.storage.event.core/config/properties"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rs/zerolog/log"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const sharedSecretHeader = "X-Webhook-Secret"
+const sharedSecretQueryParameter = "code"
+
+// Signing keys are refreshed at most once in this interval when a token with an unknown key id is received
+const jwksRefreshInterval = 5 * time.Minute
+
+/*
+webhookAuthenticator authenticates Event Grid push deliveries either by a shared secret (passed as query parameter
+or header configured as delivery property of the event subscription) or by an AAD token issued for the configured
+audience. Requests are accepted if one of the configured methods succeeds.
+*/
+type webhookAuthenticator struct {
+	sharedSecret      string
+	aadTokenValidator *aadTokenValidator
+}
+
+func newWebhookAuthenticator(properties properties.WebhookProperties) (*webhookAuthenticator, error) {
+	authenticator := &webhookAuthenticator{sharedSecret: properties.SharedSecret}
+	if properties.Aad.TenantId != "" || properties.Aad.Audience != "" {
+		if properties.Aad.TenantId == "" || properties.Aad.Audience == "" {
+			return nil, errors.New("AAD authentication requires both tenant id and audience")
+		}
+		authenticator.aadTokenValidator = newAadTokenValidator(properties.Aad)
+	}
+	if authenticator.sharedSecret == "" && authenticator.aadTokenValidator == nil {
+		return nil, errors.New("neither a shared secret nor AAD authentication is configured")
+	}
+	return authenticator, nil
+}
+
+func (this *webhookAuthenticator) authenticate(request *http.Request) error {
+	if this.sharedSecret != "" {
+		secret := request.Header.Get(sharedSecretHeader)
+		if secret == "" {
+			secret = request.URL.Query().Get(sharedSecretQueryParameter)
+		}
+		if secret != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(this.sharedSecret)) == 1 {
+			return nil
+		}
+	}
+	if this.aadTokenValidator != nil {
+		authorization := request.Header.Get("Authorization")
+		if token, isBearer := strings.CutPrefix(authorization, "Bearer "); isBearer {
+			return this.aadTokenValidator.validate(token)
+		}
+	}
+	return errors.New("no valid credentials provided")
+}
+
+/*
+aadTokenValidator validates bearer tokens issued by Azure Active Directory for the configured tenant and audience.
+The signing keys are loaded from the JSON web key set of the tenant and cached.
+*/
+type aadTokenValidator struct {
+	audience    string
+	issuers     []string
+	jwksUrl     string
+	httpClient  *http.Client
+	mutex       sync.Mutex
+	keys        map[string]*rsa.PublicKey
+	lastRefresh time.Time
+}
+
+func newAadTokenValidator(properties properties.AadProperties) *aadTokenValidator {
+	jwksUrl := properties.JwksUrl
+	if jwksUrl == "" {
+		jwksUrl = fmt.Sprintf("https://login.microsoftonline.com/%s/discovery/v2.0/keys", properties.TenantId)
+	}
+	return &aadTokenValidator{
+		audience: properties.Audience,
+		// Tokens are issued either by the v1 or the v2 endpoint depending on the app registration
+		issuers: []string{
+			fmt.Sprintf("https://sts.windows.net/%s/", properties.TenantId),
+			fmt.Sprintf("https://login.microsoftonline.com/%s/v2.0", properties.TenantId),
+		},
+		jwksUrl:    jwksUrl,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		keys:       make(map[string]*rsa.PublicKey),
+	}
+}
+
+func (this *aadTokenValidator) validate(token string) error {
+	claims := jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(token, &claims, this.getSigningKey,
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithAudience(this.audience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return err
+	}
+	for _, issuer := range this.issuers {
+		if claims.Issuer == issuer {
+			return nil
+		}
+	}
+	return fmt.Errorf("token issuer %s is not trusted", claims.Issuer)
+}
+
+func (this *aadTokenValidator) getSigningKey(token *jwt.Token) (any, error) {
+	keyId, _ := token.Header["kid"].(string)
+	if keyId == "" {
+		return nil, errors.New("token has no key id")
+	}
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	key, isKnownKey := this.keys[keyId]
+	if !isKnownKey && time.Since(this.lastRefresh) > jwksRefreshInterval {
+		err := this.refreshSigningKeys()
+		if err != nil {
+			return nil, err
+		}
+		key, isKnownKey = this.keys[keyId]
+	}
+	if !isKnownKey {
+		return nil, fmt.Errorf("unknown signing key %s", keyId)
+	}
+	return key, nil
+}
+
+/*
+refreshSigningKeys loads the RSA signing keys from the JSON web key set. Must be called with the mutex held.
+*/
+func (this *aadTokenValidator) refreshSigningKeys() error {
+	this.lastRefresh = time.Now()
+
+	response, err := this.httpClient.Get(this.jwksUrl)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("loading signing keys from %s failed with status %d", this.jwksUrl, response.StatusCode)
+	}
+
+	var keySet struct {
+		Keys []struct {
+			KeyId    string `json:"kid"`
+			KeyType  string `json:"kty"`
+			Modulus  string `json:"n"`
+			Exponent string `json:"e"`
+		} `json:"keys"`
+	}
+	err = json.NewDecoder(response.Body).Decode(&keySet)
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, key := range keySet.Keys {
+		if key.KeyType != "RSA" {
+			continue
+		}
+		modulus, err := base64.RawURLEncoding.DecodeString(key.Modulus)
+		if err != nil {
+			log.Warn().Msg(fmt.Sprintf("Ignoring signing key %s with invalid modulus", key.KeyId))
+			continue
+		}
+		exponent, err := base64.RawURLEncoding.DecodeString(key.Exponent)
+		if err != nil {
+			log.Warn().Msg(fmt.Sprintf("Ignoring signing key %s with invalid exponent", key.KeyId))
+			continue
+		}
+		keys[key.KeyId] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(modulus),
+			E: int(new(big.Int).SetBytes(exponent).Int64()),
+		}
+	}
+	this.keys = keys
+	log.Debug().Msg(fmt.Sprintf("Loaded %d signing keys from %s", len(keys), this.jwksUrl))
+	return nil
+}
@@ -0,0 +1,179 @@
+package rest
+
+import (
+	"csm.cloud.storage.event.core/config/properties"
+	"csm.cloud.storage.event.core/storage/domain"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/app"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"io"
+	"mime"
+	"net/http"
+)
+
+const defaultWebhookPath = "/events/malware-scan"
+
+// Event Grid delivers batches of at most 1 MB
+const maxWebhookRequestBodySize = 1024 * 1024
+
+/*
+MalwareScannedEventHandler processes malware scanned events received by push delivery.
+A nil error means that the event is done with, an error means that it must be delivered again.
+*/
+type MalwareScannedEventHandler interface {
+	HandleMalwareScannedEvent(malwareScannedEvent *domain.MalwareScannedEvent) error
+}
+
+/*
+EventGridWebhook accepts Event Grid push deliveries of malware scanning results as an alternative to polling
+the storage queue. Both the Event Grid schema and the CloudEvents 1.0 schema are supported including the respective
+subscription validation handshake.
+*/
+type EventGridWebhook struct {
+	path          string
+	authenticator *webhookAuthenticator
+	eventHandler  MalwareScannedEventHandler
+}
+
+/*
+NewEventGridWebhook creates the webhook for the given configuration. Fails fast (in panic) if no authentication
+method is configured.
+*/
+func NewEventGridWebhook(properties properties.WebhookProperties, eventHandler MalwareScannedEventHandler) EventGridWebhook {
+	authenticator, err := newWebhookAuthenticator(properties)
+	if err != nil {
+		panic(app.NewFatalError("Event Grid webhook authentication is misconfigured", err))
+	}
+
+	path := properties.Path
+	if path == "" {
+		path = defaultWebhookPath
+	}
+
+	return EventGridWebhook{
+		path:          path,
+		authenticator: authenticator,
+		eventHandler:  eventHandler,
+	}
+}
+
+/*
+RegisterRoutes adds the webhook endpoints to the router
+*/
+func (this *EventGridWebhook) RegisterRoutes(router *gin.Engine) {
+	router.OPTIONS(this.path, this.handleCloudEventsValidation)
+	router.POST(this.path, this.handleDelivery)
+}
+
+/*
+handleCloudEventsValidation implements the abuse protection handshake of the CloudEvents webhook specification
+which Event Grid performs with an OPTIONS request before delivering events in the CloudEvents 1.0 schema
+*/
+func (this *EventGridWebhook) handleCloudEventsValidation(context *gin.Context) {
+	origin := context.GetHeader("WebHook-Request-Origin")
+	if origin == "" {
+		context.Status(http.StatusBadRequest)
+		return
+	}
+	log.Info().Msg(fmt.Sprintf("Confirming CloudEvents webhook validation for origin %s", origin))
+	context.Header("WebHook-Allowed-Origin", origin)
+	context.Header("WebHook-Allowed-Rate", "*")
+	context.Status(http.StatusOK)
+}
+
+/*
+handleDelivery authenticates the push delivery and dispatches it depending on the schema used
+*/
+func (this *EventGridWebhook) handleDelivery(context *gin.Context) {
+	err := this.authenticator.authenticate(context.Request)
+	if err != nil {
+		log.Warn().Msg(fmt.Sprintf("Rejecting unauthenticated Event Grid delivery: %s", err.Error()))
+		context.Status(http.StatusUnauthorized)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(context.Writer, context.Request.Body, maxWebhookRequestBodySize))
+	if err != nil {
+		context.Status(http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(context.GetHeader("Content-Type"))
+	if mediaType == "application/cloudevents+json" || mediaType == "application/cloudevents-batch+json" {
+		this.handleCloudEvents(context, body)
+	} else {
+		this.handleEventGridEvents(context, body)
+	}
+}
+
+func (this *EventGridWebhook) handleEventGridEvents(context *gin.Context, body []byte) {
+	events, err := domain.ParseEventGridEvents(body)
+	if err != nil {
+		log.Error().Msg("Decoding Event Grid events failed: " + err.Error())
+		context.Status(http.StatusBadRequest)
+		return
+	}
+
+	for _, event := range events {
+		// Respond to the subscription validation handshake of the Event Grid schema
+		if event.EventType == domain.SubscriptionValidationEventType {
+			validationData, err := event.ToSubscriptionValidationData()
+			if err != nil {
+				log.Error().Msg("Decoding subscription validation event failed: " + err.Error())
+				context.Status(http.StatusBadRequest)
+				return
+			}
+			log.Info().Msg(fmt.Sprintf("Confirming Event Grid subscription validation for topic %s", event.Topic))
+			context.JSON(http.StatusOK, gin.H{"validationResponse": validationData.ValidationCode})
+			return
+		}
+
+		malwareScannedEvent, err := event.ToMalwareScannedEvent()
+		if err != nil {
+			log.Error().Msg(fmt.Sprintf("Decoding event %s into MalwareScannedEvent failed: %s", event.Id, err.Error()))
+			context.Status(http.StatusBadRequest)
+			return
+		}
+		if !this.handleEvent(context, malwareScannedEvent) {
+			return
+		}
+	}
+	context.Status(http.StatusOK)
+}
+
+func (this *EventGridWebhook) handleCloudEvents(context *gin.Context, body []byte) {
+	events, err := domain.ParseCloudEvents(body)
+	if err != nil {
+		log.Error().Msg("Decoding CloudEvents failed: " + err.Error())
+		context.Status(http.StatusBadRequest)
+		return
+	}
+
+	for _, event := range events {
+		malwareScannedEvent, err := event.ToMalwareScannedEvent()
+		if err != nil {
+			log.Error().Msg(fmt.Sprintf("Decoding event %s into MalwareScannedEvent failed: %s", event.Id, err.Error()))
+			context.Status(http.StatusBadRequest)
+			return
+		}
+		if !this.handleEvent(context, malwareScannedEvent) {
+			return
+		}
+	}
+	context.Status(http.StatusOK)
+}
+
+/*
+handleEvent passes a single event to the event handler. Responds with an error status so that Event Grid retries
+the delivery if the event couldn't be processed.
+*/
+func (this *EventGridWebhook) handleEvent(context *gin.Context, malwareScannedEvent *domain.MalwareScannedEvent) bool {
+	err := this.eventHandler.HandleMalwareScannedEvent(malwareScannedEvent)
+	if err != nil {
+		log.Error().Msg(fmt.Sprintf("Processing event %s failed, delivery will be retried: %s", malwareScannedEvent.Id, err.Error()))
+		context.Status(http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,286 @@
+package rest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"csm.cloud.storage.event.core/config/properties"
+	"csm.cloud.storage.event.core/storage/domain"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Define MalwareScannedEventHandler mock
+
+type MalwareScannedEventHandlerMock struct {
+	mock.Mock
+}
+
+func (this *MalwareScannedEventHandlerMock) HandleMalwareScannedEvent(malwareScannedEvent *domain.MalwareScannedEvent) error {
+	args := this.Called(malwareScannedEvent)
+	return args.Error(0)
+}
+
+// Tests
+
+func TestEventGridWebhook_PanicsWithoutAuthentication(t *testing.T) {
+
+	assert.Panics(t, func() {
+		NewEventGridWebhook(properties.WebhookProperties{Enabled: true}, &MalwareScannedEventHandlerMock{})
+	}, "Webhook without authentication configured should panic")
+}
+
+func TestEventGridWebhook_RejectsWrongSharedSecret(t *testing.T) {
+
+	// prepare
+	handlerMock := &MalwareScannedEventHandlerMock{}
+	router := createTestRouter(properties.WebhookProperties{SharedSecret: "secret"}, handlerMock)
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest("POST", "/events/malware-scan?code=wrong", strings.NewReader(eventGridMalwareScanningResult))
+
+	// execute
+	router.ServeHTTP(recorder, request)
+
+	// verify
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	handlerMock.AssertNumberOfCalls(t, "HandleMalwareScannedEvent", 0)
+}
+
+func TestEventGridWebhook_EventGridSubscriptionValidation(t *testing.T) {
+
+	// prepare
+	handlerMock := &MalwareScannedEventHandlerMock{}
+	router := createTestRouter(properties.WebhookProperties{SharedSecret: "secret"}, handlerMock)
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest("POST", "/events/malware-scan?code=secret", strings.NewReader(eventGridSubscriptionValidation))
+	request.Header.Set("aeg-event-type", "SubscriptionValidation")
+
+	// execute
+	router.ServeHTTP(recorder, request)
+
+	// verify
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, `{"validationResponse":"512d38b6-c7b8-40c8-89fe-f46f9e9622b6"}`, recorder.Body.String())
+	handlerMock.AssertNumberOfCalls(t, "HandleMalwareScannedEvent", 0)
+}
+
+func TestEventGridWebhook_CloudEventsValidation(t *testing.T) {
+
+	// prepare
+	router := createTestRouter(properties.WebhookProperties{SharedSecret: "secret"}, &MalwareScannedEventHandlerMock{})
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest("OPTIONS", "/events/malware-scan", nil)
+	request.Header.Set("WebHook-Request-Origin", "eventgrid.azure.net")
+
+	// execute
+	router.ServeHTTP(recorder, request)
+
+	// verify
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "eventgrid.azure.net", recorder.Header().Get("WebHook-Allowed-Origin"))
+}
+
+func TestEventGridWebhook_EventGridDelivery(t *testing.T) {
+
+	// prepare
+	handlerMock := &MalwareScannedEventHandlerMock{}
+	handlerMock.On("HandleMalwareScannedEvent", mock.Anything).Return(nil)
+	router := createTestRouter(properties.WebhookProperties{SharedSecret: "secret"}, handlerMock)
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest("POST", "/events/malware-scan", strings.NewReader(eventGridMalwareScanningResult))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Webhook-Secret", "secret")
+
+	// execute
+	router.ServeHTTP(recorder, request)
+
+	// verify
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	handlerMock.AssertNumberOfCalls(t, "HandleMalwareScannedEvent", 1)
+	event := handlerMock.Calls[0].Arguments.Get(0).(*domain.MalwareScannedEvent)
+	assert.Equal(t, "2209bebf-9e38-4fdd-bf9c-5842129d8f63", event.Id)
+	assert.Equal(t, "No threats found", event.Data.ScanResultType)
+}
+
+func TestEventGridWebhook_CloudEventsDelivery(t *testing.T) {
+
+	// prepare
+	handlerMock := &MalwareScannedEventHandlerMock{}
+	handlerMock.On("HandleMalwareScannedEvent", mock.Anything).Return(nil)
+	router := createTestRouter(properties.WebhookProperties{SharedSecret: "secret"}, handlerMock)
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest("POST", "/events/malware-scan?code=secret", strings.NewReader(cloudEventMalwareScanningResult))
+	request.Header.Set("Content-Type", "application/cloudevents+json; charset=utf-8")
+
+	// execute
+	router.ServeHTTP(recorder, request)
+
+	// verify
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	handlerMock.AssertNumberOfCalls(t, "HandleMalwareScannedEvent", 1)
+	event := handlerMock.Calls[0].Arguments.Get(0).(*domain.MalwareScannedEvent)
+	assert.Equal(t, "Microsoft.Security.MalwareScanningResult", event.EventType)
+	assert.Equal(t, "Malicious", event.Data.ScanResultType)
+}
+
+func TestEventGridWebhook_FailingHandlerRequestsRedelivery(t *testing.T) {
+
+	// prepare
+	handlerMock := &MalwareScannedEventHandlerMock{}
+	handlerMock.On("HandleMalwareScannedEvent", mock.Anything).Return(errors.New("SOME_KAFKA_AVAILABILITY_ISSUE"))
+	router := createTestRouter(properties.WebhookProperties{SharedSecret: "secret"}, handlerMock)
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest("POST", "/events/malware-scan?code=secret", strings.NewReader(eventGridMalwareScanningResult))
+
+	// execute
+	router.ServeHTTP(recorder, request)
+
+	// verify that an error status is returned so that Event Grid retries the delivery
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	handlerMock.AssertNumberOfCalls(t, "HandleMalwareScannedEvent", 1)
+}
+
+func TestEventGridWebhook_InvalidBody(t *testing.T) {
+
+	// prepare
+	handlerMock := &MalwareScannedEventHandlerMock{}
+	router := createTestRouter(properties.WebhookProperties{SharedSecret: "secret"}, handlerMock)
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest("POST", "/events/malware-scan?code=secret", strings.NewReader("Not a JSON - obviously"))
+
+	// execute
+	router.ServeHTTP(recorder, request)
+
+	// verify
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	handlerMock.AssertNumberOfCalls(t, "HandleMalwareScannedEvent", 0)
+}
+
+func TestEventGridWebhook_AadAuthentication(t *testing.T) {
+
+	// prepare signing key and JSON web key set
+	signingKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	jwksServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = fmt.Fprintf(writer, `{"keys":[{"kty":"RSA","kid":"test-key","n":"%s","e":"%s"}]}`,
+			base64.RawURLEncoding.EncodeToString(signingKey.N.Bytes()),
+			base64.RawURLEncoding.EncodeToString(big.NewInt(int64(signingKey.E)).Bytes()))
+	}))
+	defer jwksServer.Close()
+
+	handlerMock := &MalwareScannedEventHandlerMock{}
+	handlerMock.On("HandleMalwareScannedEvent", mock.Anything).Return(nil)
+	router := createTestRouter(properties.WebhookProperties{
+		Aad: properties.AadProperties{
+			TenantId: "tenant",
+			Audience: "api://storage-event",
+			JwksUrl:  jwksServer.URL,
+		},
+	}, handlerMock)
+
+	validToken := createTestToken(t, signingKey, "https://sts.windows.net/tenant/", "api://storage-event")
+	otherAudienceToken := createTestToken(t, signingKey, "https://sts.windows.net/tenant/", "api://other")
+	otherIssuerToken := createTestToken(t, signingKey, "https://sts.windows.net/other/", "api://storage-event")
+
+	for token, expectedStatus := range map[string]int{
+		validToken:         http.StatusOK,
+		otherAudienceToken: http.StatusUnauthorized,
+		otherIssuerToken:   http.StatusUnauthorized,
+		"invalid":          http.StatusUnauthorized,
+	} {
+		recorder := httptest.NewRecorder()
+		request, _ := http.NewRequest("POST", "/events/malware-scan", strings.NewReader(eventGridMalwareScanningResult))
+		request.Header.Set("Authorization", "Bearer "+token)
+
+		// execute
+		router.ServeHTTP(recorder, request)
+
+		// verify
+		assert.Equal(t, expectedStatus, recorder.Code)
+	}
+	handlerMock.AssertNumberOfCalls(t, "HandleMalwareScannedEvent", 1)
+}
+
+func createTestRouter(webhookProperties properties.WebhookProperties, handler MalwareScannedEventHandler) *gin.Engine {
+	webhook := NewEventGridWebhook(webhookProperties, handler)
+	router, err := initRouter(webhook.RegisterRoutes)
+	if err != nil {
+		panic(err)
+	}
+	return router
+}
+
+func createTestToken(t *testing.T, signingKey *rsa.PrivateKey, issuer string, audience string) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.RegisteredClaims{
+		Issuer:    issuer,
+		Audience:  jwt.ClaimStrings{audience},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	})
+	token.Header["kid"] = "test-key"
+	signedToken, err := token.SignedString(signingKey)
+	assert.Nil(t, err)
+	return signedToken
+}
+
+const eventGridMalwareScanningResult = `[{
+	"id": "2209bebf-9e38-4fdd-bf9c-5842129d8f63",
+	"subject": "storageAccounts/defendermalwaretest/containers/csm-quarantine-container/blobs/images/projects/60098f64-f566-49c6-86d8-1071eaebc6a3/picture/76b390f8-f66c-43d1-b181-c703ec817110",
+	"data": {
+		"correlationId": "2209bebf-9e38-4fdd-bf9c-5842129d8f63",
+		"blobUri": "https://defendermalwaretest.blob.core.windows.net/csm-quarantine-container/images/projects/60098f64-f566-49c6-86d8-1071eaebc6a3/picture/76b390f8-f66c-43d1-b181-c703ec817110",
+		"eTag": "0x8DBCFD701F78E3B",
+		"scanFinishedTimeUtc": "2023-10-18T12:37:42.8034649Z",
+		"scanResultType": "No threats found",
+		"scanResultDetails": null
+	},
+	"eventType": "Microsoft.Security.MalwareScanningResult",
+	"dataVersion": "1.0",
+	"metadataVersion": "1",
+	"eventTime": "2023-10-18T12:37:42.8040405Z",
+	"topic": "/subscriptions/xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx/resourceGroups/defender-malware-test/providers/Microsoft.EventGrid/topics/defendermalwaretest-eventgrid-topic"
+}]`
+
+const eventGridSubscriptionValidation = `[{
+	"id": "2d1781af-3a4c-4d7c-bd0c-e34b19da4e66",
+	"topic": "/subscriptions/xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx",
+	"subject": "",
+	"data": {
+		"validationCode": "512d38b6-c7b8-40c8-89fe-f46f9e9622b6",
+		"validationUrl": "https://rp-eastus2.eventgrid.azure.net:553/eventsubscriptions/myeventsub/validate?id=0000"
+	},
+	"eventType": "Microsoft.EventGrid.SubscriptionValidationEvent",
+	"eventTime": "2023-10-18T12:37:42.8040405Z",
+	"metadataVersion": "1",
+	"dataVersion": "1"
+}]`
+
+const cloudEventMalwareScanningResult = `{
+	"specversion": "1.0",
+	"type": "Microsoft.Security.MalwareScanningResult",
+	"source": "/subscriptions/xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx/resourceGroups/defender-malware-test/providers/Microsoft.EventGrid/topics/defendermalwaretest-eventgrid-topic",
+	"id": "2209bebf-9e38-4fdd-bf9c-5842129d8f63",
+	"time": "2023-10-18T12:37:42.8040405Z",
+	"subject": "storageAccounts/defendermalwaretest/containers/uploads/blobs/my-folder/new-file.txt",
+	"datacontenttype": "application/json",
+	"data": {
+		"correlationId": "2209bebf-9e38-4fdd-bf9c-5842129d8f63",
+		"blobUri": "https://defendermalwaretest.blob.core.windows.net/uploads/my-folder/new-file.txt",
+		"eTag": "0x8DBCFD701F78E3B",
+		"scanFinishedTimeUtc": "2023-10-18T12:37:42.8034649Z",
+		"scanResultType": "Malicious",
+		"scanResultDetails": {
+			"malwareNamesFound": ["DOS/EICAR_Test_File"],
+			"sha256": "275A021BBFB6489E54D471899F7DB9D1663FC695EC2FE2A2C4538AABF651FD0F"
+		}
+	}
+}`
@@ -1,7 +1,12 @@
 package rest
 
 import (
+	"context"
 	"csm.cloud.storage.event.core/config/properties"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/health"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"net/http"
 	"net/http/httptest"
@@ -42,7 +47,47 @@ func TestInitRouter_Readiness(t *testing.T) {
 	// verify
 	assert.Equal(t, http.StatusOK, status, "Readiness endpoint httpStatus should be 200")
 	body := recorder.Body.String()
-	assert.Equal(t, "{}", body, "Readiness endpoint should have an empty body")
+	assert.Equal(t, `{"status":"UP","checks":{}}`, body, "Readiness endpoint should report no checks")
+}
+
+func TestReadiness_FailingCheck(t *testing.T) {
+
+	// prepare
+	registry := health.NewRegistry()
+	registry.Register("kafkaProducer", health.CheckOptions{}, func(ctx context.Context) error { return nil })
+	registry.Register("blobStorage", health.CheckOptions{}, func(ctx context.Context) error {
+		return errors.New("connection refused")
+	})
+	recorder := httptest.NewRecorder()
+	testContext, _ := gin.CreateTestContext(recorder)
+	testContext.Request, _ = http.NewRequest("GET", "/health/readiness", nil)
+
+	// execute
+	readiness(testContext, registry)
+
+	// verify
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code, "Readiness endpoint httpStatus should be 503")
+	var report health.Report
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+	assert.Equal(t, health.StatusDown, report.Status)
+	assert.Equal(t, health.StatusUp, report.Checks["kafkaProducer"].Status)
+	assert.Equal(t, "connection refused", report.Checks["blobStorage"].Error)
+}
+
+func TestInitRouter_Metrics(t *testing.T) {
+
+	// prepare
+	testRouter, err := initRouter()
+	assert.Nil(t, err, "Router should initialize without error")
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", "/metrics", nil)
+
+	// execute
+	testRouter.ServeHTTP(recorder, request)
+
+	// verify
+	assert.Equal(t, http.StatusOK, recorder.Code, "Metrics endpoint httpStatus should be 200")
+	assert.Contains(t, recorder.Body.String(), "go_goroutines", "Metrics endpoint should expose the runtime metrics")
 }
 
 func TestWebServerRunner_RunFailsWhenPortIsInUse(t *testing.T) {
@@ -2,11 +2,13 @@ package producer
 
 import (
 	"csm.cloud.storage.event.core/domain"
+	deserializer "dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/kafka/consumer/deserializer/avro"
 	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/kafka/producer/serializer/avro"
 	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/test"
 	"errors"
 	"github.com/riferrei/srclient"
 	"github.com/stretchr/testify/assert"
+	"os"
 	"testing"
 )
 
@@ -31,7 +33,7 @@ func TestAvroSerializer_KeyEmptyValue(t *testing.T) {
 
 	// Verify that serialized result is correct
 	expectedKey := []uint8{0, 0, 0, 0, 3, 6, 104, 117, 105}
-	expectedVal := []uint8{0, 0, 0, 0, 4, 6, 104, 117, 105, 0, 0, 0, 0}
+	expectedVal := []uint8{0, 0, 0, 0, 4, 6, 104, 117, 105, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
 	assert.Equal(t, expectedKey, key)
 	assert.Equal(t, expectedVal, value)
 }
@@ -53,10 +55,44 @@ func TestAvroSerializer_SetValues(t *testing.T) {
 	// Verify that the values were serialized correctly to avro
 	assert.Nil(t, err)
 	expectedVal := []uint8{0, 0, 0, 0, 4, 6, 104, 117, 105, 10, 47, 112, 97, 116, 104, 16, 102, 105, 108, 101, 46, 116,
-		120, 116, 20, 116, 101, 120, 116, 47, 112, 108, 97, 105, 110, 200, 1}
+		120, 116, 20, 116, 101, 120, 116, 47, 112, 108, 97, 105, 110, 200, 1, 0, 0, 0, 0, 0, 0, 0}
 	assert.Equal(t, expectedVal, value)
 }
 
+func TestAvroSerializer_ScanProvenance(t *testing.T) {
+
+	// Initialize value serializer and a deserializer as used by consumers
+	valueSchema := createValueSchemata()
+	avroSerializer := avro.NewAvroSerializer(valueSchema)
+	avroDeserializer := deserializer.NewAvroDeserializer([]deserializer.AvroTypeDeserializer{
+		deserializer.NewAvroTypeDeserializer[domain.FileCreatedEvent](valueSchema),
+	})
+
+	// Serialize a domain event with scan provenance
+	event := domain.FileCreatedEvent{
+		Identifier:       "hui",
+		Path:             "/path",
+		FileName:         "file.txt",
+		ContentLength:    100,
+		ContentType:      "text/plain",
+		StorageAccount:   domain.NewOptionalString("defendermalwaretest"),
+		Container:        domain.NewOptionalString("uploads"),
+		ETag:             domain.NewOptionalString("0x8DBCFD701F78E3B"),
+		Sha256:           domain.NewOptionalString(""),
+		ScanFinishedTime: domain.NewOptionalString("2023-10-18T12:37:42.8034649Z"),
+		CorrelationId:    domain.NewOptionalString("2209bebf-9e38-4fdd-bf9c-5842129d8f63"),
+		EventTime:        domain.NewOptionalString("2023-10-18T12:37:42.8040405Z"),
+	}
+	value, err := avroSerializer.Serialize(&event)
+	assert.Nil(t, err)
+
+	// Verify that the event can be deserialized again including the optional values
+	deserializedEvent, err := avroDeserializer.Deserialize(value)
+	assert.Nil(t, err)
+	assert.Equal(t, event, deserializedEvent)
+	assert.Nil(t, deserializedEvent.(domain.FileCreatedEvent).Sha256)
+}
+
 func TestAvroSerializer_FailingWrongType(t *testing.T) {
 
 	// Initialize key serializer
@@ -77,14 +113,14 @@ func createValueSchemata() *srclient.Schema {
 	// Instantiate schema registry client
 	valueSchema := &srclient.Schema{}
 
+	// Read the schema which is registered for the subject
+	schemaFile, err := os.ReadFile("../../resources/avro/FileCreatedEventAvro.avsc")
+	if err != nil {
+		panic(err)
+	}
+
 	//Set schema via reflection
-	test.SetFieldValueForTesting(valueSchema, "schema", "{\"type\":\"record\",\"name\":\"FileCreatedEventAvro\","+
-		"\"namespace\":\"com.bosch.pt.csm.cloud.storage.event.messages\",\"fields\":[{\"name\":\"identifier\","+
-		"\"type\":{\"type\":\"string\",\"CommonAvroSerializer.java.string\":\"String\"},\"doc\":\"Identifier of the storage event\"},"+
-		"{\"name\":\"path\",\"type\":{\"type\":\"string\",\"CommonAvroSerializer.java.string\":\"String\"}},{\"name\":\"filename\","+
-		"\"type\":{\"type\":\"string\",\"CommonAvroSerializer.java.string\":\"String\"}},{\"name\":\"contentType\","+
-		"\"type\":{\"type\":\"string\",\"CommonAvroSerializer.java.string\":\"String\"}},{\"name\":\"contentLength\","+
-		"\"type\":\"long\"}]}")
+	test.SetFieldValueForTesting(valueSchema, "schema", string(schemaFile))
 	test.SetFieldValueForTesting(valueSchema, "id", 4)
 	test.SetFieldValueForTesting(valueSchema, "version", 1)
 
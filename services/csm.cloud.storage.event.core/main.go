@@ -6,13 +6,17 @@ import (
 	"csm.cloud.storage.event.core/kafka/admin"
 	"csm.cloud.storage.event.core/kafka/producer"
 	"csm.cloud.storage.event.core/kafka/schema-registry"
+	"csm.cloud.storage.event.core/storage/backfill"
+	"csm.cloud.storage.event.core/storage/dedup"
 	"csm.cloud.storage.event.core/storage/messages/get"
 	"csm.cloud.storage.event.core/storage/queue"
 	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/app"
 	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/datadog"
 	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/http/interceptor/request_host_rewrite"
 	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/kafka/producer/configurer"
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
 	"github.com/rs/zerolog/log"
+	"os"
 )
 
 func main() {
@@ -30,6 +34,59 @@ func main() {
 	// Initialize datadog tracer
 	datadog.ApplyDefaultTracingConfiguration()
 
+	// Run a backfill instead of the service if requested as subcommand
+	if len(os.Args) > 1 && os.Args[1] == backfill.CommandName {
+		runBackfill(configuration, os.Args[2:])
+		return
+	}
+
+	// Initialize kafka producer
+	uploadEventProducer, _ := newUploadEventProducer(configuration)
+
+	// Initialize azure storage queue listener
+	queueConfiguration := queue.NewDefaultConfiguration(configuration.Storage)
+	blobInfoService := get.NewDefaultGetBlobInfoService(configuration.Storage)
+	deduplicationStore := dedup.NewStore(configuration.Deduplication, configuration.Storage)
+	storageQueueListener := queue.NewListener(
+		uploadEventProducer,
+		blobInfoService,
+		deduplicationStore,
+		queueConfiguration,
+	)
+
+	// Initialize storage queue listener
+	if configuration.Storage.QueuePollingEnabled {
+		go app.Run(func() {
+			storageQueueListener.Listen()
+		})
+	} else {
+		log.Info().Msg("Storage queue polling is disabled")
+	}
+
+	// Initialize Event Grid webhook as alternative to polling the storage queue
+	var routeRegistrations []rest.RouteRegistration
+	if configuration.EventGrid.Webhook.Enabled {
+		eventGridWebhook := rest.NewEventGridWebhook(configuration.EventGrid.Webhook, &storageQueueListener)
+		routeRegistrations = append(routeRegistrations, eventGridWebhook.RegisterRoutes)
+	}
+
+	// Initialize admin api to control the queue listener at runtime
+	if configuration.Admin.Enabled {
+		adminApi := rest.NewAdminApi(configuration.Admin, &storageQueueListener)
+		routeRegistrations = append(routeRegistrations, adminApi.RegisterRoutes)
+	}
+
+	// Initialize and run the blocking web-server
+	webServerRunner := rest.NewWebServerRunner(configuration.Server, routeRegistrations...)
+	webServerRunner.Run()
+}
+
+/*
+newUploadEventProducer loads the schemas, creates the topics if needed (on localhost) and initializes
+the kafka producer for FileCreatedEvents
+*/
+func newUploadEventProducer(configuration config.Configuration) (producer.FileCreatedEventKafkaProducer, *kafka.Producer) {
+
 	// Initialize schema registry client and load schemas
 	schemaRegistryClient := schema_registry.NewDefaultSchemaRegistryClient(configuration.Kafka)
 	keySchema, valueSchema := schemaRegistryClient.LoadSchemas()
@@ -45,22 +102,30 @@ func main() {
 		kafkaProducer,
 		configuration.Kafka.Topic.Upload.Name,
 	)
+	return &uploadEventProducer, kafkaProducer
+}
 
-	// Initialize azure storage queue listener
-	queueConfiguration := queue.NewDefaultConfiguration(configuration.Storage)
-	blobInfoService := get.NewDefaultGetBlobInfoService(configuration.Storage)
-	storageQueueListener := queue.NewListener(
-		&uploadEventProducer,
-		blobInfoService,
-		queueConfiguration,
-	)
+/*
+runBackfill produces FileCreatedEvents for blobs already stored in a container (see backfill.Backfill)
+*/
+func runBackfill(configuration config.Configuration, arguments []string) {
+	options, err := backfill.ParseOptions(arguments, os.Stderr)
+	if err != nil {
+		panic(app.NewFatalError("Invalid backfill options", err))
+	}
 
-	// Initialize storage queue listener
-	go app.Run(func() {
-		storageQueueListener.Listen()
-	})
+	// Kafka is not needed for a dry run
+	var uploadEventProducer producer.FileCreatedEventKafkaProducer
+	if !options.DryRun {
+		var kafkaProducer *kafka.Producer
+		uploadEventProducer, kafkaProducer = newUploadEventProducer(configuration)
+		defer kafkaProducer.Close()
+	}
 
-	// Initialize and run the blocking web-server
-	webServerRunner := rest.NewWebServerRunner(configuration.Server)
-	webServerRunner.Run()
+	blobListService := get.NewDefaultBlobListService(configuration.Storage)
+	blobBackfill := backfill.NewBackfill(options, blobListService, uploadEventProducer, configuration.Storage)
+	_, err = blobBackfill.Run()
+	if err != nil {
+		panic(app.NewFatalError("Backfill failed", err))
+	}
 }
@@ -0,0 +1,177 @@
+package backfill
+
+import (
+	"context"
+	"csm.cloud.storage.event.core/config/properties"
+	"csm.cloud.storage.event.core/kafka/producer"
+	"csm.cloud.storage.event.core/storage/domain"
+	"csm.cloud.storage.event.core/storage/messages/get"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/datadog"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"strings"
+	"time"
+)
+
+/*
+Backfill produces FileCreatedEvents for blobs already stored in a container, e.g. to reprocess the quarantine
+container after an outage or the rollout of a new image pipeline. The events are created like the ones for
+malware scanning results (without the scan provenance) and produced with a limited rate. The progress is
+recorded in a checkpoint file to resume an interrupted backfill.
+*/
+type Backfill struct {
+	options              Options
+	blobListService      get.BlobListService
+	eventProducerService producer.FileCreatedEventKafkaProducer
+	storageConfig        properties.StorageProperties
+}
+
+/*
+Summary counts the blobs of a backfill run by outcome
+*/
+type Summary struct {
+	Produced int
+	Resumed  int
+	Skipped  int
+}
+
+/*
+NewBackfill creates a backfill for the given options. The event producer isn't used in a dry run and may be nil.
+*/
+func NewBackfill(
+	options Options,
+	blobListService get.BlobListService,
+	eventProducerService producer.FileCreatedEventKafkaProducer,
+	storageConfig properties.StorageProperties) Backfill {
+
+	return Backfill{
+		options:              options,
+		blobListService:      blobListService,
+		eventProducerService: eventProducerService,
+		storageConfig:        storageConfig,
+	}
+}
+
+/*
+Run lists the blobs of the container and produces an event for each blob to be processed
+*/
+func (this *Backfill) Run() (*Summary, error) {
+
+	// Load checkpoint to resume an interrupted backfill (not used in a dry run as nothing is produced)
+	progress := &checkpoint{}
+	if !this.options.DryRun {
+		loadedCheckpoint, err := loadCheckpoint(this.options)
+		if err != nil {
+			return nil, err
+		}
+		progress = loadedCheckpoint
+		if progress.LastBlob != "" {
+			log.Info().Msg(fmt.Sprintf("Resuming backfill after blob %s", progress.LastBlob))
+		}
+	}
+
+	// Limit the rate of produced events to not flood the consumers
+	throttle := time.NewTicker(time.Duration(float64(time.Second) / this.options.Rate))
+	defer throttle.Stop()
+
+	log.Info().Msg(fmt.Sprintf("Starting backfill of container %s with prefix %q (dry run: %t)",
+		this.options.Container, this.options.Prefix, this.options.DryRun))
+
+	summary := &Summary{}
+	storageName := this.blobListService.AccountName()
+	err := this.blobListService.ListBlobs(this.options.Container, this.options.Prefix, func(blob get.BlobItem) error {
+
+		// Skip blobs processed before the backfill was interrupted
+		if progress.LastBlob != "" && blob.Name <= progress.LastBlob {
+			summary.Resumed++
+			return nil
+		}
+
+		if !this.isToBeProcessed(blob) {
+			summary.Skipped++
+			return nil
+		}
+
+		// Create file created event
+		path, fileName, _ := cutLast(blob.Name, "/")
+		blobInfo := &domain.BlobInfo{
+			StorageName:   storageName,
+			ContainerName: this.options.Container,
+			Path:          path,
+			FileName:      fileName,
+		}
+		fileCreatedEvent := blobInfo.ToFileCreatedEvent(blob.ContentType, blob.ContentLength)
+
+		if this.options.DryRun {
+			log.Info().Msg(fmt.Sprintf("Dry run: FileCreatedEvent for %s", blobInfo.ToString()))
+			summary.Produced++
+			return nil
+		}
+
+		// Send event to Kafka
+		<-throttle.C
+		span := tracer.StartSpan("backfill")
+		span.SetBaggageItem("blobName", blob.Name)
+		tracingContext := tracer.ContextWithSpan(context.Background(), span)
+		_, err := datadog.TraceWithContext(tracingContext, "produce", func() (any, error) {
+			return nil, this.eventProducerService.Produce(tracingContext, fileCreatedEvent)
+		})
+		if err != nil {
+			span.Finish(tracer.WithError(err))
+			return err
+		}
+		span.Finish()
+		summary.Produced++
+
+		// Record the progress
+		progress.LastBlob = blob.Name
+		progress.Produced++
+		return progress.save(this.options.CheckpointFile)
+	})
+
+	log.Info().Msg(fmt.Sprintf("Backfill finished with %d events produced, %d blobs resumed and %d blobs skipped",
+		summary.Produced, summary.Resumed, summary.Skipped))
+	return summary, err
+}
+
+/*
+isToBeProcessed applies the checks done for malware scanning results and the modification time filter
+*/
+func (this *Backfill) isToBeProcessed(blob get.BlobItem) bool {
+
+	// Files without path can't be processed (the path is required in the event)
+	path, _, hasPath := cutLast(blob.Name, "/")
+	if !hasPath {
+		log.Debug().Msg(fmt.Sprintf("Skip blob without path: %s", blob.Name))
+		return false
+	}
+
+	// Only uploaded images are processed asynchronously (see storage queue listener)
+	if !strings.HasPrefix(path, "images") {
+		log.Debug().Msg(fmt.Sprintf("Skip async processing of uploaded file with path: %s", blob.Name))
+		return false
+	}
+
+	if !this.options.Since.IsZero() && blob.LastModified.Before(this.options.Since) {
+		log.Debug().Msg(fmt.Sprintf("Skip blob %s last modified at %s", blob.Name, blob.LastModified))
+		return false
+	}
+
+	if blob.ContentLength > this.storageConfig.MaxAllowedContentLength {
+		log.Warn().Msg(fmt.Sprintf("Skip blob %s with content length %d exceeding the maximum allowed size of %d",
+			blob.Name, blob.ContentLength, this.storageConfig.MaxAllowedContentLength))
+		return false
+	}
+	return true
+}
+
+/*
+cutLast slices the value around the last instance of the separator
+*/
+func cutLast(value string, separator string) (before string, after string, found bool) {
+	if index := strings.LastIndex(value, separator); index >= 0 {
+		return value[:index], value[index+len(separator):], true
+	}
+	return "", value, false
+}
@@ -0,0 +1,219 @@
+package backfill
+
+import (
+	"context"
+	"csm.cloud.storage.event.core/config/properties"
+	"csm.cloud.storage.event.core/domain"
+	"csm.cloud.storage.event.core/storage/messages/get"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Define FileCreatedEvent producer mock
+
+type FileCreatedEventProducerMock struct {
+	mock.Mock
+}
+
+func (this *FileCreatedEventProducerMock) Produce(tracingContext context.Context, event *domain.FileCreatedEvent) error {
+	args := this.Called(tracingContext, event)
+	return args.Error(0)
+}
+
+// Define BlobListService stub
+
+type BlobListServiceStub struct {
+	blobs []get.BlobItem
+}
+
+func (this *BlobListServiceStub) AccountName() string {
+	return "defendermalwaretest"
+}
+
+func (this *BlobListServiceStub) ListBlobs(_ string, prefix string, handleBlob func(blob get.BlobItem) error) error {
+	for _, blob := range this.blobs {
+		if !strings.HasPrefix(blob.Name, prefix) {
+			continue
+		}
+		err := handleBlob(blob)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Tests
+
+func TestBackfill_ProducesEventsForImages(t *testing.T) {
+
+	// prepare
+	producerMock := &FileCreatedEventProducerMock{}
+	producerMock.On("Produce", mock.Anything, mock.Anything).Return(nil)
+	options := createTestOptions(t)
+	cut := NewBackfill(options, createTestBlobListService(), producerMock, createTestStorageProperties())
+
+	// execute
+	summary, err := cut.Run()
+
+	// verify
+	assert.Nil(t, err)
+	assert.Equal(t, Summary{Produced: 2, Skipped: 3}, *summary)
+	producerMock.AssertNumberOfCalls(t, "Produce", 2)
+
+	event := producerMock.Calls[0].Arguments.Get(1).(*domain.FileCreatedEvent)
+	assert.Equal(t, "/images/projects/p1/picture/a", event.Identifier)
+	assert.Equal(t, "/images/projects/p1/picture", event.Path)
+	assert.Equal(t, "a", event.FileName)
+	assert.Equal(t, "image/png", event.ContentType)
+	assert.Equal(t, int64(100), event.ContentLength)
+	assert.Equal(t, "defendermalwaretest", event.StorageAccount.String)
+	assert.Equal(t, "csm-quarantine-container", event.Container.String)
+
+	// verify the progress has been recorded
+	progress, err := loadCheckpoint(options)
+	assert.Nil(t, err)
+	assert.Equal(t, "images/projects/p1/picture/c", progress.LastBlob)
+	assert.Equal(t, 2, progress.Produced)
+}
+
+func TestBackfill_FiltersByModificationTime(t *testing.T) {
+
+	// prepare
+	producerMock := &FileCreatedEventProducerMock{}
+	producerMock.On("Produce", mock.Anything, mock.Anything).Return(nil)
+	options := createTestOptions(t)
+	options.Since = time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	cut := NewBackfill(options, createTestBlobListService(), producerMock, createTestStorageProperties())
+
+	// execute
+	summary, err := cut.Run()
+
+	// verify
+	assert.Nil(t, err)
+	assert.Equal(t, Summary{Produced: 1, Skipped: 4}, *summary)
+	event := producerMock.Calls[0].Arguments.Get(1).(*domain.FileCreatedEvent)
+	assert.Equal(t, "c", event.FileName)
+}
+
+func TestBackfill_DryRunDoesNotProduce(t *testing.T) {
+
+	// prepare
+	options := createTestOptions(t)
+	options.DryRun = true
+	cut := NewBackfill(options, createTestBlobListService(), nil, createTestStorageProperties())
+
+	// execute
+	summary, err := cut.Run()
+
+	// verify
+	assert.Nil(t, err)
+	assert.Equal(t, Summary{Produced: 2, Skipped: 3}, *summary)
+	_, err = os.Stat(options.CheckpointFile)
+	assert.True(t, errors.Is(err, os.ErrNotExist), "No checkpoint is expected to be written in a dry run")
+}
+
+func TestBackfill_ResumesFromCheckpoint(t *testing.T) {
+
+	// prepare a backfill failing after the first event
+	producerMock := &FileCreatedEventProducerMock{}
+	producerMock.On("Produce", mock.Anything, mock.Anything).Return(nil).Once()
+	producerMock.On("Produce", mock.Anything, mock.Anything).Return(errors.New("SOME_KAFKA_AVAILABILITY_ISSUE")).Once()
+	options := createTestOptions(t)
+	cut := NewBackfill(options, createTestBlobListService(), producerMock, createTestStorageProperties())
+
+	summary, err := cut.Run()
+	assert.Equal(t, "SOME_KAFKA_AVAILABILITY_ISSUE", err.Error())
+	assert.Equal(t, 1, summary.Produced)
+
+	// execute the backfill again
+	producerMock = &FileCreatedEventProducerMock{}
+	producerMock.On("Produce", mock.Anything, mock.Anything).Return(nil)
+	cut = NewBackfill(options, createTestBlobListService(), producerMock, createTestStorageProperties())
+	summary, err = cut.Run()
+
+	// verify that only the remaining blob has been produced
+	assert.Nil(t, err)
+	assert.Equal(t, Summary{Produced: 1, Resumed: 2, Skipped: 2}, *summary)
+	event := producerMock.Calls[0].Arguments.Get(1).(*domain.FileCreatedEvent)
+	assert.Equal(t, "c", event.FileName)
+}
+
+func TestBackfill_FailsForCheckpointOfOtherBackfill(t *testing.T) {
+
+	// prepare
+	options := createTestOptions(t)
+	otherCheckpoint := checkpoint{Container: "other", LastBlob: "images/x"}
+	assert.Nil(t, otherCheckpoint.save(options.CheckpointFile))
+	cut := NewBackfill(options, createTestBlobListService(), &FileCreatedEventProducerMock{}, createTestStorageProperties())
+
+	// execute
+	summary, err := cut.Run()
+
+	// verify
+	assert.Nil(t, summary)
+	assert.ErrorContains(t, err, "belongs to a backfill with different options")
+}
+
+func TestParseOptions(t *testing.T) {
+
+	options, err := ParseOptions([]string{
+		"--container", "csm-quarantine-container", "--prefix", "images/projects", "--since", "2024-01-31", "--dry-run",
+	}, io.Discard)
+
+	// Verify the flags have been parsed
+	assert.Nil(t, err)
+	assert.Equal(t, "csm-quarantine-container", options.Container)
+	assert.Equal(t, "images/projects", options.Prefix)
+	assert.Equal(t, time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC), options.Since)
+	assert.True(t, options.DryRun)
+	assert.Equal(t, float64(10), options.Rate)
+}
+
+func TestParseOptions_Invalid(t *testing.T) {
+
+	for arguments, expectedError := range map[string]string{
+		"":                               "flag --container is required",
+		"--container c --since tomorrow": "flag --since is invalid",
+		"--container c --rate 0":         "flag --rate must be greater than 0",
+		"--unknown":                      "flag provided but not defined: -unknown",
+	} {
+		_, err := ParseOptions(splitArguments(arguments), io.Discard)
+		assert.ErrorContains(t, err, expectedError)
+	}
+}
+
+func createTestOptions(t *testing.T) Options {
+	return Options{
+		Container:      "csm-quarantine-container",
+		Rate:           1000,
+		CheckpointFile: filepath.Join(t.TempDir(), "checkpoint.json"),
+	}
+}
+
+func createTestStorageProperties() properties.StorageProperties {
+	return properties.StorageProperties{MaxAllowedContentLength: 1000}
+}
+
+func createTestBlobListService() *BlobListServiceStub {
+	january := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	february := time.Date(2024, 2, 15, 0, 0, 0, 0, time.UTC)
+	return &BlobListServiceStub{blobs: []get.BlobItem{
+		{Name: "images", ContentLength: 100, LastModified: january},
+		{Name: "images/projects/p1/picture/a", ContentType: "image/png", ContentLength: 100, LastModified: january},
+		{Name: "images/projects/p1/picture/b", ContentType: "image/png", ContentLength: 5000, LastModified: february},
+		{Name: "images/projects/p1/picture/c", ContentType: "image/jpeg", ContentLength: 200, LastModified: february},
+		{Name: "imports/projects/p1/file", ContentType: "text/csv", ContentLength: 100, LastModified: february},
+	}}
+}
+
+func splitArguments(arguments string) []string {
+	return strings.Fields(arguments)
+}
@@ -0,0 +1,65 @@
+package backfill
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+/*
+checkpoint records the last blob an event was produced for. Blobs are listed in lexicographical order, so an
+interrupted backfill resumes with the blobs following the last one. The options are kept to prevent resuming
+a different backfill.
+*/
+type checkpoint struct {
+	Container string    `json:"container"`
+	Prefix    string    `json:"prefix"`
+	Since     time.Time `json:"since"`
+	LastBlob  string    `json:"lastBlob"`
+	Produced  int       `json:"produced"`
+}
+
+/*
+loadCheckpoint reads the checkpoint file of the backfill. Returns an empty checkpoint if the file doesn't exist yet.
+*/
+func loadCheckpoint(options Options) (*checkpoint, error) {
+	emptyCheckpoint := &checkpoint{Container: options.Container, Prefix: options.Prefix, Since: options.Since}
+
+	content, err := os.ReadFile(options.CheckpointFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return emptyCheckpoint, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var loadedCheckpoint checkpoint
+	err = json.Unmarshal(content, &loadedCheckpoint)
+	if err != nil {
+		return nil, err
+	}
+	if loadedCheckpoint.Container != options.Container || loadedCheckpoint.Prefix != options.Prefix ||
+		!loadedCheckpoint.Since.Equal(options.Since) {
+		return nil, fmt.Errorf("checkpoint %s belongs to a backfill with different options, remove it or use another file",
+			options.CheckpointFile)
+	}
+	return &loadedCheckpoint, nil
+}
+
+/*
+save writes the checkpoint to a temporary file first, so that an interruption never leaves a partial checkpoint
+*/
+func (this *checkpoint) save(checkpointFile string) error {
+	content, err := json.Marshal(this)
+	if err != nil {
+		return err
+	}
+	temporaryFile := checkpointFile + ".tmp"
+	err = os.WriteFile(temporaryFile, content, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(temporaryFile, checkpointFile)
+}
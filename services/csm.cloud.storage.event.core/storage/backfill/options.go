@@ -0,0 +1,69 @@
+package backfill
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Name of the command line subcommand starting a backfill instead of the service
+const CommandName = "backfill"
+
+/*
+Options of a backfill run given as command line flags, e.g.
+backfill --container csm-quarantine-container --prefix images/projects --since 2024-01-31 --dry-run
+*/
+type Options struct {
+	Container      string
+	Prefix         string
+	Since          time.Time
+	DryRun         bool
+	Rate           float64
+	CheckpointFile string
+}
+
+/*
+ParseOptions parses the command line flags following the subcommand
+*/
+func ParseOptions(arguments []string, output io.Writer) (Options, error) {
+	var options Options
+	var since string
+
+	flagSet := flag.NewFlagSet(CommandName, flag.ContinueOnError)
+	flagSet.SetOutput(output)
+	flagSet.StringVar(&options.Container, "container", "", "container to list the blobs of (required)")
+	flagSet.StringVar(&options.Prefix, "prefix", "images", "only blobs with names starting with this prefix")
+	flagSet.StringVar(&since, "since", "", "only blobs modified at or after this time (RFC 3339 or yyyy-mm-dd)")
+	flagSet.BoolVar(&options.DryRun, "dry-run", false, "log the events instead of producing them")
+	flagSet.Float64Var(&options.Rate, "rate", 10, "maximum number of events produced per second")
+	flagSet.StringVar(&options.CheckpointFile, "checkpoint", "backfill-checkpoint.json", "file to resume an interrupted backfill from")
+
+	err := flagSet.Parse(arguments)
+	if err != nil {
+		return options, err
+	}
+
+	if options.Container == "" {
+		return options, errors.New("flag --container is required")
+	}
+	if options.Rate <= 0 {
+		return options, errors.New("flag --rate must be greater than 0")
+	}
+	if since != "" {
+		options.Since, err = parseTime(since)
+		if err != nil {
+			return options, fmt.Errorf("flag --since is invalid: %w", err)
+		}
+	}
+	return options, nil
+}
+
+func parseTime(value string) (time.Time, error) {
+	parsedTime, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return parsedTime, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
@@ -0,0 +1,64 @@
+package client
+
+import (
+	"csm.cloud.storage.event.core/config/properties"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/azure"
+	"fmt"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azqueue"
+)
+
+/*
+NewQueueServiceClient creates the queue client authenticated with the configured token credential
+and the queue account url, or with the connection string as fallback
+*/
+func NewQueueServiceClient(storageConfig properties.StorageProperties) (*azqueue.ServiceClient, error) {
+	if !azure.UsesTokenCredential(storageConfig.Credential) {
+		return azqueue.NewServiceClientFromConnectionString(storageConfig.ConnectionString, nil)
+	}
+	credential, err := azure.NewTokenCredential(storageConfig.Credential)
+	if err != nil {
+		return nil, err
+	}
+	if storageConfig.QueueAccountUrl == "" {
+		return nil, fmt.Errorf("queue account url is required for token authentication")
+	}
+	return azqueue.NewServiceClient(storageConfig.QueueAccountUrl, credential, nil)
+}
+
+/*
+NewBlobClient creates the blob client authenticated with the configured token credential
+and the blob account url, or with the connection string as fallback
+*/
+func NewBlobClient(storageConfig properties.StorageProperties) (*azblob.Client, error) {
+	if !azure.UsesTokenCredential(storageConfig.Credential) {
+		return azblob.NewClientFromConnectionString(storageConfig.ConnectionString, nil)
+	}
+	credential, err := azure.NewTokenCredential(storageConfig.Credential)
+	if err != nil {
+		return nil, err
+	}
+	if storageConfig.BlobAccountUrl == "" {
+		return nil, fmt.Errorf("blob account url is required for token authentication")
+	}
+	return azblob.NewClient(storageConfig.BlobAccountUrl, credential, nil)
+}
+
+/*
+NewTableServiceClient creates the table client authenticated with the configured token credential
+and the table account url, or with the connection string as fallback
+*/
+func NewTableServiceClient(storageConfig properties.StorageProperties) (*aztables.ServiceClient, error) {
+	if !azure.UsesTokenCredential(storageConfig.Credential) {
+		return aztables.NewServiceClientFromConnectionString(storageConfig.ConnectionString, nil)
+	}
+	credential, err := azure.NewTokenCredential(storageConfig.Credential)
+	if err != nil {
+		return nil, err
+	}
+	if storageConfig.TableAccountUrl == "" {
+		return nil, fmt.Errorf("table account url is required for token authentication")
+	}
+	return aztables.NewServiceClient(storageConfig.TableAccountUrl, credential, nil)
+}
@@ -0,0 +1,77 @@
+package client
+
+import (
+	"csm.cloud.storage.event.core/config/properties"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/azure"
+	commonProperties "dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/config/properties"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const testConnectionString = "DefaultEndpointsProtocol=http;AccountName=devstoreaccount1;AccountKey=Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw==;BlobEndpoint=http://127.0.0.1:10000/devstoreaccount1;QueueEndpoint=http://127.0.0.1:10001/devstoreaccount1;TableEndpoint=http://127.0.0.1:10002/devstoreaccount1"
+
+var testCredential = commonProperties.AzureCredentialProperties{
+	Type:          azure.CredentialTypeClientSecret,
+	TenantId:      "00000000-0000-0000-0000-000000000001",
+	ClientId:      "00000000-0000-0000-0000-000000000002",
+	ClientSecret:  "secret",
+	AuthorityHost: "https://localhost:8443/",
+}
+
+func Test_NewClients_FallBackToConnectionString(t *testing.T) {
+
+	// prepare
+	storageConfig := properties.StorageProperties{ConnectionString: testConnectionString}
+
+	// execute
+	queueClient, queueErr := NewQueueServiceClient(storageConfig)
+	blobClient, blobErr := NewBlobClient(storageConfig)
+	tableClient, tableErr := NewTableServiceClient(storageConfig)
+
+	// verify
+	assert.Nil(t, queueErr)
+	assert.Equal(t, "http://127.0.0.1:10001/devstoreaccount1", queueClient.URL())
+	assert.Nil(t, blobErr)
+	assert.Equal(t, "http://127.0.0.1:10000/devstoreaccount1/", blobClient.URL())
+	assert.Nil(t, tableErr)
+	assert.NotNil(t, tableClient)
+}
+
+func Test_NewClients_UseTokenCredentialWithAccountUrls(t *testing.T) {
+
+	// prepare
+	storageConfig := properties.StorageProperties{
+		Credential:      testCredential,
+		BlobAccountUrl:  "https://account.blob.core.windows.net/",
+		QueueAccountUrl: "https://account.queue.core.windows.net/",
+		TableAccountUrl: "https://account.table.core.windows.net/",
+	}
+
+	// execute
+	queueClient, queueErr := NewQueueServiceClient(storageConfig)
+	blobClient, blobErr := NewBlobClient(storageConfig)
+	_, tableErr := NewTableServiceClient(storageConfig)
+
+	// verify
+	assert.Nil(t, queueErr)
+	assert.Equal(t, "https://account.queue.core.windows.net/", queueClient.URL())
+	assert.Nil(t, blobErr)
+	assert.Equal(t, "https://account.blob.core.windows.net/", blobClient.URL())
+	assert.Nil(t, tableErr)
+}
+
+func Test_NewClients_FailWithTokenCredentialWithoutAccountUrls(t *testing.T) {
+
+	// prepare
+	storageConfig := properties.StorageProperties{Credential: testCredential, ConnectionString: testConnectionString}
+
+	// execute
+	_, queueErr := NewQueueServiceClient(storageConfig)
+	_, blobErr := NewBlobClient(storageConfig)
+	_, tableErr := NewTableServiceClient(storageConfig)
+
+	// verify
+	assert.NotNil(t, queueErr)
+	assert.NotNil(t, blobErr)
+	assert.NotNil(t, tableErr)
+}
@@ -0,0 +1,119 @@
+package dedup
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+/*
+memoryStore keeps the keys in memory for the configured time to live. The least recently added keys are evicted
+when the maximum number of entries is reached. Duplicates are only recognized within a single instance and
+until a restart.
+*/
+type memoryStore struct {
+	ttl        time.Duration
+	maxEntries int
+	now        func() time.Time
+	mutex      sync.Mutex
+	entries    map[string]*list.Element
+	order      *list.List
+}
+
+type memoryEntry struct {
+	key        string
+	recordedAt time.Time
+	// Claimed, but not yet produced
+	claimed bool
+}
+
+/*
+NewMemoryStore creates an in-memory store. A maximum number of entries below 1 means no limit.
+*/
+func NewMemoryStore(ttl time.Duration, maxEntries int) Store {
+	return &memoryStore{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		now:        time.Now,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+func (this *memoryStore) Claim(keys []string) (bool, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	this.evictExpired()
+	now := this.now()
+	for _, key := range keys {
+		if element, found := this.entries[key]; found {
+			entry := element.Value.(*memoryEntry)
+			if !entry.claimed {
+				return false, nil
+			}
+			if now.Sub(entry.recordedAt) < claimTimeout {
+				return false, ErrClaimed
+			}
+		}
+	}
+	this.record(keys, now, true)
+	return true, nil
+}
+
+func (this *memoryStore) Add(keys []string) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	this.record(keys, this.now(), false)
+	return nil
+}
+
+func (this *memoryStore) Release(keys []string) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	for _, key := range keys {
+		if element, found := this.entries[key]; found && element.Value.(*memoryEntry).claimed {
+			this.remove(element)
+		}
+	}
+	return nil
+}
+
+func (this *memoryStore) record(keys []string, now time.Time, claimed bool) {
+	for _, key := range keys {
+		// Re-adding a key moves it to the back to be evicted last
+		if element, found := this.entries[key]; found {
+			entry := element.Value.(*memoryEntry)
+			entry.recordedAt = now
+			entry.claimed = claimed
+			this.order.MoveToBack(element)
+			continue
+		}
+		this.entries[key] = this.order.PushBack(&memoryEntry{key: key, recordedAt: now, claimed: claimed})
+	}
+
+	// Evict the oldest entries exceeding the limit
+	for this.maxEntries > 0 && this.order.Len() > this.maxEntries {
+		this.remove(this.order.Front())
+	}
+}
+
+/*
+evictExpired removes the entries older than the time to live (oldest entries are at the front)
+*/
+func (this *memoryStore) evictExpired() {
+	expiredBefore := this.now().Add(-this.ttl)
+	for element := this.order.Front(); element != nil; element = this.order.Front() {
+		if !element.Value.(*memoryEntry).recordedAt.Before(expiredBefore) {
+			return
+		}
+		this.remove(element)
+	}
+}
+
+func (this *memoryStore) remove(element *list.Element) {
+	this.order.Remove(element)
+	delete(this.entries, element.Value.(*memoryEntry).key)
+}
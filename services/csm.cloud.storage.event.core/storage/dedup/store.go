@@ -0,0 +1,94 @@
+package dedup
+
+import (
+	"csm.cloud.storage.event.core/config/properties"
+	"csm.cloud.storage.event.core/storage/domain"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/app"
+	"errors"
+	"fmt"
+	"time"
+)
+
+/*
+Claims of deliveries that neither added nor released their keys (e.g. of a crashed instance) are taken over after
+this timeout, which exceeds the processing time of an event by far
+*/
+const claimTimeout = 2 * time.Minute
+
+/*
+ErrClaimed is returned by Claim while another delivery of the event is processed. The event must be delivered
+again, as the other delivery may still fail.
+*/
+var ErrClaimed = errors.New("event is being processed by another delivery")
+
+/*
+Store records the keys of malware scanned events a FileCreatedEvent has been produced for, so that events
+delivered again (e.g. by the storage queue after a visibility timeout or by Event Grid retries) are recognized
+as duplicates. Claim records the keys atomically unless one of them is recorded already (false for produced
+events), so that concurrent deliveries don't both produce the event. Add records the keys once the event is
+produced, Release removes the keys of a claimed event that failed to be produced.
+*/
+type Store interface {
+	Claim(keys []string) (bool, error)
+	Add(keys []string) error
+	Release(keys []string) error
+}
+
+/*
+KeysOf returns the deduplication keys of an event: the event id and the blob uri with the ETag of the scanned
+blob version (if available). A blob uploaded again gets a new ETag and is therefore processed again.
+*/
+func KeysOf(event *domain.MalwareScannedEvent) []string {
+	keys := make([]string, 0, 2)
+	if event.Id != "" {
+		keys = append(keys, "event:"+event.Id)
+	}
+	if event.Data.ETag != "" {
+		blobUri := event.Data.BlobUri
+		if blobUri == "" {
+			blobUri = event.Subject
+		}
+		keys = append(keys, "blob:"+blobUri+"#"+event.Data.ETag)
+	}
+	return keys
+}
+
+/*
+NewStore creates the store configured in the deduplication properties
+*/
+func NewStore(deduplicationConfig properties.DeduplicationProperties, storageConfig properties.StorageProperties) Store {
+	switch deduplicationConfig.Store {
+	case "memory":
+		return NewMemoryStore(deduplicationConfig.Ttl, deduplicationConfig.MaxEntries)
+	case "table":
+		return NewTableStore(deduplicationConfig.TableName, deduplicationConfig.Ttl, storageConfig)
+	case "none":
+		return NewDisabledStore()
+	default:
+		panic(app.NewFatalError(fmt.Sprintf("Unknown deduplication store %q", deduplicationConfig.Store), nil))
+	}
+}
+
+/*
+noOpStore disables the deduplication
+*/
+type noOpStore struct{}
+
+/*
+NewDisabledStore creates a store that never recognizes duplicates
+*/
+func NewDisabledStore() Store {
+	return &noOpStore{}
+}
+
+func (this *noOpStore) Claim(_ []string) (bool, error) {
+	return true, nil
+}
+
+func (this *noOpStore) Add(_ []string) error {
+	return nil
+}
+
+func (this *noOpStore) Release(_ []string) error {
+	return nil
+}
@@ -0,0 +1,135 @@
+package dedup
+
+import (
+	"csm.cloud.storage.event.core/storage/domain"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestKeysOf(t *testing.T) {
+
+	event := &domain.MalwareScannedEvent{
+		Id:      "2209bebf-9e38-4fdd-bf9c-5842129d8f63",
+		Subject: "storageAccounts/account/containers/container/blobs/images/a",
+		Data: domain.MalwareScanResult{
+			BlobUri: "https://account.blob.core.windows.net/container/images/a",
+			ETag:    "0x8DBCFD701F78E3B",
+		},
+	}
+
+	assert.Equal(t, []string{
+		"event:2209bebf-9e38-4fdd-bf9c-5842129d8f63",
+		"blob:https://account.blob.core.windows.net/container/images/a#0x8DBCFD701F78E3B",
+	}, KeysOf(event))
+
+	// Without ETag the blob version can't be identified
+	event.Data.ETag = ""
+	assert.Equal(t, []string{"event:2209bebf-9e38-4fdd-bf9c-5842129d8f63"}, KeysOf(event))
+}
+
+func TestMemoryStore_ClaimsKeysNotAdded(t *testing.T) {
+
+	cut := NewMemoryStore(time.Hour, 10)
+	assert.Nil(t, cut.Add([]string{"event:1", "blob:a#1"}))
+
+	// Any of the keys matches
+	assertClaimed(t, cut, false, "event:2", "blob:a#1")
+	assertClaimed(t, cut, false, "event:1")
+	assertClaimed(t, cut, true, "event:2", "blob:a#2")
+}
+
+func TestMemoryStore_ExpiresKeys(t *testing.T) {
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cut := NewMemoryStore(time.Hour, 10).(*memoryStore)
+	cut.now = func() time.Time { return now }
+	assert.Nil(t, cut.Add([]string{"event:1"}))
+
+	now = now.Add(59 * time.Minute)
+	assertClaimed(t, cut, false, "event:1")
+
+	now = now.Add(2 * time.Minute)
+	assertClaimed(t, cut, true, "event:1")
+	assert.Equal(t, 1, cut.order.Len())
+}
+
+func TestMemoryStore_EvictsLeastRecentlyAddedKeys(t *testing.T) {
+
+	cut := NewMemoryStore(time.Hour, 2)
+	assert.Nil(t, cut.Add([]string{"event:1"}))
+	assert.Nil(t, cut.Add([]string{"event:2"}))
+	assert.Nil(t, cut.Add([]string{"event:1"}))
+	assert.Nil(t, cut.Add([]string{"event:3"}))
+
+	assertClaimed(t, cut, false, "event:1")
+	assertClaimed(t, cut, true, "event:2")
+	assertClaimed(t, cut, false, "event:3")
+}
+
+func TestMemoryStore_RejectsClaimedKeysUntilReleased(t *testing.T) {
+
+	cut := NewMemoryStore(time.Hour, 10)
+	assertClaimed(t, cut, true, "event:1", "blob:a#1")
+
+	// Another delivery of the event must be delivered again, as the first one may still fail
+	claimed, err := cut.Claim([]string{"event:2", "blob:a#1"})
+	assert.False(t, claimed)
+	assert.ErrorIs(t, err, ErrClaimed)
+
+	assert.Nil(t, cut.Release([]string{"event:1", "blob:a#1"}))
+	assertClaimed(t, cut, true, "event:2", "blob:a#1")
+}
+
+func TestMemoryStore_TakesOverClaimsOfCrashedDeliveries(t *testing.T) {
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cut := NewMemoryStore(time.Hour, 10).(*memoryStore)
+	cut.now = func() time.Time { return now }
+	assertClaimed(t, cut, true, "event:1")
+
+	// Neither added nor released (e.g. the instance crashed)
+	now = now.Add(claimTimeout)
+	assertClaimed(t, cut, true, "event:1")
+}
+
+func TestMemoryStore_ClaimsKeysOfConcurrentDeliveriesOnce(t *testing.T) {
+
+	cut := NewMemoryStore(time.Hour, 10)
+	results := make(chan bool, 10)
+	for i := 0; i < 10; i++ {
+		go func() {
+			claimed, _ := cut.Claim([]string{"event:1", "blob:a#1"})
+			results <- claimed
+		}()
+	}
+
+	claims := 0
+	for i := 0; i < 10; i++ {
+		if <-results {
+			claims++
+		}
+	}
+	assert.Equal(t, 1, claims)
+}
+
+func TestDisabledStore_NeverContainsKeys(t *testing.T) {
+
+	cut := NewDisabledStore()
+	assert.Nil(t, cut.Add([]string{"event:1"}))
+	assertClaimed(t, cut, true, "event:1")
+}
+
+func TestEntityKeysOf(t *testing.T) {
+
+	partitionKey, rowKey := entityKeysOf("blob:https://account.blob.core.windows.net/container/images/a#0x1")
+	assert.Len(t, rowKey, 64)
+	assert.Equal(t, rowKey[:2], partitionKey)
+	assert.NotContains(t, rowKey, "/")
+}
+
+func assertClaimed(t *testing.T, store Store, expected bool, keys ...string) {
+	claimed, err := store.Claim(keys)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, claimed, "Unexpected result for keys %v", keys)
+}
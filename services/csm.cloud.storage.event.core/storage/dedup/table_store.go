@@ -0,0 +1,178 @@
+package dedup
+
+import (
+	"context"
+	"crypto/sha256"
+	"csm.cloud.storage.event.core/config/properties"
+	storageClient "csm.cloud.storage.event.core/storage/client"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/app"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
+	"time"
+)
+
+/*
+tableStore keeps the keys in an Azure storage table, so that duplicates are recognized across instances and
+restarts. Entities older than the time to live are treated as absent (and can be removed by a lifecycle job).
+Keys are claimed by inserting their entity, which fails if another delivery inserted it already.
+*/
+type tableStore struct {
+	client *aztables.Client
+	ttl    time.Duration
+}
+
+type tableEntity struct {
+	aztables.Entity
+	Key        string
+	RecordedAt aztables.EDMDateTime
+	// Claimed, but not yet produced (entities without the property are produced)
+	Claimed bool
+}
+
+/*
+NewTableStore creates a store using the table with the given name in the configured storage account.
+The table is created if it doesn't exist yet.
+*/
+func NewTableStore(tableName string, ttl time.Duration, storageConfig properties.StorageProperties) Store {
+	serviceClient, err := storageClient.NewTableServiceClient(storageConfig)
+	if err != nil {
+		panic(app.NewFatalError("Connection to AzureStorage (table) failed", err))
+	}
+	client := serviceClient.NewClient(tableName)
+
+	// Create the table on startup
+	requestContext, cancelFn := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelFn()
+	_, err = client.CreateTable(requestContext, nil)
+	if err != nil && !hasErrorCode(err, aztables.TableAlreadyExists) {
+		panic(app.NewFatalError("Creating deduplication table failed", err))
+	}
+
+	return &tableStore{
+		client: client,
+		ttl:    ttl,
+	}
+}
+
+func (this *tableStore) Claim(keys []string) (bool, error) {
+	for i, key := range keys {
+		claimed, err := this.claim(key)
+		if err != nil || !claimed {
+			// Release the keys claimed before, the event is produced (or dropped) by the other delivery
+			if releaseErr := this.Release(keys[:i]); releaseErr != nil {
+				err = errors.Join(err, releaseErr)
+			}
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+/*
+claim inserts the entity of the key. An existing entity is only taken over if it expired (a produced entity after
+the time to live, a claimed one after the claim timeout), conditionally on its ETag in case of concurrent deliveries.
+*/
+func (this *tableStore) claim(key string) (bool, error) {
+	requestContext, cancelFn := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelFn()
+
+	entity, err := entityOf(key, true)
+	if err != nil {
+		return false, err
+	}
+	_, err = this.client.AddEntity(requestContext, entity, nil)
+	if !hasErrorCode(err, aztables.EntityAlreadyExists) {
+		return err == nil, err
+	}
+
+	partitionKey, rowKey := entityKeysOf(key)
+	response, err := this.client.GetEntity(requestContext, partitionKey, rowKey, nil)
+	if hasErrorCode(err, aztables.ResourceNotFound) {
+		// Released by the other delivery in the meantime, which will be delivered again
+		return false, ErrClaimed
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var existing tableEntity
+	err = json.Unmarshal(response.Value, &existing)
+	if err != nil {
+		return false, err
+	}
+	age := time.Since(time.Time(existing.RecordedAt))
+	if !existing.Claimed && age < this.ttl {
+		return false, nil
+	}
+	if existing.Claimed && age < claimTimeout {
+		return false, ErrClaimed
+	}
+
+	_, err = this.client.UpdateEntity(requestContext, entity, &aztables.UpdateEntityOptions{
+		IfMatch:    &response.ETag,
+		UpdateMode: aztables.UpdateModeReplace,
+	})
+	if hasErrorCode(err, aztables.UpdateConditionNotSatisfied) {
+		return false, ErrClaimed
+	}
+	return err == nil, err
+}
+
+func (this *tableStore) Add(keys []string) error {
+	for _, key := range keys {
+		entity, err := entityOf(key, false)
+		if err != nil {
+			return err
+		}
+
+		requestContext, cancelFn := context.WithTimeout(context.Background(), 10*time.Second)
+		_, err = this.client.UpsertEntity(requestContext, entity, &aztables.UpsertEntityOptions{UpdateMode: aztables.UpdateModeReplace})
+		cancelFn()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (this *tableStore) Release(keys []string) error {
+	for _, key := range keys {
+		partitionKey, rowKey := entityKeysOf(key)
+		requestContext, cancelFn := context.WithTimeout(context.Background(), 10*time.Second)
+		_, err := this.client.DeleteEntity(requestContext, partitionKey, rowKey, nil)
+		cancelFn()
+		if err != nil && !hasErrorCode(err, aztables.ResourceNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Serializes the entity of the key recorded now
+func entityOf(key string, claimed bool) ([]byte, error) {
+	partitionKey, rowKey := entityKeysOf(key)
+	return json.Marshal(tableEntity{
+		Entity:     aztables.Entity{PartitionKey: partitionKey, RowKey: rowKey},
+		Key:        key,
+		RecordedAt: aztables.EDMDateTime(time.Now().UTC()),
+		Claimed:    claimed,
+	})
+}
+
+/*
+entityKeysOf hashes the key as blob uris contain characters not allowed in row keys (e.g. '/').
+The partitions are spread by the first characters of the hash.
+*/
+func entityKeysOf(key string) (partitionKey string, rowKey string) {
+	hash := sha256.Sum256([]byte(key))
+	rowKey = hex.EncodeToString(hash[:])
+	return rowKey[:2], rowKey
+}
+
+func hasErrorCode(err error, code aztables.TableErrorCode) bool {
+	var responseError *azcore.ResponseError
+	return errors.As(err, &responseError) && responseError.ErrorCode == string(code)
+}
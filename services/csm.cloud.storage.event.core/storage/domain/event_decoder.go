@@ -0,0 +1,116 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Attribute that is mandatory in the CloudEvents 1.0 schema and doesn't exist in the Event Grid schema
+const cloudEventsSpecVersionAttribute = "specversion"
+
+/*
+DecodeMalwareScannedEvent decodes a single malware scanning result event. The envelope format is detected
+automatically, both the Event Grid schema and the CloudEvents 1.0 schema are supported. Fields not known (yet) are
+logged but don't fail decoding, so that additions made by Microsoft to the schemas don't break processing.
+*/
+func DecodeMalwareScannedEvent(content []byte) (*MalwareScannedEvent, error) {
+
+	// Decode the envelope attributes first to detect the schema
+	var attributes map[string]json.RawMessage
+	err := json.Unmarshal(content, &attributes)
+	if err != nil {
+		return nil, err
+	}
+	if attributes == nil {
+		return nil, errors.New("event is empty")
+	}
+
+	if _, isCloudEvent := attributes[cloudEventsSpecVersionAttribute]; isCloudEvent {
+		var cloudEvent CloudEvent
+		err = json.Unmarshal(content, &cloudEvent)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(cloudEvent.SpecVersion, "1.") {
+			return nil, fmt.Errorf("unsupported CloudEvents spec version %s of event %s", cloudEvent.SpecVersion, cloudEvent.Id)
+		}
+		logUnknownFields(cloudEvent.Id, content, reflect.TypeOf(cloudEvent))
+		return cloudEvent.ToMalwareScannedEvent()
+	}
+
+	var eventGridEvent EventGridEvent
+	err = json.Unmarshal(content, &eventGridEvent)
+	if err != nil {
+		return nil, err
+	}
+	logUnknownFields(eventGridEvent.Id, content, reflect.TypeOf(eventGridEvent))
+	return eventGridEvent.ToMalwareScannedEvent()
+}
+
+/*
+decodeMessageText returns the JSON content of a queue message. Event Grid writes base64 encoded messages to storage
+queues, messages written by other clients might not be encoded.
+*/
+func decodeMessageText(text string) ([]byte, error) {
+	trimmedText := strings.TrimSpace(text)
+	if strings.HasPrefix(trimmedText, "{") {
+		return []byte(trimmedText), nil
+	}
+	return base64.StdEncoding.DecodeString(trimmedText)
+}
+
+/*
+logUnknownFields logs the fields of the event which are not mapped by the event types. The event data is checked
+against the malware scan result as the event data types are kept raw.
+*/
+func logUnknownFields(eventId string, content []byte, eventType reflect.Type) {
+	unknownFields := findUnknownFields("", content, eventType)
+	if len(unknownFields) > 0 {
+		log.Warn().Msg(fmt.Sprintf("Ignoring unknown fields of event %s: %s", eventId, strings.Join(unknownFields, ", ")))
+	}
+}
+
+/*
+findUnknownFields compares the attributes of a JSON object with the json tags of the given struct type and
+descends into nested objects. Names are compared case-insensitive like encoding/json does.
+*/
+func findUnknownFields(prefix string, content []byte, structType reflect.Type) []string {
+	var attributes map[string]json.RawMessage
+	if json.Unmarshal(content, &attributes) != nil {
+		return nil
+	}
+
+	knownFields := make(map[string]reflect.Type)
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" {
+			name = field.Name
+		}
+		fieldType := field.Type
+		// The raw event data is checked against the malware scan result
+		if fieldType == reflect.TypeOf(json.RawMessage{}) {
+			fieldType = reflect.TypeOf(MalwareScanResult{})
+		}
+		knownFields[strings.ToLower(name)] = fieldType
+	}
+
+	var unknownFields []string
+	for name, value := range attributes {
+		fieldType, isKnown := knownFields[strings.ToLower(name)]
+		if !isKnown {
+			unknownFields = append(unknownFields, prefix+name)
+		} else if fieldType.Kind() == reflect.Struct && bytes.HasPrefix(bytes.TrimSpace(value), []byte("{")) {
+			unknownFields = append(unknownFields, findUnknownFields(prefix+name+".", value, fieldType)...)
+		}
+	}
+	sort.Strings(unknownFields)
+	return unknownFields
+}
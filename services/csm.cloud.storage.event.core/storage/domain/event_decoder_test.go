@@ -0,0 +1,101 @@
+package domain
+
+import (
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeMalwareScannedEvent_EventGridSchemaWithUnknownFields(t *testing.T) {
+
+	content := `{
+		"id": "2209bebf-9e38-4fdd-bf9c-5842129d8f63",
+		"subject": "storageAccounts/defendermalwaretest/containers/uploads/blobs/some/file.png",
+		"data": {
+			"eTag": "0x8DBCFD701F78E3B",
+			"scanResultType": "No threats found",
+			"scanResultDetails": {"sha256": "275A", "newDetail": 1},
+			"newField": "value"
+		},
+		"eventType": "Microsoft.Security.MalwareScanningResult",
+		"dataVersion": "2.0",
+		"metadataVersion": "1",
+		"eventTime": "2023-10-18T12:37:42.8040405Z",
+		"topic": "/subscriptions/xxx",
+		"newAttribute": true
+	}`
+
+	malwareScannedEvent, err := DecodeMalwareScannedEvent([]byte(content))
+
+	// Verify unknown fields don't fail decoding
+	assert.Nil(t, err)
+	assert.Equal(t, "2209bebf-9e38-4fdd-bf9c-5842129d8f63", malwareScannedEvent.Id)
+	assert.Equal(t, "2.0", malwareScannedEvent.DataVersion)
+	assert.Equal(t, "275A", malwareScannedEvent.Data.ScanResultDetails.Sha256)
+
+	// Verify unknown fields are detected on all levels
+	assert.Equal(t,
+		[]string{"data.newField", "data.scanResultDetails.newDetail", "newAttribute"},
+		findUnknownFields("", []byte(content), reflect.TypeOf(EventGridEvent{})))
+}
+
+func TestDecodeMalwareScannedEvent_CloudEventsSchema(t *testing.T) {
+
+	content := `{
+		"specversion": "1.0",
+		"type": "Microsoft.Security.MalwareScanningResult",
+		"source": "/subscriptions/xxx",
+		"id": "2209bebf-9e38-4fdd-bf9c-5842129d8f63",
+		"time": "2023-10-18T12:37:42.8040405Z",
+		"subject": "storageAccounts/defendermalwaretest/containers/uploads/blobs/some/file.png",
+		"datacontenttype": "application/json",
+		"traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+		"data": {"scanResultType": "Malicious"}
+	}`
+
+	malwareScannedEvent, err := DecodeMalwareScannedEvent([]byte(content))
+
+	// Verify the event has been adapted correctly
+	assert.Nil(t, err)
+	assert.Equal(t, "Microsoft.Security.MalwareScanningResult", malwareScannedEvent.EventType)
+	assert.Equal(t, "/subscriptions/xxx", malwareScannedEvent.Topic)
+	assert.Equal(t, "Malicious", malwareScannedEvent.Data.ScanResultType)
+
+	// Verify extension attributes are reported as unknown
+	assert.Equal(t, []string{"traceparent"}, findUnknownFields("", []byte(content), reflect.TypeOf(CloudEvent{})))
+}
+
+func TestDecodeMalwareScannedEvent_CloudEventsSchemaWithBase64Data(t *testing.T) {
+
+	content := `{
+		"specversion": "1.0",
+		"type": "Microsoft.Security.MalwareScanningResult",
+		"id": "1",
+		"data_base64": "` + base64.StdEncoding.EncodeToString([]byte(`{"scanResultType": "No threats found"}`)) + `"
+	}`
+
+	malwareScannedEvent, err := DecodeMalwareScannedEvent([]byte(content))
+
+	// Verify the base64 encoded data has been decoded
+	assert.Nil(t, err)
+	assert.Equal(t, "No threats found", malwareScannedEvent.Data.ScanResultType)
+}
+
+func TestDecodeMalwareScannedEvent_FailsForUnsupportedSpecVersion(t *testing.T) {
+
+	malwareScannedEvent, err := DecodeMalwareScannedEvent([]byte(`{"specversion": "0.3", "id": "1"}`))
+
+	// Verify an error is returned
+	assert.Nil(t, malwareScannedEvent)
+	assert.Equal(t, "unsupported CloudEvents spec version 0.3 of event 1", err.Error())
+}
+
+func TestDecodeMalwareScannedEvent_FailsForEmptyEvent(t *testing.T) {
+
+	malwareScannedEvent, err := DecodeMalwareScannedEvent([]byte(`null`))
+
+	// Verify an error is returned
+	assert.Nil(t, malwareScannedEvent)
+	assert.Equal(t, "event is empty", err.Error())
+}
@@ -0,0 +1,157 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+const SubscriptionValidationEventType = "Microsoft.EventGrid.SubscriptionValidationEvent"
+
+/*
+EventGridEvent is an event delivered in the Event Grid schema. The data is kept raw as its structure depends on the
+event type (e.g. malware scanning result or subscription validation).
+*/
+type EventGridEvent struct {
+	Id              string          `json:"id"`
+	Subject         string          `json:"subject"`
+	Data            json.RawMessage `json:"data"`
+	EventType       string          `json:"eventType"`
+	DataVersion     string          `json:"dataVersion"`
+	MetadataVersion string          `json:"metadataVersion"`
+	EventTime       string          `json:"eventTime"`
+	Topic           string          `json:"topic"`
+}
+
+/*
+CloudEvent is an event delivered in the CloudEvents 1.0 schema. The data is kept raw as its structure depends on the
+event type. Binary data is transported base64 encoded in data_base64 instead of data.
+*/
+type CloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	Type            string          `json:"type"`
+	Source          string          `json:"source"`
+	Id              string          `json:"id"`
+	Time            string          `json:"time"`
+	Subject         string          `json:"subject"`
+	DataContentType string          `json:"datacontenttype"`
+	DataSchema      string          `json:"dataschema"`
+	Data            json.RawMessage `json:"data"`
+	DataBase64      string          `json:"data_base64"`
+}
+
+type SubscriptionValidationData struct {
+	ValidationCode string `json:"validationCode"`
+	ValidationUrl  string `json:"validationUrl"`
+}
+
+/*
+ParseEventGridEvents parses a push delivery in the Event Grid schema which is always a JSON array of events
+*/
+func ParseEventGridEvents(body []byte) ([]EventGridEvent, error) {
+	var events []EventGridEvent
+	err := json.Unmarshal(body, &events)
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+/*
+ParseCloudEvents parses a push delivery in the CloudEvents 1.0 schema. Event Grid delivers either a single event
+(structured content mode) or a JSON array of events (batched content mode), both are supported.
+*/
+func ParseCloudEvents(body []byte) ([]CloudEvent, error) {
+	trimmedBody := bytes.TrimSpace(body)
+	if len(trimmedBody) > 0 && trimmedBody[0] == '[' {
+		var events []CloudEvent
+		err := json.Unmarshal(trimmedBody, &events)
+		if err != nil {
+			return nil, err
+		}
+		return events, nil
+	}
+
+	var event CloudEvent
+	err := json.Unmarshal(trimmedBody, &event)
+	if err != nil {
+		return nil, err
+	}
+	return []CloudEvent{event}, nil
+}
+
+/*
+ToSubscriptionValidationData decodes the data of a subscription validation event
+*/
+func (this *EventGridEvent) ToSubscriptionValidationData() (*SubscriptionValidationData, error) {
+	if this.EventType != SubscriptionValidationEventType {
+		return nil, errors.New("event " + this.Id + " is not a subscription validation event")
+	}
+	var validationData SubscriptionValidationData
+	err := json.Unmarshal(this.Data, &validationData)
+	if err != nil {
+		return nil, err
+	}
+	return &validationData, nil
+}
+
+/*
+ToMalwareScannedEvent adapts an event in the Event Grid schema to a malware scanning result event
+*/
+func (this *EventGridEvent) ToMalwareScannedEvent() (*MalwareScannedEvent, error) {
+	var scanResult MalwareScanResult
+	err := unmarshalData(this.Data, &scanResult)
+	if err != nil {
+		return nil, err
+	}
+	return &MalwareScannedEvent{
+		Id:              this.Id,
+		Subject:         this.Subject,
+		Data:            scanResult,
+		EventType:       this.EventType,
+		DataVersion:     this.DataVersion,
+		MetadataVersion: this.MetadataVersion,
+		EventTime:       this.EventTime,
+		Topic:           this.Topic,
+	}, nil
+}
+
+/*
+ToMalwareScannedEvent adapts an event in the CloudEvents 1.0 schema to a malware scanning result event.
+The CloudEvents source corresponds to the Event Grid topic, the CloudEvents type to the Event Grid event type.
+*/
+func (this *CloudEvent) ToMalwareScannedEvent() (*MalwareScannedEvent, error) {
+	data := this.Data
+	if len(data) == 0 && this.DataBase64 != "" {
+		decodedData, err := base64.StdEncoding.DecodeString(this.DataBase64)
+		if err != nil {
+			return nil, err
+		}
+		data = decodedData
+	}
+
+	var scanResult MalwareScanResult
+	err := unmarshalData(data, &scanResult)
+	if err != nil {
+		return nil, err
+	}
+	return &MalwareScannedEvent{
+		Id:        this.Id,
+		Subject:   this.Subject,
+		Data:      scanResult,
+		EventType: this.Type,
+		EventTime: this.Time,
+		Topic:     this.Source,
+	}, nil
+}
+
+/*
+unmarshalData decodes the raw event data into the given value. Missing data results in the zero value.
+*/
+func unmarshalData(data json.RawMessage, value any) error {
+	if len(data) == 0 || string(data) == "null" {
+		return nil
+	}
+	return json.Unmarshal(data, value)
+}
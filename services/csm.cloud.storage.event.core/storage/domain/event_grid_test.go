@@ -0,0 +1,140 @@
+package domain
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseEventGridEvents(t *testing.T) {
+
+	body := `[{
+		"id": "2209bebf-9e38-4fdd-bf9c-5842129d8f63",
+		"subject": "storageAccounts/defendermalwaretest/containers/uploads/blobs/some/file.png",
+		"data": {
+			"correlationId": "2209bebf-9e38-4fdd-bf9c-5842129d8f63",
+			"eTag": "0x8DBCFD701F78E3B",
+			"scanResultType": "No threats found"
+		},
+		"eventType": "Microsoft.Security.MalwareScanningResult",
+		"dataVersion": "1.0",
+		"metadataVersion": "1",
+		"eventTime": "2023-10-18T12:37:42.8040405Z",
+		"topic": "/subscriptions/xxx/providers/Microsoft.EventGrid/topics/defendermalwaretest-eventgrid-topic"
+	}]`
+
+	events, err := ParseEventGridEvents([]byte(body))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(events))
+
+	malwareScannedEvent, err := events[0].ToMalwareScannedEvent()
+
+	// Verify the event has been adapted correctly
+	assert.Nil(t, err)
+	assert.Equal(t, "2209bebf-9e38-4fdd-bf9c-5842129d8f63", malwareScannedEvent.Id)
+	assert.Equal(t, "Microsoft.Security.MalwareScanningResult", malwareScannedEvent.EventType)
+	assert.Equal(t, "1.0", malwareScannedEvent.DataVersion)
+	assert.Equal(t, "No threats found", malwareScannedEvent.Data.ScanResultType)
+	assert.Equal(t, "0x8DBCFD701F78E3B", malwareScannedEvent.Data.ETag)
+	assert.Equal(t, "/subscriptions/xxx/providers/Microsoft.EventGrid/topics/defendermalwaretest-eventgrid-topic", malwareScannedEvent.Topic)
+}
+
+func TestParseEventGridEvents_FailsForSingleEvent(t *testing.T) {
+
+	events, err := ParseEventGridEvents([]byte(`{"id": "1"}`))
+
+	// Verify an error is returned as the Event Grid schema always uses arrays
+	assert.IsType(t, &json.UnmarshalTypeError{}, err)
+	assert.Nil(t, events)
+}
+
+func TestEventGridEvent_ToSubscriptionValidationData(t *testing.T) {
+
+	body := `[{
+		"id": "2d1781af-3a4c-4d7c-bd0c-e34b19da4e66",
+		"topic": "/subscriptions/xxx",
+		"subject": "",
+		"data": {
+			"validationCode": "512d38b6-c7b8-40c8-89fe-f46f9e9622b6",
+			"validationUrl": "https://rp-eastus2.eventgrid.azure.net:553/eventsubscriptions/myeventsub/validate?id=0000&t=2022-10-28T04:23:35.1981776Z"
+		},
+		"eventType": "Microsoft.EventGrid.SubscriptionValidationEvent",
+		"eventTime": "2022-10-28T04:23:35.1981776Z",
+		"metadataVersion": "1",
+		"dataVersion": "1"
+	}]`
+
+	events, err := ParseEventGridEvents([]byte(body))
+	assert.Nil(t, err)
+
+	validationData, err := events[0].ToSubscriptionValidationData()
+
+	// Verify the validation code has been decoded
+	assert.Nil(t, err)
+	assert.Equal(t, "512d38b6-c7b8-40c8-89fe-f46f9e9622b6", validationData.ValidationCode)
+}
+
+func TestEventGridEvent_ToSubscriptionValidationData_FailsForOtherEventTypes(t *testing.T) {
+
+	event := EventGridEvent{Id: "1", EventType: "Microsoft.Security.MalwareScanningResult"}
+
+	validationData, err := event.ToSubscriptionValidationData()
+
+	// Verify an error is returned
+	assert.Nil(t, validationData)
+	assert.Equal(t, "event 1 is not a subscription validation event", err.Error())
+}
+
+func TestParseCloudEvents_SingleEvent(t *testing.T) {
+
+	body := `{
+		"specversion": "1.0",
+		"type": "Microsoft.Security.MalwareScanningResult",
+		"source": "/subscriptions/xxx/providers/Microsoft.EventGrid/topics/defendermalwaretest-eventgrid-topic",
+		"id": "2209bebf-9e38-4fdd-bf9c-5842129d8f63",
+		"time": "2023-10-18T12:37:42.8040405Z",
+		"subject": "storageAccounts/defendermalwaretest/containers/uploads/blobs/some/file.png",
+		"datacontenttype": "application/json",
+		"data": {
+			"scanResultType": "Malicious",
+			"scanResultDetails": {
+				"malwareNamesFound": ["DOS/EICAR_Test_File"],
+				"sha256": "275A021BBFB6489E54D471899F7DB9D1663FC695EC2FE2A2C4538AABF651FD0F"
+			}
+		}
+	}`
+
+	events, err := ParseCloudEvents([]byte(body))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(events))
+
+	malwareScannedEvent, err := events[0].ToMalwareScannedEvent()
+
+	// Verify the event has been adapted correctly
+	assert.Nil(t, err)
+	assert.Equal(t, "2209bebf-9e38-4fdd-bf9c-5842129d8f63", malwareScannedEvent.Id)
+	assert.Equal(t, "Microsoft.Security.MalwareScanningResult", malwareScannedEvent.EventType)
+	assert.Equal(t, "2023-10-18T12:37:42.8040405Z", malwareScannedEvent.EventTime)
+	assert.Equal(t, "/subscriptions/xxx/providers/Microsoft.EventGrid/topics/defendermalwaretest-eventgrid-topic", malwareScannedEvent.Topic)
+	assert.Equal(t, "Malicious", malwareScannedEvent.Data.ScanResultType)
+	assert.Equal(t, []string{"DOS/EICAR_Test_File"}, malwareScannedEvent.Data.ScanResultDetails.MalwareNamesFound)
+}
+
+func TestParseCloudEvents_Batch(t *testing.T) {
+
+	body := ` [
+		{"specversion": "1.0", "id": "1", "type": "Microsoft.Security.MalwareScanningResult"},
+		{"specversion": "1.0", "id": "2", "type": "Microsoft.Security.MalwareScanningResult", "data": null}
+	]`
+
+	events, err := ParseCloudEvents([]byte(body))
+
+	// Verify all events of the batch have been parsed
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, "2", events[1].Id)
+
+	malwareScannedEvent, err := events[1].ToMalwareScannedEvent()
+	assert.Nil(t, err)
+	assert.Equal(t, "", malwareScannedEvent.Data.ScanResultType)
+}
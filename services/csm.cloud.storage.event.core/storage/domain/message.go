@@ -1,9 +1,6 @@
 package domain
 
 import (
-	"bytes"
-	"encoding/base64"
-	"encoding/json"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azqueue"
 	"github.com/rs/zerolog/log"
 )
@@ -21,8 +18,8 @@ ToMalwareScannedEvent adapts an Azure storage queue message to a malware scannin
 */
 func (this *AzureStorageMessage) ToMalwareScannedEvent() (*MalwareScannedEvent, error) {
 
-	// Decode base64 encoded json message
-	textDec, err := base64.StdEncoding.DecodeString(*this.MessageText)
+	// Decode the message text which is either base64 encoded or plain json
+	textDec, err := decodeMessageText(*this.MessageText)
 	if err != nil {
 		log.Error().Msg("Decoding message failed: " + err.Error())
 		return nil, err
@@ -32,15 +29,11 @@ func (this *AzureStorageMessage) ToMalwareScannedEvent() (*MalwareScannedEvent,
 	log.Debug().Msg("Processing message with id " + *this.MessageID)
 	log.Trace().Msg("Message content: " + string(textDec))
 
-	// Instantiate blob event and deserialize values from json string into the GO-datatype
-	var malwareScannedEvent = &MalwareScannedEvent{}
-
-	decoder := json.NewDecoder(bytes.NewReader(textDec))
-	decoder.DisallowUnknownFields()
-	err = decoder.Decode(&malwareScannedEvent)
+	// Deserialize the event from the json string in either the Event Grid or the CloudEvents schema
+	malwareScannedEvent, err := DecodeMalwareScannedEvent(textDec)
 	if err != nil {
 		log.Error().Msg("Decode message content into MalwareScannedEvent failed: " + err.Error())
 		return nil, err
 	}
-	return malwareScannedEvent, err
+	return malwareScannedEvent, nil
 }
@@ -45,3 +45,57 @@ func TestToMalwareScannedEvent_FailsWithJsonUnmarshallingError(t *testing.T) {
 	assert.Equal(t, "invalid character 'N' looking for beginning of value", err.Error())
 	assert.Nil(t, malwareScannedEvent)
 }
+
+func TestToMalwareScannedEvent_Base64EncodedEventGridEvent(t *testing.T) {
+
+	// Create message
+	text := base64.StdEncoding.EncodeToString([]byte(`{
+		"id": "2209bebf-9e38-4fdd-bf9c-5842129d8f63",
+		"subject": "storageAccounts/defendermalwaretest/containers/uploads/blobs/some/file.png",
+		"data": {"eTag": "0x8DBCFD701F78E3B", "scanResultType": "No threats found"},
+		"eventType": "Microsoft.Security.MalwareScanningResult",
+		"dataVersion": "1.0",
+		"metadataVersion": "1",
+		"eventTime": "2023-10-18T12:37:42.8040405Z",
+		"topic": "/subscriptions/xxx"
+	}`))
+	id := "id"
+	message := NewAzureStorageMessage(azqueue.DequeuedMessage{
+		MessageText: &text,
+		MessageID:   &id,
+	})
+
+	// Adapt to malware scanned event
+	malwareScannedEvent, err := message.ToMalwareScannedEvent()
+
+	// Verify the event has been decoded
+	assert.Nil(t, err)
+	assert.Equal(t, "2209bebf-9e38-4fdd-bf9c-5842129d8f63", malwareScannedEvent.Id)
+	assert.Equal(t, "No threats found", malwareScannedEvent.Data.ScanResultType)
+}
+
+func TestToMalwareScannedEvent_UnencodedCloudEvent(t *testing.T) {
+
+	// Create message
+	text := ` {
+		"specversion": "1.0",
+		"type": "Microsoft.Security.MalwareScanningResult",
+		"source": "/subscriptions/xxx",
+		"id": "2209bebf-9e38-4fdd-bf9c-5842129d8f63",
+		"subject": "storageAccounts/defendermalwaretest/containers/uploads/blobs/some/file.png",
+		"data": {"eTag": "0x8DBCFD701F78E3B", "scanResultType": "Malicious"}
+	}`
+	id := "id"
+	message := NewAzureStorageMessage(azqueue.DequeuedMessage{
+		MessageText: &text,
+		MessageID:   &id,
+	})
+
+	// Adapt to malware scanned event
+	malwareScannedEvent, err := message.ToMalwareScannedEvent()
+
+	// Verify the event has been decoded
+	assert.Nil(t, err)
+	assert.Equal(t, "Microsoft.Security.MalwareScanningResult", malwareScannedEvent.EventType)
+	assert.Equal(t, "Malicious", malwareScannedEvent.Data.ScanResultType)
+}
@@ -1,6 +1,7 @@
 package domain
 
 import (
+	storageDomain "csm.cloud.storage.event.core/domain"
 	"fmt"
 	"regexp"
 )
@@ -41,6 +42,22 @@ func (this *BlobInfo) ToString() string {
 	return fmt.Sprintf("%s/%s in storage account %s and container %s", this.Path, this.FileName, this.StorageName, this.ContainerName)
 }
 
+/*
+ToFileCreatedEvent creates the event announcing the blob for further processing. The malware scan provenance is
+added by the caller if available.
+*/
+func (this *BlobInfo) ToFileCreatedEvent(contentType string, contentLength int64) *storageDomain.FileCreatedEvent {
+	return &storageDomain.FileCreatedEvent{
+		Identifier:     "/" + this.Path + "/" + this.FileName,
+		Path:           "/" + this.Path,
+		FileName:       this.FileName,
+		ContentType:    contentType,
+		ContentLength:  contentLength,
+		StorageAccount: storageDomain.NewOptionalString(this.StorageName),
+		Container:      storageDomain.NewOptionalString(this.ContainerName),
+	}
+}
+
 /*
 ToBlobInfo parses container name, file name and path of the blob from the event's subject
 */
@@ -3,6 +3,7 @@ package delete
 import (
 	"context"
 	"csm.cloud.storage.event.core/config/properties"
+	storageClient "csm.cloud.storage.event.core/storage/client"
 	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/app"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azqueue"
 )
@@ -18,7 +19,7 @@ which uses the Azure Storage Queue configured. As the AzureStorage.Queue is a
 suitable implementation no internal implementation is required
 */
 func NewDefaultDeleteMessageService(storageConfig properties.StorageProperties) DeleteMessageService {
-	client, err := azqueue.NewServiceClientFromConnectionString(storageConfig.ConnectionString, nil)
+	client, err := storageClient.NewQueueServiceClient(storageConfig)
 	if err != nil {
 		panic(app.NewFatalError("Connection to AzureStorage failed", err))
 	}
@@ -0,0 +1,107 @@
+package get
+
+import (
+	"context"
+	"csm.cloud.storage.event.core/config/properties"
+	storageClient "csm.cloud.storage.event.core/storage/client"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/app"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
+	"net/url"
+	"strings"
+	"time"
+)
+
+/*
+BlobListService lists the blobs of a container in lexicographical order of their names
+*/
+type BlobListService interface {
+	AccountName() string
+	ListBlobs(containerName string, prefix string, handleBlob func(blob BlobItem) error) error
+}
+
+type BlobItem struct {
+	Name          string
+	ContentLength int64
+	ContentType   string
+	ETag          string
+	LastModified  time.Time
+}
+
+type defaultBlobListService struct {
+	serviceClient *service.Client
+}
+
+/*
+NewDefaultBlobListService returns a default implementation of BlobListService interface
+which uses the Azure Blob Storage configured
+*/
+func NewDefaultBlobListService(storageConfig properties.StorageProperties) BlobListService {
+	client, err := storageClient.NewBlobClient(storageConfig)
+	if err != nil {
+		panic(app.NewFatalError("Connection to AzureStorage (blob) failed", err))
+	}
+	return &defaultBlobListService{
+		client.ServiceClient(),
+	}
+}
+
+/*
+AccountName returns the name of the storage account parsed from the service url
+*/
+func (this *defaultBlobListService) AccountName() string {
+	serviceUrl, err := url.Parse(this.serviceClient.URL())
+	if err != nil {
+		return ""
+	}
+	// Local emulators (e.g. Azurite) use path-style urls: http://127.0.0.1:10000/<account>
+	if accountName, _, _ := strings.Cut(strings.TrimPrefix(serviceUrl.Path, "/"), "/"); accountName != "" {
+		return accountName
+	}
+	accountName, _, _ := strings.Cut(serviceUrl.Hostname(), ".")
+	return accountName
+}
+
+/*
+ListBlobs passes all blobs of the container with the given name prefix to handleBlob page by page.
+Listing stops at the first error returned by handleBlob.
+*/
+func (this *defaultBlobListService) ListBlobs(containerName string, prefix string, handleBlob func(blob BlobItem) error) error {
+	options := &container.ListBlobsFlatOptions{}
+	if prefix != "" {
+		options.Prefix = &prefix
+	}
+	pager := this.serviceClient.NewContainerClient(containerName).NewListBlobsFlatPager(options)
+
+	for pager.More() {
+		requestContext, cancelFn := context.WithTimeout(context.Background(), 30*time.Second)
+		page, err := pager.NextPage(requestContext)
+		cancelFn()
+		if err != nil {
+			return err
+		}
+
+		for _, item := range page.Segment.BlobItems {
+			blob := BlobItem{Name: *item.Name}
+			if item.Properties != nil {
+				if item.Properties.ContentLength != nil {
+					blob.ContentLength = *item.Properties.ContentLength
+				}
+				if item.Properties.ContentType != nil {
+					blob.ContentType = *item.Properties.ContentType
+				}
+				if item.Properties.ETag != nil {
+					blob.ETag = string(*item.Properties.ETag)
+				}
+				if item.Properties.LastModified != nil {
+					blob.LastModified = *item.Properties.LastModified
+				}
+			}
+			err = handleBlob(blob)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -3,10 +3,12 @@ package get
 import (
 	"context"
 	"csm.cloud.storage.event.core/config/properties"
+	storageClient "csm.cloud.storage.event.core/storage/client"
 	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/app"
-	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/health"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azqueue"
+	"strings"
 	"time"
 )
 
@@ -25,11 +27,38 @@ suitable implementation no internal implementation is required
 func NewDefaultGetMessageService(storageConfig properties.StorageProperties) GetMessagesService {
 
 	// Connect to Azure Storage
-	client, err := azqueue.NewServiceClientFromConnectionString(storageConfig.ConnectionString, nil)
+	client, err := storageClient.NewQueueServiceClient(storageConfig)
 	if err != nil {
 		panic(app.NewFatalError("Connection to AzureStorage failed", err))
 	}
+	queueClient := client.NewQueueClient(storageConfig.QueueName)
 
+	// Register readiness check reading the queue properties
+	health.RegisterCheck("storageQueue", health.CheckOptions{}, func(ctx context.Context) error {
+		_, err := queueClient.GetProperties(ctx, nil)
+		return err
+	})
+
+	return queueClient
+}
+
+/*
+QueuePropertiesService - Interface abstraction for reading the properties (e.g. the approximate message count)
+of the Azure Storage Queue
+*/
+type QueuePropertiesService interface {
+	GetProperties(ctx context.Context, o *azqueue.GetQueuePropertiesOptions) (azqueue.GetQueuePropertiesResponse, error)
+}
+
+/*
+NewDefaultQueuePropertiesService returns a default implementation of QueuePropertiesService interface
+which uses the Azure Storage Queue configured
+*/
+func NewDefaultQueuePropertiesService(storageConfig properties.StorageProperties) QueuePropertiesService {
+	client, err := storageClient.NewQueueServiceClient(storageConfig)
+	if err != nil {
+		panic(app.NewFatalError("Connection to AzureStorage failed", err))
+	}
 	return client.NewQueueClient(storageConfig.QueueName)
 }
 
@@ -45,6 +74,8 @@ type BlobProperties struct {
 	ContentLength int64
 	ContentType   string
 	TraceHeader   *string
+	TraceParent   *string
+	TraceState    *string
 }
 
 func (this *defaultBlobInfoService) GetBlobProperties(container string, blob string) (*BlobProperties, error) {
@@ -54,17 +85,44 @@ func (this *defaultBlobInfoService) GetBlobProperties(container string, blob str
 	if err != nil {
 		return nil, err
 	}
-	blobProperties := BlobProperties{ContentLength: *getProperties.ContentLength, ContentType: *getProperties.ContentType, TraceHeader: getProperties.Metadata["Trace_header"]}
+	blobProperties := BlobProperties{
+		ContentLength: *getProperties.ContentLength,
+		ContentType:   *getProperties.ContentType,
+		TraceHeader:   getMetadataValue(getProperties.Metadata, "trace_header"),
+		TraceParent:   getMetadataValue(getProperties.Metadata, "traceparent"),
+		TraceState:    getMetadataValue(getProperties.Metadata, "tracestate"),
+	}
 	return &blobProperties, nil
 }
 
+/*
+getMetadataValue looks up a blob metadata value by its key ignoring the case, as the casing of metadata keys
+returned by the Azure SDK doesn't necessarily match the one used when writing them
+*/
+func getMetadataValue(metadata map[string]*string, key string) *string {
+	for metadataKey, value := range metadata {
+		if strings.EqualFold(metadataKey, key) {
+			return value
+		}
+	}
+	return nil
+}
+
 func NewDefaultGetBlobInfoService(storageConfig properties.StorageProperties) GetBlobInfoService {
 
-	client, err := azblob.NewClientFromConnectionString(storageConfig.ConnectionString, nil)
+	client, err := storageClient.NewBlobClient(storageConfig)
 	if err != nil {
 		panic(app.NewFatalError("Connection to AzureStorage (blob) failed", err))
 	}
+
+	// Register readiness check reading the blob service properties
+	serviceClient := client.ServiceClient()
+	health.RegisterCheck("blobStorage", health.CheckOptions{}, func(ctx context.Context) error {
+		_, err := serviceClient.GetProperties(ctx, nil)
+		return err
+	})
+
 	return &defaultBlobInfoService{
-		client.ServiceClient(),
+		serviceClient,
 	}
 }
@@ -19,3 +19,13 @@ func Test_NewDefaultGetBlobInfoService_PanicsWhenMisconfigured(t *testing.T) {
 		NewDefaultGetBlobInfoService(properties.StorageProperties{})
 	}, "Connection to AzureStorage (blob) failed")
 }
+
+func Test_getMetadataValue_IgnoresCase(t *testing.T) {
+	traceParent := "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	traceHeader := "123-456-1-789"
+	metadata := map[string]*string{"Traceparent": &traceParent, "Trace_header": &traceHeader}
+
+	assert.Equal(t, &traceParent, getMetadataValue(metadata, "traceparent"))
+	assert.Equal(t, &traceHeader, getMetadataValue(metadata, "trace_header"))
+	assert.Nil(t, getMetadataValue(metadata, "tracestate"))
+}
@@ -7,17 +7,19 @@ import (
 )
 
 type Configuration struct {
-	getMessagesService   get.GetMessagesService
-	getBlobInfoService   get.GetBlobInfoService
-	deleteMessageService delete.DeleteMessageService
-	storageConfig        properties.StorageProperties
+	getMessagesService     get.GetMessagesService
+	getBlobInfoService     get.GetBlobInfoService
+	deleteMessageService   delete.DeleteMessageService
+	queuePropertiesService get.QueuePropertiesService
+	storageConfig          properties.StorageProperties
 }
 
 func NewDefaultConfiguration(storageConfig properties.StorageProperties) Configuration {
 	return Configuration{
-		getMessagesService:   get.NewDefaultGetMessageService(storageConfig),
-		getBlobInfoService:   get.NewDefaultGetBlobInfoService(storageConfig),
-		deleteMessageService: delete.NewDefaultDeleteMessageService(storageConfig),
-		storageConfig:        storageConfig,
+		getMessagesService:     get.NewDefaultGetMessageService(storageConfig),
+		getBlobInfoService:     get.NewDefaultGetBlobInfoService(storageConfig),
+		deleteMessageService:   delete.NewDefaultDeleteMessageService(storageConfig),
+		queuePropertiesService: get.NewDefaultQueuePropertiesService(storageConfig),
+		storageConfig:          storageConfig,
 	}
 }
@@ -5,11 +5,13 @@ import (
 	"csm.cloud.storage.event.core/config/properties"
 	storageDomain "csm.cloud.storage.event.core/domain"
 	"csm.cloud.storage.event.core/kafka/producer"
+	"csm.cloud.storage.event.core/storage/dedup"
 	"csm.cloud.storage.event.core/storage/domain"
 	"csm.cloud.storage.event.core/storage/messages/delete"
 	"csm.cloud.storage.event.core/storage/messages/get"
 	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/app"
 	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/datadog"
+	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/metrics"
 	"dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/retry"
 	"errors"
 	"fmt"
@@ -21,39 +23,52 @@ import (
 )
 
 type Listener struct {
-	eventProducerService producer.FileCreatedEventKafkaProducer
-	getMessagesService   get.GetMessagesService
-	deleteMessageService delete.DeleteMessageService
-	blobInfoService      get.GetBlobInfoService
-	storageConfig        properties.StorageProperties
+	eventProducerService   producer.FileCreatedEventKafkaProducer
+	getMessagesService     get.GetMessagesService
+	deleteMessageService   delete.DeleteMessageService
+	queuePropertiesService get.QueuePropertiesService
+	blobInfoService        get.GetBlobInfoService
+	deduplicationStore     dedup.Store
+	storageConfig          properties.StorageProperties
+	control                *listenerControl
 }
 
 func NewListener(
 	eventProducerService producer.FileCreatedEventKafkaProducer,
 	blobInfoService get.GetBlobInfoService,
+	deduplicationStore dedup.Store,
 	queueConfiguration Configuration,
 ) Listener {
 	return Listener{
-		eventProducerService: eventProducerService,
-		getMessagesService:   queueConfiguration.getMessagesService,
-		blobInfoService:      blobInfoService,
-		deleteMessageService: queueConfiguration.deleteMessageService,
-		storageConfig:        queueConfiguration.storageConfig,
+		eventProducerService:   eventProducerService,
+		getMessagesService:     queueConfiguration.getMessagesService,
+		blobInfoService:        blobInfoService,
+		deleteMessageService:   queueConfiguration.deleteMessageService,
+		queuePropertiesService: queueConfiguration.queuePropertiesService,
+		deduplicationStore:     deduplicationStore,
+		storageConfig:          queueConfiguration.storageConfig,
+		control:                newListenerControl(),
 	}
 }
 
 /*
-Listen will continuously check for new messages and handle them in a blocking way.
+Listen will continuously check for new messages and handle them in a blocking way. Polling is skipped while the
+listener is paused (see Pause and Resume).
 */
 func (this *Listener) Listen() {
 
 	// Run until the application closes or an error occurs
 	for {
 		// Load a batch of messages from azure storage queue and send kafka events
-		this.retryingGetAndHandleBatchOfMessages()
+		if !this.control.paused.Load() {
+			this.retryingGetAndHandleBatchOfMessages()
+		}
 
-		// Delay next polling interval
-		time.Sleep(this.storageConfig.QueuePollingInterval)
+		// Delay next polling interval unless an immediate poll is requested
+		select {
+		case <-time.After(this.storageConfig.QueuePollingInterval):
+		case <-this.control.pollRequests:
+		}
 	}
 }
 
@@ -98,7 +113,12 @@ func (this *Listener) getAndHandleBatchOfMessages() error {
 	}
 
 	// Handle queue messages (i.e. send kafka events)
-	return this.handleMessages(messages.Messages)
+	err = this.handleMessages(messages.Messages)
+	if err != nil {
+		return err
+	}
+	this.control.recordSuccessfulBatch(len(messages.Messages))
+	return nil
 }
 
 /*
@@ -129,15 +149,45 @@ func (this *Listener) handleMessage(message domain.AzureStorageMessage) error {
 		return err
 	}
 
+	// Process the event and keep the message in the queue for a retry in case of an error
+	err = this.processMalwareScannedEvent(*message.MessageID, malwareScannedEvent)
+	if err != nil {
+		return err
+	}
+
+	// Dequeue the message from Azure storage queue as it is either processed or will not be processed
+	return this.dequeueMessage(message)
+}
+
+/*
+HandleMalwareScannedEvent processes a malware scanned event that was not received from the storage queue
+(e.g. pushed by Event Grid). A nil error means that the event is done with (either processed or skipped),
+an error means that the event must be delivered again (also while the listener is paused).
+*/
+func (this *Listener) HandleMalwareScannedEvent(malwareScannedEvent *domain.MalwareScannedEvent) error {
+	if this.control.paused.Load() {
+		return ErrListenerPaused
+	}
+	return this.processMalwareScannedEvent(malwareScannedEvent.Id, malwareScannedEvent)
+}
+
+/*
+processMalwareScannedEvent evaluates the malware scan result of a single event and sends a FileCreatedEvent to Kafka
+for clean uploads. Events that will not be processed return without error, so that they are not delivered again.
+*/
+func (this *Listener) processMalwareScannedEvent(messageId string, malwareScannedEvent *domain.MalwareScannedEvent) error {
+	metrics.MessagesDequeued.Inc()
+
 	// Parse blob information from the event's subject
 	blobInfo, err := malwareScannedEvent.ToBlobInfo()
 	if err != nil {
 		if _, isSubjectMatchError := err.(*domain.SubjectMatchError); isSubjectMatchError {
 			log.Error().Msg(fmt.Sprintf(
-				"Ignoring message %q with wrong path or filename: %q", *message.MessageID, err.Error()),
+				"Ignoring message %q with wrong path or filename: %q", messageId, err.Error()),
 			)
-			// Dequeue the message from Azure storage queue as we will not process it
-			return this.dequeueMessage(message)
+			metrics.MessagesDropped.WithLabelValues(metrics.ReasonInvalidPath).Inc()
+			// Discard the message as we will not process it
+			return nil
 		} else {
 			return err
 		}
@@ -149,30 +199,53 @@ func (this *Listener) handleMessage(message domain.AzureStorageMessage) error {
 	// Evaluate eventType
 	if malwareScannedEvent.EventType != "Microsoft.Security.MalwareScanningResult" {
 		log.Warn().Msg(fmt.Sprintf("Unexpected event type %s for blob %s!", malwareScannedEvent.EventType, blobInfo.ToString()))
-		log.Info().Msg(fmt.Sprintf("Dequeuing message %s without processing", *message.MessageID))
-		// Dequeue from Azure storage queue so the infected file won't be processed any further
-		return this.dequeueMessage(message)
+		log.Info().Msg(fmt.Sprintf("Discarding message %s without processing", messageId))
+		metrics.MessagesDropped.WithLabelValues(metrics.ReasonUnexpectedEventType).Inc()
+		return nil
 	}
 
 	// Check malware scan result
 	if malwareScannedEvent.Data.ScanResultType == "Malicious" {
 		log.Warn().Msg(fmt.Sprintf("MALWARE DETECTED in blob %s!", blobInfo.ToString()))
-		log.Info().Msg(fmt.Sprintf("Dequeuing message %s without processing (infected file)", *message.MessageID))
-		// Dequeue from Azure storage queue so the infected file won't be processed any further
-		return this.dequeueMessage(message)
+		log.Info().Msg(fmt.Sprintf("Discarding message %s without processing (infected file)", messageId))
+		metrics.MalwareDetections.Inc()
+		metrics.MessagesDropped.WithLabelValues(metrics.ReasonMalicious).Inc()
+		// Discard the message so the infected file won't be processed any further
+		return nil
 	} else if malwareScannedEvent.Data.ScanResultType != "No threats found" {
 		log.Error().Msg(fmt.Sprintf("Unexpected scan result %s for blob %s!", malwareScannedEvent.Data.ScanResultType, blobInfo.ToString()))
-		log.Info().Msg(fmt.Sprintf("Dequeuing message %s without processing", *message.MessageID))
-		// Dequeue from Azure storage queue so the infected file won't be processed any further
-		return this.dequeueMessage(message)
+		log.Info().Msg(fmt.Sprintf("Discarding message %s without processing", messageId))
+		metrics.MessagesDropped.WithLabelValues(metrics.ReasonUnexpectedScanResult).Inc()
+		// Discard the message so the file won't be processed any further
+		return nil
 	}
 
 	// Send kafka messages only for uploaded images (project import files are immediately moved by
 	// the project service therefore further processing will fail because of the missing blob).
 	if !strings.HasPrefix(blobInfo.Path, "images") {
 		log.Info().Msg(fmt.Sprintf("Skip async processing of uploaded file with path: %s/%s", blobInfo.Path, blobInfo.FileName))
-		return this.dequeueMessage(message)
+		metrics.MessagesDropped.WithLabelValues(metrics.ReasonNotAnImage).Inc()
+		return nil
+	}
+
+	// Discard events a FileCreatedEvent has already been produced for (e.g. delivered again after a timeout). The
+	// keys are claimed, so that a concurrent delivery isn't produced as well, and released if producing fails.
+	deduplicationKeys := dedup.KeysOf(malwareScannedEvent)
+	claimed, err := this.claim(deduplicationKeys)
+	if err != nil {
+		return err
 	}
+	if !claimed {
+		log.Info().Msg(fmt.Sprintf("Discarding message %s without processing (duplicate)", messageId))
+		metrics.MessagesDropped.WithLabelValues(metrics.ReasonDuplicate).Inc()
+		return nil
+	}
+	produced := false
+	defer func() {
+		if !produced {
+			this.release(messageId, deduplicationKeys)
+		}
+	}()
 
 	// Get blob properties
 	blobProperties, err := this.blobInfoService.GetBlobProperties(blobInfo.ContainerName, blobInfo.Path+"/"+blobInfo.FileName)
@@ -180,12 +253,24 @@ func (this *Listener) handleMessage(message domain.AzureStorageMessage) error {
 		return err
 	}
 
+	// Prefer the W3C trace context over the custom trace header
+	var traceCarrier *datadog.TraceHeaderStringCarrier
 	traceHeader := blobProperties.TraceHeader
-	if traceHeader == nil {
-		noOpTraceHeader := "--1-"
-		traceHeader = &noOpTraceHeader
+	if blobProperties.TraceParent != nil {
+		traceState := ""
+		if blobProperties.TraceState != nil {
+			traceState = *blobProperties.TraceState
+		}
+		traceHeader = blobProperties.TraceParent
+		traceCarrier = datadog.NewTraceContextStringCarrier(*blobProperties.TraceParent, traceState)
+	} else {
+		if traceHeader == nil {
+			noOpTraceHeader := "--1-"
+			traceHeader = &noOpTraceHeader
+		}
+		traceCarrier = datadog.NewTraceHeaderStringCarrier(*traceHeader)
 	}
-	parentContext, err := tracer.Extract(datadog.NewTraceHeaderStringCarrier(*traceHeader))
+	parentContext, err := tracer.Extract(traceCarrier)
 	if err != nil {
 		log.Warn().Msg("tracing span context couldn't be determined for trace header: " + *traceHeader + " error: " + err.Error())
 		parentContext = nil
@@ -193,7 +278,7 @@ func (this *Listener) handleMessage(message domain.AzureStorageMessage) error {
 
 	// Set tracing context for traceHeader header from kafka message
 	span := tracer.StartSpan("handleMessage", tracer.ChildOf(parentContext))
-	span.SetBaggageItem("messageId", *message.MessageID)
+	span.SetBaggageItem("messageId", messageId)
 	tracingContext := tracer.ContextWithSpan(context.Background(), span)
 
 	// Check the content length of the blob content is within the allowed limit
@@ -203,21 +288,21 @@ func (this *Listener) handleMessage(message domain.AzureStorageMessage) error {
 			blobProperties.ContentLength,
 			this.storageConfig.MaxAllowedContentLength,
 		))
-		log.Info().Msg(fmt.Sprintf("Dequeuing message %s without processing (content length)", *message.MessageID))
+		log.Info().Msg(fmt.Sprintf("Discarding message %s without processing (content length)", messageId))
+		metrics.MessagesDropped.WithLabelValues(metrics.ReasonMaxContentLength).Inc()
 		span.Finish(tracer.WithError(errors.New("max file size exceeded")))
-		return this.dequeueMessage(message)
+		return nil
 	}
 
 	// Create file created event
-	fileCreatedEvent := &storageDomain.FileCreatedEvent{
-		Identifier:    "/" + blobInfo.Path + "/" + blobInfo.FileName,
-		Path:          "/" + blobInfo.Path,
-		FileName:      blobInfo.FileName,
-		ContentType:   blobProperties.ContentType,
-		ContentLength: blobProperties.ContentLength,
-	}
-
-	// Send event to Kafka dequeuing the message from Azure storage queue
+	fileCreatedEvent := blobInfo.ToFileCreatedEvent(blobProperties.ContentType, blobProperties.ContentLength)
+	fileCreatedEvent.ETag = storageDomain.NewOptionalString(malwareScannedEvent.Data.ETag)
+	fileCreatedEvent.Sha256 = storageDomain.NewOptionalString(malwareScannedEvent.Data.ScanResultDetails.Sha256)
+	fileCreatedEvent.ScanFinishedTime = storageDomain.NewOptionalString(malwareScannedEvent.Data.ScanFinishedTimeUtc)
+	fileCreatedEvent.CorrelationId = storageDomain.NewOptionalString(malwareScannedEvent.Data.CorrelationId)
+	fileCreatedEvent.EventTime = storageDomain.NewOptionalString(malwareScannedEvent.EventTime)
+
+	// Send event to Kafka
 	_, err = datadog.TraceWithContext(tracingContext, "produce", func() (any, error) {
 		return nil, this.eventProducerService.Produce(tracingContext, fileCreatedEvent)
 	})
@@ -226,15 +311,45 @@ func (this *Listener) handleMessage(message domain.AzureStorageMessage) error {
 		span.Finish(tracer.WithError(err))
 		return err
 	}
-	err = this.dequeueMessage(message)
+	span.Finish()
+	produced = true
+
+	// Record the produced event to recognize duplicates
+	err = this.deduplicationStore.Add(deduplicationKeys)
 	if err != nil {
-		span.Finish(tracer.WithError(err))
-		return err
+		log.Warn().Msg(fmt.Sprintf("Recording message %s for deduplication failed: %s", messageId, err.Error()))
 	}
-	span.Finish()
 	return nil
 }
 
+/*
+claim claims the keys of an event in the deduplication store, false means the event is a duplicate. An unavailable
+store must not block the processing, so the event is processed (and possibly produced twice) in this case. While
+another delivery of the event is processed, dedup.ErrClaimed is returned so that the event is delivered again.
+*/
+func (this *Listener) claim(deduplicationKeys []string) (bool, error) {
+	claimed, err := this.deduplicationStore.Claim(deduplicationKeys)
+	if errors.Is(err, dedup.ErrClaimed) {
+		return false, err
+	}
+	if err != nil {
+		log.Warn().Msg(fmt.Sprintf("Deduplication check failed, processing event anyway: %s", err.Error()))
+		return true, nil
+	}
+	return claimed, nil
+}
+
+/*
+release removes the claim of an event that wasn't produced, so that it is processed when delivered again. Claims
+that can't be released expire after the claim timeout.
+*/
+func (this *Listener) release(messageId string, deduplicationKeys []string) {
+	err := this.deduplicationStore.Release(deduplicationKeys)
+	if err != nil {
+		log.Warn().Msg(fmt.Sprintf("Releasing message %s for deduplication failed: %s", messageId, err.Error()))
+	}
+}
+
 /*
 dequeueMessage removes the given message from the storage queue
 */
@@ -0,0 +1,109 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"github.com/rs/zerolog/log"
+	"sync/atomic"
+	"time"
+)
+
+/*
+ErrListenerPaused is returned for events pushed while the listener is paused, so that they are delivered again
+*/
+var ErrListenerPaused = errors.New("listener is paused")
+
+/*
+ListenerStatus describes the state of the listener for operators
+*/
+type ListenerStatus struct {
+	Paused                   bool       `json:"paused"`
+	PollingEnabled           bool       `json:"pollingEnabled"`
+	ApproximateMessageCount  *int32     `json:"approximateMessageCount,omitempty"`
+	LastSuccessfulBatchTime  *time.Time `json:"lastSuccessfulBatchTime,omitempty"`
+	LastSuccessfulBatchCount int        `json:"lastSuccessfulBatchCount"`
+}
+
+/*
+listenerControl is shared by copies of the listener, so that the polling loop and the admin api see the same state
+*/
+type listenerControl struct {
+	paused              atomic.Bool
+	pollRequests        chan struct{}
+	lastSuccessfulBatch atomic.Pointer[successfulBatch]
+}
+
+type successfulBatch struct {
+	time  time.Time
+	count int
+}
+
+func newListenerControl() *listenerControl {
+	return &listenerControl{pollRequests: make(chan struct{}, 1)}
+}
+
+func (this *listenerControl) recordSuccessfulBatch(count int) {
+	this.lastSuccessfulBatch.Store(&successfulBatch{time: time.Now(), count: count})
+}
+
+/*
+Pause stops polling the storage queue (after the batch in progress) and rejects pushed events until Resume is called
+*/
+func (this *Listener) Pause() {
+	if !this.control.paused.Swap(true) {
+		log.Info().Msg("Pausing storage queue listener")
+	}
+}
+
+/*
+Resume continues polling the storage queue after Pause
+*/
+func (this *Listener) Resume() {
+	if this.control.paused.Swap(false) {
+		log.Info().Msg("Resuming storage queue listener")
+	}
+}
+
+/*
+PollNow skips the delay of the polling interval, so that the next batch is polled immediately.
+Returns ErrListenerPaused if the listener is paused.
+*/
+func (this *Listener) PollNow() error {
+	if this.control.paused.Load() {
+		return ErrListenerPaused
+	}
+
+	// A pending request is sufficient, so that requests don't queue up
+	select {
+	case this.control.pollRequests <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+/*
+Status returns the pause state, the time of the last successful batch and the approximate number of messages
+in the storage queue
+*/
+func (this *Listener) Status() (ListenerStatus, error) {
+	status := ListenerStatus{
+		Paused:         this.control.paused.Load(),
+		PollingEnabled: this.storageConfig.QueuePollingEnabled,
+	}
+	if batch := this.control.lastSuccessfulBatch.Load(); batch != nil {
+		status.LastSuccessfulBatchTime = &batch.time
+		status.LastSuccessfulBatchCount = batch.count
+	}
+
+	if this.queuePropertiesService == nil {
+		return status, nil
+	}
+	requestContext, cancelFn := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelFn()
+	properties, err := this.queuePropertiesService.GetProperties(requestContext, nil)
+	if err != nil {
+		return status, err
+	}
+	status.ApproximateMessageCount = properties.ApproximateMessagesCount
+	return status, nil
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"csm.cloud.storage.event.core/config"
 	"csm.cloud.storage.event.core/domain"
+	"csm.cloud.storage.event.core/storage/dedup"
+	storageDomain "csm.cloud.storage.event.core/storage/domain"
 	"csm.cloud.storage.event.core/storage/messages/delete"
 	"csm.cloud.storage.event.core/storage/messages/get"
 	commonConfig "dev.azure.com/pt-iot/smartsite/csm.cloud.common.go-app.git/common/config"
@@ -87,7 +89,7 @@ func TestHandleMessages_One_Message_Produced(t *testing.T) {
 	messages = append(messages, &message)
 
 	// Process messages and verify that the message was produced successfully
-	queueListener := NewListener(producerMock, blobInfoServiceMock, testQueueConfiguration)
+	queueListener := NewListener(producerMock, blobInfoServiceMock, dedup.NewDisabledStore(), testQueueConfiguration)
 	err := queueListener.handleMessages(messages)
 
 	assert.Nil(t, err)
@@ -97,6 +99,16 @@ func TestHandleMessages_One_Message_Produced(t *testing.T) {
 		"One message is expected to be deleted from the message queue")
 	assert.Equal(t, 1, len(blobInfoServiceMock.Calls),
 		"One blob properties call is expected to be performed")
+
+	// Verify the provenance of the malware scan is kept in the event
+	event := producerMock.Calls[0].Arguments.Get(1).(*domain.FileCreatedEvent)
+	assert.Equal(t, "defendermalwaretest", event.StorageAccount.String)
+	assert.Equal(t, "csm-quarantine-container", event.Container.String)
+	assert.Equal(t, "0x8DBCFD701F78E3B", event.ETag.String)
+	assert.Equal(t, "2023-10-18T12:37:42.8034649Z", event.ScanFinishedTime.String)
+	assert.Equal(t, "2209bebf-9e38-4fdd-bf9c-5842129d8f63", event.CorrelationId.String)
+	assert.Equal(t, "2023-10-18T12:37:42.8040405Z", event.EventTime.String)
+	assert.Nil(t, event.Sha256)
 }
 
 func TestHandleMessages_NoSubjectMatched(t *testing.T) {
@@ -122,7 +134,7 @@ func TestHandleMessages_NoSubjectMatched(t *testing.T) {
 	messages = append(messages, &message)
 
 	// Process messages and verify that message was ignored if subject doesn't match
-	queueListener := NewListener(producerMock, blobInfoServiceMock, testQueueConfiguration)
+	queueListener := NewListener(producerMock, blobInfoServiceMock, dedup.NewDisabledStore(), testQueueConfiguration)
 	err := queueListener.handleMessages(messages)
 
 	assert.Nil(t, err)
@@ -159,7 +171,7 @@ func TestHandleMessages_SkipInvalidDirectory(t *testing.T) {
 	messages = append(messages, &message)
 
 	// Process messages and verify that message was ignored if subject doesn't match
-	queueListener := NewListener(producerMock, blobInfoServiceMock, testQueueConfiguration)
+	queueListener := NewListener(producerMock, blobInfoServiceMock, dedup.NewDisabledStore(), testQueueConfiguration)
 	err := queueListener.handleMessages(messages)
 
 	assert.Nil(t, err)
@@ -194,7 +206,7 @@ func TestHandleMessages_InvalidText(t *testing.T) {
 	messages = append(messages, &message)
 
 	// Process messages and verify that processing failed if message contains invalid encoded content
-	queueListener := NewListener(producerMock, blobInfoServiceMock, testQueueConfiguration)
+	queueListener := NewListener(producerMock, blobInfoServiceMock, dedup.NewDisabledStore(), testQueueConfiguration)
 	err := queueListener.handleMessages(messages)
 
 	// Verify an error is returned
@@ -235,7 +247,7 @@ func TestHandleMessages_MalwareFound(t *testing.T) {
 	messages = append(messages, &message)
 
 	// Process messages
-	queueListener := NewListener(producerMock, blobInfoServiceMock, testQueueConfiguration)
+	queueListener := NewListener(producerMock, blobInfoServiceMock, dedup.NewDisabledStore(), testQueueConfiguration)
 	err := queueListener.handleMessages(messages)
 
 	// Verify messages with malware are handled without error
@@ -275,7 +287,7 @@ func TestHandleMessages_UnexpectedScanResultType(t *testing.T) {
 	messages = append(messages, &message)
 
 	// Process messages
-	queueListener := NewListener(producerMock, blobInfoServiceMock, testQueueConfiguration)
+	queueListener := NewListener(producerMock, blobInfoServiceMock, dedup.NewDisabledStore(), testQueueConfiguration)
 	err := queueListener.handleMessages(messages)
 
 	// Verify messages with malware are handled without error
@@ -315,7 +327,7 @@ func TestHandleMessages_UnexpectedEventType(t *testing.T) {
 	messages = append(messages, &message)
 
 	// Process messages
-	queueListener := NewListener(producerMock, blobInfoServiceMock, testQueueConfiguration)
+	queueListener := NewListener(producerMock, blobInfoServiceMock, dedup.NewDisabledStore(), testQueueConfiguration)
 	err := queueListener.handleMessages(messages)
 
 	// Verify messages with malware are handled without error
@@ -332,6 +344,116 @@ func TestHandleMessages_UnexpectedEventType(t *testing.T) {
 	deleteMessageServiceMock.AssertNumberOfCalls(t, "DeleteMessage", 1)
 }
 
+func TestHandleMessages_DuplicateDequeuedWithoutProducing(t *testing.T) {
+
+	// Activate test profile
+	_ = os.Setenv("GO_PROFILES_ACTIVE", "test")
+
+	// Init mocks
+	producerMock := &FileCreatedEventProducerMock{}
+	producerMock.On("Produce", mock.Anything, mock.Anything).Return(nil)
+
+	deleteMessageServiceMock := &DeleteMessageServiceMock{}
+	deleteMessageServiceMock.On("DeleteMessage", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
+
+	blobInfoServiceMock := &GetBlobInfoServiceMock{}
+	blobInfoServiceMock.On("GetBlobProperties", mock.Anything, mock.Anything).Return(get.BlobProperties{ContentLength: 524288, ContentType: "text/plain"}, nil)
+
+	// Init test configuration
+	testConfiguration := LoadTestConfigurationFromFilesystem()
+	testQueueConfiguration := NewTestQueueConfiguration(testConfiguration, deleteMessageServiceMock, nil)
+
+	// Init the same message delivered twice (e.g. after the visibility timeout expired)
+	var messages []*azqueue.DequeuedMessage
+	message := createTestMessage()
+	redeliveredMessage := createTestMessage()
+	messages = append(messages, &message, &redeliveredMessage)
+
+	// Process messages
+	queueListener := NewListener(producerMock, blobInfoServiceMock, dedup.NewMemoryStore(time.Hour, 100), testQueueConfiguration)
+	err := queueListener.handleMessages(messages)
+
+	// Verify that the duplicate is dequeued without producing another event
+	assert.Nil(t, err)
+
+	producerMock.AssertExpectations(t)
+	producerMock.AssertNumberOfCalls(t, "Produce", 1)
+
+	blobInfoServiceMock.AssertExpectations(t)
+	blobInfoServiceMock.AssertNumberOfCalls(t, "GetBlobProperties", 1)
+
+	deleteMessageServiceMock.AssertExpectations(t)
+	deleteMessageServiceMock.AssertNumberOfCalls(t, "DeleteMessage", 2)
+}
+
+func TestHandleMessages_ClaimedByAnotherDeliveryKeptInQueue(t *testing.T) {
+
+	// Activate test profile
+	_ = os.Setenv("GO_PROFILES_ACTIVE", "test")
+
+	// Init mocks
+	producerMock := &FileCreatedEventProducerMock{}
+	deleteMessageServiceMock := &DeleteMessageServiceMock{}
+	blobInfoServiceMock := &GetBlobInfoServiceMock{}
+
+	// Init test configuration
+	testConfiguration := LoadTestConfigurationFromFilesystem()
+	testQueueConfiguration := NewTestQueueConfiguration(testConfiguration, deleteMessageServiceMock, nil)
+
+	// Init the message claimed by a concurrent delivery (e.g. of another replica)
+	deduplicationStore := dedup.NewMemoryStore(time.Hour, 100)
+	message := createTestMessage()
+	storageMessage := storageDomain.NewAzureStorageMessage(message)
+	malwareScannedEvent, err := storageMessage.ToMalwareScannedEvent()
+	assert.Nil(t, err)
+	claimed, err := deduplicationStore.Claim(dedup.KeysOf(malwareScannedEvent))
+	assert.True(t, claimed)
+	assert.Nil(t, err)
+
+	// Process message
+	queueListener := NewListener(producerMock, blobInfoServiceMock, deduplicationStore, testQueueConfiguration)
+	err = queueListener.handleMessages([]*azqueue.DequeuedMessage{&message})
+
+	// Verify that the message is kept in the queue to be delivered again
+	assert.ErrorIs(t, err, dedup.ErrClaimed)
+	producerMock.AssertNumberOfCalls(t, "Produce", 0)
+	deleteMessageServiceMock.AssertNumberOfCalls(t, "DeleteMessage", 0)
+}
+
+func TestHandleMessages_FailedDeliveryReleasesClaim(t *testing.T) {
+
+	// Activate test profile
+	_ = os.Setenv("GO_PROFILES_ACTIVE", "test")
+
+	// Init mocks (producing the first delivery fails)
+	producerMock := &FileCreatedEventProducerMock{}
+	producerMock.On("Produce", mock.Anything, mock.Anything).Return(errors.New("broker not available")).Once()
+	producerMock.On("Produce", mock.Anything, mock.Anything).Return(nil).Once()
+
+	deleteMessageServiceMock := &DeleteMessageServiceMock{}
+	deleteMessageServiceMock.On("DeleteMessage", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
+
+	blobInfoServiceMock := &GetBlobInfoServiceMock{}
+	blobInfoServiceMock.On("GetBlobProperties", mock.Anything, mock.Anything).Return(get.BlobProperties{ContentLength: 524288, ContentType: "text/plain"}, nil)
+
+	// Init test configuration
+	testConfiguration := LoadTestConfigurationFromFilesystem()
+	testQueueConfiguration := NewTestQueueConfiguration(testConfiguration, deleteMessageServiceMock, nil)
+	queueListener := NewListener(producerMock, blobInfoServiceMock, dedup.NewMemoryStore(time.Hour, 100), testQueueConfiguration)
+
+	// Process the message and its redelivery
+	message := createTestMessage()
+	err := queueListener.handleMessages([]*azqueue.DequeuedMessage{&message})
+	assert.NotNil(t, err)
+	redeliveredMessage := createTestMessage()
+	err = queueListener.handleMessages([]*azqueue.DequeuedMessage{&redeliveredMessage})
+
+	// Verify that the redelivery is produced
+	assert.Nil(t, err)
+	producerMock.AssertNumberOfCalls(t, "Produce", 2)
+	deleteMessageServiceMock.AssertNumberOfCalls(t, "DeleteMessage", 1)
+}
+
 func TestHandleMessages_MaxContentLengthExceeded(t *testing.T) {
 
 	// Activate test profile
@@ -356,7 +478,7 @@ func TestHandleMessages_MaxContentLengthExceeded(t *testing.T) {
 	messages = append(messages, &message)
 
 	// Process messages
-	queueListener := NewListener(producerMock, blobInfoServiceMock, testQueueConfiguration)
+	queueListener := NewListener(producerMock, blobInfoServiceMock, dedup.NewDisabledStore(), testQueueConfiguration)
 	err := queueListener.handleMessages(messages)
 
 	// Verify messages with content length exceeding the allowed limit are handled without error
@@ -403,7 +525,7 @@ func TestListener_retryingHandleBatchOfMessages_WithRetryOnFailingProducer(t *te
 	testQueueConfiguration := NewTestQueueConfiguration(configuration, deleteMessageServiceMock, getMessageServiceMock)
 
 	// Process messages
-	queueListener := NewListener(producerMock, blobInfoServiceMock, testQueueConfiguration)
+	queueListener := NewListener(producerMock, blobInfoServiceMock, dedup.NewDisabledStore(), testQueueConfiguration)
 	queueListener.retryingGetAndHandleBatchOfMessages()
 
 	// Verify that messages are fetched and producing is attempted twice
@@ -450,7 +572,7 @@ func TestListener_retryingHandleBatchOfMessages_WithRetryOnFailingGetMessages(t
 	testQueueConfiguration := NewTestQueueConfiguration(configuration, deleteMessageServiceMock, getMessageServiceMock)
 
 	// Process messages
-	queueListener := NewListener(producerMock, blobInfoServiceMock, testQueueConfiguration)
+	queueListener := NewListener(producerMock, blobInfoServiceMock, dedup.NewDisabledStore(), testQueueConfiguration)
 	queueListener.retryingGetAndHandleBatchOfMessages()
 
 	// Verify that only one event is scanned, produced and one message dequeued while multiple attempts to get
@@ -496,7 +618,7 @@ func TestListener_Listen(t *testing.T) {
 	testQueueConfiguration := NewTestQueueConfiguration(configuration, deleteMessageServiceMock, getMessageServiceMock)
 
 	// Run listener asynchronously and process messages
-	queueListener := NewListener(producerMock, blobInfoServiceMock, testQueueConfiguration)
+	queueListener := NewListener(producerMock, blobInfoServiceMock, dedup.NewDisabledStore(), testQueueConfiguration)
 	go func() {
 		queueListener.Listen()
 	}()
@@ -696,3 +818,79 @@ func LoadTestConfigurationFromFilesystem() config.Configuration {
 
 	return conf.(config.Configuration)
 }
+
+// Define QueuePropertiesService mock
+
+type QueuePropertiesServiceMock struct {
+	mock.Mock
+}
+
+func (this *QueuePropertiesServiceMock) GetProperties(ctx context.Context, o *azqueue.GetQueuePropertiesOptions) (azqueue.GetQueuePropertiesResponse, error) {
+	args := this.Called(ctx, o)
+	return args.Get(0).(azqueue.GetQueuePropertiesResponse), args.Error(1)
+}
+
+func TestListener_PauseSkipsPollingAndRejectsPushedEvents(t *testing.T) {
+
+	// Activate test profile
+	_ = os.Setenv("GO_PROFILES_ACTIVE", "test")
+
+	// Init mocks
+	getMessageServiceMock := &GetMessageServiceMock{}
+	getMessageServiceMock.On("DequeueMessages", mock.Anything, mock.Anything).Return(azqueue.DequeueMessagesResponse{}, nil)
+
+	configuration := LoadTestConfigurationFromFilesystem()
+	configuration.Storage.QueuePollingInterval = time.Hour
+	testQueueConfiguration := NewTestQueueConfiguration(configuration, &DeleteMessageServiceMock{}, getMessageServiceMock)
+
+	// Run paused listener asynchronously
+	queueListener := NewListener(&FileCreatedEventProducerMock{}, &GetBlobInfoServiceMock{}, dedup.NewDisabledStore(), testQueueConfiguration)
+	queueListener.Pause()
+	go func() {
+		queueListener.Listen()
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// Verify that nothing is polled or accepted while paused
+	getMessageServiceMock.AssertNumberOfCalls(t, "DequeueMessages", 0)
+	assert.Equal(t, ErrListenerPaused, queueListener.PollNow())
+	assert.Equal(t, ErrListenerPaused, queueListener.HandleMalwareScannedEvent(&storageDomain.MalwareScannedEvent{}))
+
+	// Verify that an immediate poll is done after resuming (despite the polling interval of an hour)
+	queueListener.Resume()
+	assert.Nil(t, queueListener.PollNow())
+	time.Sleep(50 * time.Millisecond)
+	getMessageServiceMock.AssertNumberOfCalls(t, "DequeueMessages", 1)
+
+	status, err := queueListener.Status()
+	assert.Nil(t, err)
+	assert.False(t, status.Paused)
+	assert.NotNil(t, status.LastSuccessfulBatchTime)
+	assert.Equal(t, 0, status.LastSuccessfulBatchCount)
+}
+
+func TestListener_StatusIncludesApproximateMessageCount(t *testing.T) {
+
+	// Activate test profile
+	_ = os.Setenv("GO_PROFILES_ACTIVE", "test")
+
+	// Init mocks
+	messageCount := int32(42)
+	queuePropertiesServiceMock := &QueuePropertiesServiceMock{}
+	queuePropertiesServiceMock.On("GetProperties", mock.Anything, mock.Anything).Return(
+		azqueue.GetQueuePropertiesResponse{ApproximateMessagesCount: &messageCount}, nil)
+
+	testQueueConfiguration := NewTestQueueConfiguration(LoadTestConfigurationFromFilesystem(), nil, nil)
+	testQueueConfiguration.queuePropertiesService = queuePropertiesServiceMock
+
+	// Execute
+	queueListener := NewListener(&FileCreatedEventProducerMock{}, &GetBlobInfoServiceMock{}, dedup.NewDisabledStore(), testQueueConfiguration)
+	queueListener.Pause()
+	status, err := queueListener.Status()
+
+	// Verify
+	assert.Nil(t, err)
+	assert.True(t, status.Paused)
+	assert.Equal(t, int32(42), *status.ApproximateMessageCount)
+	assert.Nil(t, status.LastSuccessfulBatchTime)
+}